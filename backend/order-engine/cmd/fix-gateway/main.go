@@ -0,0 +1,166 @@
+// Command fix-gateway accepts FIX 4.4 order entry sessions without running
+// a matching engine. It enters its sessions' orders on the server's gRPC
+// order service, acting for each user with the token they logged on with,
+// and reports their fills and cancellations from the execution reports the
+// server relays over NATS. Market data stays on the server's FIX endpoint.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/config"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/cache"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/fix"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/wsbus"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load config: %v", err))
+	}
+
+	// Initialize logger
+	logger, err := initLogger(cfg.Log.Level)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+	}
+	defer logger.Sync()
+
+	// Initialize Redis cache for token revocation checks
+	redisCache, err := cache.NewRedisCache(
+		cfg.GetRedisAddr(),
+		cfg.Redis.Password,
+		cfg.Redis.DB,
+		logger,
+	)
+	if err != nil {
+		logger.Fatal("Failed to initialize Redis cache", zap.Error(err))
+	}
+	defer redisCache.Close()
+
+	// Initialize storage for FIX session state. The gateway writes no
+	// orders or trades, so it keeps no outbox.
+	pgStore, err := store.NewPostgresStore(cfg.GetDSN(), "", logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize database", zap.Error(err))
+	}
+	defer pgStore.Close()
+
+	// Initialize JWT service; counterparties log on with access tokens
+	keyCtx, stopKeyRefresh := context.WithCancel(context.Background())
+	defer stopKeyRefresh()
+	jwtService, err := auth.NewFromConfig(keyCtx, cfg.Auth, redisCache, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize JWT service", zap.Error(err))
+	}
+
+	// Enter orders on the server's engine
+	grpcConn, err := grpc.Dial(cfg.FIX.ServerAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("Failed to connect to the server", zap.Error(err))
+	}
+	defer grpcConn.Close()
+
+	remote := fix.NewRemote(
+		pb.NewOrderServiceClient(grpcConn),
+		time.Duration(cfg.FIX.RequestTimeout)*time.Second,
+		logger,
+	)
+	gateway := fix.NewGateway(remote, remote, logger)
+	remote.AddFillListener(gateway.OnFill)
+	remote.AddOrderListener(gateway.OnOrder)
+	gatewayCtx, stopGateway := context.WithCancel(context.Background())
+	defer stopGateway()
+	go gateway.Run(gatewayCtx)
+
+	// Follow the gateway's orders through the execution reports the server
+	// relays
+	natsConn, err := wsbus.Connect(cfg.NATS.URL, cfg.NATS.Username, cfg.NATS.Password, "fix-gateway", logger)
+	if err != nil {
+		logger.Fatal("Failed to connect to NATS", zap.Error(err))
+	}
+	defer natsConn.Drain()
+
+	_, err = wsbus.SubscribeUsers(natsConn, ws.ChannelOrders, func(update ws.Update) {
+		var report types.ExecutionReport
+		if err := json.Unmarshal(update.Data, &report); err != nil {
+			logger.Error("Failed to decode execution report",
+				zap.Error(err),
+				zap.String("user_id", update.UserID))
+			return
+		}
+		remote.Report(report)
+	}, logger)
+	if err != nil {
+		logger.Fatal("Failed to subscribe to execution reports", zap.Error(err))
+	}
+
+	acceptor := fix.NewAcceptor(cfg.FIX.SenderCompID, pgStore, jwtService, logger)
+	if cfg.FIX.LogonTimeout > 0 {
+		acceptor.SetLogonTimeout(time.Duration(cfg.FIX.LogonTimeout) * time.Second)
+	}
+	gateway.Register(acceptor)
+
+	// Log out the sessions of users the server revokes or blocks
+	if _, err := wsbus.SubscribeDisconnects(natsConn, acceptor.DisconnectUser, logger); err != nil {
+		logger.Fatal("Failed to subscribe to disconnects", zap.Error(err))
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.FIX.GatewayPort))
+	if err != nil {
+		logger.Fatal("Failed to listen for FIX", zap.Error(err))
+	}
+	go func() {
+		logger.Info("Starting FIX gateway",
+			zap.String("address", listener.Addr().String()),
+			zap.String("sender_comp_id", cfg.FIX.SenderCompID),
+			zap.String("server_addr", cfg.FIX.ServerAddr))
+
+		if err := acceptor.Serve(listener); err != nil && !errors.Is(err, fix.ErrAcceptorClosed) {
+			logger.Fatal("Failed to start FIX gateway", zap.Error(err))
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down FIX gateway...")
+
+	// Log out every session before the store closes
+	acceptor.Close()
+
+	logger.Info("FIX gateway exiting")
+}
+
+func initLogger(level string) (*zap.Logger, error) {
+	var cfg zap.Config
+
+	if level == "production" {
+		cfg = zap.NewProductionConfig()
+	} else {
+		cfg = zap.NewDevelopmentConfig()
+	}
+
+	return cfg.Build()
+}
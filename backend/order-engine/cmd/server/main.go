@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,13 +14,23 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"github.com/XNL-21bct0051-SDE-2/order-engine/config"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/api"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/cache"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/fix"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/grpcapi"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/marketdata"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/metrics"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/wsbus"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
 )
 
 func main() {
@@ -47,15 +59,212 @@ func main() {
 	}
 	defer redisCache.Close()
 
+	// Initialize persistent storage
+	pgStore, err := store.NewPostgresStore(cfg.GetDSN(), cfg.Database.OutboxDir, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize database", zap.Error(err))
+	}
+	defer pgStore.Close()
+
 	// Initialize JWT service
-	jwtService := auth.NewJWTService("your-secret-key", "order-engine") // TODO: Move secret to config
+	keyCtx, stopKeyRefresh := context.WithCancel(context.Background())
+	defer stopKeyRefresh()
+	jwtService, err := auth.NewFromConfig(keyCtx, cfg.Auth, redisCache, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize JWT service", zap.Error(err))
+	}
+
+	// Create matching engine
+	engine := matching.NewMatchingEngine()
+	fees := matching.FeeSchedule{
+		MakerRate: cfg.Fees.MakerRate,
+		TakerRate: cfg.Fees.TakerRate,
+	}
+	engine.SetFeeSchedule(fees)
+	stp, err := matching.ParseSelfTradePrevention(cfg.Matching.SelfTradePrevention)
+	if err != nil {
+		logger.Fatal("Invalid matching.self_trade_prevention", zap.Error(err))
+	}
+	engine.SetSelfTradePrevention(stp)
+	engine.SetThrottle(matching.ThrottleConfig{
+		MaxMessagesPerSecond:  cfg.Matching.Throttle.MaxMessagesPerSecond,
+		MaxMessageToFillRatio: cfg.Matching.Throttle.MaxMessageToFillRatio,
+		RatioWindow:           time.Duration(cfg.Matching.Throttle.RatioWindow) * time.Second,
+		MinRatioMessages:      cfg.Matching.Throttle.MinRatioMessages,
+	})
+	engine.AddThrottleListener(func(event matching.ThrottleEvent) {
+		metrics.RecordOrderThrottled(string(event.Reason), string(event.Message))
+		if event.NewBreach {
+			logger.Warn("Account breached order throttle",
+				zap.String("account_id", event.AccountID),
+				zap.String("user_id", event.UserID),
+				zap.String("reason", string(event.Reason)),
+				zap.Int("messages", event.Messages),
+				zap.Int("fills", event.Fills))
+		}
+	})
+	engine.AddOrderListener(pgStore.RecordOrder)
+	engine.AddTradeListener(pgStore.RecordTrade)
+
+	// Fan trades and book changes out to gRPC market data streams
+	feed := grpcapi.NewFeed()
+	engine.AddOrderListener(feed.OnOrder)
+	engine.AddTradeListener(feed.OnTrade)
 
-	// Initialize WebSocket hub
+	// Stream trades and L2 and L3 book updates to WebSocket subscribers
 	wsHub := ws.NewHub(logger)
+
+	// Relay every WebSocket update to the ws-gateway replicas over NATS
+	var wsPublisher *wsbus.Publisher
+	if cfg.WebSocket.Relay {
+		natsConn, err := wsbus.Connect(cfg.NATS.URL, cfg.NATS.Username, cfg.NATS.Password, "order-engine", logger)
+		if err != nil {
+			logger.Fatal("Failed to connect to NATS", zap.Error(err))
+		}
+		defer natsConn.Drain()
+		wsPublisher = wsbus.NewPublisher(natsConn, wsHub, logger)
+		wsHub.SetRelay(wsPublisher.Publish)
+	}
+
+	wsHub.SetBookSource(engine)
+	engine.AddBookListener(wsHub.PublishBookUpdate)
+	engine.AddBookOrderListener(wsHub.PublishBookOrderEvent)
+
+	// Keep 24 hour ticker statistics and candles, starting from the
+	// stored trades
+	tickers := marketdata.NewTickers()
+	candles := marketdata.NewCandles(pgStore)
+	if err := loadMarketData(context.Background(), pgStore, tickers, candles); err != nil {
+		logger.Error("Failed to load market data history", zap.Error(err))
+	}
+	tickers.AddListener(wsHub.PublishTicker)
+	engine.AddTradeListener(tickers.OnTrade)
+	engine.AddBookListener(tickers.OnBookUpdate)
+	wsHub.SetTickerSource(tickers)
+	candles.AddListener(wsHub.PublishCandle)
+	engine.AddTradeListener(candles.OnTrade)
+	wsHub.SetCandleSource(candles)
+	marketDataCtx, stopMarketData := context.WithCancel(context.Background())
+	defer stopMarketData()
+	go tickers.Run(marketDataCtx)
+	go candles.Run(marketDataCtx)
+
+	// Load accounts and enforce their risk limits and sub-account balances
+	// on every order
+	accounts, err := account.NewManager(context.Background(), pgStore, logger)
+	if err != nil {
+		logger.Fatal("Failed to load accounts", zap.Error(err))
+	}
+	accounts.SetFeeSchedule(fees)
+	engine.AddPreTradeCheck(accounts.CheckOrder)
+	engine.AddOrderListener(accounts.OnOrder)
+	engine.AddTradeListener(accounts.OnTrade)
+
+	// Stream each user's orders, fills, balances and positions to their
+	// own WebSocket connections
+	wsHub.SetOrderSource(engine)
+	engine.AddExecutionListener(wsHub.PublishExecutionReport)
+	engine.AddTradeListener(wsHub.PublishFills)
+	engine.AddTradeListener(wsHub.PublishTrade)
+
+	// Cache and broadcast every trade, whichever API its order came in on
+	engine.AddTradeListener(func(trade types.Trade) {
+		redisCache.RecordTrade(trade)
+		wsHub.BroadcastTrade(&trade)
+	})
+	wsHub.SetAccountSource(accounts)
+	accounts.AddBalanceListener(wsHub.PublishBalance)
+	accounts.AddPositionListener(wsHub.PublishPosition)
+
+	// Accept orders over WebSocket, throttled per connection
+	wsHub.SetOrderEntry(engine, accounts, ratelimit.Limit{
+		Rate:  cfg.WebSocket.OrderRate.Rate,
+		Burst: cfg.WebSocket.OrderRate.Burst,
+	})
+
+	if wsPublisher != nil {
+		if _, err := wsPublisher.ServeSnapshots(); err != nil {
+			logger.Fatal("Failed to serve WebSocket snapshots", zap.Error(err))
+		}
+	}
 	go wsHub.Run()
 
-	// Create matching engine
-	engine := matching.NewMatchingEngine()
+	// Accept FIX sessions trading on the same engine and accounts
+	var fixAcceptor *fix.Acceptor
+	if cfg.FIX.Enabled {
+		fixCtx, stopFIX := context.WithCancel(context.Background())
+		defer stopFIX()
+
+		// Report order events to FIX sessions
+		gateway := fix.NewGateway(fix.LocalEngine(engine), accounts, logger)
+		engine.AddTradeListener(gateway.OnTrade)
+		engine.AddOrderListener(gateway.OnOrder)
+		go gateway.Run(fixCtx)
+
+		// Publish books and trades to market data subscriptions
+		marketData := fix.NewMarketData(engine, logger)
+		engine.AddTradeListener(marketData.OnTrade)
+		engine.AddOrderListener(marketData.OnOrder)
+		go marketData.Run(fixCtx)
+
+		fixAcceptor = fix.NewAcceptor(cfg.FIX.SenderCompID, pgStore, jwtService, logger)
+		if cfg.FIX.LogonTimeout > 0 {
+			fixAcceptor.SetLogonTimeout(time.Duration(cfg.FIX.LogonTimeout) * time.Second)
+		}
+		gateway.Register(fixAcceptor)
+		marketData.Register(fixAcceptor)
+
+		fixListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.FIX.Port))
+		if err != nil {
+			logger.Fatal("Failed to listen for FIX", zap.Error(err))
+		}
+		go func() {
+			logger.Info("Starting FIX gateway",
+				zap.String("address", fixListener.Addr().String()),
+				zap.String("sender_comp_id", cfg.FIX.SenderCompID))
+
+			if err := fixAcceptor.Serve(fixListener); err != nil && !errors.Is(err, fix.ErrAcceptorClosed) {
+				logger.Fatal("Failed to start FIX gateway", zap.Error(err))
+			}
+		}()
+	}
+
+	// API keys are optional and need a master key to encrypt their secrets
+	var apiKeys *auth.APIKeyService
+	if cfg.Auth.APIKeyMasterKey != "" {
+		apiKeys, err = auth.NewAPIKeyService(pgStore, redisCache, cfg.Auth.APIKeyMasterKey)
+		if err != nil {
+			logger.Fatal("Failed to initialize API keys", zap.Error(err))
+		}
+		apiKeys.SetPolicy(jwtService.Policy())
+		apiKeys.SetRevocations(redisCache)
+	}
+
+	h := api.NewHandler(engine, pgStore, wsHub, jwtService, apiKeys, accounts, tickers, candles, logger)
+
+	// Revocations and kill switches close FIX sessions and gRPC streams as
+	// well as WebSocket connections, and those of the gateways
+	grpcStreams := grpcapi.NewStreams()
+	h.AddDisconnector(grpcStreams.DisconnectUser)
+	if fixAcceptor != nil {
+		h.AddDisconnector(fixAcceptor.DisconnectUser)
+	}
+	if wsPublisher != nil {
+		h.AddDisconnector(wsPublisher.DisconnectUser)
+	}
+
+	// Rate limit every request by IP before authentication, and
+	// authenticated requests by user and API key after it
+	ipRateLimit := func(c *gin.Context) { c.Next() }
+	principalRateLimit := ipRateLimit
+	if cfg.RateLimit.Enabled {
+		var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+		if cfg.RateLimit.Backend == config.RateLimitBackendRedis {
+			limiter = redisCache
+		}
+		rateLimiter := api.NewRateLimiter(limiter, rateLimitPolicy(cfg.RateLimit), logger)
+		ipRateLimit, principalRateLimit = rateLimiter.ByIP(), rateLimiter.ByPrincipal()
+	}
 
 	// Initialize Gin router
 	router := gin.Default()
@@ -73,46 +282,88 @@ func main() {
 		})
 	})
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.POST("/api/v1/auth/refresh", ipRateLimit, h.RefreshToken)
 
 	// WebSocket endpoint
-	router.GET("/ws", func(c *gin.Context) {
+	router.GET("/ws", ipRateLimit, func(c *gin.Context) {
 		// Extract user info from token
-		token := c.GetHeader("Authorization")
-		claims, err := jwtService.ValidateToken(token)
+		token, ok := api.BearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+		claims, err := jwtService.ValidateToken(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
+		if !claims.HasScope(auth.ScopeMarketDataRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": auth.ScopeMarketDataRead})
+			return
+		}
 
 		// Upgrade HTTP connection to WebSocket
-		wsHandler := ws.NewHandler(wsHub, claims.UserID)
+		wsHandler := ws.NewHandler(wsHub, claims)
 		wsHandler.ServeWS(c.Writer, c.Request)
 	})
 
 	// Protected routes
 	v1 := router.Group("/api/v1")
-	v1.Use(api.AuthMiddleware(logger))
+	v1.Use(ipRateLimit, api.AuthMiddleware(jwtService, apiKeys, logger), principalRateLimit)
 	{
 		// Order endpoints
-		v1.POST("/orders", api.RequireRole(auth.RoleTrader), api.CreateOrder(engine, redisCache, wsHub))
-		v1.GET("/orders/:id", api.GetOrder(redisCache))
-		v1.DELETE("/orders/:id", api.RequireRole(auth.RoleTrader), api.CancelOrder(engine, redisCache))
-		v1.GET("/orders", api.ListOrders(redisCache))
+		v1.POST("/orders", api.RequireScope(auth.ScopeOrdersWrite), h.CreateOrder)
+		v1.GET("/orders/:id", api.RequireScope(auth.ScopeOrdersRead), h.GetOrder)
+		v1.DELETE("/orders/:id", api.RequireAnyScope(auth.ScopeOrdersWrite, auth.ScopeOrdersCancelAny), h.CancelOrder)
+		v1.GET("/orders", api.RequireScope(auth.ScopeOrdersRead), h.ListOrders)
 
 		// Order book endpoints
-		v1.GET("/orderbook/:symbol", api.GetOrderBook(engine, redisCache))
-		v1.GET("/orderbook/:symbol/depth", api.GetOrderBookDepth(engine, redisCache))
+		v1.GET("/orderbook/:symbol", api.RequireScope(auth.ScopeMarketDataRead), h.GetOrderBook)
+		v1.GET("/orderbook/:symbol/depth", api.RequireScope(auth.ScopeMarketDataRead), h.GetOrderBookDepth)
+		v1.GET("/orderbook/:symbol/l3", api.RequireScope(auth.ScopeMarketDataRead), h.GetOrderBookL3)
 
 		// Trade endpoints
-		v1.GET("/trades/:symbol", api.GetRecentTrades(redisCache))
+		v1.GET("/ticker", api.RequireScope(auth.ScopeMarketDataRead), h.ListTickers)
+		v1.GET("/ticker/:symbol", api.RequireScope(auth.ScopeMarketDataRead), h.GetTicker)
+		v1.GET("/candles/:symbol", api.RequireScope(auth.ScopeMarketDataRead), h.GetCandles)
+		v1.GET("/trades/:symbol", api.RequireScope(auth.ScopeMarketDataRead), h.ListTrades)
+		v1.GET("/trades/:symbol/export", api.RequireScope(auth.ScopeMarketDataRead), h.ExportTrades)
+
+		// Fill endpoints
+		v1.GET("/fills", api.RequireScope(auth.ScopeOrdersRead), h.ListFills)
+
+		// Session endpoints
+		v1.POST("/auth/session", h.CreateSession)
+		v1.GET("/sessions", h.ListSessions)
+		v1.DELETE("/sessions/:id", h.RevokeSession)
+
+		// Account endpoints
+		v1.GET("/accounts", api.RequireScope(auth.ScopeAccountsRead), h.ListAccounts)
+		v1.POST("/accounts", api.RequireScope(auth.ScopeAccountsWrite), h.CreateAccount)
+		v1.GET("/accounts/:id/balances", api.RequireScope(auth.ScopeAccountsRead), h.GetAccountBalances)
+		v1.GET("/accounts/:id/positions", api.RequireScope(auth.ScopeAccountsRead), h.GetAccountPositions)
+		v1.POST("/transfers", api.RequireScope(auth.ScopeAccountsWrite), h.CreateTransfer)
+
+		// API key endpoints
+		v1.POST("/api-keys", h.CreateAPIKey)
+		v1.GET("/api-keys", h.ListAPIKeys)
+		v1.DELETE("/api-keys/:id", h.RevokeAPIKey)
 
 		// Admin endpoints
 		admin := v1.Group("/admin")
-		admin.Use(api.RequireRole(auth.RoleAdmin))
 		{
-			admin.GET("/metrics", api.GetAdminMetrics())
-			admin.POST("/symbols", api.AddSymbol())
-			admin.DELETE("/symbols/:symbol", api.RemoveSymbol())
+			admin.GET("/metrics", api.RequireScope(auth.ScopeMetricsRead), h.GetAdminMetrics)
+			admin.POST("/symbols", api.RequireScope(auth.ScopeSymbolsAdmin), h.AddSymbol)
+			admin.DELETE("/symbols/:symbol", api.RequireScope(auth.ScopeSymbolsAdmin), h.RemoveSymbol)
+			admin.GET("/users/:id/sessions", api.RequireScope(auth.ScopeSessionsAdmin), h.ListUserSessions)
+			admin.DELETE("/users/:id/sessions", api.RequireScope(auth.ScopeSessionsAdmin), h.RevokeUserSessions)
+			admin.GET("/accounts/:id/limits", api.RequireScope(auth.ScopeAccountsAdmin), h.GetRiskLimits)
+			admin.PUT("/accounts/:id/limits", api.RequireScope(auth.ScopeAccountsAdmin), h.SetRiskLimits)
+			admin.POST("/accounts/:id/deposits", api.RequireScope(auth.ScopeAccountsAdmin), h.CreateDeposit)
+			admin.GET("/accounts/:id/kill-switch", api.RequireScope(auth.ScopeRiskAdmin), h.GetKillSwitch)
+			admin.POST("/accounts/:id/kill-switch", api.RequireScope(auth.ScopeRiskAdmin), h.EngageKillSwitch)
+			admin.DELETE("/accounts/:id/kill-switch", api.RequireScope(auth.ScopeRiskAdmin), h.ReleaseKillSwitch)
+			admin.GET("/accounts/:id/audit", api.RequireScope(auth.ScopeRiskAdmin), h.ListAuditEvents)
 		}
 	}
 
@@ -135,6 +386,26 @@ func main() {
 		}
 	}()
 
+	// Create gRPC server sharing the engine and token validation
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcapi.UnaryAuthInterceptor(jwtService, logger)),
+		grpc.ChainStreamInterceptor(grpcapi.StreamAuthInterceptor(jwtService, grpcStreams, logger)),
+	)
+	grpcapi.NewServer(engine, pgStore, accounts, feed, logger).Register(grpcServer)
+
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPCPort))
+	if err != nil {
+		logger.Fatal("Failed to listen for gRPC", zap.Error(err))
+	}
+	go func() {
+		logger.Info("Starting gRPC server",
+			zap.String("address", grpcListener.Addr().String()))
+
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			logger.Fatal("Failed to start gRPC server", zap.Error(err))
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -151,9 +422,73 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Log out every FIX session before the store closes
+	if fixAcceptor != nil {
+		fixAcceptor.Close()
+	}
+
+	// End market data streams so in-flight calls can drain
+	feed.Close()
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+
 	logger.Info("Server exiting")
 }
 
+// loadMarketData replays the trades still inside the ticker window. Candles
+// are rebuilt from the start of the current daily bar; earlier bars are
+// already stored.
+func loadMarketData(ctx context.Context, pgStore *store.PostgresStore, tickers *marketdata.Tickers, candles *marketdata.Candles) error {
+	now := time.Now()
+	since := now.Add(-marketdata.TickerWindow)
+	candlesSince := types.TimeFrame1d.Start(now)
+
+	symbols, err := pgStore.TradedSymbols(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, symbol := range symbols {
+		filter := store.TradeFilter{Symbol: symbol, From: since}
+		err := pgStore.StreamTrades(ctx, filter, func(trade *types.Trade) error {
+			tickers.OnTrade(*trade)
+			if !trade.ExecutedAt.Before(candlesSince) {
+				candles.OnTrade(*trade)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimitPolicy converts the configured buckets and endpoint weights
+func rateLimitPolicy(cfg config.RateLimitConfig) *ratelimit.Policy {
+	bucket := func(b config.BucketConfig) ratelimit.Limit {
+		return ratelimit.Limit{Rate: b.Rate, Burst: b.Burst}
+	}
+
+	policy := &ratelimit.Policy{
+		IP:      bucket(cfg.IP),
+		Default: bucket(cfg.Default),
+		Roles:   make(map[string]ratelimit.Limit, len(cfg.Roles)),
+		Weights: cfg.Weights,
+	}
+	for role, b := range cfg.Roles {
+		policy.Roles[role] = bucket(b)
+	}
+	return policy
+}
+
 func initLogger(level string) (*zap.Logger, error) {
 	var cfg zap.Config
 
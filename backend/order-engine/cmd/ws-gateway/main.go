@@ -0,0 +1,155 @@
+// Command ws-gateway serves the /ws endpoint without running a matching
+// engine. It receives the updates of the channels its clients subscribe to
+// from the server over NATS, so any number of replicas can run behind a
+// load balancer. Order entry stays on the server's /ws endpoint.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/config"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/api"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/cache"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/wsbus"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load config: %v", err))
+	}
+
+	// Initialize logger
+	logger, err := initLogger(cfg.Log.Level)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+	}
+	defer logger.Sync()
+
+	// Initialize Redis cache for token revocation checks
+	redisCache, err := cache.NewRedisCache(
+		cfg.GetRedisAddr(),
+		cfg.Redis.Password,
+		cfg.Redis.DB,
+		logger,
+	)
+	if err != nil {
+		logger.Fatal("Failed to initialize Redis cache", zap.Error(err))
+	}
+	defer redisCache.Close()
+
+	// Initialize JWT service; clients connect with access tokens
+	keyCtx, stopKeyRefresh := context.WithCancel(context.Background())
+	defer stopKeyRefresh()
+	jwtService, err := auth.NewFromConfig(keyCtx, cfg.Auth, redisCache, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize JWT service", zap.Error(err))
+	}
+
+	// Receive the updates and snapshots of subscribed channels from the
+	// server
+	natsConn, err := wsbus.Connect(cfg.NATS.URL, cfg.NATS.Username, cfg.NATS.Password, "ws-gateway", logger)
+	if err != nil {
+		logger.Fatal("Failed to connect to NATS", zap.Error(err))
+	}
+	defer natsConn.Drain()
+
+	wsHub := ws.NewHub(logger)
+	subscriber := wsbus.NewSubscriber(natsConn, wsHub, time.Duration(cfg.WebSocket.SnapshotTimeout)*time.Second, logger)
+	wsHub.SetInterestListener(subscriber.SetInterest)
+	wsHub.SetRemoteSnapshot(subscriber.Snapshot)
+	go wsHub.Run()
+
+	// Close the connections of users the server revokes or blocks
+	if _, err := wsbus.SubscribeDisconnects(natsConn, wsHub.DisconnectUser, logger); err != nil {
+		logger.Fatal("Failed to subscribe to disconnects", zap.Error(err))
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(api.LoggerMiddleware(logger))
+	router.Use(api.MetricsMiddleware())
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "healthy",
+			"time":   time.Now(),
+			"nats":   natsConn.Status().String(),
+		})
+	})
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	router.GET("/ws", func(c *gin.Context) {
+		token, ok := api.BearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+		claims, err := jwtService.ValidateToken(c.Request.Context(), token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		if !claims.HasScope(auth.ScopeMarketDataRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": auth.ScopeMarketDataRead})
+			return
+		}
+
+		ws.NewHandler(wsHub, claims).ServeWS(c.Writer, c.Request)
+	})
+
+	srv := &http.Server{
+		Addr:        fmt.Sprintf(":%d", cfg.WebSocket.GatewayPort),
+		Handler:     router,
+		ReadTimeout: time.Duration(cfg.Server.ReadTimeout) * time.Second,
+	}
+	go func() {
+		logger.Info("Starting WebSocket gateway",
+			zap.String("address", srv.Addr),
+			zap.String("nats_url", natsConn.ConnectedUrl()))
+
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Failed to start WebSocket gateway", zap.Error(err))
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down WebSocket gateway...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Fatal("WebSocket gateway forced to shutdown", zap.Error(err))
+	}
+
+	logger.Info("WebSocket gateway exiting")
+}
+
+func initLogger(level string) (*zap.Logger, error) {
+	var cfg zap.Config
+
+	if level == "production" {
+		cfg = zap.NewProductionConfig()
+	} else {
+		cfg = zap.NewDevelopmentConfig()
+	}
+
+	return cfg.Build()
+}
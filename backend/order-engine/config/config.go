@@ -2,15 +2,23 @@ package config
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	NATS     NATSConfig    `mapstructure:"nats"`
-	Log      LogConfig     `mapstructure:"log"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	NATS      NATSConfig      `mapstructure:"nats"`
+	Log       LogConfig       `mapstructure:"log"`
+	Fees      FeesConfig      `mapstructure:"fees"`
+	Matching  MatchingConfig  `mapstructure:"matching"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	FIX       FIXConfig       `mapstructure:"fix"`
+	WebSocket WebSocketConfig `mapstructure:"websocket"`
 }
 
 type ServerConfig struct {
@@ -21,13 +29,17 @@ type ServerConfig struct {
 	WriteTimeout int    `mapstructure:"write_timeout"`
 }
 
+// DatabaseConfig locates the database. OutboxDir holds the order
+// updates, trades, settlements and candles the database has not kept up
+// with; it must be on local disk and survive restarts.
 type DatabaseConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
-	DBName   string `mapstructure:"dbname"`
-	SSLMode  string `mapstructure:"sslmode"`
+	Host      string `mapstructure:"host"`
+	Port      int    `mapstructure:"port"`
+	User      string `mapstructure:"user"`
+	Password  string `mapstructure:"password"`
+	DBName    string `mapstructure:"dbname"`
+	SSLMode   string `mapstructure:"sslmode"`
+	OutboxDir string `mapstructure:"outbox_dir"`
 }
 
 type RedisConfig struct {
@@ -43,6 +55,107 @@ type NATSConfig struct {
 	Password string `mapstructure:"password"`
 }
 
+type FeesConfig struct {
+	MakerRate float64 `mapstructure:"maker_rate"`
+	TakerRate float64 `mapstructure:"taker_rate"`
+}
+
+// MatchingConfig controls matching behaviour. SelfTradePrevention is
+// "none", "account" or "master".
+type MatchingConfig struct {
+	SelfTradePrevention string         `mapstructure:"self_trade_prevention"`
+	Throttle            ThrottleConfig `mapstructure:"throttle"`
+}
+
+// ThrottleConfig limits each account's order messages (new, amend and
+// cancel) in the engine, whichever gateway they arrive through. RatioWindow
+// is in seconds; zero limits are disabled.
+type ThrottleConfig struct {
+	MaxMessagesPerSecond  int     `mapstructure:"max_messages_per_second"`
+	MaxMessageToFillRatio float64 `mapstructure:"max_message_to_fill_ratio"`
+	RatioWindow           int     `mapstructure:"ratio_window"`
+	MinRatioMessages      int     `mapstructure:"min_ratio_messages"`
+}
+
+// RateLimitConfig sets the token buckets of the HTTP rate limiter. Backend
+// is "memory" for per-replica buckets or "redis" to share them. Weights are
+// keyed by "method route" and default to 1.
+type RateLimitConfig struct {
+	Enabled bool                    `mapstructure:"enabled"`
+	Backend string                  `mapstructure:"backend"`
+	IP      BucketConfig            `mapstructure:"ip"`
+	Default BucketConfig            `mapstructure:"default"`
+	Roles   map[string]BucketConfig `mapstructure:"roles"`
+	Weights map[string]float64      `mapstructure:"weights"`
+}
+
+// BucketConfig is a refill rate in tokens per second and a bucket size
+type BucketConfig struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst float64 `mapstructure:"burst"`
+}
+
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+// AuthConfig selects how tokens are verified. In "hmac" mode tokens are
+// signed with HMACSecret; in "jwks" mode RS256/ES256 tokens are verified
+// against public keys from JWKSFile or JWKSURL. Tokens must carry an expiry
+// and come from Issuer, and list Audience when it is set. Durations are in
+// seconds.
+// RoleScopes overrides the built-in role-to-scope policy when set.
+// APIKeyMasterKey (base64, 32 bytes) encrypts API key secrets; API keys
+// are disabled when it is empty.
+type AuthConfig struct {
+	Mode                string              `mapstructure:"mode"`
+	Issuer              string              `mapstructure:"issuer"`
+	IssuerOptional      bool                `mapstructure:"issuer_optional"`
+	Audience            string              `mapstructure:"audience"`
+	HMACSecret          string              `mapstructure:"hmac_secret"`
+	JWKSFile            string              `mapstructure:"jwks_file"`
+	JWKSURL             string              `mapstructure:"jwks_url"`
+	JWKSRefreshInterval int                 `mapstructure:"jwks_refresh_interval"`
+	KeyRotationGrace    int                 `mapstructure:"key_rotation_grace"`
+	AccessTokenTTL      int                 `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL     int                 `mapstructure:"refresh_token_ttl"`
+	RoleScopes          map[string][]string `mapstructure:"role_scopes"`
+	APIKeyMasterKey     string              `mapstructure:"api_key_master_key"`
+}
+
+const (
+	AuthModeHMAC = "hmac"
+	AuthModeJWKS = "jwks"
+)
+
+// FIXConfig configures the FIX gateway the server runs when Enabled.
+// Counterparties must address their messages to SenderCompID. LogonTimeout
+// is in seconds. The fix-gateway process listens on GatewayPort instead and
+// enters orders on the server's gRPC service at ServerAddr, waiting
+// RequestTimeout seconds for each request.
+type FIXConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Port           int    `mapstructure:"port"`
+	SenderCompID   string `mapstructure:"sender_comp_id"`
+	LogonTimeout   int    `mapstructure:"logon_timeout"`
+	GatewayPort    int    `mapstructure:"gateway_port"`
+	ServerAddr     string `mapstructure:"server_addr"`
+	RequestTimeout int    `mapstructure:"request_timeout"`
+}
+
+// WebSocketConfig configures the /ws endpoint. OrderRate limits the order
+// entry requests of each connection; a zero rate disables the limit. Relay
+// publishes every update to NATS for the ws-gateway processes, which listen
+// on GatewayPort and wait SnapshotTimeout seconds for the server's
+// snapshots.
+type WebSocketConfig struct {
+	OrderRate       BucketConfig `mapstructure:"order_rate"`
+	Relay           bool         `mapstructure:"relay"`
+	GatewayPort     int          `mapstructure:"gateway_port"`
+	SnapshotTimeout int          `mapstructure:"snapshot_timeout"`
+}
+
 type LogConfig struct {
 	Level string `mapstructure:"level"`
 	Path  string `mapstructure:"path"`
@@ -54,6 +167,7 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(path)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -64,9 +178,48 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := config.Auth.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.RateLimit.validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+func (a *AuthConfig) validate() error {
+	switch a.Mode {
+	case AuthModeHMAC:
+		if a.HMACSecret == "" {
+			return fmt.Errorf("auth.hmac_secret is required in hmac mode (set AUTH_HMAC_SECRET)")
+		}
+	case AuthModeJWKS:
+		if a.JWKSFile == "" && a.JWKSURL == "" {
+			return fmt.Errorf("auth.jwks_file or auth.jwks_url is required in jwks mode")
+		}
+		if a.JWKSRefreshInterval <= 0 {
+			return fmt.Errorf("auth.jwks_refresh_interval must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown auth.mode %q", a.Mode)
+	}
+	return nil
+}
+
+func (r *RateLimitConfig) validate() error {
+	if !r.Enabled {
+		return nil
+	}
+	switch r.Backend {
+	case RateLimitBackendMemory, RateLimitBackendRedis:
+	default:
+		return fmt.Errorf("unknown rate_limit.backend %q", r.Backend)
+	}
+	return nil
+}
+
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		c.Database.Host,
@@ -80,4 +233,4 @@ func (c *Config) GetDSN() string {
 
 func (c *Config) GetRedisAddr() string {
 	return fmt.Sprintf("%s:%d", c.Redis.Host, c.Redis.Port)
-} 
\ No newline at end of file
+}
@@ -0,0 +1,145 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+var (
+	ErrAccountBlocked      = errors.New("account is blocked by kill switch")
+	ErrKillSwitchActive    = errors.New("kill switch is already engaged")
+	ErrKillSwitchNotActive = errors.New("kill switch is not engaged")
+	ErrKillSwitchPending   = errors.New("kill switch is being engaged or released")
+	ErrSameAdmin           = errors.New("kill switch must be released by a different admin")
+)
+
+// EngageKillSwitch blocks new orders for the account and returns the IDs
+// of every account it covers, so their resting orders can be cancelled.
+// The switch is persisted with an audit event before it takes effect; the
+// lock is not held while it is, and the account's switch is marked pending
+// so concurrent engages and releases are refused. Orders admitted until it
+// takes effect are resting ones, cancelled with the rest by the caller.
+func (m *Manager) EngageKillSwitch(ctx context.Context, accountID, adminID, reason string) (types.KillSwitch, []string, error) {
+	m.mutex.Lock()
+	account, exists := m.accounts[accountID]
+	if !exists {
+		m.mutex.Unlock()
+		return types.KillSwitch{}, nil, ErrAccountNotFound
+	}
+	if err := m.beginSwitch(accountID); err != nil {
+		m.mutex.Unlock()
+		return types.KillSwitch{}, nil, err
+	}
+	if _, active := m.kills[accountID]; active {
+		delete(m.switching, accountID)
+		m.mutex.Unlock()
+		return types.KillSwitch{}, nil, ErrKillSwitchActive
+	}
+	m.mutex.Unlock()
+
+	ks := &types.KillSwitch{
+		AccountID: accountID,
+		Reason:    reason,
+		SetBy:     adminID,
+		SetAt:     time.Now(),
+	}
+	event := newAuditEvent(types.AuditKillSwitchEngaged, accountID, adminID, reason)
+	err := m.store.SaveKillSwitch(ctx, ks, event)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.switching, accountID)
+	if err != nil {
+		return types.KillSwitch{}, nil, err
+	}
+	m.kills[accountID] = ks
+	covered := []string{accountID}
+	if account.IsMaster() {
+		covered = append(covered, m.children[accountID]...)
+	}
+	return *ks, covered, nil
+}
+
+// ReleaseKillSwitch unblocks the account. The releasing admin must differ
+// from the one who engaged the switch. Like EngageKillSwitch it persists
+// the release before it takes effect, outside the lock.
+func (m *Manager) ReleaseKillSwitch(ctx context.Context, accountID, adminID, reason string) error {
+	m.mutex.Lock()
+	if err := m.beginSwitch(accountID); err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	ks, active := m.kills[accountID]
+	switch {
+	case !active:
+		delete(m.switching, accountID)
+		m.mutex.Unlock()
+		return ErrKillSwitchNotActive
+	case ks.SetBy == adminID:
+		delete(m.switching, accountID)
+		m.mutex.Unlock()
+		return ErrSameAdmin
+	}
+	m.mutex.Unlock()
+
+	event := newAuditEvent(types.AuditKillSwitchReleased, accountID, adminID, reason)
+	err := m.store.DeleteKillSwitch(ctx, accountID, event)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.switching, accountID)
+	if err != nil {
+		return err
+	}
+	delete(m.kills, accountID)
+	return nil
+}
+
+// beginSwitch marks the account's kill switch as being saved, unless it
+// already is; callers hold the lock
+func (m *Manager) beginSwitch(accountID string) error {
+	if m.switching[accountID] {
+		return ErrKillSwitchPending
+	}
+	m.switching[accountID] = true
+	return nil
+}
+
+// KillSwitch returns the kill switch set directly on the account
+func (m *Manager) KillSwitch(accountID string) (types.KillSwitch, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	ks, exists := m.kills[accountID]
+	if !exists {
+		return types.KillSwitch{}, false
+	}
+	return *ks, true
+}
+
+// killSwitch returns the switch blocking the account or its master;
+// callers hold the lock
+func (m *Manager) killSwitch(accountID, masterID string) *types.KillSwitch {
+	if ks, exists := m.kills[accountID]; exists {
+		return ks
+	}
+	return m.kills[masterID]
+}
+
+func newAuditEvent(action, accountID, actor, reason string) *types.AuditEvent {
+	return &types.AuditEvent{
+		ID:        uuid.New().String(),
+		Action:    action,
+		AccountID: accountID,
+		Actor:     actor,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,323 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// memStore keeps accounts and kill switches in memory
+type memStore struct {
+	mutex    sync.Mutex
+	accounts []*types.Account
+	kills    map[string]*types.KillSwitch
+	events   []*types.AuditEvent
+}
+
+func newMemStore(accounts ...*types.Account) *memStore {
+	return &memStore{accounts: accounts, kills: make(map[string]*types.KillSwitch)}
+}
+
+func (s *memStore) CreateAccount(ctx context.Context, account *types.Account) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accounts = append(s.accounts, account)
+	return nil
+}
+
+func (s *memStore) ListAccounts(ctx context.Context) ([]*types.Account, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*types.Account(nil), s.accounts...), nil
+}
+
+func (s *memStore) ListBalances(ctx context.Context) ([]*types.Balance, error) {
+	return nil, nil
+}
+
+func (s *memStore) ListPositions(ctx context.Context) ([]*types.Position, error) {
+	return nil, nil
+}
+
+func (s *memStore) ListRiskLimits(ctx context.Context) (map[string]types.RiskLimits, error) {
+	return make(map[string]types.RiskLimits), nil
+}
+
+func (s *memStore) SaveRiskLimits(ctx context.Context, accountID string, limits types.RiskLimits) error {
+	return nil
+}
+
+func (s *memStore) SaveTransfer(ctx context.Context, transfer *types.Transfer) error {
+	return nil
+}
+
+func (s *memStore) RecordSettlement(settlement Settlement) {}
+
+func (s *memStore) ListKillSwitches(ctx context.Context) ([]*types.KillSwitch, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var kills []*types.KillSwitch
+	for _, ks := range s.kills {
+		copied := *ks
+		kills = append(kills, &copied)
+	}
+	return kills, nil
+}
+
+func (s *memStore) SaveKillSwitch(ctx context.Context, ks *types.KillSwitch, event *types.AuditEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	copied := *ks
+	s.kills[ks.AccountID] = &copied
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memStore) DeleteKillSwitch(ctx context.Context, accountID string, event *types.AuditEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.kills, accountID)
+	s.events = append(s.events, event)
+	return nil
+}
+
+func newTestManager(t *testing.T, store Store) *Manager {
+	m, err := NewManager(context.Background(), store, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	return m
+}
+
+// testAccounts returns alice's master account and one sub-account
+func testAccounts() []*types.Account {
+	return []*types.Account{
+		{ID: "alice", UserID: "alice", Name: "main", CreatedAt: time.Now()},
+		{ID: "alice-sub", UserID: "alice", ParentID: "alice", Name: "sub", CreatedAt: time.Now()},
+	}
+}
+
+func testOrder(accountID string) *types.Order {
+	return &types.Order{
+		ID:        "order-1",
+		UserID:    "alice",
+		AccountID: accountID,
+		Symbol:    "BTC-USD",
+		Type:      types.LimitOrder,
+		Side:      types.BuyOrder,
+		Price:     100,
+		Quantity:  1,
+	}
+}
+
+func TestKillSwitchEngageAndRelease(t *testing.T) {
+	store := newMemStore(testAccounts()...)
+	m := newTestManager(t, store)
+	ctx := context.Background()
+
+	ks, covered, err := m.EngageKillSwitch(ctx, "alice", "admin-1", "runaway algo")
+	if err != nil {
+		t.Fatalf("engage: %v", err)
+	}
+	if ks.SetBy != "admin-1" || ks.Reason != "runaway algo" {
+		t.Fatalf("kill switch = %+v", ks)
+	}
+	if len(covered) != 2 || covered[0] != "alice" || covered[1] != "alice-sub" {
+		t.Fatalf("covered = %v, want the master and its sub-account", covered)
+	}
+
+	// The master's switch blocks its sub-accounts too
+	for _, accountID := range []string{"alice", "alice-sub"} {
+		if err := m.CheckOrder(testOrder(accountID)); !errors.Is(err, ErrAccountBlocked) {
+			t.Fatalf("order on %s: got %v, want %v", accountID, err, ErrAccountBlocked)
+		}
+	}
+
+	if _, _, err := m.EngageKillSwitch(ctx, "alice", "admin-2", "again"); !errors.Is(err, ErrKillSwitchActive) {
+		t.Fatalf("second engage: got %v, want %v", err, ErrKillSwitchActive)
+	}
+
+	if err := m.ReleaseKillSwitch(ctx, "alice", "admin-2", "resolved"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := m.Deposit(ctx, "admin-2", "alice-sub", "USD", 1000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if err := m.CheckOrder(testOrder("alice-sub")); err != nil {
+		t.Fatalf("order after release: %v", err)
+	}
+	if err := m.ReleaseKillSwitch(ctx, "alice", "admin-2", "again"); !errors.Is(err, ErrKillSwitchNotActive) {
+		t.Fatalf("second release: got %v, want %v", err, ErrKillSwitchNotActive)
+	}
+
+	if len(store.events) != 2 ||
+		store.events[0].Action != types.AuditKillSwitchEngaged ||
+		store.events[1].Action != types.AuditKillSwitchReleased {
+		t.Fatalf("audit events = %+v, want engaged then released", store.events)
+	}
+}
+
+func TestKillSwitchOnSubAccount(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+
+	_, covered, err := m.EngageKillSwitch(context.Background(), "alice-sub", "admin-1", "")
+	if err != nil {
+		t.Fatalf("engage: %v", err)
+	}
+	if len(covered) != 1 || covered[0] != "alice-sub" {
+		t.Fatalf("covered = %v, want only the sub-account", covered)
+	}
+	if err := m.CheckOrder(testOrder("alice")); err != nil {
+		t.Fatalf("order on the master: %v", err)
+	}
+	if err := m.CheckOrder(testOrder("alice-sub")); !errors.Is(err, ErrAccountBlocked) {
+		t.Fatalf("order on the sub-account: got %v, want %v", err, ErrAccountBlocked)
+	}
+}
+
+func TestKillSwitchReleaseNeedsDifferentAdmin(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+	ctx := context.Background()
+
+	if _, _, err := m.EngageKillSwitch(ctx, "alice", "admin-1", ""); err != nil {
+		t.Fatalf("engage: %v", err)
+	}
+	if err := m.ReleaseKillSwitch(ctx, "alice", "admin-1", ""); !errors.Is(err, ErrSameAdmin) {
+		t.Fatalf("release by the same admin: got %v, want %v", err, ErrSameAdmin)
+	}
+	if _, active := m.KillSwitch("alice"); !active {
+		t.Fatal("kill switch released by the admin who engaged it")
+	}
+}
+
+func TestKillSwitchUnknownAccount(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+
+	if _, _, err := m.EngageKillSwitch(context.Background(), "mallory", "admin-1", ""); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrAccountNotFound)
+	}
+}
+
+func TestKillSwitchReloadedOnRestart(t *testing.T) {
+	store := newMemStore(testAccounts()...)
+	ctx := context.Background()
+
+	if _, _, err := newTestManager(t, store).EngageKillSwitch(ctx, "alice", "admin-1", "restart"); err != nil {
+		t.Fatalf("engage: %v", err)
+	}
+
+	m := newTestManager(t, store)
+	ks, active := m.KillSwitch("alice")
+	if !active || ks.SetBy != "admin-1" {
+		t.Fatalf("reloaded kill switch = %+v, %v", ks, active)
+	}
+	if err := m.CheckOrder(testOrder("alice-sub")); !errors.Is(err, ErrAccountBlocked) {
+		t.Fatalf("order after restart: got %v, want %v", err, ErrAccountBlocked)
+	}
+
+	// The same-admin rule survives the restart
+	if err := m.ReleaseKillSwitch(ctx, "alice", "admin-1", ""); !errors.Is(err, ErrSameAdmin) {
+		t.Fatalf("release by the same admin: got %v, want %v", err, ErrSameAdmin)
+	}
+}
+
+func TestKillSwitchConcurrentEngage(t *testing.T) {
+	store := newMemStore(testAccounts()...)
+	m := newTestManager(t, store)
+
+	const admins = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, admins)
+	for i := 0; i < admins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := m.EngageKillSwitch(context.Background(), "alice", "admin", "")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	engaged := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			engaged++
+		case !errors.Is(err, ErrKillSwitchActive) && !errors.Is(err, ErrKillSwitchPending):
+			t.Fatalf("engage: %v", err)
+		}
+	}
+	if engaged != 1 || len(store.events) != 1 {
+		t.Fatalf("%d engages succeeded with %d audit events, want 1", engaged, len(store.events))
+	}
+}
+
+// slowStore holds kill switch writes until released, failing them if told
+type slowStore struct {
+	*memStore
+	saving  chan struct{}
+	release chan error
+}
+
+func (s *slowStore) SaveKillSwitch(ctx context.Context, ks *types.KillSwitch, event *types.AuditEvent) error {
+	s.saving <- struct{}{}
+	if err := <-s.release; err != nil {
+		return err
+	}
+	return s.memStore.SaveKillSwitch(ctx, ks, event)
+}
+
+func TestKillSwitchSavesOutsideTheLock(t *testing.T) {
+	store := &slowStore{
+		memStore: newMemStore(testAccounts()...),
+		saving:   make(chan struct{}),
+		release:  make(chan error),
+	}
+	m := newTestManager(t, store)
+	ctx := context.Background()
+
+	engaged := make(chan error, 1)
+	go func() {
+		_, _, err := m.EngageKillSwitch(ctx, "alice", "admin-1", "")
+		engaged <- err
+	}()
+	<-store.saving
+
+	// Orders are still checked while the switch is saved, and it cannot
+	// be changed until it is
+	if err := m.CheckOrder(testOrder("alice")); err != nil {
+		t.Fatalf("order while saving: %v", err)
+	}
+	if _, _, err := m.EngageKillSwitch(ctx, "alice", "admin-2", ""); !errors.Is(err, ErrKillSwitchPending) {
+		t.Fatalf("engage while saving: got %v, want %v", err, ErrKillSwitchPending)
+	}
+
+	// A failed save leaves the account unblocked
+	store.release <- errors.New("database down")
+	if err := <-engaged; err == nil {
+		t.Fatal("engage succeeded without saving")
+	}
+	if _, active := m.KillSwitch("alice"); active {
+		t.Fatal("unsaved kill switch took effect")
+	}
+
+	go func() {
+		_, _, err := m.EngageKillSwitch(ctx, "alice", "admin-1", "")
+		engaged <- err
+	}()
+	<-store.saving
+	store.release <- nil
+	if err := <-engaged; err != nil {
+		t.Fatalf("engage: %v", err)
+	}
+	if err := m.CheckOrder(testOrder("alice")); !errors.Is(err, ErrAccountBlocked) {
+		t.Fatalf("order after engage: got %v, want %v", err, ErrAccountBlocked)
+	}
+}
@@ -0,0 +1,680 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidTransfer     = errors.New("invalid transfer")
+	ErrRiskLimit           = errors.New("risk limit exceeded")
+)
+
+// Store persists accounts and their ledgers. Settlements are recorded from
+// the matching engine, so RecordSettlement must neither block nor drop one.
+type Store interface {
+	CreateAccount(ctx context.Context, account *types.Account) error
+	ListAccounts(ctx context.Context) ([]*types.Account, error)
+	ListBalances(ctx context.Context) ([]*types.Balance, error)
+	ListPositions(ctx context.Context) ([]*types.Position, error)
+	ListRiskLimits(ctx context.Context) (map[string]types.RiskLimits, error)
+	SaveRiskLimits(ctx context.Context, accountID string, limits types.RiskLimits) error
+	SaveTransfer(ctx context.Context, transfer *types.Transfer) error
+	RecordSettlement(settlement Settlement)
+	ListKillSwitches(ctx context.Context) ([]*types.KillSwitch, error)
+	SaveKillSwitch(ctx context.Context, ks *types.KillSwitch, event *types.AuditEvent) error
+	DeleteKillSwitch(ctx context.Context, accountID string, event *types.AuditEvent) error
+}
+
+// BalanceDelta is a change to one asset balance of an account
+type BalanceDelta struct {
+	AccountID string
+	Asset     string
+	Delta     float64
+}
+
+// Settlement is the effect of one trade on its counterparties' balances
+// and positions
+type Settlement struct {
+	TradeID   string
+	Balances  []BalanceDelta
+	Positions []types.Position
+}
+
+// BalanceListener is called with an account's balance after every change,
+// along with the user the account belongs to. Listeners run under the
+// manager lock and must not block.
+type BalanceListener func(userID string, balance types.Balance)
+
+// PositionListener is called with an account's position after every fill,
+// under the same rules as BalanceListener
+type PositionListener func(userID string, position types.Position)
+
+// Manager keeps the account hierarchy, balances, positions and risk limits
+// in memory. Balances and positions are updated from engine trades.
+// Sub-accounts trade only the funds transferred to them, less what their
+// open orders hold; master accounts are settled on credit.
+type Manager struct {
+	store      Store
+	logger     *zap.Logger
+	accounts   map[string]*types.Account
+	children   map[string][]string
+	balances   map[string]map[string]*types.Balance
+	positions  map[string]map[string]*types.Position
+	limits     map[string]types.RiskLimits
+	lastPrices map[string]float64
+	kills      map[string]*types.KillSwitch
+	switching  map[string]bool               // kill switches being saved, by account
+	holds      map[string]hold               // by order ID
+	held       map[string]map[string]float64 // by account and asset
+	feeRate    float64
+	mutex      sync.RWMutex
+
+	balanceListeners  []BalanceListener
+	positionListeners []PositionListener
+}
+
+// NewManager loads the accounts and their state from the store
+func NewManager(ctx context.Context, store Store, logger *zap.Logger) (*Manager, error) {
+	m := &Manager{
+		store:      store,
+		logger:     logger,
+		accounts:   make(map[string]*types.Account),
+		children:   make(map[string][]string),
+		balances:   make(map[string]map[string]*types.Balance),
+		positions:  make(map[string]map[string]*types.Position),
+		limits:     make(map[string]types.RiskLimits),
+		lastPrices: make(map[string]float64),
+		kills:      make(map[string]*types.KillSwitch),
+		switching:  make(map[string]bool),
+		holds:      make(map[string]hold),
+		held:       make(map[string]map[string]float64),
+	}
+
+	accounts, err := store.ListAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	for _, account := range accounts {
+		m.addAccount(account)
+	}
+
+	balances, err := store.ListBalances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load balances: %w", err)
+	}
+	for _, balance := range balances {
+		m.balance(balance.AccountID, balance.Asset).Amount = balance.Amount
+	}
+
+	positions, err := store.ListPositions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load positions: %w", err)
+	}
+	for _, position := range positions {
+		*m.position(position.AccountID, position.Symbol) = *position
+	}
+
+	if m.limits, err = store.ListRiskLimits(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load risk limits: %w", err)
+	}
+
+	kills, err := store.ListKillSwitches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kill switches: %w", err)
+	}
+	for _, ks := range kills {
+		m.kills[ks.AccountID] = ks
+	}
+
+	return m, nil
+}
+
+func (m *Manager) addAccount(account *types.Account) {
+	m.accounts[account.ID] = account
+	if !account.IsMaster() {
+		m.children[account.ParentID] = append(m.children[account.ParentID], account.ID)
+	}
+}
+
+// ResolveAccount returns the account an order of the user is placed on.
+// An empty ID selects the user's master account, which is created on first
+// use. Accounts of other users are reported as not found.
+func (m *Manager) ResolveAccount(ctx context.Context, userID, accountID string) (types.Account, error) {
+	if accountID == "" || accountID == userID {
+		return m.ensureMaster(ctx, userID)
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	account, exists := m.accounts[accountID]
+	if !exists || account.UserID != userID {
+		return types.Account{}, ErrAccountNotFound
+	}
+	return *account, nil
+}
+
+func (m *Manager) ensureMaster(ctx context.Context, userID string) (types.Account, error) {
+	m.mutex.RLock()
+	account, exists := m.accounts[userID]
+	m.mutex.RUnlock()
+	if exists {
+		return *account, nil
+	}
+
+	account = &types.Account{
+		ID:        userID,
+		UserID:    userID,
+		Name:      "master",
+		CreatedAt: time.Now(),
+	}
+	if err := m.store.CreateAccount(ctx, account); err != nil {
+		return types.Account{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if existing, exists := m.accounts[userID]; exists {
+		return *existing, nil
+	}
+	m.addAccount(account)
+	return *account, nil
+}
+
+// CreateSubAccount opens a new sub-account under the user's master account
+func (m *Manager) CreateSubAccount(ctx context.Context, userID, name string) (types.Account, error) {
+	master, err := m.ensureMaster(ctx, userID)
+	if err != nil {
+		return types.Account{}, err
+	}
+
+	account := &types.Account{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		ParentID:  master.ID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	if err := m.store.CreateAccount(ctx, account); err != nil {
+		return types.Account{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.addAccount(account)
+	return *account, nil
+}
+
+// GetAccount returns an account by ID
+func (m *Manager) GetAccount(accountID string) (types.Account, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	account, exists := m.accounts[accountID]
+	if !exists {
+		return types.Account{}, ErrAccountNotFound
+	}
+	return *account, nil
+}
+
+// Accounts returns the user's master account followed by its sub-accounts
+// in creation order
+func (m *Manager) Accounts(userID string) []types.Account {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	master, exists := m.accounts[userID]
+	if !exists {
+		return []types.Account{}
+	}
+
+	accounts := []types.Account{*master}
+	for _, id := range m.children[master.ID] {
+		accounts = append(accounts, *m.accounts[id])
+	}
+	sort.SliceStable(accounts[1:], func(i, j int) bool {
+		return accounts[1+i].CreatedAt.Before(accounts[1+j].CreatedAt)
+	})
+	return accounts
+}
+
+// Balances returns the account's balances sorted by asset
+func (m *Manager) Balances(accountID string) []types.Balance {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	balances := make([]types.Balance, 0, len(m.balances[accountID]))
+	for _, balance := range m.balances[accountID] {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+	return balances
+}
+
+// Positions returns the account's open positions sorted by symbol
+func (m *Manager) Positions(accountID string) []types.Position {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	positions := make([]types.Position, 0, len(m.positions[accountID]))
+	for _, position := range m.positions[accountID] {
+		if position.Quantity != 0 {
+			positions = append(positions, *position)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions
+}
+
+// Transfer moves an asset between two accounts of the user's hierarchy
+func (m *Manager) Transfer(ctx context.Context, userID, fromID, toID, asset string, amount float64) (*types.Transfer, error) {
+	if fromID == toID || asset == "" || amount <= 0 {
+		return nil, ErrInvalidTransfer
+	}
+	for _, id := range []string{fromID, toID} {
+		if _, err := m.ResolveAccount(ctx, userID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	transfer := &types.Transfer{
+		ID:            uuid.New().String(),
+		FromAccountID: fromID,
+		ToAccountID:   toID,
+		Asset:         asset,
+		Amount:        amount,
+		CreatedBy:     userID,
+		CreatedAt:     time.Now(),
+	}
+
+	// Debit first so concurrent transfers cannot overdraw the source, and
+	// give the funds back if the transfer cannot be recorded
+	m.mutex.Lock()
+	source := m.balance(fromID, asset)
+	if source.Amount < amount {
+		m.mutex.Unlock()
+		return nil, ErrInsufficientBalance
+	}
+	source.Amount -= amount
+	source.UpdatedAt = transfer.CreatedAt
+	m.notifyBalance(source)
+	m.mutex.Unlock()
+
+	if err := m.store.SaveTransfer(ctx, transfer); err != nil {
+		m.mutex.Lock()
+		source := m.balance(fromID, asset)
+		source.Amount += amount
+		m.notifyBalance(source)
+		m.mutex.Unlock()
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	target := m.balance(toID, asset)
+	target.Amount += amount
+	target.UpdatedAt = transfer.CreatedAt
+	m.notifyBalance(target)
+	m.mutex.Unlock()
+
+	return transfer, nil
+}
+
+// Deposit credits an account from outside the platform
+func (m *Manager) Deposit(ctx context.Context, createdBy, accountID, asset string, amount float64) (*types.Transfer, error) {
+	if asset == "" || amount <= 0 {
+		return nil, ErrInvalidTransfer
+	}
+	if _, err := m.GetAccount(accountID); err != nil {
+		return nil, err
+	}
+
+	transfer := &types.Transfer{
+		ID:          uuid.New().String(),
+		ToAccountID: accountID,
+		Asset:       asset,
+		Amount:      amount,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	if err := m.store.SaveTransfer(ctx, transfer); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	balance := m.balance(accountID, asset)
+	balance.Amount += amount
+	balance.UpdatedAt = transfer.CreatedAt
+	m.notifyBalance(balance)
+
+	return transfer, nil
+}
+
+// RiskLimits returns the limits set on an account
+func (m *Manager) RiskLimits(accountID string) types.RiskLimits {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.limits[accountID]
+}
+
+// SetRiskLimits sets the limits of a master or sub-account. Limits on a
+// master account apply to the whole hierarchy.
+func (m *Manager) SetRiskLimits(ctx context.Context, accountID string, limits types.RiskLimits) error {
+	if _, err := m.GetAccount(accountID); err != nil {
+		return err
+	}
+	if err := m.store.SaveRiskLimits(ctx, accountID, limits); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.limits[accountID] = limits
+	return nil
+}
+
+// CheckOrder rejects orders of blocked accounts and enforces the risk limits of the order's account and of its
+// master account. Position limits apply to filled positions; order values
+// of market orders use the last trade price and are skipped before the
+// first trade. Orders on sub-accounts must also be covered by the
+// available balance, see checkBalance. It is registered as a matching
+// engine pre-trade check.
+func (m *Manager) CheckOrder(order *types.Order) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	price := order.Price
+	if order.Type == types.MarketOrder || price <= 0 {
+		price = m.lastPrices[order.Symbol]
+	}
+	delta := order.Quantity
+	if order.Side == types.SellOrder {
+		delta = -delta
+	}
+
+	masterID := order.UserID
+	if account, exists := m.accounts[order.AccountID]; exists {
+		masterID = account.MasterID()
+	}
+
+	if ks := m.killSwitch(order.AccountID, masterID); ks != nil {
+		return matching.Reject(types.RejectReasonBlocked,
+			fmt.Errorf("%w: %s", ErrAccountBlocked, ks.Reason))
+	}
+
+	if order.AccountID != masterID {
+		position := m.positionQty(order.AccountID, order.Symbol)
+		if err := checkLimits(m.limits[order.AccountID], "account", order.Quantity, price, position+delta); err != nil {
+			return err
+		}
+		if err := m.checkBalance(order, price); err != nil {
+			return err
+		}
+	}
+
+	position := m.positionQty(masterID, order.Symbol)
+	for _, id := range m.children[masterID] {
+		position += m.positionQty(id, order.Symbol)
+	}
+	return checkLimits(m.limits[masterID], "master account", order.Quantity, price, position+delta)
+}
+
+func checkLimits(limits types.RiskLimits, level string, qty, price, position float64) error {
+	var err error
+	if position < 0 {
+		position = -position
+	}
+
+	switch {
+	case limits.MaxOrderQty > 0 && qty > limits.MaxOrderQty:
+		err = fmt.Errorf("%w: order quantity %g exceeds %s limit %g", ErrRiskLimit, qty, level, limits.MaxOrderQty)
+	case limits.MaxOrderValue > 0 && price > 0 && qty*price > limits.MaxOrderValue:
+		err = fmt.Errorf("%w: order value %g exceeds %s limit %g", ErrRiskLimit, qty*price, level, limits.MaxOrderValue)
+	case limits.MaxPositionQty > 0 && position > limits.MaxPositionQty:
+		err = fmt.Errorf("%w: position %g would exceed %s limit %g", ErrRiskLimit, position, level, limits.MaxPositionQty)
+	default:
+		return nil
+	}
+	return matching.Reject(types.RejectReasonRiskLimit, err)
+}
+
+// checkBalance rejects an order its account cannot pay for out of the
+// balance not held by its open orders: the quote value plus fees of a buy,
+// valued at the limit price or for market orders the last trade price, or
+// the base quantity of a sell. Symbols without a base and quote asset do
+// not settle balances and are not checked. Callers hold the lock.
+func (m *Manager) checkBalance(order *types.Order, price float64) error {
+	asset, need, ok := m.cost(order, order.Quantity, price)
+	if !ok {
+		return nil
+	}
+	if need < 0 {
+		return matching.Reject(types.RejectReasonBalance,
+			fmt.Errorf("%w: no price to value a market order on %s", ErrInsufficientBalance, order.Symbol))
+	}
+
+	available := -m.held[order.AccountID][asset]
+	if balance, exists := m.balances[order.AccountID][asset]; exists {
+		available += balance.Amount
+	}
+	if need > available {
+		return matching.Reject(types.RejectReasonBalance,
+			fmt.Errorf("%w: order needs %g %s, %g available", ErrInsufficientBalance, need, asset, available))
+	}
+	return nil
+}
+
+// cost returns the asset and amount an order of qty at price pays with. It
+// is false for symbols that do not settle balances, and the amount is
+// negative for a buy without a price.
+func (m *Manager) cost(order *types.Order, qty, price float64) (string, float64, bool) {
+	base, quote, ok := types.SplitSymbol(order.Symbol)
+	if !ok {
+		return "", 0, false
+	}
+	if order.Side == types.SellOrder {
+		return base, qty, true
+	}
+	if price <= 0 {
+		return quote, -1, true
+	}
+	return quote, qty * price * (1 + m.feeRate), true
+}
+
+// SetFeeSchedule sets the fee rates the engine charges, so buy orders on
+// sub-accounts are checked against their fees too
+func (m *Manager) SetFeeSchedule(fees matching.FeeSchedule) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.feeRate = fees.TakerRate
+	if fees.MakerRate > m.feeRate {
+		m.feeRate = fees.MakerRate
+	}
+}
+
+// hold is the balance an open order on a sub-account sets aside
+type hold struct {
+	accountID string
+	asset     string
+	amount    float64
+}
+
+// OnOrder holds the balance the remaining quantity of an open order on a
+// sub-account needs, and releases it as the order fills or closes. It is
+// registered as a matching engine order listener.
+func (m *Manager) OnOrder(order types.Order) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if h, exists := m.holds[order.ID]; exists {
+		m.held[h.accountID][h.asset] -= h.amount
+		delete(m.holds, order.ID)
+	}
+
+	account, exists := m.accounts[order.AccountID]
+	if !exists || account.IsMaster() || order.RemainingQty <= 0 ||
+		(order.Status != types.OrderStatusNew && order.Status != types.OrderStatusPartial) {
+		return
+	}
+	price := order.Price
+	if price <= 0 {
+		price = order.StopPrice
+	}
+	asset, amount, ok := m.cost(&order, order.RemainingQty, price)
+	if !ok || amount <= 0 {
+		return
+	}
+
+	if m.held[order.AccountID] == nil {
+		m.held[order.AccountID] = make(map[string]float64)
+	}
+	m.held[order.AccountID][asset] += amount
+	m.holds[order.ID] = hold{accountID: order.AccountID, asset: asset, amount: amount}
+}
+
+// OnTrade settles a trade onto both accounts' positions and, for symbols
+// of the form BASE-QUOTE, their balances. Fees are charged in the quote
+// asset. It is registered as a matching engine trade listener; the engine
+// lock keeps settlements in trade order once the manager lock is released.
+func (m *Manager) OnTrade(trade types.Trade) {
+	m.store.RecordSettlement(m.settle(trade))
+}
+
+// settle applies a trade under the lock and returns its settlement
+func (m *Manager) settle(trade types.Trade) Settlement {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastPrices[trade.Symbol] = trade.Price
+	settlement := Settlement{TradeID: trade.ID}
+
+	for _, fill := range trade.Fills() {
+		position := m.position(fill.AccountID, fill.Symbol)
+		position.Apply(fill.Side, fill.Quantity, fill.Price, fill.ExecutedAt)
+		m.notifyPosition(position)
+		settlement.Positions = append(settlement.Positions, *position)
+
+		base, quote, ok := types.SplitSymbol(fill.Symbol)
+		if !ok {
+			continue
+		}
+		notional := fill.Price * fill.Quantity
+		baseDelta, quoteDelta := fill.Quantity, -notional-fill.Fee
+		if fill.Side == types.SellOrder {
+			baseDelta, quoteDelta = -fill.Quantity, notional-fill.Fee
+		}
+		settlement.Balances = append(settlement.Balances,
+			m.adjust(fill.AccountID, base, baseDelta, fill.ExecutedAt),
+			m.adjust(fill.AccountID, quote, quoteDelta, fill.ExecutedAt))
+	}
+
+	return settlement
+}
+
+func (m *Manager) adjust(accountID, asset string, delta float64, at time.Time) BalanceDelta {
+	balance := m.balance(accountID, asset)
+	balance.Amount += delta
+	balance.UpdatedAt = at
+	m.notifyBalance(balance)
+	return BalanceDelta{AccountID: accountID, Asset: asset, Delta: delta}
+}
+
+// AddBalanceListener registers a listener for balance changes
+func (m *Manager) AddBalanceListener(listener BalanceListener) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.balanceListeners = append(m.balanceListeners, listener)
+}
+
+// AddPositionListener registers a listener for position changes
+func (m *Manager) AddPositionListener(listener PositionListener) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.positionListeners = append(m.positionListeners, listener)
+}
+
+// notifyBalance reports a balance change; callers hold the lock
+func (m *Manager) notifyBalance(balance *types.Balance) {
+	for _, listener := range m.balanceListeners {
+		listener(m.owner(balance.AccountID), *balance)
+	}
+}
+
+// notifyPosition reports a position change; callers hold the lock
+func (m *Manager) notifyPosition(position *types.Position) {
+	for _, listener := range m.positionListeners {
+		listener(m.owner(position.AccountID), *position)
+	}
+}
+
+// owner returns the user an account belongs to; callers hold the lock. A
+// master account's ID is its user's ID, so that is assumed for accounts
+// not created yet.
+func (m *Manager) owner(accountID string) string {
+	if account, exists := m.accounts[accountID]; exists {
+		return account.UserID
+	}
+	return accountID
+}
+
+func (m *Manager) positionQty(accountID, symbol string) float64 {
+	if position, exists := m.positions[accountID][symbol]; exists {
+		return position.Quantity
+	}
+	return 0
+}
+
+// balance returns the balance entry, creating it; callers hold the lock
+func (m *Manager) balance(accountID, asset string) *types.Balance {
+	assets, exists := m.balances[accountID]
+	if !exists {
+		assets = make(map[string]*types.Balance)
+		m.balances[accountID] = assets
+	}
+	balance, exists := assets[asset]
+	if !exists {
+		balance = &types.Balance{AccountID: accountID, Asset: asset}
+		assets[asset] = balance
+	}
+	return balance
+}
+
+// position returns the position entry, creating it; callers hold the lock
+func (m *Manager) position(accountID, symbol string) *types.Position {
+	symbols, exists := m.positions[accountID]
+	if !exists {
+		symbols = make(map[string]*types.Position)
+		m.positions[accountID] = symbols
+	}
+	position, exists := symbols[symbol]
+	if !exists {
+		position = &types.Position{AccountID: accountID, Symbol: symbol}
+		symbols[symbol] = position
+	}
+	return position
+}
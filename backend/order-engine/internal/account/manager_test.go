@@ -0,0 +1,209 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestCheckOrderBalance(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+	m.SetFeeSchedule(matching.FeeSchedule{MakerRate: 0.001, TakerRate: 0.002})
+	ctx := context.Background()
+
+	if _, err := m.Deposit(ctx, "admin-1", "alice", "USD", 1000); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if _, err := m.Transfer(ctx, "alice", "alice", "alice-sub", "USD", 150); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+
+	// 1 BTC at 100 plus the taker fee fits in 150 USD, 2 BTC do not
+	order := testOrder("alice-sub")
+	if err := m.CheckOrder(order); err != nil {
+		t.Fatalf("covered buy: %v", err)
+	}
+	order.Quantity = 2
+	assertRejected(t, m.CheckOrder(order), types.RejectReasonBalance)
+
+	// A sell needs the base asset
+	sell := testOrder("alice-sub")
+	sell.Side = types.SellOrder
+	assertRejected(t, m.CheckOrder(sell), types.RejectReasonBalance)
+
+	// Master accounts trade on credit
+	order = testOrder("alice")
+	order.Quantity = 100
+	if err := m.CheckOrder(order); err != nil {
+		t.Fatalf("master account buy: %v", err)
+	}
+
+	// Market orders are valued at the last trade price, once there is one
+	market := testOrder("alice-sub")
+	market.Type = types.MarketOrder
+	market.Price = 0
+	assertRejected(t, m.CheckOrder(market), types.RejectReasonBalance)
+	m.OnTrade(types.Trade{ID: "t0", Symbol: "BTC-USD", Price: 120, Quantity: 1,
+		BuyerAccountID: "bob", SellerAccountID: "carol", ExecutedAt: time.Now()})
+	if err := m.CheckOrder(market); err != nil {
+		t.Fatalf("covered market buy: %v", err)
+	}
+}
+
+func TestOpenOrdersHoldBalance(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+	ctx := context.Background()
+
+	if _, err := m.Deposit(ctx, "admin-1", "alice-sub", "USD", 150); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	// A resting buy of 1 at 100 holds 100 USD, leaving 50
+	resting := testOrder("alice-sub")
+	resting.Status = types.OrderStatusNew
+	resting.RemainingQty = 1
+	m.OnOrder(*resting)
+
+	next := testOrder("alice-sub")
+	next.ID = "order-2"
+	assertRejected(t, m.CheckOrder(next), types.RejectReasonBalance)
+	next.Quantity = 0.5
+	if err := m.CheckOrder(next); err != nil {
+		t.Fatalf("order within the rest of the balance: %v", err)
+	}
+
+	// Half of the resting order fills: it holds 50 and the balance is 100
+	resting.Status = types.OrderStatusPartial
+	resting.RemainingQty = 0.5
+	m.OnOrder(*resting)
+	m.OnTrade(types.Trade{ID: "t1", Symbol: "BTC-USD", Price: 100, Quantity: 0.5,
+		BuyOrderID: resting.ID, BuyerAccountID: "alice-sub", BuyerUserID: "alice",
+		SellerAccountID: "bob", SellerUserID: "bob", ExecutedAt: time.Now()})
+	next.Quantity = 0.6
+	assertRejected(t, m.CheckOrder(next), types.RejectReasonBalance)
+
+	// Cancelling releases the rest
+	resting.Status = types.OrderStatusCancelled
+	m.OnOrder(*resting)
+	next.Quantity = 1
+	if err := m.CheckOrder(next); err != nil {
+		t.Fatalf("order after cancel: %v", err)
+	}
+}
+
+func assertRejected(t *testing.T, err error, reason types.RejectReason) {
+	t.Helper()
+	var reject *matching.RejectError
+	if !errors.As(err, &reject) || reject.Reason != reason {
+		t.Fatalf("got %v, want a %s reject", err, reason)
+	}
+}
+
+// balanceOf returns an account's amount of an asset
+func balanceOf(m *Manager, accountID, asset string) float64 {
+	for _, balance := range m.Balances(accountID) {
+		if balance.Asset == asset {
+			return balance.Amount
+		}
+	}
+	return 0
+}
+
+func TestTransfer(t *testing.T) {
+	store := newMemStore(append(testAccounts(),
+		&types.Account{ID: "bob", UserID: "bob", Name: "main", CreatedAt: time.Now()})...)
+	m := newTestManager(t, store)
+	ctx := context.Background()
+
+	if _, err := m.Deposit(ctx, "admin-1", "alice", "USD", 100); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	transfer, err := m.Transfer(ctx, "alice", "alice", "alice-sub", "USD", 40)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if transfer.CreatedBy != "alice" || transfer.Amount != 40 {
+		t.Fatalf("transfer = %+v", transfer)
+	}
+	if balanceOf(m, "alice", "USD") != 60 || balanceOf(m, "alice-sub", "USD") != 40 {
+		t.Fatalf("balances %v and %v, want 60 and 40", m.Balances("alice"), m.Balances("alice-sub"))
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		from, to string
+		amount   float64
+		want     error
+	}{
+		{"more than the balance", "alice", "alice-sub", "alice", 41, ErrInsufficientBalance},
+		{"to the same account", "alice", "alice", "alice", 1, ErrInvalidTransfer},
+		{"nothing", "alice", "alice", "alice-sub", 0, ErrInvalidTransfer},
+		{"to another user", "alice", "alice", "bob", 1, ErrAccountNotFound},
+		{"from another user", "bob", "alice", "bob", 1, ErrAccountNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := m.Transfer(ctx, tt.userID, tt.from, tt.to, "USD", tt.amount); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if balanceOf(m, "alice", "USD") != 60 || balanceOf(m, "alice-sub", "USD") != 40 || balanceOf(m, "bob", "USD") != 0 {
+		t.Fatal("refused transfers moved funds")
+	}
+}
+
+func TestRiskLimits(t *testing.T) {
+	m := newTestManager(t, newMemStore(testAccounts()...))
+	ctx := context.Background()
+
+	if err := m.SetRiskLimits(ctx, "alice-sub", types.RiskLimits{MaxOrderQty: 5}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+	if err := m.SetRiskLimits(ctx, "alice", types.RiskLimits{MaxOrderValue: 1000, MaxPositionQty: 8}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+	if err := m.SetRiskLimits(ctx, "nobody", types.RiskLimits{}); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("limits of an unknown account: got %v, want %v", err, ErrAccountNotFound)
+	}
+
+	// The sub-account's quantity limit binds only the sub-account, and is
+	// checked before its balance
+	order := testOrder("alice")
+	order.Quantity = 6
+	order.Price = 10
+	if err := m.CheckOrder(order); err != nil {
+		t.Fatalf("master order within limits: %v", err)
+	}
+	sub := testOrder("alice-sub")
+	sub.Quantity = 6
+	sub.Price = 10
+	assertRejected(t, m.CheckOrder(sub), types.RejectReasonRiskLimit)
+
+	// The master's order value limit
+	order.Quantity = 2
+	order.Price = 600
+	assertRejected(t, m.CheckOrder(order), types.RejectReasonRiskLimit)
+
+	// The master's position limit counts the whole hierarchy
+	m.OnTrade(types.Trade{ID: "t1", Symbol: "BTC-USD", Price: 10, Quantity: 5,
+		BuyerAccountID: "alice-sub", BuyerUserID: "alice",
+		SellerAccountID: "bob", SellerUserID: "bob", ExecutedAt: time.Now()})
+	order.Price = 10
+	order.Quantity = 3
+	if err := m.CheckOrder(order); err != nil {
+		t.Fatalf("order reaching the position limit: %v", err)
+	}
+	order.Quantity = 4
+	assertRejected(t, m.CheckOrder(order), types.RejectReasonRiskLimit)
+
+	// Selling reduces the position and is allowed
+	order.Side = types.SellOrder
+	if err := m.CheckOrder(order); err != nil {
+		t.Fatalf("reducing order: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+type CreateAccountRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+type TransferRequest struct {
+	FromAccountID string  `json:"from_account_id" binding:"required"`
+	ToAccountID   string  `json:"to_account_id" binding:"required"`
+	Asset         string  `json:"asset" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+}
+
+type DepositRequest struct {
+	Asset  string  `json:"asset" binding:"required"`
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// ListAccounts returns the caller's master account and its sub-accounts
+func (h *Handler) ListAccounts(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+
+	if _, err := h.accounts.ResolveAccount(c.Request.Context(), claims.UserID, ""); err != nil {
+		h.logger.Error("Failed to open master account",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+
+	accounts := make([]types.Account, 0)
+	for _, a := range h.accounts.Accounts(claims.UserID) {
+		if claims.Allows(auth.ScopeAccountsRead, auth.Resource{Account: a.ID}) {
+			accounts = append(accounts, a)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// CreateAccount opens a sub-account under the caller's master account
+func (h *Handler) CreateAccount(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+
+	var req CreateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	acct, err := h.accounts.CreateSubAccount(c.Request.Context(), claims.UserID, req.Name)
+	if err != nil {
+		h.logger.Error("Failed to create sub-account",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+		return
+	}
+
+	h.logger.Info("Sub-account created",
+		zap.String("user_id", claims.UserID),
+		zap.String("account_id", acct.ID))
+	c.JSON(http.StatusCreated, acct)
+}
+
+// GetAccountBalances returns the balances of one of the caller's accounts
+func (h *Handler) GetAccountBalances(c *gin.Context) {
+	acct, ok := h.callerAccount(c, auth.ScopeAccountsRead)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": acct.ID,
+		"balances":   h.accounts.Balances(acct.ID),
+	})
+}
+
+// GetAccountPositions returns the open positions of one of the caller's accounts
+func (h *Handler) GetAccountPositions(c *gin.Context) {
+	acct, ok := h.callerAccount(c, auth.ScopeAccountsRead)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": acct.ID,
+		"positions":  h.accounts.Positions(acct.ID),
+	})
+}
+
+// callerAccount resolves the :id account of the caller and checks that the
+// permission covers it
+func (h *Handler) callerAccount(c *gin.Context, permission string) (types.Account, bool) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return types.Account{}, false
+	}
+
+	acct, err := h.accounts.ResolveAccount(c.Request.Context(), claims.UserID, c.Param("id"))
+	if errors.Is(err, account.ErrAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return types.Account{}, false
+	}
+	if err != nil {
+		h.logger.Error("Failed to resolve account",
+			zap.Error(err),
+			zap.String("account_id", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve account"})
+		return types.Account{}, false
+	}
+
+	if !claims.Allows(permission, auth.Resource{Account: acct.ID}) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": permission})
+		return types.Account{}, false
+	}
+	return acct, true
+}
+
+// CreateTransfer moves funds between two accounts of the caller's hierarchy
+func (h *Handler) CreateTransfer(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, id := range []string{req.FromAccountID, req.ToAccountID} {
+		if !claims.Allows(auth.ScopeAccountsWrite, auth.Resource{Account: id}) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": auth.ScopeAccountsWrite})
+			return
+		}
+	}
+
+	transfer, err := h.accounts.Transfer(c.Request.Context(), claims.UserID,
+		req.FromAccountID, req.ToAccountID, req.Asset, req.Amount)
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, account.ErrInvalidTransfer), errors.Is(err, account.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("Failed to transfer funds",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to transfer funds"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// GetRiskLimits returns the limits set on any account
+func (h *Handler) GetRiskLimits(c *gin.Context) {
+	accountID := c.Param("id")
+	if _, err := h.accounts.GetAccount(accountID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": accountID,
+		"limits":     h.accounts.RiskLimits(accountID),
+	})
+}
+
+// SetRiskLimits replaces the limits of any master or sub-account
+func (h *Handler) SetRiskLimits(c *gin.Context) {
+	accountID := c.Param("id")
+
+	var limits types.RiskLimits
+	if err := c.ShouldBindJSON(&limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limits.MaxOrderQty < 0 || limits.MaxOrderValue < 0 || limits.MaxPositionQty < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limits must not be negative"})
+		return
+	}
+
+	err := h.accounts.SetRiskLimits(c.Request.Context(), accountID, limits)
+	if errors.Is(err, account.ErrAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to set risk limits",
+			zap.Error(err),
+			zap.String("account_id", accountID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set risk limits"})
+		return
+	}
+
+	h.logger.Info("Risk limits updated",
+		zap.String("account_id", accountID),
+		zap.String("admin_id", c.GetString("user_id")))
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": accountID,
+		"limits":     limits,
+	})
+}
+
+// CreateDeposit credits any account from outside the platform
+func (h *Handler) CreateDeposit(c *gin.Context) {
+	accountID := c.Param("id")
+
+	var req DepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := h.accounts.Deposit(c.Request.Context(), c.GetString("user_id"), accountID, req.Asset, req.Amount)
+	if errors.Is(err, account.ErrAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to deposit funds",
+			zap.Error(err),
+			zap.String("account_id", accountID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to deposit funds"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
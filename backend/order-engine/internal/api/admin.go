@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+type AddSymbolRequest struct {
+	Symbol string `json:"symbol" binding:"required"`
+}
+
+// GetAdminMetrics summarizes the state of every order book
+func (h *Handler) GetAdminMetrics(c *gin.Context) {
+	symbols := h.engine.Symbols()
+	books := make([]gin.H, 0, len(symbols))
+
+	for _, symbol := range symbols {
+		snapshot, err := h.engine.GetOrderBook(symbol)
+		if err != nil {
+			continue
+		}
+
+		bidOrders, askOrders := 0, 0
+		for _, level := range snapshot.Bids {
+			bidOrders += level.Orders
+		}
+		for _, level := range snapshot.Asks {
+			askOrders += level.Orders
+		}
+
+		books = append(books, gin.H{
+			"symbol":     symbol,
+			"bid_levels": len(snapshot.Bids),
+			"ask_levels": len(snapshot.Asks),
+			"bid_orders": bidOrders,
+			"ask_orders": askOrders,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbols":     len(symbols),
+		"order_books": books,
+	})
+}
+
+// AddSymbol opens an order book for a new symbol
+func (h *Handler) AddSymbol(c *gin.Context) {
+	var req AddSymbolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok || !claims.Allows(auth.ScopeSymbolsAdmin, auth.Resource{Symbol: req.Symbol}) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": auth.ScopeSymbolsAdmin})
+		return
+	}
+
+	if err := h.engine.AddSymbol(req.Symbol); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("Symbol added", zap.String("symbol", req.Symbol))
+	c.JSON(http.StatusCreated, gin.H{"symbol": req.Symbol})
+}
+
+// RemoveSymbol closes the order book for a symbol with no resting orders
+func (h *Handler) RemoveSymbol(c *gin.Context) {
+	symbol := c.Param("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+
+	if err := h.engine.RemoveSymbol(symbol); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("Symbol removed", zap.String("symbol", symbol))
+	c.JSON(http.StatusOK, gin.H{"message": "symbol removed"})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+type CreateAPIKeyRequest struct {
+	Label      string   `json:"label" binding:"max=64"`
+	Scopes     []string `json:"scopes"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// requireTokenAuth resolves the caller's claims and rejects requests made
+// with an API key, so a leaked key cannot mint further keys
+func (h *Handler) requireTokenAuth(c *gin.Context) (*auth.Claims, bool) {
+	if h.apiKeys == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "api keys are not configured"})
+		return nil, false
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return nil, false
+	}
+	if claims.APIKeyID != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "api keys cannot manage api keys"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// CreateAPIKey issues a key for the caller. The secret is only returned here.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	claims, ok := h.requireTokenAuth(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := h.apiKeys.Create(c.Request.Context(), claims, req.Label, req.Scopes, req.AllowedIPs)
+	if err != nil {
+		h.logger.Warn("Failed to create api key",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("API key created",
+		zap.String("user_id", claims.UserID),
+		zap.String("key_id", key.ID))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"secret":  secret,
+	})
+}
+
+// ListAPIKeys returns the caller's keys without secrets
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	claims, ok := h.requireTokenAuth(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeys.List(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.logger.Error("Failed to list api keys",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list api keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey disables one of the caller's keys
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	claims, ok := h.requireTokenAuth(c)
+	if !ok {
+		return
+	}
+
+	err := h.apiKeys.Revoke(c.Request.Context(), claims.UserID, c.Param("id"))
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke api key",
+			zap.Error(err),
+			zap.String("key_id", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
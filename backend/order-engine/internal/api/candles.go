@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/marketdata"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// GetCandles returns up to limit bars of a symbol that open in [from, to),
+// oldest first, including the live bar. tf defaults to 1m; without from
+// the latest bars before to are returned.
+func (h *Handler) GetCandles(c *gin.Context) {
+	symbol := c.Param("symbol")
+
+	tf := types.TimeFrame1m
+	if raw := c.Query("tf"); raw != "" {
+		var err error
+		if tf, err = types.ParseTimeFrame(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from.IsZero() {
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+		from = tf.Start(end.Add(-time.Duration(limit-1) * tf.Duration()))
+	}
+
+	stored, err := h.store.ListCandles(c.Request.Context(), store.CandleFilter{
+		Symbol:    symbol,
+		TimeFrame: tf,
+		From:      from,
+		To:        to,
+		Limit:     limit,
+	})
+	if err != nil {
+		h.logger.Error("Failed to list candles",
+			zap.Error(err),
+			zap.String("symbol", symbol),
+			zap.String("time_frame", string(tf)))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list candles"})
+		return
+	}
+
+	candles := marketdata.MergeCandles(stored, h.candles.Recent(symbol, tf, from, to))
+	if len(candles) > limit {
+		candles = candles[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":     symbol,
+		"time_frame": tf,
+		"candles":    candles,
+	})
+}
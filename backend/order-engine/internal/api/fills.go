@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// ListFills returns the caller's executions, newest first, with the side,
+// liquidity flag and fee of each. Fills on symbols or accounts the caller's
+// scopes do not cover are left out.
+func (h *Handler) ListFills(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+	userID := claims.UserID
+
+	filter := store.FillFilter{
+		UserID:    userID,
+		AccountID: c.Query("account_id"),
+		Symbol:    c.Query("symbol"),
+	}
+
+	var err error
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Cursor, err = parseCursor(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Limit = limit + 1
+
+	// Pages are read until enough fills are allowed, so a page is only
+	// short when there are no more
+	fills := make([]*types.Fill, 0, filter.Limit)
+	for len(fills) < filter.Limit {
+		page, err := h.store.ListFills(c.Request.Context(), filter)
+		if err != nil {
+			h.logger.Error("Failed to list fills",
+				zap.Error(err),
+				zap.String("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list fills"})
+			return
+		}
+		for _, fill := range page {
+			if claims.Allows(auth.ScopeOrdersRead, auth.Resource{Symbol: fill.Symbol, Account: fill.AccountID}) {
+				fills = append(fills, fill)
+			}
+		}
+		if len(page) < filter.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		filter.Cursor = &store.Cursor{Time: last.ExecutedAt, ID: last.ID}
+	}
+
+	response := gin.H{}
+	if len(fills) > limit {
+		fills = fills[:limit]
+		last := fills[len(fills)-1]
+		response["next_cursor"] = store.Cursor{Time: last.ExecutedAt, ID: last.ID}.Encode()
+	}
+	response["fills"] = fills
+
+	c.JSON(http.StatusOK, response)
+}
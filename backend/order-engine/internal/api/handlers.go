@@ -1,89 +1,143 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/marketdata"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
 )
 
 type Handler struct {
-	engine *matching.MatchingEngine
-	logger *zap.Logger
+	engine   *matching.MatchingEngine
+	store    *store.PostgresStore
+	hub      *ws.Hub
+	jwt      *auth.JWTService
+	apiKeys  *auth.APIKeyService
+	accounts *account.Manager
+	tickers  *marketdata.Tickers
+	candles  *marketdata.Candles
+	logger   *zap.Logger
+
+	disconnectors []func(userID, reason string) int
 }
 
-func NewHandler(engine *matching.MatchingEngine, logger *zap.Logger) *Handler {
+func NewHandler(engine *matching.MatchingEngine, pgStore *store.PostgresStore, hub *ws.Hub, jwtService *auth.JWTService, apiKeys *auth.APIKeyService, accounts *account.Manager, tickers *marketdata.Tickers, candles *marketdata.Candles, logger *zap.Logger) *Handler {
 	return &Handler{
-		engine: engine,
-		logger: logger,
+		engine:   engine,
+		store:    pgStore,
+		hub:      hub,
+		jwt:      jwtService,
+		apiKeys:  apiKeys,
+		accounts: accounts,
+		tickers:  tickers,
+		candles:  candles,
+		logger:   logger,
 	}
 }
 
-func RegisterRoutes(r *gin.Engine, engine *matching.MatchingEngine, logger *zap.Logger) {
-	h := NewHandler(engine, logger)
-
-	// API v1 group
-	v1 := r.Group("/api/v1")
-	{
-		// Order endpoints
-		v1.POST("/orders", h.CreateOrder)
-		v1.GET("/orders/:id", h.GetOrder)
-		v1.DELETE("/orders/:id", h.CancelOrder)
-		v1.GET("/orders", h.ListOrders)
+// AddDisconnector registers a function closing a user's connections other
+// than the hub's WebSocket connections, such as FIX sessions or gRPC
+// streams. It returns how many it closed.
+func (h *Handler) AddDisconnector(disconnect func(userID, reason string) int) {
+	h.disconnectors = append(h.disconnectors, disconnect)
+}
 
-		// Order book endpoints
-		v1.GET("/orderbook/:symbol", h.GetOrderBook)
-		v1.GET("/orderbook/:symbol/depth", h.GetOrderBookDepth)
+// disconnectUser closes every live connection of the user
+func (h *Handler) disconnectUser(userID, reason string) int {
+	disconnected := h.hub.DisconnectUser(userID, reason)
+	for _, disconnect := range h.disconnectors {
+		disconnected += disconnect(userID, reason)
 	}
+	return disconnected
 }
 
+// CreateOrderRequest carries no user ID; the owner is the authenticated
+// caller. AccountID selects one of the caller's sub-accounts and defaults
+// to the master account.
 type CreateOrderRequest struct {
-	UserID     string          `json:"user_id" binding:"required"`
-	Symbol     string          `json:"symbol" binding:"required"`
-	Type       types.OrderType `json:"type" binding:"required"`
-	Side       types.OrderSide `json:"side" binding:"required"`
-	Price      float64         `json:"price"`
-	Quantity   float64         `json:"quantity" binding:"required,gt=0"`
-	StopPrice  float64         `json:"stop_price,omitempty"`
+	ClientOrderID string          `json:"client_order_id"`
+	AccountID     string          `json:"account_id"`
+	Symbol        string          `json:"symbol"`
+	Type          types.OrderType `json:"type"`
+	Side          types.OrderSide `json:"side"`
+	Price         float64         `json:"price"`
+	Quantity      float64         `json:"quantity"`
+	StopPrice     float64         `json:"stop_price,omitempty"`
 }
 
 func (h *Handler) CreateOrder(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+
 	var req CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate order type and price
-	if req.Type == types.LimitOrder && req.Price <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "limit orders require a valid price"})
+	order := &types.Order{
+		ID:            uuid.New().String(),
+		ClientOrderID: req.ClientOrderID,
+		UserID:        claims.UserID,
+		Symbol:        req.Symbol,
+		Type:          req.Type,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		StopPrice:     req.StopPrice,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := order.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if req.Type == types.StopOrder && req.StopPrice <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "stop orders require a valid stop price"})
+	acct, err := h.accounts.ResolveAccount(c.Request.Context(), claims.UserID, req.AccountID)
+	if errors.Is(err, account.ErrAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to resolve account",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve account"})
 		return
 	}
 
-	order := &types.Order{
-		ID:          uuid.New().String(),
-		UserID:      req.UserID,
-		Symbol:      req.Symbol,
-		Type:        req.Type,
-		Side:        req.Side,
-		Price:       req.Price,
-		Quantity:    req.Quantity,
-		StopPrice:   req.StopPrice,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if !claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: req.Symbol, Account: acct.ID}) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": auth.ScopeOrdersWrite})
+		return
 	}
 
+	order.AccountID = acct.ID
+
 	trades, err := h.engine.ProcessOrder(order)
+
+	if err != nil && order.Status == types.OrderStatusRejected {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+			"order": order,
+			"fills": types.OrderFills(order.ID, trades),
+		})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to process order",
 			zap.Error(err),
@@ -94,8 +148,8 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"order":  order,
-		"trades": trades,
+		"order": order,
+		"fills": types.OrderFills(order.ID, trades),
 	})
 }
 
@@ -111,13 +165,38 @@ func (h *Handler) GetOrder(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
 }
 
+// CancelOrder cancels one of the caller's resting orders. Cancelling
+// another user's order requires the orders:cancel:any scope.
 func (h *Handler) CancelOrder(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+
 	orderID := c.Param("id")
 	if orderID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "order ID is required"})
 		return
 	}
 
+	order, err := h.engine.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	resource := auth.Resource{Symbol: order.Symbol, Account: order.AccountID}
+	permission := auth.ScopeOrdersWrite
+	if order.UserID != claims.UserID {
+		permission = auth.ScopeOrdersCancelAny
+	}
+	if !claims.Allows(permission, resource) {
+		// Do not reveal that another user's order exists
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
 	if err := h.engine.CancelOrder(orderID); err != nil {
 		h.logger.Error("Failed to cancel order",
 			zap.Error(err),
@@ -129,10 +208,108 @@ func (h *Handler) CancelOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "order cancelled"})
 }
 
+// closedOrderStatuses are the terminal states; orders in them have left the
+// live engine and are only available from storage
+var closedOrderStatuses = []types.OrderStatus{
+	types.OrderStatusFilled,
+	types.OrderStatusCancelled,
+	types.OrderStatusRejected,
+}
+
+// ListOrders returns the caller's order blotter, newest first. Open orders
+// come from the live engine and closed orders from storage. Orders on
+// symbols or accounts the caller's scopes do not cover are left out.
 func (h *Handler) ListOrders(c *gin.Context) {
-	// Note: This is a simplified version. In a real implementation,
-	// you would need to query orders from a persistent storage with pagination.
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+		return
+	}
+	userID := claims.UserID
+	allowed := func(order *types.Order) bool {
+		return claims.Allows(auth.ScopeOrdersRead, auth.Resource{Symbol: order.Symbol, Account: order.AccountID})
+	}
+
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.UserID = userID
+
+	orders := make([]*types.Order, 0, filter.Limit+1)
+	seen := make(map[string]bool)
+
+	for _, order := range h.engine.GetOrdersByUser(userID) {
+		order := order
+		if filter.Matches(&order) && allowed(&order) {
+			orders = append(orders, &order)
+			seen[order.ID] = true
+		}
+	}
+
+	storeFilter := filter
+	storeFilter.Statuses = intersectStatuses(filter.Statuses, closedOrderStatuses)
+	storeFilter.Limit = filter.Limit + 1
+	// Pages of stored orders are read until enough of them are allowed, so
+	// a page is only short when there are no more
+	for found := 0; len(storeFilter.Statuses) > 0 && found <= filter.Limit; {
+		stored, err := h.store.ListOrders(c.Request.Context(), storeFilter)
+		if err != nil {
+			h.logger.Error("Failed to list orders",
+				zap.Error(err),
+				zap.String("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list orders"})
+			return
+		}
+		for _, order := range stored {
+			if !seen[order.ID] && allowed(order) {
+				orders = append(orders, order)
+				found++
+			}
+		}
+		if len(stored) < storeFilter.Limit {
+			break
+		}
+		last := stored[len(stored)-1]
+		storeFilter.Cursor = &store.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].ID > orders[j].ID
+		}
+		return orders[i].CreatedAt.After(orders[j].CreatedAt)
+	})
+
+	response := gin.H{}
+	if len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+		last := orders[len(orders)-1]
+		response["next_cursor"] = store.Cursor{Time: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	response["orders"] = orders
+
+	c.JSON(http.StatusOK, response)
+}
+
+// intersectStatuses narrows the allowed statuses to those requested, or
+// returns all allowed statuses when none were requested
+func intersectStatuses(requested, allowed []types.OrderStatus) []types.OrderStatus {
+	if len(requested) == 0 {
+		return allowed
+	}
+
+	result := make([]types.OrderStatus, 0, len(requested))
+	for _, status := range requested {
+		for _, a := range allowed {
+			if status == a {
+				result = append(result, status)
+				break
+			}
+		}
+	}
+	return result
 }
 
 func (h *Handler) GetOrderBook(c *gin.Context) {
@@ -182,10 +359,34 @@ func (h *Handler) GetOrderBookDepth(c *gin.Context) {
 		asks = asks[:depthLevels]
 	}
 
+	// The checksum covers the top orderbook.ChecksumDepth levels
 	c.JSON(http.StatusOK, gin.H{
 		"symbol":    symbol,
+		"sequence":  snapshot.Sequence,
+		"checksum":  snapshot.Checksum,
 		"timestamp": snapshot.Timestamp,
 		"bids":      bids,
 		"asks":      asks,
 	})
-} 
\ No newline at end of file
+}
+
+// GetOrderBookL3 returns every resting order of a book. Its sequence is
+// shared with the L2 and L3 WebSocket feeds.
+func (h *Handler) GetOrderBookL3(c *gin.Context) {
+	symbol := c.Param("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+
+	snapshot, err := h.engine.GetOrderBookL3(symbol)
+	if err != nil {
+		h.logger.Error("Failed to get L3 order book",
+			zap.Error(err),
+			zap.String("symbol", symbol))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
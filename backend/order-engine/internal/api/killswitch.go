@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+)
+
+// killSwitchCloseReason is sent in the close frame of disconnected sessions
+const killSwitchCloseReason = "account disabled by kill switch"
+
+type EngageKillSwitchRequest struct {
+	Reason     string `json:"reason" binding:"required,max=256"`
+	Disconnect bool   `json:"disconnect"`
+}
+
+type ReleaseKillSwitchRequest struct {
+	Reason string `json:"reason" binding:"max=256"`
+}
+
+// EngageKillSwitch blocks new orders for an account and its sub-accounts,
+// cancels all of their resting orders and optionally disconnects the
+// owner's WebSocket sessions
+func (h *Handler) EngageKillSwitch(c *gin.Context) {
+	accountID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req EngageKillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ks, covered, err := h.accounts.EngageKillSwitch(c.Request.Context(), accountID, adminID, req.Reason)
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, account.ErrKillSwitchActive), errors.Is(err, account.ErrKillSwitchPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("Failed to engage kill switch",
+			zap.Error(err),
+			zap.String("account_id", accountID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to engage kill switch"})
+		return
+	}
+
+	cancelled, err := h.engine.CancelAccountOrders(covered)
+	if err != nil {
+		// The account is blocked; report the partial cancel so it can be retried
+		h.logger.Error("Failed to cancel orders for kill switch",
+			zap.Error(err),
+			zap.String("account_id", accountID),
+			zap.Int("cancelled", len(cancelled)))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":            "kill switch engaged but not all orders were cancelled",
+			"kill_switch":      ks,
+			"cancelled_orders": len(cancelled),
+		})
+		return
+	}
+
+	disconnected := 0
+	if req.Disconnect {
+		acct, _ := h.accounts.GetAccount(accountID)
+		disconnected = h.disconnectUser(acct.UserID, killSwitchCloseReason)
+	}
+
+	h.logger.Warn("Kill switch engaged",
+		zap.String("account_id", accountID),
+		zap.String("admin_id", adminID),
+		zap.String("reason", req.Reason),
+		zap.Int("cancelled_orders", len(cancelled)),
+		zap.Int("disconnected_sessions", disconnected))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"kill_switch":           ks,
+		"cancelled_orders":      len(cancelled),
+		"disconnected_sessions": disconnected,
+	})
+}
+
+// ReleaseKillSwitch unblocks an account. It must be released by a
+// different admin from the one who engaged it.
+func (h *Handler) ReleaseKillSwitch(c *gin.Context) {
+	accountID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req ReleaseKillSwitchRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := h.accounts.ReleaseKillSwitch(c.Request.Context(), accountID, adminID, req.Reason)
+	switch {
+	case errors.Is(err, account.ErrKillSwitchNotActive):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, account.ErrSameAdmin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, account.ErrKillSwitchPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("Failed to release kill switch",
+			zap.Error(err),
+			zap.String("account_id", accountID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to release kill switch"})
+		return
+	}
+
+	h.logger.Warn("Kill switch released",
+		zap.String("account_id", accountID),
+		zap.String("admin_id", adminID),
+		zap.String("reason", req.Reason))
+
+	c.JSON(http.StatusOK, gin.H{"message": "kill switch released"})
+}
+
+// GetKillSwitch reports whether a kill switch is engaged on the account
+func (h *Handler) GetKillSwitch(c *gin.Context) {
+	accountID := c.Param("id")
+	if _, err := h.accounts.GetAccount(accountID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ks, active := h.accounts.KillSwitch(accountID)
+	response := gin.H{
+		"account_id": accountID,
+		"engaged":    active,
+	}
+	if active {
+		response["kill_switch"] = ks
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListAuditEvents returns the administrative actions taken on an account
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	accountID := c.Param("id")
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := h.store.ListAuditEvents(c.Request.Context(), accountID, limit)
+	if err != nil {
+		h.logger.Error("Failed to list audit events",
+			zap.Error(err),
+			zap.String("account_id", accountID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
@@ -1,39 +1,128 @@
 package api
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/metrics"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
 )
 
-// AuthMiddleware handles authentication for protected routes
-func AuthMiddleware(logger *zap.Logger) gin.HandlerFunc {
+// maxSignedBodySize bounds the body read to verify an API key signature
+const maxSignedBodySize = 1 << 20
+
+// AuthMiddleware authenticates the request with either a bearer token or
+// an API key signature, and stores the resulting claims in the context for
+// downstream handlers and role checks. apiKeys may be nil to disable API keys.
+func AuthMiddleware(jwtService *auth.JWTService, apiKeys *auth.APIKeyService, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+		var (
+			claims *auth.Claims
+			err    error
+		)
+
+		if keyID := c.GetHeader("X-API-Key"); keyID != "" {
+			if apiKeys == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "api key authentication is disabled"})
+				c.Abort()
+				return
+			}
+			claims, err = authenticateAPIKey(c, apiKeys, keyID)
+		} else {
+			header := c.GetHeader("Authorization")
+			if header == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+				c.Abort()
+				return
+			}
+
+			token, ok := BearerToken(header)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header must use the Bearer scheme"})
+				c.Abort()
+				return
+			}
+
+			claims, err = jwtService.ValidateToken(c.Request.Context(), token)
+		}
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
 			c.Abort()
 			return
 		}
-
-		// TODO: Implement proper token validation
-		// This is a placeholder for actual JWT validation
-		if !isValidToken(token) {
-			logger.Warn("Invalid auth token", zap.String("token", token))
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		if errors.Is(err, auth.ErrRevocationCheck) {
+			logger.Error("Failed to check token revocation", zap.Error(err))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authentication temporarily unavailable"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			// The reason is only logged, so callers cannot probe which
+			// check a token or signature failed
+			logger.Warn("Authentication failed",
+				zap.Error(err),
+				zap.String("ip", c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
 		}
 
 		// Add user info to context for downstream handlers
-		// TODO: Extract actual user info from token
-		c.Set("user_id", "test_user")
+		c.Set("claims", claims)
+		c.Set("user_id", claims.UserID)
 		c.Next()
 	}
 }
 
+// authenticateAPIKey verifies the signature headers over the request and
+// restores the body for the handler. Bodies over maxSignedBodySize fail
+// with an *http.MaxBytesError.
+func authenticateAPIKey(c *gin.Context, apiKeys *auth.APIKeyService, keyID string) (*auth.Claims, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, auth.ErrInvalidSignature
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	return apiKeys.Authenticate(c.Request.Context(), auth.SignedRequest{
+		KeyID:      keyID,
+		Timestamp:  c.GetHeader("X-API-Timestamp"),
+		RecvWindow: c.GetHeader("X-API-Recv-Window"),
+		Signature:  c.GetHeader("X-API-Signature"),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.RequestURI(),
+		Body:       body,
+		ClientIP:   c.ClientIP(),
+	})
+}
+
+// BearerToken extracts the token from an Authorization header value
+func BearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
 // LoggerMiddleware logs request details
 func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -70,16 +159,129 @@ func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-// RateLimiterMiddleware implements a simple rate limiter
-func RateLimiterMiddleware() gin.HandlerFunc {
-	// TODO: Implement proper rate limiting using a token bucket or similar algorithm
+// MetricsMiddleware records request latency and counts per route
+func MetricsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
+
 		c.Next()
+
+		handler := c.FullPath()
+		if handler == "" {
+			handler = "unmatched"
+		}
+		metrics.RecordHTTPRequest(handler, c.Request.Method,
+			strconv.Itoa(c.Writer.Status()), time.Since(start).Seconds())
+	}
+}
+
+// rateLimitBucket is one token bucket a request is charged against
+type rateLimitBucket struct {
+	scope string
+	key   string
+	limit ratelimit.Limit
+}
+
+// rateLimitResultKey holds the most depleted bucket charged so far, so the
+// headers reflect every stage
+const rateLimitResultKey = "rate_limit_result"
+
+// RateLimiter charges requests against token buckets for the client IP
+// and, once authenticated, for the user and the API key used. The cost of
+// a request is its endpoint weight. It sets RateLimit-* headers from the
+// most depleted bucket and answers 429 with Retry-After when any bucket is
+// empty. If the limiter fails the request is let through.
+type RateLimiter struct {
+	limiter ratelimit.Limiter
+	policy  *ratelimit.Policy
+	logger  *zap.Logger
+}
+
+func NewRateLimiter(limiter ratelimit.Limiter, policy *ratelimit.Policy, logger *zap.Logger) *RateLimiter {
+	return &RateLimiter{
+		limiter: limiter,
+		policy:  policy,
+		logger:  logger,
+	}
+}
+
+// ByIP charges the client IP bucket. It goes before AuthMiddleware so
+// requests with bad credentials are limited as well.
+func (r *RateLimiter) ByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.charge(c, []rateLimitBucket{{scope: "ip", key: "ip:" + c.ClientIP(), limit: r.policy.IP}})
+	}
+}
+
+// ByPrincipal charges the user and API key buckets of an authenticated
+// request. It goes after AuthMiddleware.
+func (r *RateLimiter) ByPrincipal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := claimsFromContext(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		limit := r.policy.LimitFor(claims.AllRoles())
+		buckets := []rateLimitBucket{{scope: "user", key: "user:" + claims.UserID, limit: limit}}
+		if claims.APIKeyID != "" {
+			buckets = append(buckets, rateLimitBucket{scope: "api_key", key: "key:" + claims.APIKeyID, limit: limit})
+		}
+		r.charge(c, buckets)
+	}
+}
+
+func (r *RateLimiter) charge(c *gin.Context, buckets []rateLimitBucket) {
+	cost := r.policy.Weight(c.Request.Method, c.FullPath())
+
+	var tightest *ratelimit.Result
+	if value, ok := c.Get(rateLimitResultKey); ok {
+		tightest = value.(*ratelimit.Result)
+	}
+	for _, b := range buckets {
+		if b.limit.Unlimited() {
+			continue
+		}
+
+		result, err := r.limiter.Allow(c.Request.Context(), b.key, b.limit, cost)
+		if err != nil {
+			r.logger.Error("Rate limiter unavailable", zap.Error(err), zap.String("scope", b.scope))
+			continue
+		}
+
+		if !result.Allowed {
+			metrics.RecordRateLimited(b.scope)
+			setRateLimitHeaders(c, result)
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate limit exceeded",
+				"scope":       b.scope,
+				"retry_after": result.RetryAfter.Seconds(),
+			})
+			c.Abort()
+			return
+		}
+
+		if tightest == nil || result.Remaining/result.Limit < tightest.Remaining/tightest.Limit {
+			result := result
+			tightest = &result
+		}
+	}
+
+	if tightest != nil {
+		c.Set(rateLimitResultKey, tightest)
+		setRateLimitHeaders(c, *tightest)
 	}
+	c.Next()
+}
+
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.FormatFloat(result.Limit, 'f', -1, 64))
+	c.Header("RateLimit-Remaining", strconv.FormatFloat(math.Floor(result.Remaining), 'f', -1, 64))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
 }
 
-// isValidToken is a placeholder for proper token validation
-func isValidToken(token string) bool {
-	// TODO: Implement proper token validation
-	return token != ""
-} 
\ No newline at end of file
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
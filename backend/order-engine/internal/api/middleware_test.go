@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+func newAuthRouter(jwtService *auth.JWTService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Any("/ping", AuthMiddleware(jwtService, nil, zap.NewNop()),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestAuthMiddlewareHidesFailureReason(t *testing.T) {
+	jwtService := auth.NewJWTService("secret", "test")
+	router := newAuthRouter(jwtService)
+
+	expired, _ := jwtService.GenerateToken("alice", auth.RoleTrader, -time.Minute)
+	foreign, _ := auth.NewJWTService("secret", "other").GenerateToken("alice", auth.RoleTrader, time.Minute)
+	for name, token := range map[string]string{"garbage": "not-a-token", "expired": expired, "other issuer": foreign} {
+		w := get(router, token)
+		if w.Code != http.StatusUnauthorized || strings.TrimSpace(w.Body.String()) != `{"error":"unauthorized"}` {
+			t.Fatalf("%s: status %d, body %s, want 401 unauthorized", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAuthMiddlewareAcceptsValidToken(t *testing.T) {
+	jwtService := auth.NewJWTService("secret", "test")
+	token, _ := jwtService.GenerateToken("alice", auth.RoleTrader, time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	newAuthRouter(jwtService).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+}
+
+func TestAuthMiddlewareRefusesLargeSignedBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Any("/ping", AuthMiddleware(auth.NewJWTService("secret", "test"), &auth.APIKeyService{}, zap.NewNop()),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	body := strings.NewReader(strings.Repeat("x", maxSignedBodySize+1))
+	req := httptest.NewRequest(http.MethodPost, "/ping", body)
+	req.Header.Set("X-API-Key", "key-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+)
+
+// parseLimit reads the page size from the limit query parameter
+func parseLimit(c *gin.Context) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
+// parseTime accepts either an RFC 3339 timestamp or Unix milliseconds
+func parseTime(c *gin.Context, key string) (time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or Unix milliseconds", key)
+	}
+	return t, nil
+}
+
+// parseTimeRange reads the from/to query parameters
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseTime(c, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to, err := parseTime(c, "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseCursor reads the opaque pagination cursor, if any
+func parseCursor(c *gin.Context) (*store.Cursor, error) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	return store.DecodeCursor(raw)
+}
+
+// parseOrderFilter builds an order filter from the query string. The user
+// is never taken from the query; callers set it from the authenticated identity.
+func parseOrderFilter(c *gin.Context) (store.OrderFilter, error) {
+	var filter store.OrderFilter
+	var err error
+
+	filter.AccountID = c.Query("account_id")
+	filter.Symbol = c.Query("symbol")
+
+	if side := strings.ToUpper(c.Query("side")); side != "" {
+		filter.Side = types.OrderSide(side)
+		if filter.Side != types.BuyOrder && filter.Side != types.SellOrder {
+			return filter, fmt.Errorf("invalid side %q", side)
+		}
+	}
+
+	if orderType := strings.ToUpper(c.Query("type")); orderType != "" {
+		filter.Type = types.OrderType(orderType)
+		switch filter.Type {
+		case types.LimitOrder, types.MarketOrder, types.StopOrder:
+		default:
+			return filter, fmt.Errorf("invalid type %q", orderType)
+		}
+	}
+
+	if raw := c.Query("status"); raw != "" {
+		for _, s := range strings.Split(raw, ",") {
+			status := types.OrderStatus(strings.ToUpper(strings.TrimSpace(s)))
+			switch status {
+			case types.OrderStatusNew, types.OrderStatusPartial, types.OrderStatusFilled,
+				types.OrderStatusCancelled, types.OrderStatusRejected:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return filter, fmt.Errorf("invalid status %q", s)
+			}
+		}
+	}
+
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return filter, err
+	}
+
+	if filter.Cursor, err = parseCursor(c); err != nil {
+		return filter, err
+	}
+
+	if filter.Limit, err = parseLimit(c); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+)
+
+// newRateLimitedRouter serves /ping behind the IP limit, authentication
+// and the principal limits, in the order the server uses
+func newRateLimitedRouter(jwtService *auth.JWTService, policy *ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(ratelimit.NewMemoryLimiter(), policy, zap.NewNop())
+
+	router := gin.New()
+	router.GET("/ping",
+		limiter.ByIP(),
+		AuthMiddleware(jwtService, nil, zap.NewNop()),
+		limiter.ByPrincipal(),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func get(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitAppliesBeforeAuthentication(t *testing.T) {
+	router := newRateLimitedRouter(auth.NewJWTService("secret", "test"), &ratelimit.Policy{
+		IP: ratelimit.Limit{Rate: 1, Burst: 2},
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := get(router, "not-a-token"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: status %d, want 401", i+1, w.Code)
+		}
+	}
+	w := get(router, "not-a-token")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("status %d, retry after %q, want 429 after the IP burst", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitChargesUserAfterAuthentication(t *testing.T) {
+	jwtService := auth.NewJWTService("secret", "test")
+	router := newRateLimitedRouter(jwtService, &ratelimit.Policy{
+		IP:      ratelimit.Limit{Rate: 1, Burst: 10},
+		Default: ratelimit.Limit{Rate: 1, Burst: 1},
+	})
+
+	token, err := jwtService.GenerateToken("alice", auth.RoleTrader, time.Minute)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	w := get(router, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	// The headers report the user bucket, the more depleted of the two
+	if remaining := w.Header().Get("RateLimit-Remaining"); remaining != "0" {
+		t.Fatalf("remaining %q, want the user bucket's 0", remaining)
+	}
+
+	if w := get(router, token); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429 once the user bucket is empty", w.Code)
+	}
+}
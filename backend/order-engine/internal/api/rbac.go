@@ -62,6 +62,70 @@ func RequireAnyRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
+// RequireScope middleware ensures the user has been granted the permission.
+// On routes with a :symbol parameter, symbol-limited scopes must cover it.
+// Account qualifiers are checked by the handlers once they know the
+// account; listings leave out what the qualifiers do not cover.
+func RequireScope(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := c.Get("claims")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+			c.Abort()
+			return
+		}
+
+		userClaims, ok := claims.(*auth.Claims)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid claims type"})
+			c.Abort()
+			return
+		}
+
+		if !userClaims.Allows(permission, auth.Resource{Symbol: c.Param("symbol")}) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAnyScope middleware ensures the user has any of the permissions.
+// Qualifiers are checked as in RequireScope.
+func RequireAnyScope(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userClaims, ok := claimsFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authentication"})
+			c.Abort()
+			return
+		}
+
+		resource := auth.Resource{Symbol: c.Param("symbol")}
+		for _, permission := range permissions {
+			if userClaims.Allows(permission, resource) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scopes": permissions})
+		c.Abort()
+	}
+}
+
+// claimsFromContext returns the claims stored by AuthMiddleware
+func claimsFromContext(c *gin.Context) (*auth.Claims, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	userClaims, ok := claims.(*auth.Claims)
+	return userClaims, ok
+}
+
 // RequireAdmin middleware ensures the user is an admin
 func RequireAdmin() gin.HandlerFunc {
 	return RequireRole(auth.RoleAdmin)
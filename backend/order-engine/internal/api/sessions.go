@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// CreateSession exchanges the bearer token the request was authenticated
+// with, typically issued by the auth service at login, for an access and
+// refresh token pair. The presented token is revoked.
+func (h *Handler) CreateSession(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	pair, err := h.jwt.StartSession(c.Request.Context(), claims)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, pair)
+	case errors.Is(err, auth.ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sessions are started from a login token outside any session"})
+	case errors.Is(err, auth.ErrSigningDisabled), errors.Is(err, auth.ErrTokenStoreMissing):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "sessions are not available"})
+	default:
+		h.logger.Error("Failed to start session",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start session"})
+	}
+}
+
+// RefreshToken rotates a refresh token into a new access/refresh pair
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := h.jwt.RefreshTokens(c.Request.Context(), req.RefreshToken)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, pair)
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrExpiredToken), errors.Is(err, auth.ErrRevokedToken):
+		h.logger.Warn("Refresh token rejected",
+			zap.Error(err),
+			zap.String("ip", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error("Failed to refresh token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+	}
+}
+
+// ListSessions returns the caller's active sessions
+func (h *Handler) ListSessions(c *gin.Context) {
+	h.listSessions(c, c.GetString("user_id"))
+}
+
+// RevokeSession revokes one of the caller's own sessions
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	session, err := h.jwt.GetSession(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, auth.ErrSessionNotFound) || (err == nil && session.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	if err := h.jwt.RevokeSession(c.Request.Context(), session); err != nil {
+		h.logger.Error("Failed to revoke session",
+			zap.Error(err),
+			zap.String("session_id", session.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// ListUserSessions lets an admin inspect another user's sessions
+func (h *Handler) ListUserSessions(c *gin.Context) {
+	h.listSessions(c, c.Param("id"))
+}
+
+// revokedCloseReason is sent to the connections closed on revocation
+const revokedCloseReason = "credentials revoked"
+
+// RevokeUserSessions lets an admin revoke every token and API key issued
+// to a user, e.g. when the account is compromised, and closes the user's
+// live connections, which were only authenticated when they opened
+func (h *Handler) RevokeUserSessions(c *gin.Context) {
+	userID := c.Param("id")
+
+	count, err := h.jwt.RevokeAllForUser(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to revoke user sessions",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+
+	keys := 0
+	if h.apiKeys != nil {
+		if keys, err = h.apiKeys.RevokeAllForUser(c.Request.Context(), userID); err != nil {
+			// Tokens are revoked and the keys are refused by the user's
+			// revocation cutoff until it expires; report so it is retried
+			h.logger.Error("Failed to revoke user api keys",
+				zap.Error(err),
+				zap.String("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "tokens revoked but not all api keys were revoked"})
+			return
+		}
+	}
+
+	disconnected := h.disconnectUser(userID, revokedCloseReason)
+
+	h.logger.Warn("Revoked all tokens for user",
+		zap.String("user_id", userID),
+		zap.String("admin_id", c.GetString("user_id")),
+		zap.Int("sessions", count),
+		zap.Int("api_keys", keys),
+		zap.Int("disconnected", disconnected))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "all tokens revoked",
+		"revoked_sessions":      count,
+		"revoked_api_keys":      keys,
+		"disconnected_sessions": disconnected,
+	})
+}
+
+func (h *Handler) listSessions(c *gin.Context, userID string) {
+	sessions, err := h.jwt.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to list sessions",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTicker returns a symbol's 24 hour statistics and best prices
+func (h *Handler) GetTicker(c *gin.Context) {
+	ticker, err := h.tickers.Get(c.Param("symbol"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ticker)
+}
+
+// ListTickers returns the ticker of every symbol with trades or book
+// activity since startup or in the last 24 hours, ordered by symbol
+func (h *Handler) ListTickers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"tickers": h.tickers.All()})
+}
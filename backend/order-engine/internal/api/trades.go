@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// exportFlushInterval is the number of rows written between flushes while
+// streaming an export
+const exportFlushInterval = 1000
+
+// exportWriteTimeout is how long each flushed chunk of an export may take
+const exportWriteTimeout = 30 * time.Second
+
+// MarketTrade is the public view of a trade, without order or user IDs
+type MarketTrade struct {
+	ID         string    `json:"id"`
+	Symbol     string    `json:"symbol"`
+	Price      float64   `json:"price"`
+	Quantity   float64   `json:"quantity"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+func newMarketTrade(trade *types.Trade) MarketTrade {
+	return MarketTrade{
+		ID:         trade.ID,
+		Symbol:     trade.Symbol,
+		Price:      trade.Price,
+		Quantity:   trade.Quantity,
+		ExecutedAt: trade.ExecutedAt,
+	}
+}
+
+// parseTradeFilter reads the from/to range and the trade ID cursor
+func parseTradeFilter(c *gin.Context) (store.TradeFilter, error) {
+	filter := store.TradeFilter{
+		Symbol:  c.Param("symbol"),
+		AfterID: c.Query("cursor"),
+	}
+	if filter.Symbol == "" {
+		return filter, fmt.Errorf("symbol is required")
+	}
+
+	var err error
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// ListTrades returns historical trades for a symbol, oldest first. The
+// next_cursor is the ID of the last trade in the page.
+func (h *Handler) ListTrades(c *gin.Context) {
+	filter, err := parseTradeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Limit = limit + 1
+
+	trades, err := h.store.ListTrades(c.Request.Context(), filter)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list trades",
+			zap.Error(err),
+			zap.String("symbol", filter.Symbol))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list trades"})
+		return
+	}
+
+	response := gin.H{"symbol": filter.Symbol}
+	if len(trades) > limit {
+		trades = trades[:limit]
+		response["next_cursor"] = trades[len(trades)-1].ID
+	}
+
+	result := make([]MarketTrade, len(trades))
+	for i, trade := range trades {
+		result[i] = newMarketTrade(trade)
+	}
+	response["trades"] = result
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportTrades streams every trade in a time range as CSV or NDJSON
+func (h *Handler) ExportTrades(c *gin.Context) {
+	filter, err := parseTradeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.From.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	// Exports cover a whole range in one response and do not page
+	filter.AfterID = ""
+
+	format := c.DefaultQuery("format", "csv")
+	var (
+		contentType string
+		writeRow    func(*types.Trade) error
+		flush       func() error
+	)
+
+	switch format {
+	case "csv":
+		w := csv.NewWriter(c.Writer)
+		contentType = "text/csv"
+		writeRow = func(trade *types.Trade) error {
+			return w.Write([]string{
+				trade.ID,
+				trade.Symbol,
+				strconv.FormatFloat(trade.Price, 'f', -1, 64),
+				strconv.FormatFloat(trade.Quantity, 'f', -1, 64),
+				trade.ExecutedAt.UTC().Format(time.RFC3339Nano),
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+		if err := w.Write([]string{"id", "symbol", "price", "quantity", "executed_at"}); err != nil {
+			return
+		}
+	case "ndjson":
+		enc := json.NewEncoder(c.Writer)
+		contentType = "application/x-ndjson"
+		writeRow = func(trade *types.Trade) error {
+			return enc.Encode(newMarketTrade(trade))
+		}
+		flush = func() error { return nil }
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+
+	rc := http.NewResponseController(c.Writer)
+	rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-trades.%s"`, filter.Symbol, format))
+	c.Status(http.StatusOK)
+
+	rows := 0
+	err = h.store.StreamTrades(c.Request.Context(), filter, func(trade *types.Trade) error {
+		if err := writeRow(trade); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushInterval == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// Headers are already sent, so the only signal left is a truncated body
+		h.logger.Error("Failed to export trades",
+			zap.Error(err),
+			zap.String("symbol", filter.Symbol),
+			zap.Int("rows", rows))
+		c.Abort()
+		return
+	}
+	c.Writer.Flush()
+}
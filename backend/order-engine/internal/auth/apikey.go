@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrAPIKeyRevoked     = errors.New("api key has been revoked")
+	ErrInvalidSignature  = errors.New("invalid request signature")
+	ErrRequestExpired    = errors.New("request timestamp outside receive window")
+	ErrReplayedRequest   = errors.New("request has already been processed")
+	ErrIPNotAllowed      = errors.New("client IP not allowed for this api key")
+	ErrInvalidRecvWindow = errors.New("invalid receive window")
+)
+
+// Receive window limits for signed requests
+const (
+	DefaultRecvWindow = 5 * time.Second
+	MaxRecvWindow     = 60 * time.Second
+)
+
+// APIKey lets a program authenticate by signing requests with a secret
+// instead of presenting a JWT. The secret is stored encrypted.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Label      string     `json:"label"`
+	Roles      []string   `json:"roles"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	EncryptedSecret []byte `json:"-"`
+}
+
+// APIKeyStore persists API keys
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	// GetAPIKey returns ErrAPIKeyNotFound for unknown keys
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]*APIKey, error)
+	// RevokeAPIKey returns ErrAPIKeyNotFound unless the user owns the key
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+}
+
+// ReplayGuard remembers request signatures for the length of the receive
+// window. MarkUsed returns false if the signature was already seen.
+type ReplayGuard interface {
+	MarkUsed(ctx context.Context, signature string, ttl time.Duration) (bool, error)
+}
+
+// UserRevocations reports whether a user's credentials issued at a given
+// time have been revoked, such as by JWTService.RevokeAllForUser
+type UserRevocations interface {
+	IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error)
+}
+
+// SignedRequest is the material covered by an API key signature
+type SignedRequest struct {
+	KeyID      string
+	Timestamp  string
+	RecvWindow string
+	Signature  string
+	Method     string
+	Path       string
+	Body       []byte
+	ClientIP   string
+}
+
+// APIKeyService manages API keys and authenticates signed requests
+type APIKeyService struct {
+	store       APIKeyStore
+	guard       ReplayGuard
+	revocations UserRevocations
+	policy      Policy
+	aead        cipher.AEAD
+}
+
+// NewAPIKeyService creates the service. masterKey is a base64-encoded
+// 32-byte key used to encrypt key secrets at rest.
+func NewAPIKeyService(store APIKeyStore, guard ReplayGuard, masterKey string) (*APIKeyService, error) {
+	raw, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("api key master key must be 32 bytes, base64 encoded")
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &APIKeyService{
+		store:  store,
+		guard:  guard,
+		policy: DefaultPolicy(),
+		aead:   aead,
+	}, nil
+}
+
+// SetPolicy replaces the role-to-scope policy used to bound new keys
+func (s *APIKeyService) SetPolicy(policy Policy) {
+	s.policy = policy
+}
+
+// SetRevocations rejects keys created before their owner's tokens were
+// all revoked
+func (s *APIKeyService) SetRevocations(revocations UserRevocations) {
+	s.revocations = revocations
+}
+
+// Create issues a key for the owner of claims and returns the secret,
+// which is not retrievable afterwards. Requested scopes must already be
+// granted to the owner; with no scopes the key inherits the owner's grant.
+func (s *APIKeyService) Create(ctx context.Context, owner *Claims, label string, scopes, allowedIPs []string) (*APIKey, string, error) {
+	for _, raw := range scopes {
+		scope, err := ParseScope(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		if !owner.coversScope(scope) {
+			return nil, "", fmt.Errorf("scope %q exceeds the caller's permissions", raw)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = owner.GrantedScopes()
+	}
+
+	for _, entry := range allowedIPs {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return nil, "", fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	key := &APIKey{
+		ID:              uuid.New().String(),
+		UserID:          owner.UserID,
+		Label:           label,
+		Roles:           owner.AllRoles(),
+		Scopes:          scopes,
+		AllowedIPs:      allowedIPs,
+		CreatedAt:       time.Now(),
+		EncryptedSecret: s.aead.Seal(nonce, nonce, []byte(secret), nil),
+	}
+
+	if err := s.store.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+// List returns the user's keys without their secrets
+func (s *APIKeyService) List(ctx context.Context, userID string) ([]*APIKey, error) {
+	return s.store.ListAPIKeys(ctx, userID)
+}
+
+// Revoke disables one of the user's keys
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id string) error {
+	return s.store.RevokeAPIKey(ctx, userID, id)
+}
+
+// RevokeAllForUser revokes every active key of the user and returns how
+// many were revoked
+func (s *APIKeyService) RevokeAllForUser(ctx context.Context, userID string) (int, error) {
+	keys, err := s.store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, key := range keys {
+		if key.RevokedAt != nil {
+			continue
+		}
+		if err := s.store.RevokeAPIKey(ctx, userID, key.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// Authenticate verifies a signed request and returns the same claims a JWT
+// for the key's owner would, limited to the key's scopes. The signature is
+// hex(HMAC-SHA256(secret, timestamp + method + path + body)), where the
+// timestamp is in Unix milliseconds and path includes the query string.
+func (s *APIKeyService) Authenticate(ctx context.Context, req SignedRequest) (*Claims, error) {
+	ts, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrRequestExpired
+	}
+
+	window := DefaultRecvWindow
+	if req.RecvWindow != "" {
+		ms, err := strconv.ParseInt(req.RecvWindow, 10, 64)
+		if err != nil || ms <= 0 || time.Duration(ms)*time.Millisecond > MaxRecvWindow {
+			return nil, ErrInvalidRecvWindow
+		}
+		window = time.Duration(ms) * time.Millisecond
+	}
+
+	skew := time.Since(time.UnixMilli(ts))
+	if skew > window || skew < -window {
+		return nil, ErrRequestExpired
+	}
+
+	key, err := s.store.GetAPIKey(ctx, req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if s.revocations != nil {
+		revoked, err := s.revocations.IsTokenRevoked(ctx, "apikey:"+key.ID, key.UserID, key.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRevocationCheck, err)
+		}
+		if revoked {
+			return nil, ErrAPIKeyRevoked
+		}
+	}
+	if !ipAllowed(key.AllowedIPs, req.ClientIP) {
+		return nil, ErrIPNotAllowed
+	}
+
+	secret, err := s.openSecret(key.EncryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(req.Timestamp + req.Method + req.Path))
+	mac.Write(req.Body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(req.Signature)) {
+		return nil, ErrInvalidSignature
+	}
+
+	// The signature is only replayable inside the window, so remember it
+	// for twice as long to cover clock skew in both directions
+	fresh, err := s.guard.MarkUsed(ctx, req.Signature, 2*window)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRevocationCheck, err)
+	}
+	if !fresh {
+		return nil, ErrReplayedRequest
+	}
+
+	claims := &Claims{
+		UserID:   key.UserID,
+		Roles:    key.Roles,
+		Scopes:   key.Scopes,
+		APIKeyID: key.ID,
+	}
+	if err := s.policy.Apply(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (s *APIKeyService) openSecret(sealed []byte) ([]byte, error) {
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("stored api key secret is corrupt")
+	}
+	secret, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt api key secret: %w", err)
+	}
+	return secret, nil
+}
+
+// ipAllowed reports whether ip matches the allowlist. An empty allowlist
+// permits any address.
+func ipAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// coversScope reports whether the claims grant everything the scope would
+func (c *Claims) coversScope(scope Scope) bool {
+	symbols := scope.Symbols
+	if len(symbols) == 0 {
+		symbols = []string{""}
+	}
+	accounts := scope.Accounts
+	if len(accounts) == 0 {
+		accounts = []string{""}
+	}
+
+	for _, symbol := range symbols {
+		for _, account := range accounts {
+			if !c.allowsExactly(scope.Permission, symbol, account) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allowsExactly is like Allows but treats an empty symbol or account as
+// "every symbol" or "every account", so only unrestricted grants match it
+func (c *Claims) allowsExactly(permission, symbol, account string) bool {
+	for _, grant := range c.grants {
+		if grant.Permission != permission {
+			continue
+		}
+		if len(grant.Symbols) > 0 && (symbol == "" || !contains(grant.Symbols, symbol)) {
+			continue
+		}
+		if len(grant.Accounts) > 0 && (account == "" || !contains(grant.Accounts, account)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memKeyStore keeps API keys in memory
+type memKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]*APIKey
+}
+
+func (m *memKeyStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = key
+	return nil
+}
+
+func (m *memKeyStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (m *memKeyStore) ListAPIKeys(ctx context.Context, userID string) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []*APIKey
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memKeyStore) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok || key.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+// memReplayGuard remembers every signature it is shown
+type memReplayGuard struct {
+	mu   sync.Mutex
+	seen map[string]time.Duration
+	err  error
+}
+
+func (g *memReplayGuard) MarkUsed(ctx context.Context, signature string, ttl time.Duration) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return false, g.err
+	}
+	if _, ok := g.seen[signature]; ok {
+		return false, nil
+	}
+	g.seen[signature] = ttl
+	return true, nil
+}
+
+func newTestAPIKeyService(t *testing.T) (*APIKeyService, *memReplayGuard) {
+	guard := &memReplayGuard{seen: make(map[string]time.Duration)}
+	s, err := NewAPIKeyService(&memKeyStore{keys: make(map[string]*APIKey)}, guard,
+		base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("new api key service: %v", err)
+	}
+	return s, guard
+}
+
+// ownerClaims returns resolved claims for a user with the given grant
+func ownerClaims(t *testing.T, role string, scopes ...string) *Claims {
+	claims := &Claims{UserID: "alice", Role: role, Scopes: scopes}
+	if err := DefaultPolicy().Apply(claims); err != nil {
+		t.Fatalf("apply policy: %v", err)
+	}
+	return claims
+}
+
+// signRequest builds a POST /api/v1/orders request signed at ts
+func signRequest(keyID, secret string, ts time.Time, body string) SignedRequest {
+	req := SignedRequest{
+		KeyID:     keyID,
+		Timestamp: strconv.FormatInt(ts.UnixMilli(), 10),
+		Method:    "POST",
+		Path:      "/api/v1/orders?client=bot",
+		Body:      []byte(body),
+		ClientIP:  "10.0.0.5",
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(req.Timestamp + req.Method + req.Path))
+	mac.Write(req.Body)
+	req.Signature = hex.EncodeToString(mac.Sum(nil))
+	return req
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	s, _ := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	key, secret, err := s.Create(ctx, ownerClaims(t, RoleTrader), "bot",
+		[]string{"orders:write@symbol=BTC-USD"}, []string{"10.0.0.0/24", "192.168.1.7"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *SignedRequest)
+		want   error
+	}{
+		{"valid", func(req *SignedRequest) {}, nil},
+		{"allowed address", func(req *SignedRequest) { req.ClientIP = "192.168.1.7" }, nil},
+		{"wider window", func(req *SignedRequest) {
+			*req = signRequest(key.ID, secret, time.Now().Add(-20*time.Second), `{"qty":1}`)
+			req.RecvWindow = "30000"
+		}, nil},
+		{"tampered body", func(req *SignedRequest) { req.Body = []byte(`{"qty":100}`) }, ErrInvalidSignature},
+		{"tampered path", func(req *SignedRequest) { req.Path = "/api/v1/orders" }, ErrInvalidSignature},
+		{"tampered method", func(req *SignedRequest) { req.Method = "DELETE" }, ErrInvalidSignature},
+		{"wrong secret", func(req *SignedRequest) {
+			*req = signRequest(key.ID, "not-the-secret", time.Now(), `{"qty":1}`)
+		}, ErrInvalidSignature},
+		{"too old", func(req *SignedRequest) {
+			*req = signRequest(key.ID, secret, time.Now().Add(-10*time.Second), `{"qty":1}`)
+		}, ErrRequestExpired},
+		{"too far ahead", func(req *SignedRequest) {
+			*req = signRequest(key.ID, secret, time.Now().Add(10*time.Second), `{"qty":1}`)
+		}, ErrRequestExpired},
+		{"bad timestamp", func(req *SignedRequest) { req.Timestamp = "yesterday" }, ErrRequestExpired},
+		{"window too wide", func(req *SignedRequest) { req.RecvWindow = "60001" }, ErrInvalidRecvWindow},
+		{"zero window", func(req *SignedRequest) { req.RecvWindow = "0" }, ErrInvalidRecvWindow},
+		{"bad window", func(req *SignedRequest) { req.RecvWindow = "5s" }, ErrInvalidRecvWindow},
+		{"address outside the allowlist", func(req *SignedRequest) { req.ClientIP = "10.0.1.5" }, ErrIPNotAllowed},
+		{"unparseable address", func(req *SignedRequest) { req.ClientIP = "" }, ErrIPNotAllowed},
+		{"unknown key", func(req *SignedRequest) { req.KeyID = "missing" }, ErrAPIKeyNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Distinct bodies keep the replay guard out of the way
+			req := signRequest(key.ID, secret, time.Now(), `{"qty":1}`)
+			tt.modify(&req)
+			if tt.want == nil {
+				req = resign(req, secret, strconv.Itoa(i))
+			}
+
+			claims, err := s.Authenticate(ctx, req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if claims.UserID != "alice" || claims.APIKeyID != key.ID {
+				t.Fatalf("claims = %+v, want alice's key", claims)
+			}
+			if !claims.Allows(ScopeOrdersWrite, Resource{Symbol: "BTC-USD"}) || claims.Allows(ScopeOrdersWrite, Resource{Symbol: "ETH-USD"}) {
+				t.Fatalf("scopes = %v, want only orders:write on BTC-USD", claims.GrantedScopes())
+			}
+		})
+	}
+}
+
+// resign replaces the body and signs the request again
+func resign(req SignedRequest, secret, body string) SignedRequest {
+	ts, _ := strconv.ParseInt(req.Timestamp, 10, 64)
+	signed := signRequest(req.KeyID, secret, time.UnixMilli(ts), body)
+	signed.RecvWindow = req.RecvWindow
+	signed.ClientIP = req.ClientIP
+	return signed
+}
+
+func TestAPIKeyRejectsReplay(t *testing.T) {
+	s, guard := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	key, secret, err := s.Create(ctx, ownerClaims(t, RoleTrader), "bot", nil, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	req := signRequest(key.ID, secret, time.Now(), `{"qty":1}`)
+	if _, err := s.Authenticate(ctx, req); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, req); !errors.Is(err, ErrReplayedRequest) {
+		t.Fatalf("replay: got %v, want %v", err, ErrReplayedRequest)
+	}
+
+	// Signatures are remembered for twice the window
+	if ttl := guard.seen[req.Signature]; ttl != 2*DefaultRecvWindow {
+		t.Fatalf("remembered for %s, want %s", ttl, 2*DefaultRecvWindow)
+	}
+
+	// Requests with bad signatures are not recorded, so they cannot be used
+	// to burn a signature before the real request arrives
+	forged := signRequest(key.ID, "not-the-secret", time.Now(), `{"qty":2}`)
+	if _, err := s.Authenticate(ctx, forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged: got %v, want %v", err, ErrInvalidSignature)
+	}
+	if _, ok := guard.seen[forged.Signature]; ok {
+		t.Fatal("forged signature recorded")
+	}
+
+	// Requests fail closed when the guard is unavailable
+	guard.err = errors.New("connection refused")
+	if _, err := s.Authenticate(ctx, signRequest(key.ID, secret, time.Now(), `{"qty":3}`)); !errors.Is(err, ErrRevocationCheck) {
+		t.Fatalf("guard down: got %v, want %v", err, ErrRevocationCheck)
+	}
+}
+
+func TestAPIKeyRevoked(t *testing.T) {
+	s, _ := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	key, secret, _ := s.Create(ctx, ownerClaims(t, RoleTrader), "bot", nil, nil)
+	if err := s.Revoke(ctx, "mallory", key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("revoke another user's key: got %v, want %v", err, ErrAPIKeyNotFound)
+	}
+	if err := s.Revoke(ctx, "alice", key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, signRequest(key.ID, secret, time.Now(), "")); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Fatalf("revoked key: got %v, want %v", err, ErrAPIKeyRevoked)
+	}
+}
+
+// cutoffRevocations revokes everything a user was issued up to a cutoff
+type cutoffRevocations map[string]time.Time
+
+func (r cutoffRevocations) IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error) {
+	cutoff, ok := r[userID]
+	return ok && !issuedAt.After(cutoff), nil
+}
+
+func TestAPIKeyRevokedWithUser(t *testing.T) {
+	s, _ := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	old, oldSecret, _ := s.Create(ctx, ownerClaims(t, RoleTrader), "old", nil, nil)
+	revocations := cutoffRevocations{"alice": time.Now()}
+	s.SetRevocations(revocations)
+	if _, err := s.Authenticate(ctx, signRequest(old.ID, oldSecret, time.Now(), "")); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Fatalf("key created before the cutoff: got %v, want %v", err, ErrAPIKeyRevoked)
+	}
+
+	time.Sleep(time.Millisecond)
+	current, secret, _ := s.Create(ctx, ownerClaims(t, RoleTrader), "new", nil, nil)
+	if _, err := s.Authenticate(ctx, signRequest(current.ID, secret, time.Now(), "")); err != nil {
+		t.Fatalf("key created after the cutoff: %v", err)
+	}
+
+	// Revoking the user's keys outlasts the cutoff
+	if n, err := s.RevokeAllForUser(ctx, "alice"); err != nil || n != 2 {
+		t.Fatalf("revoke all = %d, %v, want both keys", n, err)
+	}
+	delete(revocations, "alice")
+	if _, err := s.Authenticate(ctx, signRequest(current.ID, secret, time.Now().Add(time.Millisecond), "")); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Fatalf("revoked key: got %v, want %v", err, ErrAPIKeyRevoked)
+	}
+	if n, _ := s.RevokeAllForUser(ctx, "alice"); n != 0 {
+		t.Fatalf("revoked %d keys again, want 0", n)
+	}
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		owner  *Claims
+		scopes []string
+		ips    []string
+		ok     bool
+	}{
+		{"inherits the owner's grant", ownerClaims(t, RoleTrader), nil, nil, true},
+		{"narrower permission", ownerClaims(t, RoleTrader), []string{ScopeOrdersRead}, nil, true},
+		{"narrower symbols", ownerClaims(t, RoleTrader), []string{"orders:write@symbol=BTC-USD|ETH-USD"}, nil, true},
+		{"narrower account", ownerClaims(t, RoleTrader), []string{"orders:write@account=acc-1"}, nil, true},
+		{"same symbols", ownerClaims(t, RoleTrader, "orders:write@symbol=BTC-USD"), []string{"orders:write@symbol=BTC-USD"}, nil, true},
+		{"symbol subset", ownerClaims(t, RoleTrader, "orders:write@symbol=BTC-USD|ETH-USD"), []string{"orders:write@symbol=ETH-USD"}, nil, true},
+		{"permission not granted", ownerClaims(t, RoleTrader), []string{ScopeRiskAdmin}, nil, false},
+		{"unrestricted from a symbol grant", ownerClaims(t, RoleTrader, "orders:write@symbol=BTC-USD"), []string{ScopeOrdersWrite}, nil, false},
+		{"other symbol", ownerClaims(t, RoleTrader, "orders:write@symbol=BTC-USD"), []string{"orders:write@symbol=ETH-USD"}, nil, false},
+		{"symbol superset", ownerClaims(t, RoleTrader, "orders:write@symbol=BTC-USD"), []string{"orders:write@symbol=BTC-USD|ETH-USD"}, nil, false},
+		{"unrestricted from an account grant", ownerClaims(t, RoleTrader, "orders:write@account=acc-1"), []string{"orders:write@symbol=BTC-USD"}, nil, false},
+		{"other account", ownerClaims(t, RoleTrader, "orders:write@account=acc-1"), []string{"orders:write@account=acc-2"}, nil, false},
+		{"malformed scope", ownerClaims(t, RoleTrader), []string{"orders:write@symbol"}, nil, false},
+		{"addresses and networks", ownerClaims(t, RoleTrader), nil, []string{"10.0.0.1", "10.1.0.0/16", "::1"}, true},
+		{"malformed address", ownerClaims(t, RoleTrader), nil, []string{"10.0.0.300"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestAPIKeyService(t)
+			key, secret, err := s.Create(context.Background(), tt.owner, "bot", tt.scopes, tt.ips)
+			if (err == nil) != tt.ok {
+				t.Fatalf("create: err = %v, want ok = %v", err, tt.ok)
+			}
+			if err != nil {
+				return
+			}
+			if secret == "" || len(key.EncryptedSecret) == 0 || string(key.EncryptedSecret) == secret {
+				t.Fatal("secret not returned or stored in the clear")
+			}
+			if tt.scopes == nil && len(key.Scopes) != len(tt.owner.GrantedScopes()) {
+				t.Fatalf("key scopes = %v, want the owner's %v", key.Scopes, tt.owner.GrantedScopes())
+			}
+		})
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		allowlist []string
+		ip        string
+		want      bool
+	}{
+		{nil, "203.0.113.9", true},
+		{nil, "", true},
+		{[]string{"203.0.113.9"}, "203.0.113.9", true},
+		{[]string{"203.0.113.9"}, "203.0.113.10", false},
+		{[]string{"203.0.113.0/24"}, "203.0.113.255", true},
+		{[]string{"203.0.113.0/24"}, "203.0.114.1", false},
+		{[]string{"2001:db8::/32"}, "2001:db8::1", true},
+		{[]string{"2001:db8::/32"}, "203.0.113.9", false},
+		{[]string{"203.0.113.9"}, "not-an-ip", false},
+		{[]string{"garbage", "203.0.113.9"}, "203.0.113.9", true},
+	}
+	for _, tt := range tests {
+		if got := ipAllowed(tt.allowlist, tt.ip); got != tt.want {
+			t.Errorf("ipAllowed(%v, %q) = %v, want %v", tt.allowlist, tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/config"
+)
+
+// NewFromConfig creates the JWT service every process validates tokens
+// with, checking revocations against tokens. In JWKS mode the keys are
+// refreshed until ctx is done.
+func NewFromConfig(ctx context.Context, cfg config.AuthConfig, tokens TokenStore, logger *zap.Logger) (*JWTService, error) {
+	var jwtService *JWTService
+	if cfg.Mode == config.AuthModeJWKS {
+		keySet, err := NewKeySet(
+			cfg.JWKSFile,
+			cfg.JWKSURL,
+			time.Duration(cfg.KeyRotationGrace)*time.Second,
+			logger,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWKS: %w", err)
+		}
+		go keySet.Run(ctx, time.Duration(cfg.JWKSRefreshInterval)*time.Second)
+
+		jwtService = NewJWKSService(keySet, cfg.Issuer)
+	} else {
+		jwtService = NewJWTService(cfg.HMACSecret, cfg.Issuer)
+	}
+	jwtService.SetAudience(cfg.Audience)
+	jwtService.SetIssuerOptional(cfg.IssuerOptional)
+	jwtService.SetTokenStore(tokens)
+	if len(cfg.RoleScopes) > 0 {
+		policy, err := NewPolicy(cfg.RoleScopes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth.role_scopes: %w", err)
+		}
+		jwtService.SetPolicy(policy)
+	}
+	jwtService.SetTokenTTLs(
+		time.Duration(cfg.AccessTokenTTL)*time.Second,
+		time.Duration(cfg.RefreshTokenTTL)*time.Second,
+	)
+	return jwtService, nil
+}
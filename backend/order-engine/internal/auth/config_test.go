@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/config"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.AuthConfig{
+		Mode:       config.AuthModeHMAC,
+		Issuer:     "order-engine",
+		Audience:   "order-engine",
+		HMACSecret: "secret",
+		RoleScopes: map[string][]string{RoleTrader: {ScopeMarketDataRead}},
+	}
+
+	s, err := NewFromConfig(ctx, cfg, nil, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	token, err := s.GenerateToken("alice", RoleTrader, time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	claims, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !claims.HasScope(ScopeMarketDataRead) || claims.HasScope(ScopeOrdersWrite) {
+		t.Fatal("configured role scopes not applied")
+	}
+
+	// Tokens for another audience are refused
+	other := cfg
+	other.Audience = "billing"
+	foreign, _ := NewJWTService("secret", "order-engine").GenerateToken("alice", RoleTrader, time.Minute)
+	if s, err = NewFromConfig(ctx, other, nil, zap.NewNop()); err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, foreign); err == nil {
+		t.Fatal("accepted a token without the configured audience")
+	}
+
+	cfg.RoleScopes = map[string][]string{RoleTrader: {ScopeOrdersWrite + "@venue=otc"}}
+	if _, err := NewFromConfig(ctx, cfg, nil, zap.NewNop()); err == nil {
+		t.Fatal("accepted invalid role scopes")
+	}
+}
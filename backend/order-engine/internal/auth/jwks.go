@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// jwk is a single JSON Web Key. Only the public RSA and EC members are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type verificationKey struct {
+	key crypto.PublicKey
+	// retiredAt is set once the key disappears from the JWKS; it stays
+	// usable until the rotation grace period has passed
+	retiredAt time.Time
+}
+
+// KeySet holds the public keys used to verify asymmetrically signed tokens,
+// loaded from a local JWKS file or a JWKS URL and refreshed periodically
+type KeySet struct {
+	file        string
+	url         string
+	gracePeriod time.Duration
+	httpClient  *http.Client
+	logger      *zap.Logger
+
+	keys  map[string]*verificationKey
+	now   func() time.Time
+	mutex sync.RWMutex
+}
+
+// NewKeySet loads the JWKS from file, or from url when file is empty
+func NewKeySet(file, url string, gracePeriod time.Duration, logger *zap.Logger) (*KeySet, error) {
+	if file == "" && url == "" {
+		return nil, fmt.Errorf("either a JWKS file or a JWKS URL is required")
+	}
+
+	ks := &KeySet{
+		file:        file,
+		url:         url,
+		gracePeriod: gracePeriod,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		logger:      logger,
+		keys:        make(map[string]*verificationKey),
+		now:         time.Now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := ks.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Run refreshes the key set every interval until ctx is cancelled
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := ks.Refresh(refreshCtx); err != nil {
+				ks.logger.Error("Failed to refresh JWKS", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Refresh reloads the JWKS. Keys missing from the new set are retired
+// rather than dropped so tokens signed before a rotation keep verifying.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	data, err := ks.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	fresh := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			ks.logger.Warn("Skipping invalid JWK", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		fresh[k.Kid] = key
+	}
+	if len(fresh) == 0 {
+		return fmt.Errorf("JWKS contains no usable signing keys")
+	}
+
+	now := ks.now()
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	for kid, existing := range ks.keys {
+		if _, ok := fresh[kid]; ok {
+			continue
+		}
+		if existing.retiredAt.IsZero() {
+			existing.retiredAt = now
+			ks.logger.Info("Signing key retired", zap.String("kid", kid))
+		} else if now.Sub(existing.retiredAt) > ks.gracePeriod {
+			delete(ks.keys, kid)
+			ks.logger.Info("Signing key removed", zap.String("kid", kid))
+		}
+	}
+	for kid, key := range fresh {
+		if _, ok := ks.keys[kid]; !ok {
+			ks.logger.Info("Signing key added", zap.String("kid", kid))
+		}
+		ks.keys[kid] = &verificationKey{key: key}
+	}
+
+	return nil
+}
+
+// Key returns the public key for kid, if it is current or within its
+// rotation grace period
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !k.retiredAt.IsZero() && ks.now().Sub(k.retiredAt) > ks.gracePeriod {
+		return nil, ErrUnknownKey
+	}
+	return k.key, nil
+}
+
+func (ks *KeySet) load(ctx context.Context) ([]byte, error) {
+	if ks.file != "" {
+		data, err := os.ReadFile(ks.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := ks.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
+	}
+	return data, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Kid == "" {
+		return nil, fmt.Errorf("missing kid")
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
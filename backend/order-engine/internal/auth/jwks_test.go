@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+const testIssuer = "https://idp.example.com"
+
+// testIdP signs tokens with RSA keys it publishes in a JWKS file
+type testIdP struct {
+	t    *testing.T
+	file string
+	keys map[string]*rsa.PrivateKey
+}
+
+func newTestIdP(t *testing.T, kids ...string) *testIdP {
+	idp := &testIdP{
+		t:    t,
+		file: filepath.Join(t.TempDir(), "jwks.json"),
+		keys: make(map[string]*rsa.PrivateKey),
+	}
+	idp.publish(kids...)
+	return idp
+}
+
+// publish replaces the JWKS with the keys named, generating new ones
+func (idp *testIdP) publish(kids ...string) {
+	var set jwkSet
+	for _, kid := range kids {
+		key, ok := idp.keys[kid]
+		if !ok {
+			var err error
+			if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+				idp.t.Fatalf("generate key: %v", err)
+			}
+			idp.keys[kid] = key
+		}
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		idp.t.Fatalf("marshal jwks: %v", err)
+	}
+	if err := os.WriteFile(idp.file, data, 0o600); err != nil {
+		idp.t.Fatalf("write jwks: %v", err)
+	}
+}
+
+func (idp *testIdP) sign(kid string, claims *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(idp.keys[kid])
+	if err != nil {
+		idp.t.Fatalf("sign: %v", err)
+	}
+	return signed
+}
+
+func idpClaims(userID string) *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID: userID,
+		Role:   RoleTrader,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-" + userID,
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{"order-engine"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// newTestKeySet loads the IdP's keys on a clock the test advances
+func newTestKeySet(t *testing.T, idp *testIdP, grace time.Duration) (*KeySet, *time.Time) {
+	ks, err := NewKeySet(idp.file, "", grace, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new key set: %v", err)
+	}
+	now := time.Now()
+	ks.now = func() time.Time { return now }
+	return ks, &now
+}
+
+func TestJWKSValidateToken(t *testing.T) {
+	idp := newTestIdP(t, "key-1")
+	ks, _ := newTestKeySet(t, idp, time.Hour)
+	s := NewJWKSService(ks, testIssuer)
+	s.SetAudience("order-engine")
+
+	claims, err := s.ValidateToken(context.Background(), idp.sign("key-1", idpClaims("alice")))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if claims.UserID != "alice" || !claims.HasScope(ScopeOrdersWrite) {
+		t.Fatalf("claims = %+v, want alice with the trader scopes", claims)
+	}
+
+	if _, err := s.GenerateToken("alice", RoleTrader, time.Minute); !errors.Is(err, ErrSigningDisabled) {
+		t.Fatalf("generate: got %v, want %v", err, ErrSigningDisabled)
+	}
+}
+
+func TestJWKSRejectsForeignTokens(t *testing.T) {
+	idp := newTestIdP(t, "key-1")
+	ks, _ := newTestKeySet(t, idp, time.Hour)
+	s := NewJWKSService(ks, testIssuer)
+	s.SetAudience("order-engine")
+
+	tests := []struct {
+		name   string
+		modify func(claims *Claims)
+		want   error
+	}{
+		{"other issuer", func(c *Claims) { c.Issuer = "https://other.example.com" }, ErrInvalidToken},
+		{"no issuer", func(c *Claims) { c.Issuer = "" }, ErrInvalidToken},
+		{"no expiry", func(c *Claims) { c.ExpiresAt = nil }, ErrInvalidToken},
+		{"expired", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }, ErrExpiredToken},
+		{"other audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"billing"} }, ErrInvalidToken},
+		{"no audience", func(c *Claims) { c.Audience = nil }, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idpClaims("alice")
+			tt.modify(claims)
+			if _, err := s.ValidateToken(context.Background(), idp.sign("key-1", claims)); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Tokens signed with a key outside the set, or naming none, are refused
+	stranger := newTestIdP(t, "key-1")
+	if _, err := s.ValidateToken(context.Background(), stranger.sign("key-1", idpClaims("alice"))); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("foreign key: got %v, want %v", err, ErrInvalidToken)
+	}
+	unnamed := jwt.NewWithClaims(jwt.SigningMethodRS256, idpClaims("alice"))
+	signed, _ := unnamed.SignedString(idp.keys["key-1"])
+	if _, err := s.ValidateToken(context.Background(), signed); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("no kid: got %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	idp := newTestIdP(t, "key-1")
+	ks, now := newTestKeySet(t, idp, time.Hour)
+	s := NewJWKSService(ks, testIssuer)
+	ctx := context.Background()
+
+	old := idp.sign("key-1", idpClaims("alice"))
+
+	// The IdP rotates to a new key and stops publishing the old one
+	idp.publish("key-2")
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, idp.sign("key-2", idpClaims("bob"))); err != nil {
+		t.Fatalf("token signed with the new key: %v", err)
+	}
+
+	// Tokens signed before the rotation verify during the grace period
+	*now = now.Add(59 * time.Minute)
+	if _, err := s.ValidateToken(ctx, old); err != nil {
+		t.Fatalf("token signed with the retired key within the grace period: %v", err)
+	}
+
+	// and are refused after it, even before the next refresh drops the key
+	*now = now.Add(2 * time.Minute)
+	if _, err := s.ValidateToken(ctx, old); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("retired key after the grace period: got %v, want %v", err, ErrInvalidToken)
+	}
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := ks.Key("key-1"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("retired key after refresh: got %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestJWKSKeyReinstatedWithinGrace(t *testing.T) {
+	idp := newTestIdP(t, "key-1", "key-2")
+	ks, now := newTestKeySet(t, idp, time.Minute)
+	ctx := context.Background()
+
+	idp.publish("key-2")
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// Publishing a retired key again makes it current
+	idp.publish("key-1", "key-2")
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	*now = now.Add(time.Hour)
+	if _, err := ks.Key("key-1"); err != nil {
+		t.Fatalf("reinstated key: %v", err)
+	}
+}
@@ -1,59 +1,203 @@
 package auth
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrExpiredToken      = errors.New("token has expired")
+	ErrRevokedToken      = errors.New("token has been revoked")
+	ErrRevocationCheck   = errors.New("unable to check token revocation")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrTokenStoreMissing = errors.New("token store not configured")
+	ErrSigningDisabled   = errors.New("token signing is not available with public keys only")
 )
 
+// Token types carried in the typ claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// Default lifetimes for token pairs
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Claims are the claims of an access or refresh token. The user is read
+// from user_id, falling back to the id claim the auth service signs and
+// then to sub.
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string   `json:"user_id"`
+	AuthID    string   `json:"id,omitempty"`
+	Role      string   `json:"role"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	TokenType string   `json:"typ,omitempty"`
 	jwt.RegisteredClaims
+
+	// APIKeyID is set when the request was authenticated with an API key
+	// rather than a token
+	APIKeyID string `json:"-"`
+
+	// grants are the effective scopes, resolved from the roles and the
+	// explicit scopes once the token has been validated
+	grants []Scope
 }
 
 type JWTService struct {
-	secretKey []byte
-	issuer    string
+	secretKey      []byte
+	keySet         *KeySet
+	issuer         string
+	optionalIssuer bool
+	audience       string
+	store          TokenStore
+	policy         Policy
+	accessTTL      time.Duration
+	refreshTTL     time.Duration
 }
 
 func NewJWTService(secretKey string, issuer string) *JWTService {
 	return &JWTService{
-		secretKey: []byte(secretKey),
-		issuer:    issuer,
+		secretKey:  []byte(secretKey),
+		issuer:     issuer,
+		policy:     DefaultPolicy(),
+		accessTTL:  DefaultAccessTokenTTL,
+		refreshTTL: DefaultRefreshTokenTTL,
+	}
+}
+
+// NewJWKSService verifies RS256 and ES256 tokens against the public keys
+// in keySet. It cannot issue tokens; those come from the auth service.
+func NewJWKSService(keySet *KeySet, issuer string) *JWTService {
+	return &JWTService{
+		keySet:     keySet,
+		issuer:     issuer,
+		policy:     DefaultPolicy(),
+		accessTTL:  DefaultAccessTokenTTL,
+		refreshTTL: DefaultRefreshTokenTTL,
+	}
+}
+
+// SetAudience requires tokens to be issued for audience, and issues them
+// for it
+func (s *JWTService) SetAudience(audience string) {
+	s.audience = audience
+}
+
+// SetIssuerOptional accepts tokens without an iss claim, as the auth
+// service signs them. Tokens that carry one must still match the issuer.
+// It eases the migration to issuer-checked tokens and should be turned off
+// once every token in circulation has an issuer.
+func (s *JWTService) SetIssuerOptional(optional bool) {
+	s.optionalIssuer = optional
+}
+
+// SetTokenStore enables sessions and revocation checks backed by store
+func (s *JWTService) SetTokenStore(store TokenStore) {
+	s.store = store
+}
+
+// SetPolicy replaces the role-to-scope policy applied to validated tokens
+func (s *JWTService) SetPolicy(policy Policy) {
+	s.policy = policy
+}
+
+// Policy returns the role-to-scope policy applied to validated tokens
+func (s *JWTService) Policy() Policy {
+	return s.policy
+}
+
+// SetTokenTTLs overrides the lifetimes of access and refresh tokens
+func (s *JWTService) SetTokenTTLs(access, refresh time.Duration) {
+	if access > 0 {
+		s.accessTTL = access
+	}
+	if refresh > 0 {
+		s.refreshTTL = refresh
 	}
 }
 
 func (s *JWTService) GenerateToken(userID, role string, duration time.Duration) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Role:   role,
+	claims := s.newClaims(userID, role, "", TokenTypeAccess, time.Now(), duration)
+	return s.sign(claims)
+}
+
+func (s *JWTService) newClaims(userID, role, sessionID, tokenType string, now time.Time, duration time.Duration) *Claims {
+	var audience jwt.ClaimStrings
+	if s.audience != "" {
+		audience = jwt.ClaimStrings{s.audience}
+	}
+	return &Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		TokenType: tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    s.issuer,
+			Audience:  audience,
 		},
 	}
+}
+
+func (s *JWTService) sign(claims *Claims) (string, error) {
+	if s.keySet != nil {
+		return "", ErrSigningDisabled
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.secretKey)
 }
 
-func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
+// ValidateToken verifies an access token and checks it against the
+// revocation list when a token store is configured
+func (s *JWTService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != "" && claims.TokenType != TokenTypeAccess {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	if err := s.policy.Apply(claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// parse verifies the signature and standard claims without consulting
+// the revocation list
+func (s *JWTService) parse(tokenString string) (*Claims, error) {
+	validMethods := []string{jwt.SigningMethodHS256.Alg()}
+	if s.keySet != nil {
+		validMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.verificationKey,
+		jwt.WithValidMethods(validMethods))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -67,9 +211,85 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	// jwt/v4 only checks the time claims that are present and never the
+	// issuer or audience; an IdP may sign tokens for other services
+	if !claims.VerifyExpiresAt(time.Now(), true) || !claims.VerifyIssuer(s.issuer, !s.optionalIssuer) {
+		return nil, ErrInvalidToken
+	}
+	if s.audience != "" && !claims.VerifyAudience(s.audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.UserID == "" {
+		claims.UserID = claims.AuthID
+	}
+	if claims.UserID == "" {
+		claims.UserID = claims.Subject
+	}
+	if claims.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+
 	return claims, nil
 }
 
+// verificationKey selects the key for a token: the shared secret in HMAC
+// mode, or the JWKS key named by the kid header
+func (s *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s.keySet == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.secretKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+	return s.keySet.Key(kid)
+}
+
+func (s *JWTService) checkRevoked(ctx context.Context, claims *Claims) error {
+	if s.store == nil {
+		return nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	revoked, err := s.store.IsTokenRevoked(ctx, claims.TokenID(), claims.UserID, issuedAt)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationCheck, err)
+	}
+	if revoked {
+		return ErrRevokedToken
+	}
+	return nil
+}
+
+// TokenID returns the ID the token is revoked by: its jti, or for tokens
+// without one, such as those of the auth service, a fingerprint of the
+// user and the issue and expiry times. Tokens issued to a user in the same
+// second with the same expiry share a fingerprint.
+func (c *Claims) TokenID() string {
+	if c.ID != "" {
+		return c.ID
+	}
+
+	var issuedAt, expiresAt int64
+	if c.IssuedAt != nil {
+		issuedAt = c.IssuedAt.Unix()
+	}
+	if c.ExpiresAt != nil {
+		expiresAt = c.ExpiresAt.Unix()
+	}
+	sum := sha256.Sum256([]byte(c.UserID + "|" + strconv.FormatInt(issuedAt, 10) + "|" + strconv.FormatInt(expiresAt, 10)))
+	return "fp:" + hex.EncodeToString(sum[:16])
+}
+
 // Role-based access control (RBAC)
 const (
 	RoleAdmin   = "admin"
@@ -77,15 +297,28 @@ const (
 	RoleAnalyst = "analyst"
 )
 
+// AllRoles returns the single role claim together with the roles list
+func (c *Claims) AllRoles() []string {
+	if c.Role == "" {
+		return c.Roles
+	}
+	return append([]string{c.Role}, c.Roles...)
+}
+
 // HasRole checks if the user has the required role
 func (c *Claims) HasRole(role string) bool {
-	return c.Role == role
+	for _, r := range c.AllRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 // HasAnyRole checks if the user has any of the required roles
 func (c *Claims) HasAnyRole(roles ...string) bool {
 	for _, role := range roles {
-		if c.Role == role {
+		if c.HasRole(role) {
 			return true
 		}
 	}
@@ -94,15 +327,15 @@ func (c *Claims) HasAnyRole(roles ...string) bool {
 
 // IsAdmin checks if the user is an admin
 func (c *Claims) IsAdmin() bool {
-	return c.Role == RoleAdmin
+	return c.HasRole(RoleAdmin)
 }
 
 // IsTrader checks if the user is a trader
 func (c *Claims) IsTrader() bool {
-	return c.Role == RoleTrader
+	return c.HasRole(RoleTrader)
 }
 
 // IsAnalyst checks if the user is an analyst
 func (c *Claims) IsAnalyst() bool {
-	return c.Role == RoleAnalyst
-} 
\ No newline at end of file
+	return c.HasRole(RoleAnalyst)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestValidateTokenChecksIssuerAndExpiry(t *testing.T) {
+	s := NewJWTService("secret", "order-engine")
+	ctx := context.Background()
+
+	token, err := s.GenerateToken("alice", RoleTrader, time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	// Same secret, different issuer
+	other, _ := NewJWTService("secret", "other-service").GenerateToken("alice", RoleTrader, time.Minute)
+	if _, err := s.ValidateToken(ctx, other); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("other issuer: got %v, want %v", err, ErrInvalidToken)
+	}
+
+	claims := s.newClaims("alice", RoleTrader, "", TokenTypeAccess, time.Now(), time.Minute)
+	claims.ExpiresAt = nil
+	unbounded, _ := s.sign(claims)
+	if _, err := s.ValidateToken(ctx, unbounded); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("no expiry: got %v, want %v", err, ErrInvalidToken)
+	}
+
+	expired, _ := s.GenerateToken("alice", RoleTrader, -time.Minute)
+	if _, err := s.ValidateToken(ctx, expired); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expired: got %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestValidateTokenChecksAudience(t *testing.T) {
+	s := NewJWTService("secret", "order-engine")
+	s.SetAudience("order-engine")
+	ctx := context.Background()
+
+	token, _ := s.GenerateToken("alice", RoleTrader, time.Minute)
+	if _, err := s.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	claims := s.newClaims("alice", RoleTrader, "", TokenTypeAccess, time.Now(), time.Minute)
+	claims.Audience = jwt.ClaimStrings{"billing"}
+	foreign, _ := s.sign(claims)
+	if _, err := s.ValidateToken(ctx, foreign); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("other audience: got %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestValidateTokenReadsUserID(t *testing.T) {
+	s := NewJWTService("secret", "order-engine")
+	ctx := context.Background()
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["iss"] = "order-engine"
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   string
+	}{
+		{"user_id", jwt.MapClaims{"user_id": "alice", "id": "other", "sub": "other"}, "alice"},
+		{"auth service id", jwt.MapClaims{"id": "alice", "email": "alice@example.com", "roles": []string{RoleTrader}}, "alice"},
+		{"subject", jwt.MapClaims{"sub": "alice"}, "alice"},
+	}
+	for _, tt := range tests {
+		claims, err := s.ValidateToken(ctx, sign(tt.claims))
+		if err != nil {
+			t.Fatalf("%s: validate: %v", tt.name, err)
+		}
+		if claims.UserID != tt.want {
+			t.Fatalf("%s: user %q, want %q", tt.name, claims.UserID, tt.want)
+		}
+	}
+
+	if _, err := s.ValidateToken(ctx, sign(jwt.MapClaims{"role": RoleTrader})); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("no user: got %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestValidateTokenWithOptionalIssuer(t *testing.T) {
+	s := NewJWTService("secret", "order-engine")
+	ctx := context.Background()
+
+	// An auth service token: HS256 with the shared secret and no iss
+	unissued, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":    "alice",
+		"roles": []string{RoleTrader},
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, unissued); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("required issuer: got %v, want %v", err, ErrInvalidToken)
+	}
+
+	s.SetIssuerOptional(true)
+	if _, err := s.ValidateToken(ctx, unissued); err != nil {
+		t.Fatalf("optional issuer: %v", err)
+	}
+
+	// A token naming another issuer is still rejected
+	other, _ := NewJWTService("secret", "other-service").GenerateToken("alice", RoleTrader, time.Minute)
+	if _, err := s.ValidateToken(ctx, other); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("other issuer: got %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Permissions that can be granted as scopes
+const (
+	ScopeOrdersRead      = "orders:read"
+	ScopeOrdersReadAny   = "orders:read:any"
+	ScopeOrdersWrite     = "orders:write"
+	ScopeOrdersCancelAny = "orders:cancel:any"
+	ScopeMarketDataRead  = "marketdata:read"
+	ScopeSymbolsAdmin    = "symbols:admin"
+	ScopeSessionsAdmin   = "sessions:admin"
+	ScopeMetricsRead     = "metrics:read"
+	ScopeAccountsRead    = "accounts:read"
+	ScopeAccountsWrite   = "accounts:write"
+	ScopeAccountsAdmin   = "accounts:admin"
+	ScopeRiskAdmin       = "risk:admin"
+)
+
+// Scope grants a permission, optionally limited to some symbols or
+// accounts. Its string form is the permission followed by optional
+// qualifiers, e.g. "orders:write@symbol=BTC-USD|ETH-USD@account=acc-1".
+type Scope struct {
+	Permission string
+	Symbols    []string
+	Accounts   []string
+}
+
+// Resource identifies what a permission is being exercised on. Empty
+// fields are not checked.
+type Resource struct {
+	Symbol  string
+	Account string
+}
+
+// ParseScope parses the string form of a scope
+func ParseScope(s string) (Scope, error) {
+	parts := strings.Split(strings.TrimSpace(s), "@")
+	scope := Scope{Permission: parts[0]}
+	if scope.Permission == "" {
+		return scope, fmt.Errorf("scope %q has no permission", s)
+	}
+
+	for _, qualifier := range parts[1:] {
+		key, value, found := strings.Cut(qualifier, "=")
+		if !found || value == "" {
+			return scope, fmt.Errorf("scope %q has malformed qualifier %q", s, qualifier)
+		}
+		values := strings.Split(value, "|")
+		switch key {
+		case "symbol":
+			scope.Symbols = append(scope.Symbols, values...)
+		case "account":
+			scope.Accounts = append(scope.Accounts, values...)
+		default:
+			return scope, fmt.Errorf("scope %q has unknown qualifier %q", s, key)
+		}
+	}
+
+	return scope, nil
+}
+
+func (s Scope) String() string {
+	var b strings.Builder
+	b.WriteString(s.Permission)
+	if len(s.Symbols) > 0 {
+		b.WriteString("@symbol=" + strings.Join(s.Symbols, "|"))
+	}
+	if len(s.Accounts) > 0 {
+		b.WriteString("@account=" + strings.Join(s.Accounts, "|"))
+	}
+	return b.String()
+}
+
+// Allows reports whether the scope grants permission on the resource
+func (s Scope) Allows(permission string, r Resource) bool {
+	if s.Permission != permission {
+		return false
+	}
+	if r.Symbol != "" && len(s.Symbols) > 0 && !contains(s.Symbols, r.Symbol) {
+		return false
+	}
+	if r.Account != "" && len(s.Accounts) > 0 && !contains(s.Accounts, r.Account) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy maps each role to the scopes it grants
+type Policy map[string][]Scope
+
+// DefaultPolicy is used when no policy is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		RoleAdmin: {
+			{Permission: ScopeOrdersRead},
+			{Permission: ScopeOrdersReadAny},
+			{Permission: ScopeOrdersWrite},
+			{Permission: ScopeOrdersCancelAny},
+			{Permission: ScopeMarketDataRead},
+			{Permission: ScopeSymbolsAdmin},
+			{Permission: ScopeSessionsAdmin},
+			{Permission: ScopeMetricsRead},
+			{Permission: ScopeAccountsRead},
+			{Permission: ScopeAccountsWrite},
+			{Permission: ScopeAccountsAdmin},
+			{Permission: ScopeRiskAdmin},
+		},
+		RoleTrader: {
+			{Permission: ScopeOrdersRead},
+			{Permission: ScopeOrdersWrite},
+			{Permission: ScopeMarketDataRead},
+			{Permission: ScopeAccountsRead},
+			{Permission: ScopeAccountsWrite},
+		},
+		RoleAnalyst: {
+			{Permission: ScopeMarketDataRead},
+			{Permission: ScopeMetricsRead},
+		},
+	}
+}
+
+// NewPolicy builds a policy from role names to scope strings
+func NewPolicy(table map[string][]string) (Policy, error) {
+	policy := make(Policy, len(table))
+	for role, scopes := range table {
+		for _, raw := range scopes {
+			scope, err := ParseScope(raw)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %w", role, err)
+			}
+			policy[role] = append(policy[role], scope)
+		}
+	}
+	return policy, nil
+}
+
+// Apply resolves the effective scopes of the claims from their roles.
+// Scopes listed explicitly in the claims narrow that grant: only those the
+// roles cover are kept, so a token cannot grant itself more than its roles.
+func (p Policy) Apply(c *Claims) error {
+	roles := &Claims{grants: make([]Scope, 0)}
+	for _, role := range c.AllRoles() {
+		roles.grants = append(roles.grants, p[role]...)
+	}
+	if len(c.Scopes) == 0 {
+		c.grants = roles.grants
+		return nil
+	}
+
+	grants := make([]Scope, 0)
+	for _, raw := range c.Scopes {
+		scope, err := ParseScope(raw)
+		if err != nil {
+			return err
+		}
+		if roles.coversScope(scope) {
+			grants = append(grants, scope)
+		}
+	}
+
+	c.grants = grants
+	return nil
+}
+
+// HasScope reports whether the permission is granted for any resource
+func (c *Claims) HasScope(permission string) bool {
+	for _, scope := range c.grants {
+		if scope.Permission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the permission is granted on the resource
+func (c *Claims) Allows(permission string, r Resource) bool {
+	for _, scope := range c.grants {
+		if scope.Allows(permission, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedScopes returns the effective scopes in string form, sorted
+func (c *Claims) GrantedScopes() []string {
+	scopes := make([]string, len(c.grants))
+	for i, scope := range c.grants {
+		scopes[i] = scope.String()
+	}
+	sort.Strings(scopes)
+	return scopes
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Scope
+	}{
+		{"orders:write", Scope{Permission: ScopeOrdersWrite}},
+		{" orders:write ", Scope{Permission: ScopeOrdersWrite}},
+		{"orders:write@symbol=BTC-USD", Scope{Permission: ScopeOrdersWrite, Symbols: []string{"BTC-USD"}}},
+		{"orders:write@symbol=BTC-USD|ETH-USD", Scope{Permission: ScopeOrdersWrite, Symbols: []string{"BTC-USD", "ETH-USD"}}},
+		{"accounts:read@account=acc-1", Scope{Permission: ScopeAccountsRead, Accounts: []string{"acc-1"}}},
+		{"orders:write@symbol=BTC-USD@account=acc-1|acc-2", Scope{
+			Permission: ScopeOrdersWrite,
+			Symbols:    []string{"BTC-USD"},
+			Accounts:   []string{"acc-1", "acc-2"},
+		}},
+		{"orders:write@account=acc-1@symbol=BTC-USD", Scope{
+			Permission: ScopeOrdersWrite,
+			Symbols:    []string{"BTC-USD"},
+			Accounts:   []string{"acc-1"},
+		}},
+		{"orders:write@symbol=BTC-USD@symbol=ETH-USD", Scope{Permission: ScopeOrdersWrite, Symbols: []string{"BTC-USD", "ETH-USD"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseScope(tt.raw)
+		if err != nil {
+			t.Errorf("ParseScope(%q): %v", tt.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseScope(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+
+		// The string form parses back to the same scope
+		if again, err := ParseScope(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("ParseScope(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+		}
+	}
+
+	for _, raw := range []string{
+		"",
+		"@symbol=BTC-USD",
+		"orders:write@",
+		"orders:write@symbol",
+		"orders:write@symbol=",
+		"orders:write@venue=X",
+	} {
+		if _, err := ParseScope(raw); err == nil {
+			t.Errorf("ParseScope(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	scope, _ := ParseScope("orders:write@symbol=BTC-USD|ETH-USD@account=acc-1")
+
+	tests := []struct {
+		permission string
+		resource   Resource
+		want       bool
+	}{
+		{ScopeOrdersWrite, Resource{Symbol: "BTC-USD", Account: "acc-1"}, true},
+		{ScopeOrdersWrite, Resource{Symbol: "ETH-USD", Account: "acc-1"}, true},
+		{ScopeOrdersWrite, Resource{Symbol: "SOL-USD", Account: "acc-1"}, false},
+		{ScopeOrdersWrite, Resource{Symbol: "BTC-USD", Account: "acc-2"}, false},
+		// Fields left empty are not checked
+		{ScopeOrdersWrite, Resource{Symbol: "BTC-USD"}, true},
+		{ScopeOrdersWrite, Resource{Account: "acc-1"}, true},
+		{ScopeOrdersWrite, Resource{}, true},
+		{ScopeOrdersRead, Resource{Symbol: "BTC-USD", Account: "acc-1"}, false},
+	}
+	for _, tt := range tests {
+		if got := scope.Allows(tt.permission, tt.resource); got != tt.want {
+			t.Errorf("Allows(%s, %+v) = %v, want %v", tt.permission, tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	policy, err := NewPolicy(map[string][]string{
+		RoleTrader:  {"orders:write@symbol=BTC-USD", ScopeOrdersRead},
+		RoleAnalyst: {ScopeMarketDataRead},
+	})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims Claims
+		want   []string
+	}{
+		{"role", Claims{Role: RoleTrader}, []string{"orders:read", "orders:write@symbol=BTC-USD"}},
+		{"roles are combined", Claims{Role: RoleTrader, Roles: []string{RoleAnalyst}}, []string{
+			"marketdata:read", "orders:read", "orders:write@symbol=BTC-USD",
+		}},
+		{"unknown role", Claims{Role: "auditor"}, []string{}},
+		// Explicit scopes narrow the role grant rather than adding to it
+		{"explicit scopes narrow", Claims{Role: RoleTrader, Scopes: []string{ScopeOrdersRead}}, []string{"orders:read"}},
+		{"explicit scopes within the role", Claims{Role: RoleTrader, Scopes: []string{
+			"orders:write@symbol=BTC-USD@account=acc-1", "orders:write@symbol=ETH-USD", ScopeMarketDataRead,
+		}}, []string{"orders:write@symbol=BTC-USD@account=acc-1"}},
+		{"explicit scopes without a role", Claims{Scopes: []string{"orders:write@account=acc-1"}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			if err := policy.Apply(&claims); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if got := claims.GrantedScopes(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("granted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A role's symbol limit holds when the scope is checked
+	claims := &Claims{Role: RoleTrader}
+	policy.Apply(claims)
+	if claims.Allows(ScopeOrdersWrite, Resource{Symbol: "ETH-USD"}) || !claims.Allows(ScopeOrdersWrite, Resource{Symbol: "BTC-USD"}) {
+		t.Fatalf("granted %v, want orders:write only on BTC-USD", claims.GrantedScopes())
+	}
+
+	if err := policy.Apply(&Claims{Role: RoleTrader, Scopes: []string{"orders:write@"}}); err == nil {
+		t.Fatal("malformed explicit scope accepted")
+	}
+	if _, err := NewPolicy(map[string][]string{RoleTrader: {"orders:write@desk=1"}}); err == nil {
+		t.Fatal("policy with a malformed scope accepted")
+	}
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session groups the access and refresh tokens issued from one login.
+// Only the latest token of each kind is valid; rotation revokes the rest.
+type Session struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"user_id"`
+	Role           string    `json:"role"`
+	Roles          []string  `json:"roles,omitempty"`
+	Scopes         []string  `json:"scopes,omitempty"`
+	AccessTokenID  string    `json:"access_token_id"`
+	RefreshTokenID string    `json:"refresh_token_id"`
+	AccessExpiry   time.Time `json:"access_expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	RefreshedAt    time.Time `json:"refreshed_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// TokenPair is returned on login and on every refresh
+type TokenPair struct {
+	SessionID        string    `json:"session_id"`
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenStore persists sessions and the revocation list keyed by token ID
+type TokenStore interface {
+	SaveSession(ctx context.Context, session *Session) error
+	// GetSession returns ErrSessionNotFound for unknown or expired sessions
+	GetSession(ctx context.Context, sessionID string) (*Session, error)
+	ListSessions(ctx context.Context, userID string) ([]*Session, error)
+	DeleteSession(ctx context.Context, session *Session) error
+	// RevokeToken keeps the token ID on the revocation list until expiresAt
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeUserTokens invalidates every token for the user issued before now
+	RevokeUserTokens(ctx context.Context, userID string, ttl time.Duration) error
+	IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error)
+}
+
+// GenerateTokenPair starts a new session for the principal, with a
+// short-lived access token and a refresh token carrying its roles and
+// scopes
+func (s *JWTService) GenerateTokenPair(ctx context.Context, principal *Claims) (*TokenPair, error) {
+	if s.store == nil {
+		return nil, ErrTokenStoreMissing
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:        uuid.New().String(),
+		UserID:    principal.UserID,
+		Role:      principal.Role,
+		Roles:     principal.Roles,
+		Scopes:    principal.Scopes,
+		CreatedAt: now,
+	}
+
+	return s.issuePair(ctx, session, now)
+}
+
+// StartSession exchanges a validated access token that belongs to no
+// session, such as one issued at login by the auth service, for a session
+// token pair. The token is revoked by its TokenID so each login starts one
+// session; tokens without a jti are accepted.
+func (s *JWTService) StartSession(ctx context.Context, claims *Claims) (*TokenPair, error) {
+	if s.store == nil {
+		return nil, ErrTokenStoreMissing
+	}
+	if s.keySet != nil {
+		return nil, ErrSigningDisabled
+	}
+	if claims.SessionID != "" || claims.APIKeyID != "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.store.RevokeToken(ctx, claims.TokenID(), claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	return s.GenerateTokenPair(ctx, claims)
+}
+
+// RefreshTokens exchanges a refresh token for a new pair. The presented
+// refresh token and the session's previous access token are revoked;
+// presenting an already rotated refresh token revokes the whole session.
+func (s *JWTService) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if s.store == nil {
+		return nil, ErrTokenStoreMissing
+	}
+
+	claims, err := s.parse(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeRefresh || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := s.store.GetSession(ctx, claims.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrRevokedToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.RefreshTokenID != claims.ID {
+		// A rotated refresh token is being replayed; assume it was stolen
+		if err := s.RevokeSession(ctx, session); err != nil {
+			return nil, err
+		}
+		return nil, ErrRevokedToken
+	}
+
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.RevokeToken(ctx, session.AccessTokenID, session.AccessExpiry); err != nil {
+		return nil, err
+	}
+	if err := s.store.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	return s.issuePair(ctx, session, time.Now())
+}
+
+func (s *JWTService) issuePair(ctx context.Context, session *Session, now time.Time) (*TokenPair, error) {
+	access := s.newClaims(session.UserID, session.Role, session.ID, TokenTypeAccess, now, s.accessTTL)
+	refresh := s.newClaims(session.UserID, session.Role, session.ID, TokenTypeRefresh, now, s.refreshTTL)
+	access.Roles, access.Scopes = session.Roles, session.Scopes
+	refresh.Roles, refresh.Scopes = session.Roles, session.Scopes
+
+	accessToken, err := s.sign(access)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.sign(refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	session.AccessTokenID = access.ID
+	session.RefreshTokenID = refresh.ID
+	session.AccessExpiry = access.ExpiresAt.Time
+	session.RefreshedAt = now
+	session.ExpiresAt = refresh.ExpiresAt.Time
+
+	if err := s.store.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		SessionID:        session.ID,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  access.ExpiresAt.Time,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refresh.ExpiresAt.Time,
+	}, nil
+}
+
+// GetSession looks up a session by ID
+func (s *JWTService) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	if s.store == nil {
+		return nil, ErrTokenStoreMissing
+	}
+	return s.store.GetSession(ctx, sessionID)
+}
+
+// ListSessions returns the user's active sessions
+func (s *JWTService) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	if s.store == nil {
+		return nil, ErrTokenStoreMissing
+	}
+	return s.store.ListSessions(ctx, userID)
+}
+
+// RevokeSession revokes both tokens of a session and forgets it
+func (s *JWTService) RevokeSession(ctx context.Context, session *Session) error {
+	if s.store == nil {
+		return ErrTokenStoreMissing
+	}
+
+	if err := s.store.RevokeToken(ctx, session.AccessTokenID, session.AccessExpiry); err != nil {
+		return err
+	}
+	if err := s.store.RevokeToken(ctx, session.RefreshTokenID, session.ExpiresAt); err != nil {
+		return err
+	}
+	return s.store.DeleteSession(ctx, session)
+}
+
+// RevokeAllForUser immediately invalidates every token issued to the user,
+// including tokens that do not belong to a session
+func (s *JWTService) RevokeAllForUser(ctx context.Context, userID string) (int, error) {
+	if s.store == nil {
+		return 0, ErrTokenStoreMissing
+	}
+
+	ttl := s.refreshTTL
+	if s.accessTTL > ttl {
+		ttl = s.accessTTL
+	}
+	if err := s.store.RevokeUserTokens(ctx, userID, ttl); err != nil {
+		return 0, err
+	}
+
+	sessions, err := s.store.ListSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, session := range sessions {
+		if err := s.RevokeSession(ctx, session); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(sessions), nil
+}
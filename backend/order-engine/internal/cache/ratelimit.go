@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+)
+
+const rateLimitPrefix = "ratelimit:"
+
+// takeTokensScript refills and charges a token bucket atomically using the
+// Redis clock, so replicas with skewed clocks share one consistent bucket.
+// It returns whether the request was allowed and the tokens left.
+var takeTokensScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Allow charges a token bucket shared by every replica
+func (c *RedisCache) Allow(ctx context.Context, key string, limit ratelimit.Limit, cost float64) (ratelimit.Result, error) {
+	values, err := takeTokensScript.Run(ctx, c.client, []string{rateLimitPrefix + key},
+		limit.Rate, limit.Burst, cost).Slice()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take tokens: %w", err)
+	}
+	if len(values) != 2 {
+		return ratelimit.Result{}, fmt.Errorf("unexpected rate limit reply %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("invalid token count %q: %w", raw, err)
+	}
+
+	return ratelimit.ResultFor(limit, tokens, cost, allowed == 1), nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+)
+
+// newTestCache connects to an in-process Redis whose clock the test sets
+func newTestCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	m.SetTime(time.Unix(1700000000, 0))
+	c, err := NewRedisCache(m.Addr(), "", 0, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new redis cache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, m
+}
+
+func allow(t *testing.T, c *RedisCache, key string, limit ratelimit.Limit, cost float64) ratelimit.Result {
+	t.Helper()
+	result, err := c.Allow(context.Background(), key, limit, cost)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	return result
+}
+
+func TestRedisLimiterBurstAndRefill(t *testing.T) {
+	c, m := newTestCache(t)
+	limit := ratelimit.Limit{Rate: 2, Burst: 4}
+
+	for i := 0; i < 4; i++ {
+		if result := allow(t, c, "ip:a", limit, 1); !result.Allowed {
+			t.Fatalf("request %d denied", i+1)
+		}
+	}
+	result := allow(t, c, "ip:a", limit, 1)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("request over the burst: %+v, want denied with a 500ms retry", result)
+	}
+
+	// Other keys have their own bucket
+	if !allow(t, c, "ip:b", limit, 1).Allowed {
+		t.Fatal("other bucket limited")
+	}
+
+	// The bucket refills on the Redis clock
+	m.SetTime(time.Unix(1700000000, 0).Add(500 * time.Millisecond))
+	if result := allow(t, c, "ip:a", limit, 1); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after refill: %+v, want allowed with none left", result)
+	}
+
+	// Refills stop at the burst
+	m.SetTime(time.Unix(1700000000, 0).Add(time.Minute))
+	if result := allow(t, c, "ip:a", limit, 1); result.Remaining != 3 {
+		t.Fatalf("after a long idle: %v left, want 3", result.Remaining)
+	}
+}
+
+func TestRedisLimiterWeight(t *testing.T) {
+	c, _ := newTestCache(t)
+	limit := ratelimit.Limit{Rate: 1, Burst: 10}
+
+	if result := allow(t, c, "user:alice", limit, 7.5); !result.Allowed || result.Remaining != 2.5 {
+		t.Fatalf("weighted request: %+v, want allowed with 2.5 left", result)
+	}
+
+	// A denied request takes nothing
+	if result := allow(t, c, "user:alice", limit, 3); result.Allowed || result.Remaining != 2.5 {
+		t.Fatalf("heavy request: %+v, want denied with 2.5 left", result)
+	}
+	if !allow(t, c, "user:alice", limit, 2.5).Allowed {
+		t.Fatal("request within the remaining tokens denied")
+	}
+}
+
+func TestRedisLimiterExpiresIdleBuckets(t *testing.T) {
+	c, m := newTestCache(t)
+
+	allow(t, c, "ip:a", ratelimit.Limit{Rate: 1, Burst: 10}, 1)
+	if ttl := m.TTL(rateLimitPrefix + "ip:a"); ttl != 11*time.Second {
+		t.Fatalf("bucket ttl %s, want the refill time plus a second", ttl)
+	}
+}
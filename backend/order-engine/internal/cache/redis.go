@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,9 +13,18 @@ import (
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
 )
 
+// tradeQueueSize bounds the trades waiting to be cached; later trades are
+// dropped from the cache, which only serves recent trades
+const tradeQueueSize = 4096
+
 type RedisCache struct {
 	client *redis.Client
 	logger *zap.Logger
+
+	trades    chan types.Trade
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewRedisCache(addr, password string, db int, logger *zap.Logger) (*RedisCache, error) {
@@ -31,10 +41,15 @@ func NewRedisCache(addr, password string, db int, logger *zap.Logger) (*RedisCac
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &RedisCache{
-		client: client,
-		logger: logger,
-	}, nil
+	c := &RedisCache{
+		client:  client,
+		logger:  logger,
+		trades:  make(chan types.Trade, tradeQueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.runTradeWriter()
+	return c, nil
 }
 
 // Key prefixes
@@ -83,6 +98,44 @@ func (c *RedisCache) GetOrderBook(ctx context.Context, symbol string) (*types.Or
 	return &snapshot, nil
 }
 
+// RecordTrade queues a trade to be cached, so it can be registered as a
+// matching engine trade listener. It never blocks: while Redis falls behind
+// or after Close, trades are left out of the cache.
+func (c *RedisCache) RecordTrade(trade types.Trade) {
+	select {
+	case <-c.closing:
+		return
+	default:
+	}
+
+	select {
+	case c.trades <- trade:
+	default:
+		c.logger.Warn("Trade cache queue full, skipping trade",
+			zap.String("trade_id", trade.ID),
+			zap.String("symbol", trade.Symbol))
+	}
+}
+
+func (c *RedisCache) runTradeWriter() {
+	defer close(c.done)
+
+	for {
+		select {
+		case trade := <-c.trades:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := c.CacheTrade(ctx, &trade); err != nil {
+				c.logger.Error("Failed to cache trade",
+					zap.Error(err),
+					zap.String("trade_id", trade.ID))
+			}
+			cancel()
+		case <-c.closing:
+			return
+		}
+	}
+}
+
 // CacheTrade stores the trade in Redis
 func (c *RedisCache) CacheTrade(ctx context.Context, trade *types.Trade) error {
 	key := fmt.Sprintf("%s%s:%s", tradePrefix, trade.Symbol, trade.ID)
@@ -193,5 +246,8 @@ func (c *RedisCache) GetOrder(ctx context.Context, orderID string) (*types.Order
 
 // Close closes the Redis connection
 func (c *RedisCache) Close() error {
+	// The trade channel is never closed, as the engine may still send on it
+	c.closeOnce.Do(func() { close(c.closing) })
+	<-c.done
 	return c.client.Close()
 } 
\ No newline at end of file
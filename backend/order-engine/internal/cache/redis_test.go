@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestRecordTrade(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	c.RecordTrade(types.Trade{ID: "t1", Symbol: "BTC-USD", Price: 100, Quantity: 1, ExecutedAt: time.Now()})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		trades, err := c.GetRecentTrades(ctx, "BTC-USD", 10)
+		if err != nil {
+			t.Fatalf("recent trades: %v", err)
+		}
+		if len(trades) == 1 && trades[0].ID == "t1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recent trades = %v, want t1", trades)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Trades recorded after Close are skipped rather than panicking
+	c.Close()
+	c.RecordTrade(types.Trade{ID: "t2", Symbol: "BTC-USD"})
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// Key prefixes for sessions, the token revocation list and API key
+// request signatures
+const (
+	sessionPrefix       = "session:"
+	userSessionsPrefix  = "user_sessions:"
+	revokedTokenPrefix  = "revoked_token:"
+	revokedUserPrefix   = "revoked_user:"
+	usedSignaturePrefix = "used_signature:"
+)
+
+// SaveSession stores the session until its refresh token expires
+func (c *RedisCache) SaveSession(ctx context.Context, session *auth.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session %s has already expired", session.ID)
+	}
+
+	userKey := userSessionsPrefix + session.UserID
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, sessionPrefix+session.ID, data, ttl)
+	pipe.SAdd(ctx, userKey, session.ID)
+	pipe.Expire(ctx, userKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (c *RedisCache) GetSession(ctx context.Context, sessionID string) (*auth.Session, error) {
+	data, err := c.client.Get(ctx, sessionPrefix+sessionID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, auth.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session auth.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// ListSessions returns the user's sessions, pruning any that have expired
+func (c *RedisCache) ListSessions(ctx context.Context, userID string) ([]*auth.Session, error) {
+	userKey := userSessionsPrefix + userID
+	ids, err := c.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := make([]*auth.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := c.GetSession(ctx, id)
+		if err == auth.ErrSessionNotFound {
+			c.client.SRem(ctx, userKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession removes a session and its entry in the user's index
+func (c *RedisCache) DeleteSession(ctx context.Context, session *auth.Session) error {
+	pipe := c.client.TxPipeline()
+	pipe.Del(ctx, sessionPrefix+session.ID)
+	pipe.SRem(ctx, userSessionsPrefix+session.UserID, session.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken adds the token ID to the revocation list until it expires
+func (c *RedisCache) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+
+	if err := c.client.Set(ctx, revokedTokenPrefix+tokenID, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserTokens records a cutoff before which all of the user's tokens
+// are invalid. The cutoff is kept for the longest token lifetime.
+func (c *RedisCache) RevokeUserTokens(ctx context.Context, userID string, ttl time.Duration) error {
+	cutoff := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := c.client.Set(ctx, revokedUserPrefix+userID, cutoff, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked checks the token ID and the user's cutoff in one round trip
+func (c *RedisCache) IsTokenRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error) {
+	pipe := c.client.Pipeline()
+	tokenCmd := pipe.Exists(ctx, revokedTokenPrefix+tokenID)
+	userCmd := pipe.Get(ctx, revokedUserPrefix+userID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to check revocation: %w", err)
+	}
+
+	if tokenCmd.Val() > 0 {
+		return true, nil
+	}
+
+	cutoff, err := userCmd.Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read revocation cutoff: %w", err)
+	}
+
+	// Token timestamps have second precision, so a token issued in the same
+	// second as the cutoff is treated as revoked
+	return issuedAt.Unix() <= cutoff, nil
+}
+
+// MarkUsed records a request signature for ttl and reports whether it was
+// seen for the first time
+func (c *RedisCache) MarkUsed(ctx context.Context, signature string, ttl time.Duration) (bool, error) {
+	fresh, err := c.client.SetNX(ctx, usedSignaturePrefix+signature, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record request signature: %w", err)
+	}
+	return fresh, nil
+}
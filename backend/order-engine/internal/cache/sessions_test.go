@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// newTestJWTService issues tokens with sessions kept in an in-process Redis
+func newTestJWTService(t *testing.T) (*auth.JWTService, *RedisCache) {
+	c, _ := newTestCache(t)
+	s := auth.NewJWTService("secret", "order-engine")
+	s.SetTokenStore(c)
+	return s, c
+}
+
+// startSession logs the user in and exchanges the login token for a session
+func startSession(t *testing.T, s *auth.JWTService, userID string) *auth.TokenPair {
+	t.Helper()
+	ctx := context.Background()
+
+	login, err := s.GenerateToken(userID, auth.RoleTrader, time.Minute)
+	if err != nil {
+		t.Fatalf("generate login token: %v", err)
+	}
+	claims, err := s.ValidateToken(ctx, login)
+	if err != nil {
+		t.Fatalf("validate login token: %v", err)
+	}
+	pair, err := s.StartSession(ctx, claims)
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	// The login token cannot be used again
+	if _, err := s.ValidateToken(ctx, login); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("login token after the exchange: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	return pair
+}
+
+func TestStartSession(t *testing.T) {
+	s, _ := newTestJWTService(t)
+	ctx := context.Background()
+
+	pair := startSession(t, s, "alice")
+	claims, err := s.ValidateToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("validate access token: %v", err)
+	}
+	if claims.UserID != "alice" || claims.SessionID != pair.SessionID || !claims.HasRole(auth.RoleTrader) {
+		t.Fatalf("claims = %+v, want alice's trader session", claims)
+	}
+
+	sessions, err := s.ListSessions(ctx, "alice")
+	if err != nil || len(sessions) != 1 || sessions[0].ID != pair.SessionID {
+		t.Fatalf("sessions = %v, %v, want the new session", sessions, err)
+	}
+
+	// Session tokens cannot start further sessions
+	if _, err := s.StartSession(ctx, claims); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("session from a session token: got %v, want %v", err, auth.ErrInvalidToken)
+	}
+
+	// Refresh tokens are not access tokens
+	if _, err := s.ValidateToken(ctx, pair.RefreshToken); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("refresh token used for access: got %v, want %v", err, auth.ErrInvalidToken)
+	}
+}
+
+func TestStartSessionFromAuthServiceToken(t *testing.T) {
+	s, _ := newTestJWTService(t)
+	s.SetIssuerOptional(true)
+	ctx := context.Background()
+
+	// The auth service signs {id, email, roles} with no jti or issuer
+	login := func(issuedAt time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"id":    "alice",
+			"email": "alice@example.com",
+			"roles": []string{auth.RoleTrader},
+			"iat":   issuedAt.Unix(),
+			"exp":   issuedAt.Add(15 * time.Minute).Unix(),
+		}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return token
+	}
+	laptop, phone := login(time.Now().Add(-time.Minute)), login(time.Now())
+
+	claims, err := s.ValidateToken(ctx, laptop)
+	if err != nil {
+		t.Fatalf("validate login token: %v", err)
+	}
+	pair, err := s.StartSession(ctx, claims)
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	if session, err := s.ValidateToken(ctx, pair.AccessToken); err != nil || session.UserID != "alice" {
+		t.Fatalf("session token = %+v, %v, want alice's session", session, err)
+	}
+
+	// The exchanged token is revoked, the other device's login is not
+	if _, err := s.ValidateToken(ctx, laptop); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("exchanged login token: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if _, err := s.ValidateToken(ctx, phone); err != nil {
+		t.Fatalf("other login token: %v", err)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, _ := newTestJWTService(t)
+	ctx := context.Background()
+
+	first := startSession(t, s, "alice")
+	second, err := s.RefreshTokens(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh returned %+v, want new tokens for the same session", second)
+	}
+
+	// Rotation revokes the previous access token
+	if _, err := s.ValidateToken(ctx, first.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("previous access token: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if _, err := s.ValidateToken(ctx, second.AccessToken); err != nil {
+		t.Fatalf("current access token: %v", err)
+	}
+
+	third, err := s.RefreshTokens(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+
+	// Replaying a rotated refresh token revokes the whole session
+	if _, err := s.RefreshTokens(ctx, first.RefreshToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("replayed refresh token: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if _, err := s.ValidateToken(ctx, third.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("access token after reuse: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if _, err := s.RefreshTokens(ctx, third.RefreshToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("refresh token after reuse: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if _, err := s.GetSession(ctx, first.SessionID); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Fatalf("session after reuse: got %v, want %v", err, auth.ErrSessionNotFound)
+	}
+}
+
+func TestRevokeAllForUser(t *testing.T) {
+	s, _ := newTestJWTService(t)
+	ctx := context.Background()
+
+	alice := []*auth.TokenPair{startSession(t, s, "alice"), startSession(t, s, "alice")}
+	standalone, _ := s.GenerateToken("alice", auth.RoleTrader, time.Minute)
+	bob := startSession(t, s, "bob")
+
+	count, err := s.RevokeAllForUser(ctx, "alice")
+	if err != nil || count != 2 {
+		t.Fatalf("revoked %d sessions, %v, want 2", count, err)
+	}
+
+	// The cutoff covers every token issued to alice up to now, with or
+	// without a session
+	for _, token := range []string{alice[0].AccessToken, alice[1].AccessToken, standalone} {
+		if _, err := s.ValidateToken(ctx, token); !errors.Is(err, auth.ErrRevokedToken) {
+			t.Fatalf("alice's token after the cutoff: got %v, want %v", err, auth.ErrRevokedToken)
+		}
+	}
+	if _, err := s.RefreshTokens(ctx, alice[0].RefreshToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Fatalf("alice's refresh token after the cutoff: got %v, want %v", err, auth.ErrRevokedToken)
+	}
+	if sessions, _ := s.ListSessions(ctx, "alice"); len(sessions) != 0 {
+		t.Fatalf("alice still has %d sessions", len(sessions))
+	}
+
+	// Other users are unaffected
+	if _, err := s.ValidateToken(ctx, bob.AccessToken); err != nil {
+		t.Fatalf("bob's token: %v", err)
+	}
+}
+
+func TestMarkUsed(t *testing.T) {
+	c, m := newTestCache(t)
+	ctx := context.Background()
+
+	fresh, err := c.MarkUsed(ctx, "signature", time.Minute)
+	if err != nil || !fresh {
+		t.Fatalf("first use = %v, %v, want fresh", fresh, err)
+	}
+	if fresh, _ := c.MarkUsed(ctx, "signature", time.Minute); fresh {
+		t.Fatal("replayed signature reported fresh")
+	}
+	if fresh, _ := c.MarkUsed(ctx, "other", time.Minute); !fresh {
+		t.Fatal("other signature reported used")
+	}
+
+	// Signatures are forgotten once they could no longer be accepted
+	m.FastForward(time.Minute)
+	if fresh, _ := c.MarkUsed(ctx, "signature", time.Minute); !fresh {
+		t.Fatal("signature still recorded after its ttl")
+	}
+}
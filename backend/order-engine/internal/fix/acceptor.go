@@ -0,0 +1,273 @@
+package fix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// DefaultLogonTimeout is how long a new connection has to send its Logon
+const DefaultLogonTimeout = 10 * time.Second
+
+// maxHeartBtInt bounds the heartbeat interval a counterparty may ask for
+const maxHeartBtInt = 300
+
+var ErrAcceptorClosed = errors.New("fix: acceptor closed")
+
+// Handler processes an application message received on a session
+type Handler func(s *Session, msg *Message)
+
+// Acceptor accepts FIX 4.4 connections. Counterparties log on with an
+// access token in the Password field; a session is bound to the user who
+// first logs on to it and refused to anyone else.
+type Acceptor struct {
+	compID       string
+	store        SessionStore
+	jwt          *auth.JWTService
+	logger       *zap.Logger
+	logonTimeout time.Duration
+	handlers     map[string]Handler
+	disconnected []func(s *Session)
+
+	mutex     sync.Mutex
+	sessions  map[string]*Session
+	connected map[string]bool
+	listeners map[net.Listener]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewAcceptor creates an acceptor answering to compID
+func NewAcceptor(compID string, store SessionStore, jwtService *auth.JWTService, logger *zap.Logger) *Acceptor {
+	return &Acceptor{
+		compID:       compID,
+		store:        store,
+		jwt:          jwtService,
+		logger:       logger,
+		logonTimeout: DefaultLogonTimeout,
+		handlers:     make(map[string]Handler),
+		sessions:     make(map[string]*Session),
+		connected:    make(map[string]bool),
+		listeners:    make(map[net.Listener]bool),
+	}
+}
+
+// SetLogonTimeout sets how long a new connection has to log on
+func (a *Acceptor) SetLogonTimeout(timeout time.Duration) {
+	a.logonTimeout = timeout
+}
+
+// Handle registers the handler for an application message type. Handlers
+// must be registered before Serve is called.
+func (a *Acceptor) Handle(msgType string, handler Handler) {
+	a.handlers[msgType] = handler
+}
+
+// OnDisconnect registers a function called after a session's connection
+// closes, e.g. to drop its subscriptions. It must be registered before
+// Serve is called.
+func (a *Acceptor) OnDisconnect(fn func(s *Session)) {
+	a.disconnected = append(a.disconnected, fn)
+}
+
+// Serve accepts connections on the listener until it is closed
+func (a *Acceptor) Serve(listener net.Listener) error {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		listener.Close()
+		return ErrAcceptorClosed
+	}
+	a.listeners[listener] = true
+	a.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			a.mutex.Lock()
+			closed := a.closed
+			a.mutex.Unlock()
+			if closed {
+				return ErrAcceptorClosed
+			}
+			return err
+		}
+
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.serveConn(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and logs out every connected session
+func (a *Acceptor) Close() error {
+	a.mutex.Lock()
+	a.closed = true
+	for listener := range a.listeners {
+		listener.Close()
+	}
+	sessions := make([]*Session, 0, len(a.connected))
+	for id := range a.connected {
+		sessions = append(sessions, a.sessions[id])
+	}
+	a.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.logout("acceptor shutting down")
+	}
+	a.wg.Wait()
+	return nil
+}
+
+// DisconnectUser logs out every connected session of the user with the
+// reason in Text, and returns how many were logged out. The sessions can
+// log on again with a valid token.
+func (a *Acceptor) DisconnectUser(userID, reason string) int {
+	a.mutex.Lock()
+	var sessions []*Session
+	for id := range a.connected {
+		if s := a.sessions[id]; s.UserID() == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	a.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.logout(reason)
+	}
+	return len(sessions)
+}
+
+// serveConn logs the connection on and runs its session until it closes
+func (a *Acceptor) serveConn(conn net.Conn) {
+	defer conn.Close()
+	logger := a.logger.With(zap.String("remote_addr", conn.RemoteAddr().String()))
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(a.logonTimeout))
+	msg, _, err := ReadMessage(reader)
+	if err != nil {
+		logger.Warn("Failed to read logon", zap.Error(err))
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	targetCompID, _ := msg.Get(TagSenderCompID)
+	seq, _ := msg.Int(TagMsgSeqNum)
+	if msg.MsgType() != MsgTypeLogon {
+		logger.Warn("First message was not a logon", zap.String("msg_type", msg.MsgType()))
+		writeLogout(conn, a.compID, targetCompID, 1, "first message must be a logon")
+		return
+	}
+	if target, _ := msg.Get(TagTargetCompID); target != a.compID || targetCompID == "" || seq <= 0 {
+		logger.Warn("Logon with invalid header",
+			zap.String("sender_comp_id", targetCompID),
+			zap.String("target_comp_id", target))
+		writeLogout(conn, a.compID, targetCompID, 1, "invalid CompID or MsgSeqNum")
+		return
+	}
+
+	heartBtInt, err := msg.Int(TagHeartBtInt)
+	if err != nil || heartBtInt <= 0 || heartBtInt > maxHeartBtInt {
+		writeLogout(conn, a.compID, targetCompID, 1, fmt.Sprintf("HeartBtInt must be between 1 and %d", maxHeartBtInt))
+		return
+	}
+	if encrypt, _ := msg.Get(TagEncryptMethod); encrypt != "0" {
+		writeLogout(conn, a.compID, targetCompID, 1, "EncryptMethod must be 0")
+		return
+	}
+
+	token, _ := msg.Get(TagPassword)
+	claims, err := a.jwt.ValidateToken(context.Background(), token)
+	if err != nil {
+		logger.Warn("FIX logon authentication failed",
+			zap.Error(err),
+			zap.String("sender_comp_id", targetCompID))
+		writeLogout(conn, a.compID, targetCompID, 1, "authentication failed")
+		return
+	}
+
+	s, err := a.attach(targetCompID, claims.UserID)
+	if err != nil {
+		logger.Warn("FIX logon refused",
+			zap.Error(err),
+			zap.String("sender_comp_id", targetCompID),
+			zap.String("user_id", claims.UserID))
+		writeLogout(conn, a.compID, targetCompID, 1, err.Error())
+		return
+	}
+	defer a.release(s)
+
+	if !s.logon(conn, msg, token, claims, time.Duration(heartBtInt)*time.Second) {
+		return
+	}
+	s.logger.Info("FIX session logged on",
+		zap.String("user_id", claims.UserID),
+		zap.String("remote_addr", conn.RemoteAddr().String()))
+
+	s.run(reader)
+	s.logger.Info("FIX session disconnected")
+}
+
+// attach finds or creates the session for a counterparty and marks it
+// connected. A session can only have one connection at a time.
+func (a *Acceptor) attach(targetCompID, userID string) (*Session, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.closed {
+		return nil, ErrAcceptorClosed
+	}
+
+	id := sessionID(a.compID, targetCompID)
+	if a.connected[id] {
+		return nil, fmt.Errorf("session %s is already logged on", id)
+	}
+
+	s, exists := a.sessions[id]
+	if !exists {
+		ctx := context.Background()
+		state, err := a.store.LoadSession(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		if state == nil {
+			if err := a.store.ResetSession(ctx, id, userID); err != nil {
+				return nil, fmt.Errorf("failed to create session: %w", err)
+			}
+			state = &SessionState{UserID: userID, NextSenderSeq: 1, NextTargetSeq: 1}
+		}
+		s = newSession(a, targetCompID, state)
+		a.sessions[id] = s
+	}
+
+	if s.UserID() != userID {
+		return nil, fmt.Errorf("session %s belongs to another user", id)
+	}
+
+	a.connected[id] = true
+	return s, nil
+}
+
+// release marks the session disconnected
+func (a *Acceptor) release(s *Session) {
+	s.detach()
+
+	for _, fn := range a.disconnected {
+		fn(s)
+	}
+
+	a.mutex.Lock()
+	delete(a.connected, s.id)
+	a.mutex.Unlock()
+}
@@ -0,0 +1,401 @@
+package fix
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+const testCompID = "ENGINE"
+
+// masterAccounts resolves every order to the user's master account
+type masterAccounts struct{}
+
+func (masterAccounts) ResolveAccount(ctx context.Context, userID, accountID string) (types.Account, error) {
+	return types.Account{ID: userID, UserID: userID}, nil
+}
+
+type testEnv struct {
+	t        *testing.T
+	jwt      *auth.JWTService
+	store    *MemoryStore
+	engine   *matching.MatchingEngine
+	acceptor *Acceptor
+	addr     string
+}
+
+// newTestEnv runs an acceptor with an order entry gateway on localhost
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{
+		t:      t,
+		jwt:    auth.NewJWTService("test-secret", "test"),
+		store:  NewMemoryStore(),
+		engine: matching.NewMatchingEngine(),
+	}
+
+	gateway := NewGateway(LocalEngine(env.engine), masterAccounts{}, zap.NewNop())
+	env.engine.AddTradeListener(gateway.OnTrade)
+	env.engine.AddOrderListener(gateway.OnOrder)
+	marketData := NewMarketData(env.engine, zap.NewNop())
+	env.engine.AddTradeListener(marketData.OnTrade)
+	env.engine.AddOrderListener(marketData.OnOrder)
+	ctx, cancel := context.WithCancel(context.Background())
+	go gateway.Run(ctx)
+	go marketData.Run(ctx)
+	t.Cleanup(cancel)
+
+	env.start()
+	gateway.Register(env.acceptor)
+	marketData.Register(env.acceptor)
+	return env
+}
+
+// start runs a new acceptor on the environment's store, as after a restart
+func (env *testEnv) start() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		env.t.Fatalf("listen: %v", err)
+	}
+	env.acceptor = NewAcceptor(testCompID, env.store, env.jwt, zap.NewNop())
+	env.addr = listener.Addr().String()
+	go env.acceptor.Serve(listener)
+	acceptor := env.acceptor
+	env.t.Cleanup(func() { acceptor.Close() })
+}
+
+// testClient is a scripted FIX initiator
+type testClient struct {
+	t       *testing.T
+	conn    net.Conn
+	reader  *bufio.Reader
+	compID  string
+	nextSeq int
+}
+
+func (env *testEnv) dial(compID string, nextSeq int) *testClient {
+	conn, err := net.Dial("tcp", env.addr)
+	if err != nil {
+		env.t.Fatalf("dial: %v", err)
+	}
+	env.t.Cleanup(func() { conn.Close() })
+	return &testClient{t: env.t, conn: conn, reader: bufio.NewReader(conn), compID: compID, nextSeq: nextSeq}
+}
+
+// logon connects as userID and waits for the Logon reply
+func (env *testEnv) logon(compID, userID string, nextSeq int, heartBtInt int) *testClient {
+	token, err := env.jwt.GenerateToken(userID, auth.RoleTrader, time.Hour)
+	if err != nil {
+		env.t.Fatalf("generate token: %v", err)
+	}
+	c := env.dial(compID, nextSeq)
+	c.send(NewMessage(MsgTypeLogon).
+		Set(TagEncryptMethod, "0").
+		SetInt(TagHeartBtInt, heartBtInt).
+		Set(TagPassword, token))
+	c.expect(MsgTypeLogon)
+	return c
+}
+
+func (c *testClient) send(msg *Message) {
+	c.t.Helper()
+	msg.Set(TagSenderCompID, c.compID).
+		Set(TagTargetCompID, testCompID).
+		SetTime(TagSendingTime, time.Now())
+	if _, ok := msg.Get(TagMsgSeqNum); !ok {
+		msg.SetInt(TagMsgSeqNum, c.nextSeq)
+		c.nextSeq++
+	}
+	if _, err := c.conn.Write(msg.Bytes()); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c *testClient) read() *Message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, _, err := ReadMessage(c.reader)
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// expect reads the next message other than a heartbeat and checks its type
+func (c *testClient) expect(msgType string) *Message {
+	c.t.Helper()
+	for {
+		msg := c.read()
+		if msg.MsgType() == MsgTypeHeartbeat && msgType != MsgTypeHeartbeat {
+			continue
+		}
+		if msg.MsgType() != msgType {
+			c.t.Fatalf("expected MsgType %s, got %s", msgType, msg)
+		}
+		return msg
+	}
+}
+
+// expectReport reads an ExecutionReport and checks its ExecType and OrdStatus
+func (c *testClient) expectReport(execType, ordStatus string) *Message {
+	c.t.Helper()
+	msg := c.expect(MsgTypeExecutionReport)
+	assertField(c.t, msg, TagExecType, execType)
+	assertField(c.t, msg, TagOrdStatus, ordStatus)
+	return msg
+}
+
+func assertField(t *testing.T, msg *Message, tag int, want string) {
+	t.Helper()
+	if got, _ := msg.Get(tag); got != want {
+		t.Fatalf("tag %d: expected %q, got %q in %s", tag, want, got, msg)
+	}
+}
+
+func newOrder(clOrdID, side, qty, price string) *Message {
+	return NewMessage(MsgTypeNewOrderSingle).
+		Set(TagClOrdID, clOrdID).
+		Set(TagSymbol, "BTC-USD").
+		Set(TagSide, side).
+		Set(TagOrderQty, qty).
+		Set(TagOrdType, OrdTypeLimit).
+		Set(TagPrice, price).
+		SetTime(TagTransactTime, time.Now())
+}
+
+func TestOrderEntry(t *testing.T) {
+	env := newTestEnv(t)
+	buyer := env.logon("BUYER", "user-1", 1, 30)
+	seller := env.logon("SELLER", "user-2", 1, 30)
+
+	buyer.send(newOrder("b-1", SideBuy, "1", "100"))
+	ack := buyer.expectReport(ExecTypeNew, OrdStatusNew)
+	assertField(t, ack, TagClOrdID, "b-1")
+	assertField(t, ack, TagLeavesQty, "1")
+	orderID, _ := ack.Get(TagOrderID)
+
+	// A duplicate ClOrdID is rejected while the order is open
+	buyer.send(newOrder("b-1", SideBuy, "1", "99"))
+	dup := buyer.expectReport(ExecTypeRejected, OrdStatusRejected)
+	assertField(t, dup, TagOrdRejReason, OrdRejReasonDuplicateOrder)
+
+	// Both sides receive their fill
+	seller.send(newOrder("s-1", SideSell, "0.4", "100"))
+	seller.expectReport(ExecTypeNew, OrdStatusNew)
+	sellFill := seller.expectReport(ExecTypeTrade, OrdStatusFilled)
+	assertField(t, sellFill, TagLastQty, "0.4")
+	assertField(t, sellFill, TagLastPx, "100")
+
+	buyFill := buyer.expectReport(ExecTypeTrade, OrdStatusPartiallyFilled)
+	assertField(t, buyFill, TagOrderID, orderID)
+	assertField(t, buyFill, TagCumQty, "0.4")
+	assertField(t, buyFill, TagLeavesQty, "0.6")
+
+	buyer.send(NewMessage(MsgTypeOrderCancelReplaceRequest).
+		Set(TagOrigClOrdID, "b-1").
+		Set(TagClOrdID, "b-2").
+		Set(TagSymbol, "BTC-USD").
+		Set(TagSide, SideBuy).
+		Set(TagOrderQty, "2").
+		Set(TagOrdType, OrdTypeLimit).
+		Set(TagPrice, "99").
+		SetTime(TagTransactTime, time.Now()))
+	replaced := buyer.expectReport(ExecTypeReplaced, OrdStatusPartiallyFilled)
+	assertField(t, replaced, TagClOrdID, "b-2")
+	assertField(t, replaced, TagOrigClOrdID, "b-1")
+	assertField(t, replaced, TagOrderQty, "2")
+	assertField(t, replaced, TagPrice, "99")
+	assertField(t, replaced, TagLeavesQty, "1.6")
+
+	buyer.send(NewMessage(MsgTypeOrderCancelRequest).
+		Set(TagOrigClOrdID, "b-2").
+		Set(TagClOrdID, "b-3").
+		Set(TagSymbol, "BTC-USD").
+		Set(TagSide, SideBuy).
+		SetTime(TagTransactTime, time.Now()))
+	canceled := buyer.expectReport(ExecTypeCanceled, OrdStatusCanceled)
+	assertField(t, canceled, TagClOrdID, "b-3")
+	assertField(t, canceled, TagOrigClOrdID, "b-2")
+	assertField(t, canceled, TagCumQty, "0.4")
+	assertField(t, canceled, TagLeavesQty, "0")
+
+	// The order is closed, so cancelling it again fails
+	buyer.send(NewMessage(MsgTypeOrderCancelRequest).
+		Set(TagOrigClOrdID, "b-2").
+		Set(TagClOrdID, "b-4").
+		Set(TagSymbol, "BTC-USD").
+		Set(TagSide, SideBuy).
+		SetTime(TagTransactTime, time.Now()))
+	reject := buyer.expect(MsgTypeOrderCancelReject)
+	assertField(t, reject, TagCxlRejReason, CxlRejReasonUnknownOrder)
+	assertField(t, reject, TagCxlRejResponseTo, CxlRejResponseToCancel)
+
+	// Market orders with nothing to trade against are rejected
+	seller.send(NewMessage(MsgTypeNewOrderSingle).
+		Set(TagClOrdID, "s-2").
+		Set(TagSymbol, "BTC-USD").
+		Set(TagSide, SideSell).
+		Set(TagOrderQty, "1").
+		Set(TagOrdType, OrdTypeMarket).
+		SetTime(TagTransactTime, time.Now()))
+	seller.expectReport(ExecTypeRejected, OrdStatusRejected)
+}
+
+func TestInvalidMessages(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.logon("CLIENT", "user-1", 1, 30)
+
+	c.send(NewMessage(MsgTypeNewOrderSingle).
+		Set(TagClOrdID, "c-1").
+		Set(TagSide, SideBuy).
+		SetTime(TagTransactTime, time.Now()))
+	reject := c.expect(MsgTypeReject)
+	assertField(t, reject, TagSessionRejectReason, SessionRejectRequiredTagMissing)
+	assertField(t, reject, TagRefTagID, "55")
+	assertField(t, reject, TagRefSeqNum, "2")
+
+	c.send(NewMessage("AE"))
+	businessReject := c.expect(MsgTypeBusinessMessageReject)
+	assertField(t, businessReject, TagBusinessRejectReason, BusinessRejectUnsupportedMsgType)
+}
+
+func TestLogonRequiresValidToken(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.dial("CLIENT", 1)
+	c.send(NewMessage(MsgTypeLogon).
+		Set(TagEncryptMethod, "0").
+		SetInt(TagHeartBtInt, 30).
+		Set(TagPassword, "not-a-token"))
+	logout := c.expect(MsgTypeLogout)
+	assertField(t, logout, TagText, "authentication failed")
+}
+
+func TestSessionBoundToUser(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.logon("CLIENT", "user-1", 1, 30)
+	c.send(NewMessage(MsgTypeLogout))
+	c.expect(MsgTypeLogout)
+
+	token, _ := env.jwt.GenerateToken("user-2", auth.RoleTrader, time.Hour)
+	other := env.dial("CLIENT", 3)
+	other.send(NewMessage(MsgTypeLogon).
+		Set(TagEncryptMethod, "0").
+		SetInt(TagHeartBtInt, 30).
+		Set(TagPassword, token))
+	other.expect(MsgTypeLogout)
+}
+
+func TestDisconnectUser(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.logon("ALICE", "user-1", 1, 30)
+	bob := env.logon("BOB", "user-2", 1, 30)
+
+	if n := env.acceptor.DisconnectUser("user-1", "credentials revoked"); n != 1 {
+		t.Fatalf("disconnected %d sessions, want 1", n)
+	}
+	logout := alice.expect(MsgTypeLogout)
+	assertField(t, logout, TagText, "credentials revoked")
+
+	// Other users stay logged on
+	bob.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "ping"))
+	bob.expect(MsgTypeHeartbeat)
+}
+
+func TestHeartbeats(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.logon("CLIENT", "user-1", 1, 2)
+
+	// The acceptor heartbeats an idle session, then tests a silent one
+	heartbeat := c.read()
+	if heartbeat.MsgType() != MsgTypeHeartbeat {
+		t.Fatalf("expected a heartbeat, got %s", heartbeat)
+	}
+	if _, ok := heartbeat.Get(TagTestReqID); ok {
+		t.Fatalf("unsolicited heartbeat carries TestReqID: %s", heartbeat)
+	}
+	test := c.expect(MsgTypeTestRequest)
+	id, _ := test.Get(TagTestReqID)
+	c.send(NewMessage(MsgTypeHeartbeat).Set(TagTestReqID, id))
+
+	c.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "ping"))
+	reply := c.expect(MsgTypeHeartbeat)
+	assertField(t, reply, TagTestReqID, "ping")
+}
+
+func TestSequenceGap(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.logon("CLIENT", "user-1", 1, 30)
+
+	// Skip MsgSeqNum 2: the acceptor asks for it and holds back 3
+	c.send(NewMessage(MsgTypeTestRequest).SetInt(TagMsgSeqNum, 3).Set(TagTestReqID, "after-gap"))
+	resend := c.expect(MsgTypeResendRequest)
+	assertField(t, resend, TagBeginSeqNo, "2")
+	assertField(t, resend, TagEndSeqNo, "0")
+
+	c.send(NewMessage(MsgTypeSequenceReset).
+		SetInt(TagMsgSeqNum, 2).
+		Set(TagPossDupFlag, "Y").
+		Set(TagGapFillFlag, "Y").
+		SetInt(TagNewSeqNo, 3))
+	reply := c.expect(MsgTypeHeartbeat)
+	assertField(t, reply, TagTestReqID, "after-gap")
+
+	// A duplicate below the expected sequence is ignored
+	c.send(NewMessage(MsgTypeTestRequest).SetInt(TagMsgSeqNum, 3).Set(TagPossDupFlag, "Y").Set(TagTestReqID, "dup"))
+	c.nextSeq = 4
+	c.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "next"))
+	reply = c.expect(MsgTypeHeartbeat)
+	assertField(t, reply, TagTestReqID, "next")
+}
+
+func TestResendAfterReconnect(t *testing.T) {
+	env := newTestEnv(t)
+	buyer := env.logon("BUYER", "user-1", 1, 30)
+	buyer.send(newOrder("b-1", SideBuy, "1", "100"))
+	ack := buyer.expectReport(ExecTypeNew, OrdStatusNew)
+	assertField(t, ack, TagMsgSeqNum, "2")
+	buyer.send(NewMessage(MsgTypeLogout))
+	buyer.expect(MsgTypeLogout)
+
+	// The buyer's order fills while it is offline
+	seller := env.logon("SELLER", "user-2", 1, 30)
+	seller.send(newOrder("s-1", SideSell, "1", "100"))
+	seller.expectReport(ExecTypeNew, OrdStatusNew)
+	seller.expectReport(ExecTypeTrade, OrdStatusFilled)
+
+	// After a restart the session resumes its sequence numbers, and the
+	// missed fill is resent on request
+	env.acceptor.Close()
+	env.start()
+	buyer = env.logon("BUYER", "user-1", 4, 30)
+	// Logon 1, report 2, logout 3, fill 4, logon 5
+	buyer.send(NewMessage(MsgTypeResendRequest).SetInt(TagBeginSeqNo, 1).SetInt(TagEndSeqNo, 0))
+
+	gapFill := buyer.expect(MsgTypeSequenceReset)
+	assertField(t, gapFill, TagMsgSeqNum, "1")
+	assertField(t, gapFill, TagNewSeqNo, "2")
+
+	report := buyer.expectReport(ExecTypeNew, OrdStatusNew)
+	assertField(t, report, TagMsgSeqNum, "2")
+	assertField(t, report, TagPossDupFlag, "Y")
+
+	gapFill = buyer.expect(MsgTypeSequenceReset)
+	assertField(t, gapFill, TagMsgSeqNum, "3")
+	assertField(t, gapFill, TagNewSeqNo, "4")
+
+	fill := buyer.expectReport(ExecTypeTrade, OrdStatusFilled)
+	assertField(t, fill, TagMsgSeqNum, "4")
+	assertField(t, fill, TagPossDupFlag, "Y")
+	assertField(t, fill, TagClOrdID, "b-1")
+
+	gapFill = buyer.expect(MsgTypeSequenceReset)
+	assertField(t, gapFill, TagMsgSeqNum, "5")
+	assertField(t, gapFill, TagNewSeqNo, "6")
+}
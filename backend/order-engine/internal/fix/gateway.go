@@ -0,0 +1,655 @@
+package fix
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// AccountResolver maps the Account field of an order to one of the user's
+// accounts. An empty account ID means the master account.
+type AccountResolver interface {
+	ResolveAccount(ctx context.Context, userID, accountID string) (types.Account, error)
+}
+
+// Engine executes the orders entered on a gateway's sessions: the matching
+// engine itself when the gateway runs in the server, or a Remote one. Its
+// fills and cancellations must be reported to the gateway's OnFill and
+// OnOrder under the order IDs the gateway submitted.
+type Engine interface {
+	// SubmitOrder places an order, setting its status and reject reason
+	// and the account it was placed on. Rejected orders are returned with
+	// an error explaining why.
+	SubmitOrder(s *Session, order *types.Order) error
+	CancelOrder(s *Session, orderID string) error
+	AmendOrder(s *Session, orderID string, price, quantity float64) error
+}
+
+// localEngine executes orders on a matching engine in the same process
+type localEngine struct {
+	engine *matching.MatchingEngine
+}
+
+// LocalEngine executes a gateway's orders on the matching engine. Register
+// the gateway's OnTrade and OnOrder as its listeners.
+func LocalEngine(engine *matching.MatchingEngine) Engine {
+	return localEngine{engine: engine}
+}
+
+func (e localEngine) SubmitOrder(_ *Session, order *types.Order) error {
+	_, err := e.engine.ProcessOrder(order)
+	return err
+}
+
+func (e localEngine) CancelOrder(_ *Session, orderID string) error {
+	return e.engine.CancelOrder(orderID)
+}
+
+func (e localEngine) AmendOrder(_ *Session, orderID string, price, quantity float64) error {
+	_, _, err := e.engine.AmendOrder(orderID, price, quantity)
+	return err
+}
+
+type orderState int
+
+const (
+	orderActive orderState = iota
+	// Fills of an order with a new or replace request in flight are held
+	// back until the request is acknowledged
+	orderPendingNew
+	orderPendingReplace
+	orderPendingCancel
+)
+
+// pendingFill is a fill held back while a request is in flight
+type pendingFill struct {
+	execID string
+	price  float64
+	qty    float64
+	fee    float64
+}
+
+// trackedOrder is an order entered through a session, with what the
+// gateway needs to build its execution reports
+type trackedOrder struct {
+	session  *Session
+	orderID  string
+	clOrdID  string
+	account  string
+	symbol   string
+	side     types.OrderSide
+	ordType  types.OrderType
+	price    float64
+	quantity float64
+	cumQty   float64
+	notional float64
+	state    orderState
+	// requestClOrdID is the ClOrdID of the cancel or replace in flight
+	requestClOrdID string
+	pending        []pendingFill
+	closed         bool
+}
+
+// outbound is a report waiting to be sent on a session
+type outbound struct {
+	session *Session
+	msg     *Message
+}
+
+// Gateway translates FIX order entry messages into matching engine calls
+// and reports every change to those orders as ExecutionReports. Feed it
+// the engine's fills and order changes and start Run.
+type Gateway struct {
+	engine   Engine
+	accounts AccountResolver
+	logger   *zap.Logger
+
+	// mutex guards the tracked orders and the report queue. It is taken
+	// by engine listeners, so it must never be held across engine calls.
+	mutex    sync.Mutex
+	orders   map[string]*trackedOrder
+	clOrdIDs map[string]map[string]*trackedOrder
+	queue    []outbound
+	signal   chan struct{}
+}
+
+func NewGateway(engine Engine, accounts AccountResolver, logger *zap.Logger) *Gateway {
+	return &Gateway{
+		engine:   engine,
+		accounts: accounts,
+		logger:   logger,
+		orders:   make(map[string]*trackedOrder),
+		clOrdIDs: make(map[string]map[string]*trackedOrder),
+		signal:   make(chan struct{}, 1),
+	}
+}
+
+// Register adds the order entry handlers to an acceptor
+func (g *Gateway) Register(a *Acceptor) {
+	a.Handle(MsgTypeNewOrderSingle, g.newOrderSingle)
+	a.Handle(MsgTypeOrderCancelRequest, g.orderCancelRequest)
+	a.Handle(MsgTypeOrderCancelReplaceRequest, g.orderCancelReplaceRequest)
+}
+
+// Run sends queued reports in order until the context is cancelled
+func (g *Gateway) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.signal:
+		}
+
+		g.mutex.Lock()
+		queue := g.queue
+		g.queue = nil
+		g.mutex.Unlock()
+
+		for _, out := range queue {
+			if err := out.session.Send(out.msg); err != nil {
+				g.logger.Error("Failed to send execution report",
+					zap.Error(err),
+					zap.String("session", out.session.ID()))
+			}
+		}
+	}
+}
+
+// enqueue queues a report. The mutex must be held.
+func (g *Gateway) enqueue(s *Session, msg *Message) {
+	g.queue = append(g.queue, outbound{session: s, msg: msg})
+	select {
+	case g.signal <- struct{}{}:
+	default:
+	}
+}
+
+// OnTrade reports fills of tracked orders
+func (g *Gateway) OnTrade(trade types.Trade) {
+	for _, fill := range trade.Fills() {
+		g.OnFill(fill)
+	}
+}
+
+// OnFill reports a fill if it is of a tracked order
+func (g *Gateway) OnFill(fill types.Fill) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	t, exists := g.orders[fill.OrderID]
+	if !exists {
+		return
+	}
+	pf := pendingFill{execID: fill.ID, price: fill.Price, qty: fill.Quantity, fee: fill.Fee}
+	if t.state == orderPendingNew || t.state == orderPendingReplace {
+		t.pending = append(t.pending, pf)
+		return
+	}
+	g.reportFill(t, pf)
+}
+
+// OnOrder reports cancellations of tracked orders, whether requested by
+// the session or not, e.g. by self-trade prevention or a kill switch
+func (g *Gateway) OnOrder(order types.Order) {
+	if order.Status != types.OrderStatusCancelled {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	t, exists := g.orders[order.ID]
+	if !exists || t.closed {
+		return
+	}
+
+	msg := g.report(t, ExecTypeCanceled, OrdStatusCanceled)
+	if t.state == orderPendingCancel {
+		msg.Set(TagClOrdID, t.requestClOrdID).Set(TagOrigClOrdID, t.clOrdID)
+	}
+	g.enqueue(t.session, msg)
+	t.closed = true
+	g.untrack(t)
+}
+
+// reportFill applies a fill to the order and reports it. The mutex must be
+// held.
+func (g *Gateway) reportFill(t *trackedOrder, fill pendingFill) {
+	t.cumQty += fill.qty
+	t.notional += fill.qty * fill.price
+
+	msg := g.report(t, ExecTypeTrade, t.status()).
+		Set(TagExecID, fill.execID).
+		SetFloat(TagLastPx, fill.price).
+		SetFloat(TagLastQty, fill.qty).
+		SetFloat(TagCommission, fill.fee).
+		Set(TagCommType, CommTypeAbsolute)
+	g.enqueue(t.session, msg)
+
+	if t.cumQty >= t.quantity {
+		t.closed = true
+		g.untrack(t)
+	}
+}
+
+// flush reports the fills held back while a request was in flight
+func (g *Gateway) flush(t *trackedOrder) {
+	pending := t.pending
+	t.pending = nil
+	for _, fill := range pending {
+		g.reportFill(t, fill)
+	}
+}
+
+func (g *Gateway) track(t *trackedOrder) {
+	g.orders[t.orderID] = t
+	byClOrdID, exists := g.clOrdIDs[t.session.ID()]
+	if !exists {
+		byClOrdID = make(map[string]*trackedOrder)
+		g.clOrdIDs[t.session.ID()] = byClOrdID
+	}
+	byClOrdID[t.clOrdID] = t
+}
+
+func (g *Gateway) untrack(t *trackedOrder) {
+	delete(g.orders, t.orderID)
+	if byClOrdID := g.clOrdIDs[t.session.ID()]; byClOrdID[t.clOrdID] == t {
+		delete(byClOrdID, t.clOrdID)
+	}
+}
+
+// lookup finds a session's open order by OrderID, or by the ClOrdID it
+// currently has
+func (g *Gateway) lookup(s *Session, orderID, clOrdID string) *trackedOrder {
+	if orderID != "" {
+		if t, exists := g.orders[orderID]; exists && t.session == s {
+			return t
+		}
+		return nil
+	}
+	return g.clOrdIDs[s.ID()][clOrdID]
+}
+
+func (t *trackedOrder) status() string {
+	switch {
+	case t.cumQty >= t.quantity:
+		return OrdStatusFilled
+	case t.cumQty > 0:
+		return OrdStatusPartiallyFilled
+	default:
+		return OrdStatusNew
+	}
+}
+
+// report builds an ExecutionReport with the order's current state
+func (g *Gateway) report(t *trackedOrder, execType, ordStatus string) *Message {
+	leaves := t.quantity - t.cumQty
+	if ordStatus == OrdStatusCanceled || ordStatus == OrdStatusRejected {
+		leaves = 0
+	}
+	avgPx := 0.0
+	if t.cumQty > 0 {
+		avgPx = t.notional / t.cumQty
+	}
+
+	msg := NewMessage(MsgTypeExecutionReport).
+		Set(TagOrderID, t.orderID).
+		Set(TagClOrdID, t.clOrdID).
+		Set(TagExecID, uuid.New().String()).
+		Set(TagExecType, execType).
+		Set(TagOrdStatus, ordStatus).
+		Set(TagSymbol, t.symbol).
+		Set(TagSide, sideToFIX(t.side)).
+		Set(TagOrdType, ordTypeToFIX(t.ordType)).
+		SetFloat(TagOrderQty, t.quantity).
+		SetFloat(TagCumQty, t.cumQty).
+		SetFloat(TagLeavesQty, leaves).
+		SetFloat(TagAvgPx, avgPx).
+		SetTime(TagTransactTime, time.Now())
+	if t.ordType == types.LimitOrder {
+		msg.SetFloat(TagPrice, t.price)
+	}
+	if t.account != "" {
+		msg.Set(TagAccount, t.account)
+	}
+	return msg
+}
+
+// rejectOrder reports a new order that never reached the engine
+func (g *Gateway) rejectOrder(s *Session, t *trackedOrder, reason, text string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.enqueue(s, g.report(t, ExecTypeRejected, OrdStatusRejected).
+		Set(TagOrdRejReason, reason).
+		Set(TagText, text))
+}
+
+// cancelReject refuses a cancel or replace request
+func (g *Gateway) cancelReject(msg *Message, t *trackedOrder, responseTo, reason, text string) *Message {
+	clOrdID, _ := msg.Get(TagClOrdID)
+	origClOrdID, _ := msg.Get(TagOrigClOrdID)
+	reject := NewMessage(MsgTypeOrderCancelReject).
+		Set(TagOrderID, "NONE").
+		Set(TagClOrdID, clOrdID).
+		Set(TagOrigClOrdID, origClOrdID).
+		Set(TagOrdStatus, OrdStatusRejected).
+		Set(TagCxlRejResponseTo, responseTo).
+		Set(TagCxlRejReason, reason).
+		Set(TagText, text)
+	if t != nil {
+		reject.Set(TagOrderID, t.orderID).Set(TagOrdStatus, t.status())
+	}
+	return reject
+}
+
+// requireFields sends a session Reject naming the first missing field
+func requireFields(s *Session, msg *Message, tags ...int) bool {
+	for _, tag := range tags {
+		if v, ok := msg.Get(tag); !ok || v == "" {
+			s.Reject(msg, SessionRejectRequiredTagMissing, tag, fmt.Sprintf("required tag %d missing", tag))
+			return false
+		}
+	}
+	return true
+}
+
+// floatField parses a decimal field, sending a session Reject if it is
+// malformed. Missing fields are zero.
+func floatField(s *Session, msg *Message, tag int) (float64, bool) {
+	v, ok := msg.Get(tag)
+	if !ok {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		s.Reject(msg, SessionRejectIncorrectFormat, tag, fmt.Sprintf("tag %d must be a decimal", tag))
+		return 0, false
+	}
+	return f, true
+}
+
+func (g *Gateway) newOrderSingle(s *Session, msg *Message) {
+	if !requireFields(s, msg, TagClOrdID, TagSymbol, TagSide, TagOrderQty, TagOrdType, TagTransactTime) {
+		return
+	}
+
+	clOrdID, _ := msg.Get(TagClOrdID)
+	symbol, _ := msg.Get(TagSymbol)
+	accountID, _ := msg.Get(TagAccount)
+	fixSide, _ := msg.Get(TagSide)
+	fixOrdType, _ := msg.Get(TagOrdType)
+
+	side, ok := sidesFromFIX[fixSide]
+	if !ok {
+		s.Reject(msg, SessionRejectValueIncorrect, TagSide, "Side must be 1 (buy) or 2 (sell)")
+		return
+	}
+	ordType, ok := ordTypesFromFIX[fixOrdType]
+	if !ok {
+		s.Reject(msg, SessionRejectValueIncorrect, TagOrdType, "OrdType must be 1 (market), 2 (limit) or 3 (stop)")
+		return
+	}
+	qty, ok := floatField(s, msg, TagOrderQty)
+	if !ok {
+		return
+	}
+	price, ok := floatField(s, msg, TagPrice)
+	if !ok {
+		return
+	}
+	stopPx, ok := floatField(s, msg, TagStopPx)
+	if !ok {
+		return
+	}
+
+	t := &trackedOrder{
+		session:  s,
+		orderID:  uuid.New().String(),
+		clOrdID:  clOrdID,
+		account:  accountID,
+		symbol:   symbol,
+		side:     side,
+		ordType:  ordType,
+		price:    price,
+		quantity: qty,
+		state:    orderPendingNew,
+	}
+
+	order := &types.Order{
+		ID:            t.orderID,
+		ClientOrderID: clOrdID,
+		UserID:        s.UserID(),
+		Symbol:        symbol,
+		Type:          ordType,
+		Side:          side,
+		Price:         price,
+		Quantity:      qty,
+		StopPrice:     stopPx,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := order.Validate(); err != nil {
+		g.rejectOrder(s, t, OrdRejReasonOther, err.Error())
+		return
+	}
+
+	acct, err := g.accounts.ResolveAccount(context.Background(), s.UserID(), accountID)
+	if err != nil {
+		g.rejectOrder(s, t, OrdRejReasonOther, err.Error())
+		return
+	}
+	t.account = acct.ID
+
+	if !s.Claims().Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: symbol, Account: acct.ID}) {
+		g.rejectOrder(s, t, OrdRejReasonOther, "insufficient scope, requires "+auth.ScopeOrdersWrite)
+		return
+	}
+
+	g.mutex.Lock()
+	if _, exists := g.clOrdIDs[s.ID()][clOrdID]; exists {
+		g.mutex.Unlock()
+		g.rejectOrder(s, t, OrdRejReasonDuplicateOrder, "duplicate ClOrdID")
+		return
+	}
+	g.track(t)
+	g.mutex.Unlock()
+
+	order.AccountID = acct.ID
+	err = g.engine.SubmitOrder(s, order)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if order.AccountID != "" {
+		t.account = order.AccountID
+	}
+
+	switch {
+	case order.Status == types.OrderStatusRejected && len(t.pending) == 0:
+		t.closed = true
+		g.untrack(t)
+		g.enqueue(s, g.report(t, ExecTypeRejected, OrdStatusRejected).
+			Set(TagOrdRejReason, ordRejReason(order.RejectReason)).
+			Set(TagText, err.Error()))
+
+	case order.Status == types.OrderStatusRejected:
+		// A market order that traded part of its quantity before running
+		// out of liquidity: the remainder is cancelled
+		g.enqueue(s, g.report(t, ExecTypeNew, OrdStatusNew))
+		t.state = orderActive
+		g.flush(t)
+		if !t.closed {
+			t.closed = true
+			g.untrack(t)
+			g.enqueue(s, g.report(t, ExecTypeCanceled, OrdStatusCanceled).Set(TagText, err.Error()))
+		}
+
+	case err != nil:
+		g.logger.Error("Failed to process FIX order",
+			zap.Error(err),
+			zap.String("order_id", t.orderID),
+			zap.String("session", s.ID()))
+		t.closed = true
+		g.untrack(t)
+		g.enqueue(s, g.report(t, ExecTypeRejected, OrdStatusRejected).
+			Set(TagOrdRejReason, OrdRejReasonOther).
+			Set(TagText, "internal error"))
+
+	default:
+		g.enqueue(s, g.report(t, ExecTypeNew, OrdStatusNew))
+		t.state = orderActive
+		g.flush(t)
+	}
+}
+
+func (g *Gateway) orderCancelRequest(s *Session, msg *Message) {
+	if !requireFields(s, msg, TagOrigClOrdID, TagClOrdID, TagSymbol, TagSide, TagTransactTime) {
+		return
+	}
+	orderID, _ := msg.Get(TagOrderID)
+	origClOrdID, _ := msg.Get(TagOrigClOrdID)
+	clOrdID, _ := msg.Get(TagClOrdID)
+
+	g.mutex.Lock()
+	t := g.lookup(s, orderID, origClOrdID)
+	if t == nil || t.state != orderActive {
+		text := "unknown order"
+		reason := CxlRejReasonUnknownOrder
+		if t != nil {
+			text = "order has a request in flight"
+			reason = CxlRejReasonOther
+		}
+		g.enqueue(s, g.cancelReject(msg, t, CxlRejResponseToCancel, reason, text))
+		g.mutex.Unlock()
+		return
+	}
+	t.state = orderPendingCancel
+	t.requestClOrdID = clOrdID
+	g.mutex.Unlock()
+
+	err := g.engine.CancelOrder(s, t.orderID)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if err != nil && !t.closed {
+		t.state = orderActive
+		g.enqueue(s, g.cancelReject(msg, t, CxlRejResponseToCancel, CxlRejReasonOther, err.Error()))
+	}
+}
+
+func (g *Gateway) orderCancelReplaceRequest(s *Session, msg *Message) {
+	if !requireFields(s, msg, TagOrigClOrdID, TagClOrdID, TagSymbol, TagSide, TagOrderQty, TagOrdType, TagTransactTime) {
+		return
+	}
+	orderID, _ := msg.Get(TagOrderID)
+	origClOrdID, _ := msg.Get(TagOrigClOrdID)
+	clOrdID, _ := msg.Get(TagClOrdID)
+	qty, ok := floatField(s, msg, TagOrderQty)
+	if !ok {
+		return
+	}
+	price, ok := floatField(s, msg, TagPrice)
+	if !ok {
+		return
+	}
+
+	g.mutex.Lock()
+	t := g.lookup(s, orderID, origClOrdID)
+	var text string
+	switch {
+	case t == nil:
+		g.enqueue(s, g.cancelReject(msg, nil, CxlRejResponseToReplace, CxlRejReasonUnknownOrder, "unknown order"))
+		g.mutex.Unlock()
+		return
+	case t.state != orderActive:
+		text = "order has a request in flight"
+	case t.ordType != types.LimitOrder:
+		text = "only limit orders can be replaced"
+	case price <= 0:
+		text = "Price must be positive"
+	case qty <= t.cumQty:
+		text = fmt.Sprintf("OrderQty must exceed the filled quantity %g", t.cumQty)
+	case g.clOrdIDs[s.ID()][clOrdID] != nil:
+		text = "duplicate ClOrdID"
+	}
+	if text != "" {
+		g.enqueue(s, g.cancelReject(msg, t, CxlRejResponseToReplace, CxlRejReasonOther, text))
+		g.mutex.Unlock()
+		return
+	}
+	t.state = orderPendingReplace
+	t.requestClOrdID = clOrdID
+	g.mutex.Unlock()
+
+	err := g.engine.AmendOrder(s, t.orderID, price, qty)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	t.state = orderActive
+	if err != nil {
+		if !t.closed {
+			g.enqueue(s, g.cancelReject(msg, t, CxlRejResponseToReplace, CxlRejReasonOther, err.Error()))
+		}
+		g.flush(t)
+		return
+	}
+
+	delete(g.clOrdIDs[s.ID()], t.clOrdID)
+	t.clOrdID = clOrdID
+	t.price = price
+	t.quantity = qty
+	g.clOrdIDs[s.ID()][clOrdID] = t
+
+	g.enqueue(s, g.report(t, ExecTypeReplaced, t.status()).Set(TagOrigClOrdID, origClOrdID))
+	g.flush(t)
+}
+
+var (
+	sidesFromFIX = map[string]types.OrderSide{
+		SideBuy:  types.BuyOrder,
+		SideSell: types.SellOrder,
+	}
+	ordTypesFromFIX = map[string]types.OrderType{
+		OrdTypeMarket: types.MarketOrder,
+		OrdTypeLimit:  types.LimitOrder,
+		OrdTypeStop:   types.StopOrder,
+	}
+)
+
+func sideToFIX(side types.OrderSide) string {
+	if side == types.SellOrder {
+		return SideSell
+	}
+	return SideBuy
+}
+
+func ordTypeToFIX(ordType types.OrderType) string {
+	switch ordType {
+	case types.MarketOrder:
+		return OrdTypeMarket
+	case types.StopOrder:
+		return OrdTypeStop
+	default:
+		return OrdTypeLimit
+	}
+}
+
+// ordRejReason maps an engine reject reason onto OrdRejReason. The
+// engine's reason is always in Text as well.
+func ordRejReason(reason types.RejectReason) string {
+	if reason == types.RejectReasonRiskLimit {
+		return OrdRejReasonExceedsLimit
+	}
+	return OrdRejReasonOther
+}
@@ -0,0 +1,439 @@
+package fix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// bookView is the part of a book a subscription sees: both sides sorted
+// best first and cut to the subscription's depth
+type bookView struct {
+	bids   []types.OrderBookLevel
+	offers []types.OrderBookLevel
+}
+
+// mdSubscription is a session's subscription to one MarketDataRequest
+type mdSubscription struct {
+	session *Session
+	reqID   string
+	symbols []string
+	depth   int
+	entries map[string]bool
+	// views holds the book last sent for each symbol. It is only touched
+	// by Run; a symbol without a view is still owed its snapshot.
+	views map[string]*bookView
+}
+
+func (sub *mdSubscription) wants(symbol string) bool {
+	for _, s := range sub.symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func (sub *mdSubscription) wantsBook() bool {
+	return sub.entries[MDEntryTypeBid] || sub.entries[MDEntryTypeOffer]
+}
+
+type mdTrade struct {
+	sub   *mdSubscription
+	trade types.Trade
+}
+
+// MarketData answers MarketDataRequests with a full refresh of each book
+// followed by incremental refreshes as trades happen and levels change.
+// Register OnTrade and OnOrder as engine listeners and start Run.
+type MarketData struct {
+	engine *matching.MatchingEngine
+	logger *zap.Logger
+
+	// mutex guards the subscriptions and pending changes. It is taken by
+	// engine listeners, so it must never be held across engine calls.
+	mutex         sync.Mutex
+	subscriptions map[*Session]map[string]*mdSubscription
+	trades        []mdTrade
+	dirty         map[string]bool
+	signal        chan struct{}
+}
+
+func NewMarketData(engine *matching.MatchingEngine, logger *zap.Logger) *MarketData {
+	return &MarketData{
+		engine:        engine,
+		logger:        logger,
+		subscriptions: make(map[*Session]map[string]*mdSubscription),
+		dirty:         make(map[string]bool),
+		signal:        make(chan struct{}, 1),
+	}
+}
+
+// Register adds the market data handler to an acceptor and drops a
+// session's subscriptions when it disconnects
+func (md *MarketData) Register(a *Acceptor) {
+	a.Handle(MsgTypeMarketDataRequest, md.marketDataRequest)
+	a.OnDisconnect(md.drop)
+}
+
+// OnTrade queues the trade for every subscription to trades on its symbol
+func (md *MarketData) OnTrade(trade types.Trade) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+
+	for _, subs := range md.subscriptions {
+		for _, sub := range subs {
+			if sub.entries[MDEntryTypeTrade] && sub.wants(trade.Symbol) {
+				md.trades = append(md.trades, mdTrade{sub: sub, trade: trade})
+				md.notify()
+			}
+		}
+	}
+}
+
+// OnOrder marks the order's book as changed
+func (md *MarketData) OnOrder(order types.Order) {
+	// Rejected orders never rest on the book
+	if order.Status == types.OrderStatusRejected {
+		return
+	}
+
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+
+	md.dirty[order.Symbol] = true
+	md.notify()
+}
+
+// notify wakes Run. The mutex must be held.
+func (md *MarketData) notify() {
+	select {
+	case md.signal <- struct{}{}:
+	default:
+	}
+}
+
+// drop removes every subscription of a session
+func (md *MarketData) drop(s *Session) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	delete(md.subscriptions, s)
+}
+
+// Run sends snapshots to new subscriptions and incremental refreshes to
+// existing ones until the context is cancelled
+func (md *MarketData) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-md.signal:
+		}
+
+		md.mutex.Lock()
+		trades := md.trades
+		md.trades = nil
+		dirty := md.dirty
+		md.dirty = make(map[string]bool)
+		subs := make(map[string][]*mdSubscription, len(dirty))
+		for _, bySession := range md.subscriptions {
+			for _, sub := range bySession {
+				for _, symbol := range sub.symbols {
+					if dirty[symbol] {
+						subs[symbol] = append(subs[symbol], sub)
+					}
+				}
+			}
+		}
+		md.mutex.Unlock()
+
+		books := make(map[string]*types.OrderBookSnapshot, len(subs))
+		for symbol := range subs {
+			books[symbol] = md.book(symbol)
+		}
+
+		// Snapshots go out before any trade or change a new subscription
+		// is sent, so it has a book to apply them to
+		for symbol, symbolSubs := range subs {
+			for _, sub := range symbolSubs {
+				if sub.views[symbol] != nil {
+					continue
+				}
+				view := newBookView(books[symbol], sub.depth)
+				sub.views[symbol] = view
+				md.send(sub.session, snapshotMessage(sub.reqID, symbol, view, sub.entries))
+			}
+		}
+
+		for _, t := range trades {
+			md.send(t.sub.session, NewMessage(MsgTypeMarketDataIncremental).
+				Set(TagMDReqID, t.sub.reqID).
+				SetInt(TagNoMDEntries, 1).
+				Add(TagMDUpdateAction, MDUpdateActionNew).
+				Add(TagMDEntryType, MDEntryTypeTrade).
+				Add(TagSymbol, t.trade.Symbol).
+				Add(TagMDEntryPx, formatFloat(t.trade.Price)).
+				Add(TagMDEntrySize, formatFloat(t.trade.Quantity)).
+				Add(TagMDEntryDate, t.trade.ExecutedAt.UTC().Format("20060102")).
+				Add(TagMDEntryTime, t.trade.ExecutedAt.UTC().Format("15:04:05.000")))
+		}
+
+		for symbol, symbolSubs := range subs {
+			for _, sub := range symbolSubs {
+				if !sub.wantsBook() {
+					continue
+				}
+				view := newBookView(books[symbol], sub.depth)
+				msg := NewMessage(MsgTypeMarketDataIncremental).Set(TagMDReqID, sub.reqID)
+				n := 0
+				if sub.entries[MDEntryTypeBid] {
+					n += diffLevels(msg, symbol, MDEntryTypeBid, sub.views[symbol].bids, view.bids)
+				}
+				if sub.entries[MDEntryTypeOffer] {
+					n += diffLevels(msg, symbol, MDEntryTypeOffer, sub.views[symbol].offers, view.offers)
+				}
+				sub.views[symbol] = view
+				if n == 0 {
+					continue
+				}
+				md.send(sub.session, withEntryCount(msg, n))
+			}
+		}
+	}
+}
+
+// book returns a snapshot of a symbol's book, empty if it has no orders yet
+func (md *MarketData) book(symbol string) *types.OrderBookSnapshot {
+	snapshot, err := md.engine.GetOrderBook(symbol)
+	if err != nil {
+		// The book is created by the symbol's first order
+		return &types.OrderBookSnapshot{Symbol: symbol, Timestamp: time.Now()}
+	}
+	return snapshot
+}
+
+func (md *MarketData) send(s *Session, msg *Message) {
+	if err := s.Send(msg); err != nil {
+		md.logger.Error("Failed to send market data", zap.Error(err), zap.String("session", s.ID()))
+	}
+}
+
+func (md *MarketData) reject(s *Session, reqID, reason, text string) {
+	md.send(s, NewMessage(MsgTypeMarketDataRequestReject).
+		Set(TagMDReqID, reqID).
+		Set(TagMDReqRejReason, reason).
+		Set(TagText, text))
+}
+
+func (md *MarketData) marketDataRequest(s *Session, msg *Message) {
+	if !requireFields(s, msg, TagMDReqID, TagSubscriptionReqType) {
+		return
+	}
+	reqID, _ := msg.Get(TagMDReqID)
+	reqType, _ := msg.Get(TagSubscriptionReqType)
+
+	switch reqType {
+	case SubscriptionReqTypeUnsubscribe:
+		md.mutex.Lock()
+		delete(md.subscriptions[s], reqID)
+		md.mutex.Unlock()
+		return
+	case SubscriptionReqTypeSnapshot, SubscriptionReqTypeSubscribe:
+	default:
+		md.reject(s, reqID, MDReqRejReasonUnsupportedSubscription, "SubscriptionRequestType must be 0, 1 or 2")
+		return
+	}
+
+	if !requireFields(s, msg, TagMarketDepth, TagNoMDEntryTypes, TagNoRelatedSym) {
+		return
+	}
+	depth, err := msg.Int(TagMarketDepth)
+	if err != nil || depth < 0 {
+		md.reject(s, reqID, MDReqRejReasonUnsupportedMarketDepth, "MarketDepth must be 0 (full book) or a number of levels")
+		return
+	}
+	if updateType, ok := msg.Get(TagMDUpdateType); ok && updateType != MDUpdateTypeIncremental {
+		md.reject(s, reqID, MDReqRejReasonUnsupportedMDUpdateType, "only incremental refresh is supported")
+		return
+	}
+
+	entries := make(map[string]bool)
+	for _, entryType := range msg.Values(TagMDEntryType) {
+		switch entryType {
+		case MDEntryTypeBid, MDEntryTypeOffer, MDEntryTypeTrade:
+			entries[entryType] = true
+		default:
+			md.reject(s, reqID, MDReqRejReasonUnsupportedMDEntryType,
+				fmt.Sprintf("unsupported MDEntryType %q, expecting 0, 1 or 2", entryType))
+			return
+		}
+	}
+	symbols := msg.Values(TagSymbol)
+	if len(entries) == 0 || len(symbols) == 0 {
+		s.Reject(msg, SessionRejectRequiredTagMissing, 0, "at least one MDEntryType and Symbol are required")
+		return
+	}
+
+	claims := s.Claims()
+	for _, symbol := range symbols {
+		if !claims.Allows(auth.ScopeMarketDataRead, auth.Resource{Symbol: symbol}) {
+			md.reject(s, reqID, MDReqRejReasonInsufficientPermissions,
+				fmt.Sprintf("insufficient scope for %s, requires %s", symbol, auth.ScopeMarketDataRead))
+			return
+		}
+	}
+
+	if reqType == SubscriptionReqTypeSnapshot {
+		for _, symbol := range symbols {
+			view := newBookView(md.book(symbol), depth)
+			md.send(s, snapshotMessage(reqID, symbol, view, entries))
+		}
+		return
+	}
+
+	md.mutex.Lock()
+	bySession, exists := md.subscriptions[s]
+	if !exists {
+		bySession = make(map[string]*mdSubscription)
+		md.subscriptions[s] = bySession
+	}
+	if _, exists := bySession[reqID]; exists {
+		md.mutex.Unlock()
+		md.reject(s, reqID, MDReqRejReasonDuplicateMDReqID, "MDReqID is already subscribed")
+		return
+	}
+	bySession[reqID] = &mdSubscription{
+		session: s,
+		reqID:   reqID,
+		symbols: symbols,
+		depth:   depth,
+		entries: entries,
+		views:   make(map[string]*bookView),
+	}
+
+	// Run sends the snapshots
+	for _, symbol := range symbols {
+		md.dirty[symbol] = true
+	}
+	md.notify()
+	md.mutex.Unlock()
+}
+
+// newBookView sorts both sides best first and cuts them to depth levels;
+// a depth of 0 keeps the full book
+func newBookView(snapshot *types.OrderBookSnapshot, depth int) *bookView {
+	view := &bookView{
+		bids:   append([]types.OrderBookLevel(nil), snapshot.Bids...),
+		offers: append([]types.OrderBookLevel(nil), snapshot.Asks...),
+	}
+	sort.Slice(view.bids, func(i, j int) bool { return view.bids[i].Price > view.bids[j].Price })
+	sort.Slice(view.offers, func(i, j int) bool { return view.offers[i].Price < view.offers[j].Price })
+	if depth > 0 {
+		if len(view.bids) > depth {
+			view.bids = view.bids[:depth]
+		}
+		if len(view.offers) > depth {
+			view.offers = view.offers[:depth]
+		}
+	}
+	return view
+}
+
+// snapshotMessage builds a MarketDataSnapshotFullRefresh with the entry
+// types a subscription asked for
+func snapshotMessage(reqID, symbol string, view *bookView, entries map[string]bool) *Message {
+	msg := NewMessage(MsgTypeMarketDataSnapshot).
+		Set(TagMDReqID, reqID).
+		Set(TagSymbol, symbol)
+
+	n := 0
+	add := func(entryType string, levels []types.OrderBookLevel) {
+		if !entries[entryType] {
+			return
+		}
+		for _, level := range levels {
+			msg.Add(TagMDEntryType, entryType).
+				Add(TagMDEntryPx, formatFloat(level.Price)).
+				Add(TagMDEntrySize, formatFloat(level.Quantity)).
+				Add(TagNumberOfOrders, strconv.Itoa(level.Orders))
+			n++
+		}
+	}
+	add(MDEntryTypeBid, view.bids)
+	add(MDEntryTypeOffer, view.offers)
+	return withEntryCount(msg, n)
+}
+
+// diffLevels adds the entries that turn one side of a book view into the
+// next, deletions first so a depth-limited book never overflows, and
+// returns how many it added
+func diffLevels(msg *Message, symbol, entryType string, prev, next []types.OrderBookLevel) int {
+	nextByPrice := make(map[float64]types.OrderBookLevel, len(next))
+	for _, level := range next {
+		nextByPrice[level.Price] = level
+	}
+	prevByPrice := make(map[float64]types.OrderBookLevel, len(prev))
+	for _, level := range prev {
+		prevByPrice[level.Price] = level
+	}
+
+	n := 0
+	add := func(action string, level types.OrderBookLevel) {
+		msg.Add(TagMDUpdateAction, action).
+			Add(TagMDEntryType, entryType).
+			Add(TagSymbol, symbol).
+			Add(TagMDEntryPx, formatFloat(level.Price))
+		if action != MDUpdateActionDelete {
+			msg.Add(TagMDEntrySize, formatFloat(level.Quantity)).
+				Add(TagNumberOfOrders, strconv.Itoa(level.Orders))
+		}
+		n++
+	}
+
+	for _, level := range prev {
+		if _, exists := nextByPrice[level.Price]; !exists {
+			add(MDUpdateActionDelete, level)
+		}
+	}
+	for _, level := range next {
+		old, exists := prevByPrice[level.Price]
+		switch {
+		case !exists:
+			add(MDUpdateActionNew, level)
+		case old != level:
+			add(MDUpdateActionChange, level)
+		}
+	}
+	return n
+}
+
+// withEntryCount inserts NoMDEntries before the first entry of the group
+func withEntryCount(msg *Message, n int) *Message {
+	fields := msg.Fields()
+	out := &Message{fields: make([]Field, 0, len(fields)+1)}
+	inserted := false
+	for _, f := range fields {
+		if !inserted && (f.Tag == TagMDUpdateAction || f.Tag == TagMDEntryType) {
+			out.fields = append(out.fields, Field{Tag: TagNoMDEntries, Value: strconv.Itoa(n)})
+			inserted = true
+		}
+		out.fields = append(out.fields, f)
+	}
+	if !inserted {
+		out.fields = append(out.fields, Field{Tag: TagNoMDEntries, Value: strconv.Itoa(n)})
+	}
+	return out
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,90 @@
+package fix
+
+import (
+	"testing"
+)
+
+func marketDataRequest(reqID, reqType string, depth int, entryTypes ...string) *Message {
+	msg := NewMessage(MsgTypeMarketDataRequest).
+		Set(TagMDReqID, reqID).
+		Set(TagSubscriptionReqType, reqType).
+		SetInt(TagMarketDepth, depth).
+		Set(TagMDUpdateType, MDUpdateTypeIncremental).
+		SetInt(TagNoMDEntryTypes, len(entryTypes))
+	for _, entryType := range entryTypes {
+		msg.Add(TagMDEntryType, entryType)
+	}
+	return msg.SetInt(TagNoRelatedSym, 1).Add(TagSymbol, "BTC-USD")
+}
+
+func TestMarketDataSubscription(t *testing.T) {
+	env := newTestEnv(t)
+	trader := env.logon("TRADER", "user-1", 1, 30)
+	trader.send(newOrder("b-1", SideBuy, "1", "100"))
+	trader.expectReport(ExecTypeNew, OrdStatusNew)
+	trader.send(newOrder("b-2", SideBuy, "2", "99"))
+	trader.expectReport(ExecTypeNew, OrdStatusNew)
+
+	// A depth of 1 only shows the best bid
+	viewer := env.logon("VIEWER", "user-2", 1, 30)
+	viewer.send(marketDataRequest("md-1", SubscriptionReqTypeSubscribe, 1, MDEntryTypeBid, MDEntryTypeOffer))
+	snapshot := viewer.expect(MsgTypeMarketDataSnapshot)
+	assertField(t, snapshot, TagMDReqID, "md-1")
+	assertField(t, snapshot, TagNoMDEntries, "1")
+	assertField(t, snapshot, TagMDEntryPx, "100")
+	assertField(t, snapshot, TagMDEntrySize, "1")
+
+	trades := env.logon("TRADES", "user-3", 1, 30)
+	trades.send(marketDataRequest("md-2", SubscriptionReqTypeSubscribe, 0, MDEntryTypeTrade))
+	empty := trades.expect(MsgTypeMarketDataSnapshot)
+	assertField(t, empty, TagNoMDEntries, "0")
+
+	// Selling through the best bid removes it and exposes the next one
+	seller := env.logon("SELLER", "user-4", 1, 30)
+	seller.send(newOrder("s-1", SideSell, "1", "100"))
+	seller.expectReport(ExecTypeNew, OrdStatusNew)
+	seller.expectReport(ExecTypeTrade, OrdStatusFilled)
+
+	trade := trades.expect(MsgTypeMarketDataIncremental)
+	assertField(t, trade, TagMDEntryType, MDEntryTypeTrade)
+	assertField(t, trade, TagMDEntryPx, "100")
+	assertField(t, trade, TagMDEntrySize, "1")
+
+	update := viewer.expect(MsgTypeMarketDataIncremental)
+	assertField(t, update, TagNoMDEntries, "2")
+	actions := update.Values(TagMDUpdateAction)
+	prices := update.Values(TagMDEntryPx)
+	if len(actions) != 2 || actions[0] != MDUpdateActionDelete || actions[1] != MDUpdateActionNew ||
+		prices[0] != "100" || prices[1] != "99" {
+		t.Fatalf("expected the 100 bid deleted and the 99 bid added, got %s", update)
+	}
+
+	// Unsubscribed sessions get nothing more; the next message is the
+	// heartbeat answering the test request
+	viewer.send(marketDataRequest("md-1", SubscriptionReqTypeUnsubscribe, 0, MDEntryTypeBid))
+	viewer.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "unsubscribed"))
+	assertField(t, viewer.expect(MsgTypeHeartbeat), TagTestReqID, "unsubscribed")
+	seller.send(newOrder("s-2", SideSell, "1", "101"))
+	seller.expectReport(ExecTypeNew, OrdStatusNew)
+	viewer.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "done"))
+	assertField(t, viewer.expect(MsgTypeHeartbeat), TagTestReqID, "done")
+}
+
+func TestMarketDataRequestRejects(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.logon("VIEWER", "user-1", 1, 30)
+
+	c.send(marketDataRequest("md-1", SubscriptionReqTypeSnapshot, 0, MDEntryTypeBid))
+	snapshot := c.expect(MsgTypeMarketDataSnapshot)
+	assertField(t, snapshot, TagNoMDEntries, "0")
+
+	c.send(marketDataRequest("md-2", SubscriptionReqTypeSubscribe, 0, "B"))
+	reject := c.expect(MsgTypeMarketDataRequestReject)
+	assertField(t, reject, TagMDReqRejReason, MDReqRejReasonUnsupportedMDEntryType)
+
+	c.send(marketDataRequest("md-3", SubscriptionReqTypeSubscribe, 0, MDEntryTypeBid))
+	c.expect(MsgTypeMarketDataSnapshot)
+	c.send(marketDataRequest("md-3", SubscriptionReqTypeSubscribe, 0, MDEntryTypeBid))
+	reject = c.expect(MsgTypeMarketDataRequestReject)
+	assertField(t, reject, TagMDReqRejReason, MDReqRejReasonDuplicateMDReqID)
+}
@@ -0,0 +1,280 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// soh separates the fields of a message
+const soh = '\x01'
+
+// maxBodyLength bounds the size of an incoming message
+const maxBodyLength = 64 << 10
+
+// SendingTimeFormat is the UTCTimestamp format with milliseconds
+const SendingTimeFormat = "20060102-15:04:05.000"
+
+var (
+	ErrGarbled       = errors.New("garbled message")
+	ErrFieldNotFound = errors.New("field not found")
+)
+
+// Field is a tag=value pair
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message as an ordered list of fields. BeginString,
+// BodyLength and CheckSum are added by Bytes and are not kept in the list.
+type Message struct {
+	fields []Field
+}
+
+// NewMessage creates a message of the given type
+func NewMessage(msgType string) *Message {
+	return &Message{fields: []Field{{Tag: TagMsgType, Value: msgType}}}
+}
+
+// MsgType returns the message type
+func (m *Message) MsgType() string {
+	v, _ := m.Get(TagMsgType)
+	return v
+}
+
+// Get returns the first value of a tag
+func (m *Message) Get(tag int) (string, bool) {
+	for _, f := range m.fields {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns every value of a tag in order, e.g. the entries of a
+// repeating group
+func (m *Message) Values(tag int) []string {
+	values := make([]string, 0)
+	for _, f := range m.fields {
+		if f.Tag == tag {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Int returns the value of a tag as an integer
+func (m *Message) Int(tag int) (int, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, ErrFieldNotFound
+	}
+	return strconv.Atoi(v)
+}
+
+// Float returns the value of a tag as a float
+func (m *Message) Float(tag int) (float64, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, ErrFieldNotFound
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// Set replaces the value of a tag, or appends it
+func (m *Message) Set(tag int, value string) *Message {
+	for i, f := range m.fields {
+		if f.Tag == tag {
+			m.fields[i].Value = value
+			return m
+		}
+	}
+	return m.Add(tag, value)
+}
+
+// Add appends a field, e.g. one entry of a repeating group
+func (m *Message) Add(tag int, value string) *Message {
+	m.fields = append(m.fields, Field{Tag: tag, Value: value})
+	return m
+}
+
+// SetInt sets an integer field
+func (m *Message) SetInt(tag, value int) *Message {
+	return m.Set(tag, strconv.Itoa(value))
+}
+
+// SetFloat sets a decimal field without trailing zeros
+func (m *Message) SetFloat(tag int, value float64) *Message {
+	return m.Set(tag, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// SetTime sets a UTCTimestamp field
+func (m *Message) SetTime(tag int, t time.Time) *Message {
+	return m.Set(tag, t.UTC().Format(SendingTimeFormat))
+}
+
+// Fields returns the fields in order
+func (m *Message) Fields() []Field {
+	return m.fields
+}
+
+// headerOrder lists the header fields that must follow MsgType
+var headerOrder = []int{
+	TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagPossDupFlag,
+	TagSendingTime, TagOrigSendingTime,
+}
+
+// Bytes encodes the message with its standard header and trailer
+func (m *Message) Bytes() []byte {
+	var body bytes.Buffer
+	write := func(f Field) {
+		body.WriteString(strconv.Itoa(f.Tag))
+		body.WriteByte('=')
+		body.WriteString(f.Value)
+		body.WriteByte(soh)
+	}
+
+	write(Field{Tag: TagMsgType, Value: m.MsgType()})
+	for _, tag := range headerOrder {
+		if v, ok := m.Get(tag); ok {
+			write(Field{Tag: tag, Value: v})
+		}
+	}
+	for _, f := range m.fields {
+		if f.Tag == TagMsgType || isHeaderTag(f.Tag) {
+			continue
+		}
+		write(f)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("8=%s\x019=%d\x01", BeginString, body.Len()))
+	out.Write(body.Bytes())
+	out.WriteString(fmt.Sprintf("10=%03d\x01", checksum(out.Bytes())))
+	return out.Bytes()
+}
+
+func isHeaderTag(tag int) bool {
+	for _, t := range headerOrder {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(data []byte) int {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
+
+// String renders the message with | as the field separator, for logs
+func (m *Message) String() string {
+	return string(bytes.ReplaceAll(m.Bytes(), []byte{soh}, []byte{'|'}))
+}
+
+// ReadMessage reads one message, verifying its framing and checksum, and
+// returns it together with its raw bytes
+func ReadMessage(r *bufio.Reader) (*Message, []byte, error) {
+	var raw bytes.Buffer
+
+	begin, err := readField(r, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if begin.Tag != TagBeginString {
+		return nil, nil, fmt.Errorf("%w: message must start with BeginString", ErrGarbled)
+	}
+	if begin.Value != BeginString {
+		return nil, nil, fmt.Errorf("%w: unsupported BeginString %q", ErrGarbled, begin.Value)
+	}
+
+	length, err := readField(r, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	bodyLength, convErr := strconv.Atoi(length.Value)
+	if length.Tag != TagBodyLength || convErr != nil || bodyLength <= 0 || bodyLength > maxBodyLength {
+		return nil, nil, fmt.Errorf("%w: invalid BodyLength", ErrGarbled)
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+	raw.Write(body)
+	expected := checksum(raw.Bytes())
+
+	trailer, err := readField(r, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum, convErr := strconv.Atoi(trailer.Value)
+	if trailer.Tag != TagCheckSum || convErr != nil {
+		return nil, nil, fmt.Errorf("%w: BodyLength does not match the message", ErrGarbled)
+	}
+	if sum != expected {
+		return nil, nil, fmt.Errorf("%w: CheckSum %03d, expected %03d", ErrGarbled, sum, expected)
+	}
+
+	msg, err := parseBody(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, raw.Bytes(), nil
+}
+
+// ParseMessage parses a complete encoded message
+func ParseMessage(data []byte) (*Message, error) {
+	msg, _, err := ReadMessage(bufio.NewReader(bytes.NewReader(data)))
+	return msg, err
+}
+
+func readField(r *bufio.Reader, raw *bytes.Buffer) (Field, error) {
+	data, err := r.ReadBytes(soh)
+	if err != nil {
+		return Field{}, err
+	}
+	raw.Write(data)
+	return splitField(data[:len(data)-1])
+}
+
+func splitField(data []byte) (Field, error) {
+	tag, value, found := bytes.Cut(data, []byte{'='})
+	if !found {
+		return Field{}, fmt.Errorf("%w: field without '='", ErrGarbled)
+	}
+	n, err := strconv.Atoi(string(tag))
+	if err != nil || n <= 0 {
+		return Field{}, fmt.Errorf("%w: invalid tag %q", ErrGarbled, tag)
+	}
+	return Field{Tag: n, Value: string(value)}, nil
+}
+
+func parseBody(body []byte) (*Message, error) {
+	if body[len(body)-1] != soh {
+		return nil, fmt.Errorf("%w: body does not end with a field separator", ErrGarbled)
+	}
+
+	msg := &Message{}
+	for _, data := range bytes.Split(body[:len(body)-1], []byte{soh}) {
+		f, err := splitField(data)
+		if err != nil {
+			return nil, err
+		}
+		msg.fields = append(msg.fields, f)
+	}
+	if len(msg.fields) == 0 || msg.fields[0].Tag != TagMsgType {
+		return nil, fmt.Errorf("%w: MsgType must be the third field", ErrGarbled)
+	}
+	return msg, nil
+}
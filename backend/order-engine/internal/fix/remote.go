@@ -0,0 +1,311 @@
+package fix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// Remote executes a gateway's orders on the server's matching engine over
+// the gRPC order service, acting for each session's user with the token it
+// logged on with. Orders are submitted with the gateway's order ID as their
+// client order ID, so the execution reports the server publishes for them
+// can be matched even before SubmitOrder returns; pass those to Report.
+type Remote struct {
+	client  pb.OrderServiceClient
+	timeout time.Duration
+	logger  *zap.Logger
+
+	fillListeners  []func(fill types.Fill)
+	orderListeners []func(order types.Order)
+
+	mutex  sync.Mutex
+	orders map[string]*remoteOrder
+}
+
+// remoteOrder is an open order submitted through the remote, by the
+// gateway's order ID
+type remoteOrder struct {
+	serverID string
+	closed   bool
+	filled   float64
+	// caughtUp is closed once the reported fills reach want
+	want     float64
+	caughtUp chan struct{}
+}
+
+// NewRemote creates a remote engine calling the server's order service,
+// waiting at most timeout for each call
+func NewRemote(client pb.OrderServiceClient, timeout time.Duration, logger *zap.Logger) *Remote {
+	return &Remote{
+		client:  client,
+		timeout: timeout,
+		logger:  logger,
+		orders:  make(map[string]*remoteOrder),
+	}
+}
+
+// AddFillListener registers a function called with every fill of the
+// remote's orders, e.g. a gateway's OnFill. It must be registered before
+// any order is submitted.
+func (r *Remote) AddFillListener(listener func(fill types.Fill)) {
+	r.fillListeners = append(r.fillListeners, listener)
+}
+
+// AddOrderListener registers a function called with every change to the
+// remote's orders, e.g. a gateway's OnOrder. It must be registered before
+// any order is submitted.
+func (r *Remote) AddOrderListener(listener func(order types.Order)) {
+	r.orderListeners = append(r.orderListeners, listener)
+}
+
+// ResolveAccount leaves the account to the server, which resolves an empty
+// ID to the user's master account and checks the user owns the rest
+func (r *Remote) ResolveAccount(_ context.Context, userID, accountID string) (types.Account, error) {
+	return types.Account{ID: accountID, UserID: userID}, nil
+}
+
+// SubmitOrder places an order on the server. Fills the server made before
+// answering are reported to the listeners before it returns.
+func (r *Remote) SubmitOrder(s *Session, order *types.Order) error {
+	tracked := &remoteOrder{}
+	r.mutex.Lock()
+	r.orders[order.ID] = tracked
+	r.mutex.Unlock()
+
+	ctx, cancel := r.context(s)
+	defer cancel()
+	resp, err := r.client.SubmitOrder(ctx, &pb.SubmitOrderRequest{
+		ClientOrderId: order.ID,
+		AccountId:     order.AccountID,
+		Symbol:        order.Symbol,
+		Type:          typesToProto[order.Type],
+		Side:          sidesToProto[order.Side],
+		Price:         order.Price,
+		Quantity:      order.Quantity,
+		StopPrice:     order.StopPrice,
+	})
+	if err != nil {
+		r.mutex.Lock()
+		delete(r.orders, order.ID)
+		r.mutex.Unlock()
+		if refused(err) {
+			order.Status = types.OrderStatusRejected
+		}
+		return statusError(err)
+	}
+
+	order.AccountID = resp.Order.AccountId
+	order.Status = statusesFromProto[resp.Order.Status]
+	order.RejectReason = types.RejectReason(resp.Order.RejectReason)
+	r.catchUp(order.ID, resp.Order.Id, resp.Order.FilledQty, order.Status != types.OrderStatusNew && order.Status != types.OrderStatusPartial)
+
+	if order.Status == types.OrderStatusRejected {
+		return fmt.Errorf("order rejected: %s", order.RejectReason)
+	}
+	return nil
+}
+
+// CancelOrder cancels an order the remote submitted
+func (r *Remote) CancelOrder(s *Session, orderID string) error {
+	serverID, err := r.serverID(orderID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.context(s)
+	defer cancel()
+	_, err = r.client.CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: serverID})
+	return statusError(err)
+}
+
+// AmendOrder amends an order the remote submitted. Fills the server made
+// before answering are reported to the listeners before it returns.
+func (r *Remote) AmendOrder(s *Session, orderID string, price, quantity float64) error {
+	serverID, err := r.serverID(orderID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.context(s)
+	defer cancel()
+	resp, err := r.client.AmendOrder(ctx, &pb.AmendOrderRequest{
+		OrderId:  serverID,
+		Price:    price,
+		Quantity: quantity,
+	})
+	if err != nil {
+		return statusError(err)
+	}
+	orderStatus := statusesFromProto[resp.Order.Status]
+	r.catchUp(orderID, serverID, resp.Order.FilledQty, orderStatus != types.OrderStatusNew && orderStatus != types.OrderStatusPartial)
+	return nil
+}
+
+// Report passes an execution report published by the server on to the
+// listeners, under the gateway's order ID, if it is of an order the remote
+// submitted. Reports must be passed in the order they were published.
+func (r *Remote) Report(report types.ExecutionReport) {
+	order := report.Order
+	order.ID = report.ClientOrderID
+
+	r.mutex.Lock()
+	tracked, exists := r.orders[order.ID]
+	if !exists {
+		r.mutex.Unlock()
+		return
+	}
+	var caughtUp chan struct{}
+	if report.ExecType == types.ExecTypeTrade {
+		tracked.filled += report.LastQty
+		if tracked.caughtUp != nil && tracked.filled >= tracked.want {
+			caughtUp = tracked.caughtUp
+			tracked.caughtUp = nil
+		}
+	}
+	if order.Status != types.OrderStatusNew && order.Status != types.OrderStatusPartial {
+		tracked.closed = true
+		if tracked.serverID != "" {
+			delete(r.orders, order.ID)
+		}
+	}
+	r.mutex.Unlock()
+
+	if report.ExecType == types.ExecTypeTrade {
+		// Fills are named after their trade and side, as by Trade.Fills
+		suffix := "-B"
+		if order.Side == types.SellOrder {
+			suffix = "-S"
+		}
+		fill := types.Fill{
+			ID:            report.TradeID + suffix,
+			TradeID:       report.TradeID,
+			OrderID:       order.ID,
+			ClientOrderID: order.ClientOrderID,
+			UserID:        order.UserID,
+			AccountID:     order.AccountID,
+			Symbol:        order.Symbol,
+			Side:          order.Side,
+			Liquidity:     report.Liquidity,
+			Price:         report.LastPrice,
+			Quantity:      report.LastQty,
+			Fee:           report.Fee,
+			ExecutedAt:    order.UpdatedAt,
+		}
+		for _, listener := range r.fillListeners {
+			listener(fill)
+		}
+	}
+	for _, listener := range r.orderListeners {
+		listener(order)
+	}
+	if caughtUp != nil {
+		close(caughtUp)
+	}
+}
+
+// catchUp records the server's ID of an order and waits, at most the
+// timeout, until the fills the server says it made have been reported.
+// Orders the server closed are forgotten once they are.
+func (r *Remote) catchUp(orderID, serverID string, filled float64, closed bool) {
+	r.mutex.Lock()
+	tracked, exists := r.orders[orderID]
+	if !exists {
+		r.mutex.Unlock()
+		return
+	}
+	tracked.serverID = serverID
+	var caughtUp chan struct{}
+	if tracked.filled < filled {
+		tracked.want = filled
+		tracked.caughtUp = make(chan struct{})
+		caughtUp = tracked.caughtUp
+	}
+	r.mutex.Unlock()
+
+	if caughtUp != nil {
+		select {
+		case <-caughtUp:
+		case <-time.After(r.timeout):
+			r.logger.Warn("Timed out waiting for fills of FIX order",
+				zap.String("order_id", orderID),
+				zap.String("server_order_id", serverID))
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	tracked.caughtUp = nil
+	if closed || tracked.closed {
+		delete(r.orders, orderID)
+	}
+}
+
+func (r *Remote) serverID(orderID string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tracked, exists := r.orders[orderID]
+	if !exists || tracked.serverID == "" {
+		return "", errors.New("order not found")
+	}
+	return tracked.serverID, nil
+}
+
+// context authenticates a call as the session's user
+func (r *Remote) context(s *Session) (context.Context, context.CancelFunc) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+s.Token())
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// refused reports whether the server turned a request down, as opposed to
+// failing in a way that leaves its outcome unknown
+func refused(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.ResourceExhausted, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusError strips the gRPC code from an error reported to a session
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if refused(err) {
+		return errors.New(status.Convert(err).Message())
+	}
+	return err
+}
+
+var (
+	typesToProto = map[types.OrderType]pb.OrderType{
+		types.LimitOrder:  pb.OrderType_ORDER_TYPE_LIMIT,
+		types.MarketOrder: pb.OrderType_ORDER_TYPE_MARKET,
+		types.StopOrder:   pb.OrderType_ORDER_TYPE_STOP,
+	}
+	sidesToProto = map[types.OrderSide]pb.Side{
+		types.BuyOrder:  pb.Side_SIDE_BUY,
+		types.SellOrder: pb.Side_SIDE_SELL,
+	}
+	statusesFromProto = map[pb.OrderStatus]types.OrderStatus{
+		pb.OrderStatus_ORDER_STATUS_NEW:       types.OrderStatusNew,
+		pb.OrderStatus_ORDER_STATUS_PARTIAL:   types.OrderStatusPartial,
+		pb.OrderStatus_ORDER_STATUS_FILLED:    types.OrderStatusFilled,
+		pb.OrderStatus_ORDER_STATUS_CANCELLED: types.OrderStatusCancelled,
+		pb.OrderStatus_ORDER_STATUS_REJECTED:  types.OrderStatusRejected,
+	}
+)
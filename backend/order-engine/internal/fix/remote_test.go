@@ -0,0 +1,146 @@
+package fix
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// fakeOrderService answers as told and records what it was asked
+type fakeOrderService struct {
+	submit func(req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error)
+
+	mutex     sync.Mutex
+	tokens    []string
+	cancelled []string
+}
+
+func (f *fakeOrderService) record(ctx context.Context) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.tokens = append(f.tokens, md.Get("authorization")...)
+}
+
+func (f *fakeOrderService) SubmitOrder(ctx context.Context, req *pb.SubmitOrderRequest, _ ...grpc.CallOption) (*pb.SubmitOrderResponse, error) {
+	f.record(ctx)
+	return f.submit(req)
+}
+
+func (f *fakeOrderService) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest, _ ...grpc.CallOption) (*pb.CancelOrderResponse, error) {
+	f.record(ctx)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.cancelled = append(f.cancelled, req.OrderId)
+	return nil, status.Error(codes.FailedPrecondition, "order not open")
+}
+
+func (f *fakeOrderService) AmendOrder(ctx context.Context, req *pb.AmendOrderRequest, _ ...grpc.CallOption) (*pb.AmendOrderResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "amend")
+}
+
+func (f *fakeOrderService) GetOrder(ctx context.Context, req *pb.GetOrderRequest, _ ...grpc.CallOption) (*pb.Order, error) {
+	return nil, status.Error(codes.Unimplemented, "get")
+}
+
+func TestRemoteWaitsForFillsBeforeRejecting(t *testing.T) {
+	var remote *Remote
+	service := &fakeOrderService{}
+	service.submit = func(req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error) {
+		// The market order traded 1 before running out of liquidity; its
+		// trade report arrives over NATS after the response
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			remote.Report(types.ExecutionReport{
+				ExecType: types.ExecTypeTrade,
+				Order: types.Order{
+					ID:            "server-1",
+					ClientOrderID: req.ClientOrderId,
+					UserID:        "user-1",
+					Side:          types.BuyOrder,
+					Status:        types.OrderStatusPartial,
+				},
+				TradeID:   "trade-1",
+				LastPrice: 100,
+				LastQty:   1,
+			})
+		}()
+		return &pb.SubmitOrderResponse{Order: &pb.Order{
+			Id:           "server-1",
+			AccountId:    "acct-1",
+			Status:       pb.OrderStatus_ORDER_STATUS_REJECTED,
+			RejectReason: string(types.RejectReasonNoLiquidity),
+			FilledQty:    1,
+		}}, nil
+	}
+	remote = NewRemote(service, 2*time.Second, zap.NewNop())
+
+	var fills []types.Fill
+	remote.AddFillListener(func(fill types.Fill) { fills = append(fills, fill) })
+
+	s := &Session{token: "token-1"}
+	order := &types.Order{ID: "gateway-1", Type: types.MarketOrder, Side: types.BuyOrder, Quantity: 2}
+	err := remote.SubmitOrder(s, order)
+	if err == nil {
+		t.Fatal("rejected order returned no error")
+	}
+	if order.Status != types.OrderStatusRejected || order.AccountID != "acct-1" {
+		t.Fatalf("order is %s on %q, want rejected on acct-1", order.Status, order.AccountID)
+	}
+	if len(fills) != 1 || fills[0].OrderID != "gateway-1" || fills[0].ID != "trade-1-B" {
+		t.Fatalf("fills %+v, want trade-1-B of gateway-1 reported before returning", fills)
+	}
+	if len(service.tokens) != 1 || service.tokens[0] != "Bearer token-1" {
+		t.Fatalf("authorization %v, want the session's token", service.tokens)
+	}
+
+	// The order is closed, so it can no longer be cancelled
+	if err := remote.CancelOrder(s, "gateway-1"); err == nil {
+		t.Fatal("cancelled a closed order")
+	}
+}
+
+func TestRemoteCancelsByServerID(t *testing.T) {
+	service := &fakeOrderService{submit: func(req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error) {
+		return &pb.SubmitOrderResponse{Order: &pb.Order{Id: "server-1", Status: pb.OrderStatus_ORDER_STATUS_NEW}}, nil
+	}}
+	remote := NewRemote(service, time.Second, zap.NewNop())
+
+	var orders []types.Order
+	remote.AddOrderListener(func(order types.Order) { orders = append(orders, order) })
+
+	s := &Session{token: "token-1"}
+	if err := remote.SubmitOrder(s, &types.Order{ID: "gateway-1", Type: types.LimitOrder, Price: 100, Quantity: 1}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// The server's refusal is reported without its gRPC code
+	err := remote.CancelOrder(s, "gateway-1")
+	if err == nil || err.Error() != "order not open" {
+		t.Fatalf("cancel error %v, want the server's message", err)
+	}
+	if len(service.cancelled) != 1 || service.cancelled[0] != "server-1" {
+		t.Fatalf("cancelled %v, want server-1", service.cancelled)
+	}
+
+	// Reports of other orders are ignored, and the gateway's are passed on
+	// under its ID
+	remote.Report(types.ExecutionReport{ExecType: types.ExecTypeCanceled, Order: types.Order{ID: "other", ClientOrderID: "mine", Status: types.OrderStatusCancelled}})
+	remote.Report(types.ExecutionReport{ExecType: types.ExecTypeCanceled, Order: types.Order{ID: "server-1", ClientOrderID: "gateway-1", Status: types.OrderStatusCancelled}})
+	if len(orders) != 1 || orders[0].ID != "gateway-1" {
+		t.Fatalf("orders %+v, want the cancellation of gateway-1", orders)
+	}
+	if _, err := remote.serverID("gateway-1"); err == nil {
+		t.Fatal("cancelled order still tracked")
+	}
+}
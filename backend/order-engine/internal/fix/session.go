@@ -0,0 +1,570 @@
+package fix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// writeTimeout bounds a write to a counterparty
+const writeTimeout = 10 * time.Second
+
+// adminMsgTypes are the session-level messages that are never resent;
+// a resend request covering them is answered with a gap fill
+var adminMsgTypes = map[string]bool{
+	MsgTypeHeartbeat:     true,
+	MsgTypeTestRequest:   true,
+	MsgTypeResendRequest: true,
+	MsgTypeSequenceReset: true,
+	MsgTypeLogout:        true,
+	MsgTypeLogon:         true,
+}
+
+// Session is the state shared with one counterparty. It outlives
+// connections: messages sent while the counterparty is offline are
+// stored and resent when it logs on again and asks for them.
+type Session struct {
+	id           string
+	senderCompID string
+	targetCompID string
+	acceptor     *Acceptor
+	logger       *zap.Logger
+
+	// mutex guards the connection and the outgoing sequence
+	mutex         sync.Mutex
+	conn          net.Conn
+	token         string
+	claims        *auth.Claims
+	userID        string
+	nextSenderSeq int
+	heartBtInt    time.Duration
+	lastSent      time.Time
+	lastReceived  time.Time
+	testReqID     string
+
+	// Incoming state is only touched by the connection's read loop
+	nextTargetSeq int
+	queued        map[int]*Message
+	resendPending bool
+}
+
+func newSession(a *Acceptor, targetCompID string, state *SessionState) *Session {
+	return &Session{
+		id:            sessionID(a.compID, targetCompID),
+		senderCompID:  a.compID,
+		targetCompID:  targetCompID,
+		acceptor:      a,
+		logger:        a.logger.With(zap.String("session", sessionID(a.compID, targetCompID))),
+		userID:        state.UserID,
+		nextSenderSeq: state.NextSenderSeq,
+		nextTargetSeq: state.NextTargetSeq,
+	}
+}
+
+func sessionID(senderCompID, targetCompID string) string {
+	return fmt.Sprintf("%s:%s->%s", BeginString, senderCompID, targetCompID)
+}
+
+// ID identifies the session by protocol version and CompIDs
+func (s *Session) ID() string {
+	return s.id
+}
+
+// UserID returns the user the session is bound to
+func (s *Session) UserID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.userID
+}
+
+// Claims returns the claims of the token presented at the last logon
+func (s *Session) Claims() *auth.Claims {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.claims
+}
+
+// Token returns the access token presented at the last logon, e.g. to act
+// for the user on another service
+func (s *Session) Token() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.token
+}
+
+// Send assigns the next sequence number to an application message, stores
+// it and writes it if the counterparty is connected
+func (s *Session) Send(msg *Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.send(msg)
+}
+
+// send is Send with the mutex held
+func (s *Session) send(msg *Message) error {
+	now := time.Now()
+	seq := s.nextSenderSeq
+	msg.Set(TagSenderCompID, s.senderCompID).
+		Set(TagTargetCompID, s.targetCompID).
+		SetInt(TagMsgSeqNum, seq).
+		SetTime(TagSendingTime, now)
+	raw := msg.Bytes()
+
+	var stored []byte
+	if !adminMsgTypes[msg.MsgType()] {
+		stored = raw
+	}
+	// A message is only sent once it can be resent
+	if err := s.acceptor.store.SaveOutgoing(context.Background(), s.id, seq, stored); err != nil {
+		return fmt.Errorf("failed to store message %d: %w", seq, err)
+	}
+	s.nextSenderSeq++
+
+	s.write(raw)
+	return nil
+}
+
+// write sends raw bytes on the current connection, dropping the
+// connection if the write fails. The mutex must be held.
+func (s *Session) write(raw []byte) {
+	if s.conn == nil {
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := s.conn.Write(raw); err != nil {
+		s.logger.Warn("Failed to write FIX message", zap.Error(err))
+		s.conn.Close()
+		return
+	}
+	s.lastSent = time.Now()
+}
+
+// Reject sends a session-level Reject for an invalid message
+func (s *Session) Reject(ref *Message, reason string, refTag int, text string) error {
+	msg := NewMessage(MsgTypeReject).
+		Set(TagSessionRejectReason, reason).
+		Set(TagRefMsgType, ref.MsgType()).
+		Set(TagText, text)
+	if seq, ok := ref.Get(TagMsgSeqNum); ok {
+		msg.Set(TagRefSeqNum, seq)
+	}
+	if refTag != 0 {
+		msg.SetInt(TagRefTagID, refTag)
+	}
+	return s.Send(msg)
+}
+
+// BusinessReject sends a BusinessMessageReject for an application message
+// that cannot be processed
+func (s *Session) BusinessReject(ref *Message, reason, text string) error {
+	msg := NewMessage(MsgTypeBusinessMessageReject).
+		Set(TagBusinessRejectReason, reason).
+		Set(TagRefMsgType, ref.MsgType()).
+		Set(TagText, text)
+	if seq, ok := ref.Get(TagMsgSeqNum); ok {
+		msg.Set(TagRefSeqNum, seq)
+	}
+	return s.Send(msg)
+}
+
+// logon attaches the connection and answers the counterparty's Logon. It
+// returns false if the logon was refused and the connection closed.
+func (s *Session) logon(conn net.Conn, msg *Message, token string, claims *auth.Claims, heartBtInt time.Duration) bool {
+	ctx := context.Background()
+
+	if reset, _ := msg.Get(TagResetSeqNumFlag); reset == "Y" {
+		if err := s.acceptor.store.ResetSession(ctx, s.id, claims.UserID); err != nil {
+			s.logger.Error("Failed to reset FIX session", zap.Error(err))
+			writeLogout(conn, s.senderCompID, s.targetCompID, s.nextSenderSeq, "session store unavailable")
+			return false
+		}
+		s.mutex.Lock()
+		s.nextSenderSeq = 1
+		s.mutex.Unlock()
+		s.nextTargetSeq = 1
+	}
+
+	seq, _ := msg.Int(TagMsgSeqNum)
+	if seq < s.nextTargetSeq {
+		writeLogout(conn, s.senderCompID, s.targetCompID, s.nextSenderSeq,
+			fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", s.nextTargetSeq, seq))
+		return false
+	}
+
+	s.mutex.Lock()
+	s.conn = conn
+	s.token = token
+	s.claims = claims
+	s.userID = claims.UserID
+	s.heartBtInt = heartBtInt
+	s.lastReceived = time.Now()
+	s.testReqID = ""
+
+	reply := NewMessage(MsgTypeLogon).
+		Set(TagEncryptMethod, "0").
+		SetInt(TagHeartBtInt, int(heartBtInt/time.Second))
+	if reset, _ := msg.Get(TagResetSeqNumFlag); reset == "Y" {
+		reply.Set(TagResetSeqNumFlag, "Y")
+	}
+	err := s.send(reply)
+	s.mutex.Unlock()
+	if err != nil {
+		s.logger.Error("Failed to send logon", zap.Error(err))
+		return false
+	}
+
+	s.queued = make(map[int]*Message)
+	s.resendPending = false
+	if seq > s.nextTargetSeq {
+		// The logon itself is handled; only the messages before it are missing
+		s.queued[seq] = nil
+		s.requestResend(seq)
+	} else {
+		s.advance(seq + 1)
+	}
+	return true
+}
+
+// run reads messages until the connection closes or either side logs out
+func (s *Session) run(reader *bufio.Reader) {
+	done := make(chan struct{})
+	defer close(done)
+	go s.monitor(done)
+
+	for {
+		msg, _, err := ReadMessage(reader)
+		if err != nil {
+			if errors.Is(err, ErrGarbled) {
+				s.logger.Warn("Dropping connection after garbled message", zap.Error(err))
+			}
+			return
+		}
+
+		s.mutex.Lock()
+		s.lastReceived = time.Now()
+		s.testReqID = ""
+		s.mutex.Unlock()
+
+		if !s.receive(msg) {
+			return
+		}
+	}
+}
+
+// detach forgets the connection after it closed
+func (s *Session) detach() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// logout sends a Logout and closes the connection
+func (s *Session) logout(text string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return
+	}
+	if err := s.send(NewMessage(MsgTypeLogout).Set(TagText, text)); err != nil {
+		s.logger.Error("Failed to send logout", zap.Error(err))
+	}
+	s.conn.Close()
+}
+
+// monitor sends heartbeats when the session is idle, and a TestRequest
+// when the counterparty is. A counterparty that stays silent for another
+// interval is disconnected.
+func (s *Session) monitor(done chan struct{}) {
+	s.mutex.Lock()
+	interval := s.heartBtInt
+	s.mutex.Unlock()
+
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+
+	grace := interval / 5
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.mutex.Lock()
+			if s.conn == nil {
+				s.mutex.Unlock()
+				return
+			}
+			idle := now.Sub(s.lastReceived)
+			switch {
+			case s.testReqID != "" && idle >= 2*interval+grace:
+				s.logger.Warn("Counterparty missed its heartbeats, disconnecting")
+				s.conn.Close()
+			case s.testReqID == "" && idle >= interval+grace:
+				s.testReqID = fmt.Sprintf("TEST-%d", now.UnixNano())
+				if err := s.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, s.testReqID)); err != nil {
+					s.logger.Error("Failed to send test request", zap.Error(err))
+				}
+			case now.Sub(s.lastSent) >= interval:
+				if err := s.send(NewMessage(MsgTypeHeartbeat)); err != nil {
+					s.logger.Error("Failed to send heartbeat", zap.Error(err))
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// receive checks the sequence number of an incoming message and processes
+// it, with any queued messages it unblocks. It returns false when the
+// connection should close.
+func (s *Session) receive(msg *Message) bool {
+	if sender, _ := msg.Get(TagSenderCompID); sender != s.targetCompID {
+		s.Reject(msg, SessionRejectCompIDProblem, TagSenderCompID, "unexpected SenderCompID")
+		s.logout("incorrect SenderCompID")
+		return false
+	}
+	if target, _ := msg.Get(TagTargetCompID); target != s.senderCompID {
+		s.Reject(msg, SessionRejectCompIDProblem, TagTargetCompID, "unexpected TargetCompID")
+		s.logout("incorrect TargetCompID")
+		return false
+	}
+
+	seq, err := msg.Int(TagMsgSeqNum)
+	if err != nil {
+		s.logout("MsgSeqNum missing or invalid")
+		return false
+	}
+
+	// A reset moves the incoming sequence regardless of MsgSeqNum
+	if msg.MsgType() == MsgTypeSequenceReset {
+		if gapFill, _ := msg.Get(TagGapFillFlag); gapFill != "Y" {
+			newSeq, err := msg.Int(TagNewSeqNo)
+			if err != nil || newSeq < s.nextTargetSeq {
+				s.Reject(msg, SessionRejectValueIncorrect, TagNewSeqNo, "NewSeqNo must not decrease the sequence")
+				return true
+			}
+			s.advance(newSeq)
+			return s.drain()
+		}
+	}
+
+	switch {
+	case seq > s.nextTargetSeq:
+		s.queued[seq] = msg
+		if msg.MsgType() == MsgTypeResendRequest {
+			// Answer at once so both sides can recover gaps at the same time
+			s.queued[seq] = nil
+			s.process(msg)
+		}
+		if !s.resendPending {
+			s.requestResend(seq)
+		}
+		return true
+
+	case seq < s.nextTargetSeq:
+		if possDup, _ := msg.Get(TagPossDupFlag); possDup == "Y" {
+			return true
+		}
+		s.logout(fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", s.nextTargetSeq, seq))
+		return false
+	}
+
+	// A Logout is consumed even though it ends the connection
+	ok := s.process(msg)
+	s.advance(nextSeq(msg, seq))
+	if !ok {
+		return false
+	}
+	return s.drain()
+}
+
+// drain processes queued messages that are now in sequence
+func (s *Session) drain() bool {
+	for {
+		msg, queued := s.queued[s.nextTargetSeq]
+		if !queued {
+			break
+		}
+		delete(s.queued, s.nextTargetSeq)
+		seq := s.nextTargetSeq
+		ok := msg == nil || s.process(msg)
+		s.advance(nextSeq(msg, seq))
+		if !ok {
+			return false
+		}
+	}
+
+	// Drop messages the counterparty skipped over with a gap fill
+	for seq := range s.queued {
+		if seq < s.nextTargetSeq {
+			delete(s.queued, seq)
+		}
+	}
+	if len(s.queued) == 0 {
+		s.resendPending = false
+	}
+	return true
+}
+
+// nextSeq is the sequence number expected after msg
+func nextSeq(msg *Message, seq int) int {
+	if msg != nil && msg.MsgType() == MsgTypeSequenceReset {
+		if newSeq, err := msg.Int(TagNewSeqNo); err == nil && newSeq > seq {
+			return newSeq
+		}
+	}
+	return seq + 1
+}
+
+func (s *Session) advance(next int) {
+	s.nextTargetSeq = next
+	if err := s.acceptor.store.SetNextTargetSeq(context.Background(), s.id, next); err != nil {
+		s.logger.Error("Failed to store incoming sequence number", zap.Error(err))
+	}
+}
+
+// requestResend asks the counterparty for everything from the first
+// missing message onwards
+func (s *Session) requestResend(received int) {
+	s.logger.Info("Incoming sequence gap, requesting resend",
+		zap.Int("expected", s.nextTargetSeq),
+		zap.Int("received", received))
+
+	s.resendPending = true
+	err := s.Send(NewMessage(MsgTypeResendRequest).
+		SetInt(TagBeginSeqNo, s.nextTargetSeq).
+		SetInt(TagEndSeqNo, 0))
+	if err != nil {
+		s.logger.Error("Failed to send resend request", zap.Error(err))
+	}
+}
+
+// process handles one in-sequence message. It returns false when the
+// connection should close.
+func (s *Session) process(msg *Message) bool {
+	switch msg.MsgType() {
+	case MsgTypeHeartbeat, MsgTypeSequenceReset:
+	case MsgTypeTestRequest:
+		reply := NewMessage(MsgTypeHeartbeat)
+		if id, ok := msg.Get(TagTestReqID); ok {
+			reply.Set(TagTestReqID, id)
+		}
+		if err := s.Send(reply); err != nil {
+			s.logger.Error("Failed to send heartbeat", zap.Error(err))
+		}
+	case MsgTypeResendRequest:
+		begin, err1 := msg.Int(TagBeginSeqNo)
+		end, err2 := msg.Int(TagEndSeqNo)
+		if err1 != nil || err2 != nil {
+			s.Reject(msg, SessionRejectRequiredTagMissing, TagBeginSeqNo, "BeginSeqNo and EndSeqNo are required")
+			return true
+		}
+		s.resend(begin, end)
+	case MsgTypeReject:
+		text, _ := msg.Get(TagText)
+		s.logger.Warn("Counterparty rejected a message", zap.String("text", text))
+	case MsgTypeLogout:
+		s.logout("logout acknowledged")
+		return false
+	case MsgTypeLogon:
+		s.Reject(msg, SessionRejectValueIncorrect, TagMsgType, "session is already logged on")
+	default:
+		handler, exists := s.acceptor.handlers[msg.MsgType()]
+		if !exists {
+			s.BusinessReject(msg, BusinessRejectUnsupportedMsgType, "unsupported message type")
+			return true
+		}
+		handler(s, msg)
+	}
+	return true
+}
+
+// resend replays stored messages from begin to end with PossDupFlag set,
+// replacing session-level messages with gap fills
+func (s *Session) resend(begin, end int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	last := s.nextSenderSeq - 1
+	if end == 0 || end > last {
+		end = last
+	}
+	if begin < 1 || begin > end {
+		return
+	}
+
+	stored, err := s.acceptor.store.LoadOutgoing(context.Background(), s.id, begin, end)
+	if err != nil {
+		s.logger.Error("Failed to load messages for resend", zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Resending messages",
+		zap.Int("begin", begin),
+		zap.Int("end", end),
+		zap.Int("stored", len(stored)))
+
+	now := time.Now()
+	gapStart := begin
+	for _, m := range stored {
+		if m.SeqNum > gapStart {
+			s.write(s.gapFill(gapStart, m.SeqNum, now))
+		}
+
+		msg, err := ParseMessage(m.Raw)
+		if err != nil {
+			s.logger.Error("Failed to parse stored message", zap.Error(err), zap.Int("seq", m.SeqNum))
+			s.write(s.gapFill(m.SeqNum, m.SeqNum+1, now))
+		} else {
+			original, _ := msg.Get(TagSendingTime)
+			msg.Set(TagPossDupFlag, "Y").
+				Set(TagOrigSendingTime, original).
+				SetTime(TagSendingTime, now)
+			s.write(msg.Bytes())
+		}
+		gapStart = m.SeqNum + 1
+	}
+	if gapStart <= end {
+		s.write(s.gapFill(gapStart, end+1, now))
+	}
+}
+
+// gapFill encodes a SequenceReset-GapFill taking the place of the
+// messages from seq up to, not including, newSeq
+func (s *Session) gapFill(seq, newSeq int, now time.Time) []byte {
+	return NewMessage(MsgTypeSequenceReset).
+		Set(TagSenderCompID, s.senderCompID).
+		Set(TagTargetCompID, s.targetCompID).
+		SetInt(TagMsgSeqNum, seq).
+		Set(TagPossDupFlag, "Y").
+		SetTime(TagSendingTime, now).
+		SetTime(TagOrigSendingTime, now).
+		Set(TagGapFillFlag, "Y").
+		SetInt(TagNewSeqNo, newSeq).
+		Bytes()
+}
+
+// writeLogout refuses a logon without touching any session state
+func writeLogout(conn net.Conn, senderCompID, targetCompID string, seq int, text string) {
+	msg := NewMessage(MsgTypeLogout).
+		Set(TagSenderCompID, senderCompID).
+		Set(TagTargetCompID, targetCompID).
+		SetInt(TagMsgSeqNum, seq).
+		SetTime(TagSendingTime, time.Now()).
+		Set(TagText, text)
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	conn.Write(msg.Bytes())
+	conn.Close()
+}
@@ -0,0 +1,115 @@
+package fix
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// SessionState is the persistent state of a session. A session is bound
+// to the user who first logged on to it.
+type SessionState struct {
+	UserID        string
+	NextSenderSeq int
+	NextTargetSeq int
+}
+
+// StoredMessage is an outgoing message kept for resend requests
+type StoredMessage struct {
+	SeqNum int
+	Raw    []byte
+}
+
+// SessionStore persists sequence numbers and outgoing messages so a
+// session can resume, and resend what was missed, after a reconnect or
+// restart
+type SessionStore interface {
+	// LoadSession returns the session state, or nil if the session is new
+	LoadSession(ctx context.Context, sessionID string) (*SessionState, error)
+	// ResetSession binds the session to a user and starts both sequences
+	// at 1, dropping stored messages
+	ResetSession(ctx context.Context, sessionID, userID string) error
+	// SaveOutgoing advances the next sender sequence number past seqNum and
+	// stores raw for resends; raw is nil for messages that are never resent
+	SaveOutgoing(ctx context.Context, sessionID string, seqNum int, raw []byte) error
+	// SetNextTargetSeq records the next expected incoming sequence number
+	SetNextTargetSeq(ctx context.Context, sessionID string, seqNum int) error
+	// LoadOutgoing returns the stored messages from begin to end inclusive,
+	// in order. An end of 0 means through the last message.
+	LoadOutgoing(ctx context.Context, sessionID string, begin, end int) ([]StoredMessage, error)
+}
+
+type memorySession struct {
+	state    SessionState
+	messages map[int][]byte
+}
+
+// MemoryStore keeps sessions in process memory. State is lost on restart,
+// so it is meant for tests and development.
+type MemoryStore struct {
+	sessions map[string]*memorySession
+	mutex    sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*memorySession)}
+}
+
+func (s *MemoryStore) LoadSession(ctx context.Context, sessionID string) (*SessionState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, nil
+	}
+	state := session.state
+	return &state, nil
+}
+
+func (s *MemoryStore) ResetSession(ctx context.Context, sessionID, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[sessionID] = &memorySession{
+		state:    SessionState{UserID: userID, NextSenderSeq: 1, NextTargetSeq: 1},
+		messages: make(map[int][]byte),
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveOutgoing(ctx context.Context, sessionID string, seqNum int, raw []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := s.sessions[sessionID]
+	if raw != nil {
+		session.messages[seqNum] = raw
+	}
+	session.state.NextSenderSeq = seqNum + 1
+	return nil
+}
+
+func (s *MemoryStore) SetNextTargetSeq(ctx context.Context, sessionID string, seqNum int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[sessionID].state.NextTargetSeq = seqNum
+	return nil
+}
+
+func (s *MemoryStore) LoadOutgoing(ctx context.Context, sessionID string, begin, end int) ([]StoredMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := make([]StoredMessage, 0)
+	for seq, raw := range s.sessions[sessionID].messages {
+		if seq >= begin && (end == 0 || seq <= end) {
+			messages = append(messages, StoredMessage{SeqNum: seq, Raw: raw})
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SeqNum < messages[j].SeqNum
+	})
+	return messages, nil
+}
@@ -0,0 +1,155 @@
+package fix
+
+// BeginString is the only protocol version the acceptor speaks
+const BeginString = "FIX.4.4"
+
+// Message types
+const (
+	MsgTypeHeartbeat                 = "0"
+	MsgTypeTestRequest               = "1"
+	MsgTypeResendRequest             = "2"
+	MsgTypeReject                    = "3"
+	MsgTypeSequenceReset             = "4"
+	MsgTypeLogout                    = "5"
+	MsgTypeExecutionReport           = "8"
+	MsgTypeOrderCancelReject         = "9"
+	MsgTypeLogon                     = "A"
+	MsgTypeNewOrderSingle            = "D"
+	MsgTypeOrderCancelRequest        = "F"
+	MsgTypeOrderCancelReplaceRequest = "G"
+	MsgTypeMarketDataRequest         = "V"
+	MsgTypeMarketDataSnapshot        = "W"
+	MsgTypeMarketDataIncremental     = "X"
+	MsgTypeMarketDataRequestReject   = "Y"
+	MsgTypeBusinessMessageReject     = "j"
+)
+
+// Field tags
+const (
+	TagAccount              = 1
+	TagAvgPx                = 6
+	TagBeginSeqNo           = 7
+	TagBeginString          = 8
+	TagBodyLength           = 9
+	TagCheckSum             = 10
+	TagClOrdID              = 11
+	TagCommission           = 12
+	TagCommType             = 13
+	TagCumQty               = 14
+	TagEndSeqNo             = 16
+	TagExecID               = 17
+	TagLastPx               = 31
+	TagLastQty              = 32
+	TagMsgSeqNum            = 34
+	TagMsgType              = 35
+	TagNewSeqNo             = 36
+	TagOrderID              = 37
+	TagOrderQty             = 38
+	TagOrdStatus            = 39
+	TagOrdType              = 40
+	TagOrigClOrdID          = 41
+	TagPossDupFlag          = 43
+	TagPrice                = 44
+	TagRefSeqNum            = 45
+	TagSenderCompID         = 49
+	TagSendingTime          = 52
+	TagSide                 = 54
+	TagSymbol               = 55
+	TagTargetCompID         = 56
+	TagText                 = 58
+	TagTransactTime         = 60
+	TagEncryptMethod        = 98
+	TagStopPx               = 99
+	TagCxlRejReason         = 102
+	TagOrdRejReason         = 103
+	TagHeartBtInt           = 108
+	TagTestReqID            = 112
+	TagOrigSendingTime      = 122
+	TagGapFillFlag          = 123
+	TagResetSeqNumFlag      = 141
+	TagNoRelatedSym         = 146
+	TagExecType             = 150
+	TagLeavesQty            = 151
+	TagMDReqID              = 262
+	TagSubscriptionReqType  = 263
+	TagMarketDepth          = 264
+	TagMDUpdateType         = 265
+	TagNoMDEntryTypes       = 267
+	TagNoMDEntries          = 268
+	TagMDEntryType          = 269
+	TagMDEntryPx            = 270
+	TagMDEntrySize          = 271
+	TagMDEntryDate          = 272
+	TagMDEntryTime          = 273
+	TagMDUpdateAction       = 279
+	TagMDReqRejReason       = 281
+	TagNumberOfOrders       = 346
+	TagRefTagID             = 371
+	TagRefMsgType           = 372
+	TagSessionRejectReason  = 373
+	TagBusinessRejectReason = 380
+	TagCxlRejResponseTo     = 434
+	TagUsername             = 553
+	TagPassword             = 554
+)
+
+// Field values
+const (
+	SideBuy  = "1"
+	SideSell = "2"
+
+	OrdTypeMarket = "1"
+	OrdTypeLimit  = "2"
+	OrdTypeStop   = "3"
+
+	ExecTypeNew      = "0"
+	ExecTypeCanceled = "4"
+	ExecTypeReplaced = "5"
+	ExecTypeRejected = "8"
+	ExecTypeTrade    = "F"
+
+	OrdStatusNew             = "0"
+	OrdStatusPartiallyFilled = "1"
+	OrdStatusFilled          = "2"
+	OrdStatusCanceled        = "4"
+	OrdStatusRejected        = "8"
+
+	OrdRejReasonUnknownSymbol  = "1"
+	OrdRejReasonExceedsLimit   = "3"
+	OrdRejReasonDuplicateOrder = "6"
+	OrdRejReasonOther          = "99"
+	CxlRejReasonUnknownOrder   = "1"
+	CxlRejReasonOther          = "99"
+	CxlRejResponseToCancel     = "1"
+	CxlRejResponseToReplace    = "2"
+	CommTypeAbsolute           = "3"
+
+	SessionRejectRequiredTagMissing = "1"
+	SessionRejectValueIncorrect     = "5"
+	SessionRejectIncorrectFormat    = "6"
+	SessionRejectCompIDProblem      = "9"
+	SessionRejectInvalidMsgType     = "11"
+
+	SubscriptionReqTypeSnapshot    = "0"
+	SubscriptionReqTypeSubscribe   = "1"
+	SubscriptionReqTypeUnsubscribe = "2"
+	MDUpdateTypeIncremental        = "1"
+
+	MDEntryTypeBid   = "0"
+	MDEntryTypeOffer = "1"
+	MDEntryTypeTrade = "2"
+
+	MDUpdateActionNew    = "0"
+	MDUpdateActionChange = "1"
+	MDUpdateActionDelete = "2"
+
+	MDReqRejReasonDuplicateMDReqID        = "1"
+	MDReqRejReasonInsufficientPermissions = "3"
+	MDReqRejReasonUnsupportedSubscription = "4"
+	MDReqRejReasonUnsupportedMarketDepth  = "5"
+	MDReqRejReasonUnsupportedMDUpdateType = "6"
+	MDReqRejReasonUnsupportedMDEntryType  = "8"
+
+	BusinessRejectUnsupportedMsgType = "3"
+	BusinessRejectNotAuthorized      = "6"
+)
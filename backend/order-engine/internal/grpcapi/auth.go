@@ -0,0 +1,116 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/api"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// methodScopes lists the permissions that allow calling each method, any
+// one of which is enough. Methods missing from the table are refused.
+var methodScopes = map[string][]string{
+	pb.OrderService_SubmitOrder_FullMethodName:           {auth.ScopeOrdersWrite},
+	pb.OrderService_CancelOrder_FullMethodName:           {auth.ScopeOrdersWrite, auth.ScopeOrdersCancelAny},
+	pb.OrderService_AmendOrder_FullMethodName:            {auth.ScopeOrdersWrite},
+	pb.OrderService_GetOrder_FullMethodName:              {auth.ScopeOrdersRead},
+	pb.MarketDataService_GetOrderBook_FullMethodName:     {auth.ScopeMarketDataRead},
+	pb.MarketDataService_StreamMarketData_FullMethodName: {auth.ScopeMarketDataRead},
+}
+
+type claimsKey struct{}
+
+// claimsFromContext returns the claims stored by the auth interceptors
+func claimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims, ok
+}
+
+// UnaryAuthInterceptor authenticates unary calls with the bearer token in
+// the authorization metadata and checks the method's scopes
+func UnaryAuthInterceptor(jwtService *auth.JWTService, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, jwtService, info.FullMethod, logger)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is the streaming counterpart of UnaryAuthInterceptor.
+// Streams are tracked in streams, so revoking the user's tokens ends them.
+func StreamAuthInterceptor(jwtService *auth.JWTService, streams *Streams, logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), jwtService, info.FullMethod, logger)
+		if err != nil {
+			return err
+		}
+
+		claims, _ := claimsFromContext(ctx)
+		ctx, done := streams.track(ctx, claims.UserID)
+		defer done()
+
+		err = handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+		if errors.Is(context.Cause(ctx), errStreamRevoked) {
+			return status.Error(codes.Unauthenticated, errStreamRevoked.Error())
+		}
+		return err
+	}
+}
+
+// authenticatedStream carries the claims in the stream's context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, jwtService *auth.JWTService, method string, logger *zap.Logger) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token, ok := api.BearerToken(values[0])
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata must use the Bearer scheme")
+	}
+
+	claims, err := jwtService.ValidateToken(ctx, token)
+	if errors.Is(err, auth.ErrRevocationCheck) {
+		logger.Error("Failed to check token revocation", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "authentication temporarily unavailable")
+	}
+	if err != nil {
+		addr := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			addr = p.Addr.String()
+		}
+		logger.Warn("Authentication failed",
+			zap.Error(err),
+			zap.String("method", method),
+			zap.String("peer", addr))
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	for _, permission := range methodScopes[method] {
+		if claims.HasScope(permission) {
+			return context.WithValue(ctx, claimsKey{}, claims), nil
+		}
+	}
+	return nil, status.Errorf(codes.PermissionDenied, "insufficient scope, requires one of %v", methodScopes[method])
+}
@@ -0,0 +1,116 @@
+package grpcapi
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+var (
+	sidesFromProto = map[pb.Side]types.OrderSide{
+		pb.Side_SIDE_BUY:  types.BuyOrder,
+		pb.Side_SIDE_SELL: types.SellOrder,
+	}
+	sidesToProto = map[types.OrderSide]pb.Side{
+		types.BuyOrder:  pb.Side_SIDE_BUY,
+		types.SellOrder: pb.Side_SIDE_SELL,
+	}
+	typesFromProto = map[pb.OrderType]types.OrderType{
+		pb.OrderType_ORDER_TYPE_LIMIT:  types.LimitOrder,
+		pb.OrderType_ORDER_TYPE_MARKET: types.MarketOrder,
+		pb.OrderType_ORDER_TYPE_STOP:   types.StopOrder,
+	}
+	typesToProto = map[types.OrderType]pb.OrderType{
+		types.LimitOrder:  pb.OrderType_ORDER_TYPE_LIMIT,
+		types.MarketOrder: pb.OrderType_ORDER_TYPE_MARKET,
+		types.StopOrder:   pb.OrderType_ORDER_TYPE_STOP,
+	}
+	statusesToProto = map[types.OrderStatus]pb.OrderStatus{
+		types.OrderStatusNew:       pb.OrderStatus_ORDER_STATUS_NEW,
+		types.OrderStatusPartial:   pb.OrderStatus_ORDER_STATUS_PARTIAL,
+		types.OrderStatusFilled:    pb.OrderStatus_ORDER_STATUS_FILLED,
+		types.OrderStatusCancelled: pb.OrderStatus_ORDER_STATUS_CANCELLED,
+		types.OrderStatusRejected:  pb.OrderStatus_ORDER_STATUS_REJECTED,
+	}
+	liquidityToProto = map[types.Liquidity]pb.Liquidity{
+		types.LiquidityMaker: pb.Liquidity_LIQUIDITY_MAKER,
+		types.LiquidityTaker: pb.Liquidity_LIQUIDITY_TAKER,
+	}
+)
+
+func orderToProto(order *types.Order) *pb.Order {
+	return &pb.Order{
+		Id:            order.ID,
+		ClientOrderId: order.ClientOrderID,
+		UserId:        order.UserID,
+		AccountId:     order.AccountID,
+		Symbol:        order.Symbol,
+		Type:          typesToProto[order.Type],
+		Side:          sidesToProto[order.Side],
+		Price:         order.Price,
+		Quantity:      order.Quantity,
+		FilledQty:     order.FilledQty,
+		RemainingQty:  order.RemainingQty,
+		Status:        statusesToProto[order.Status],
+		RejectReason:  string(order.RejectReason),
+		StopPrice:     order.StopPrice,
+		CreatedAt:     timestamppb.New(order.CreatedAt),
+		UpdatedAt:     timestamppb.New(order.UpdatedAt),
+	}
+}
+
+// fillsToProto returns the order's side of each trade
+func fillsToProto(orderID string, trades []*types.Trade) []*pb.Fill {
+	fills := make([]*pb.Fill, 0, len(trades))
+	for _, fill := range types.OrderFills(orderID, trades) {
+		fills = append(fills, &pb.Fill{
+			TradeId:    fill.TradeID,
+			OrderId:    fill.OrderID,
+			Side:       sidesToProto[fill.Side],
+			Liquidity:  liquidityToProto[fill.Liquidity],
+			Price:      fill.Price,
+			Quantity:   fill.Quantity,
+			Fee:        fill.Fee,
+			ExecutedAt: timestamppb.New(fill.ExecutedAt),
+		})
+	}
+	return fills
+}
+
+func tradeToProto(trade *types.Trade) *pb.Trade {
+	return &pb.Trade{
+		Id:         trade.ID,
+		Symbol:     trade.Symbol,
+		Price:      trade.Price,
+		Quantity:   trade.Quantity,
+		TakerSide:  sidesToProto[trade.TakerSide],
+		ExecutedAt: timestamppb.New(trade.ExecutedAt),
+	}
+}
+
+// snapshotToProto converts a snapshot, keeping at most depth levels per
+// side when depth is positive
+func snapshotToProto(snapshot *types.OrderBookSnapshot, depth int) *pb.OrderBookSnapshot {
+	return &pb.OrderBookSnapshot{
+		Symbol:    snapshot.Symbol,
+		Bids:      levelsToProto(snapshot.Bids, depth),
+		Asks:      levelsToProto(snapshot.Asks, depth),
+		Timestamp: timestamppb.New(snapshot.Timestamp),
+	}
+}
+
+func levelsToProto(levels []types.OrderBookLevel, depth int) []*pb.PriceLevel {
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+	result := make([]*pb.PriceLevel, len(levels))
+	for i, level := range levels {
+		result[i] = &pb.PriceLevel{
+			Price:    level.Price,
+			Quantity: level.Quantity,
+			Orders:   int32(level.Orders),
+		}
+	}
+	return result
+}
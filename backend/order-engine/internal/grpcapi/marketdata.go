@@ -0,0 +1,242 @@
+package grpcapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// tradeBufferSize bounds the trades waiting to be sent on one stream.
+// Trades cannot be conflated, so a stream that falls this far behind is
+// closed.
+const tradeBufferSize = 1024
+
+// subscription is one market data stream's view of the feed
+type subscription struct {
+	symbols map[string]bool
+	trades  chan types.Trade
+	// changed is signalled when a book in dirty needs a new snapshot
+	changed chan struct{}
+	dirty   map[string]bool
+	lagged  bool
+	mutex   sync.Mutex
+}
+
+// Feed fans trades and book changes from the engine out to market data
+// streams. Register OnTrade and OnOrder as engine listeners.
+type Feed struct {
+	subscriptions map[*subscription]bool
+	done          chan struct{}
+	closeOnce     sync.Once
+	mutex         sync.RWMutex
+}
+
+func NewFeed() *Feed {
+	return &Feed{
+		subscriptions: make(map[*subscription]bool),
+		done:          make(chan struct{}),
+	}
+}
+
+func (f *Feed) subscribe(symbols []string) *subscription {
+	sub := &subscription{
+		symbols: make(map[string]bool, len(symbols)),
+		trades:  make(chan types.Trade, tradeBufferSize),
+		changed: make(chan struct{}, 1),
+		dirty:   make(map[string]bool),
+	}
+	for _, symbol := range symbols {
+		sub.symbols[symbol] = true
+	}
+
+	f.mutex.Lock()
+	f.subscriptions[sub] = true
+	f.mutex.Unlock()
+	return sub
+}
+
+func (f *Feed) unsubscribe(sub *subscription) {
+	f.mutex.Lock()
+	delete(f.subscriptions, sub)
+	f.mutex.Unlock()
+}
+
+// OnTrade queues a trade for every stream subscribed to its symbol. It
+// never blocks; streams that cannot keep up are marked as lagged.
+func (f *Feed) OnTrade(trade types.Trade) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for sub := range f.subscriptions {
+		if !sub.symbols[trade.Symbol] {
+			continue
+		}
+		select {
+		case sub.trades <- trade:
+		default:
+			sub.mutex.Lock()
+			sub.lagged = true
+			sub.mutex.Unlock()
+			sub.signal()
+		}
+	}
+}
+
+// OnOrder marks the order's book as changed for every subscribed stream
+func (f *Feed) OnOrder(order types.Order) {
+	// Rejected orders never rest on the book
+	if order.Status == types.OrderStatusRejected {
+		return
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for sub := range f.subscriptions {
+		if !sub.symbols[order.Symbol] {
+			continue
+		}
+		sub.mutex.Lock()
+		sub.dirty[order.Symbol] = true
+		sub.mutex.Unlock()
+		sub.signal()
+	}
+}
+
+// Close ends every stream so the gRPC server can stop gracefully
+func (f *Feed) Close() {
+	f.closeOnce.Do(func() { close(f.done) })
+}
+
+func (sub *subscription) signal() {
+	select {
+	case sub.changed <- struct{}{}:
+	default:
+	}
+}
+
+// takeDirty returns the symbols whose books changed since the last call
+// and whether the stream fell behind
+func (sub *subscription) takeDirty() ([]string, bool) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	symbols := make([]string, 0, len(sub.dirty))
+	for symbol := range sub.dirty {
+		symbols = append(symbols, symbol)
+	}
+	sub.dirty = make(map[string]bool)
+	return symbols, sub.lagged
+}
+
+// GetOrderBook returns a snapshot of a symbol's book
+func (s *Server) GetOrderBook(ctx context.Context, req *pb.GetOrderBookRequest) (*pb.OrderBookSnapshot, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authentication")
+	}
+	if req.Symbol == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol is required")
+	}
+	if req.Depth < 0 {
+		return nil, status.Error(codes.InvalidArgument, "depth must not be negative")
+	}
+	if !claims.Allows(auth.ScopeMarketDataRead, auth.Resource{Symbol: req.Symbol}) {
+		return nil, status.Errorf(codes.PermissionDenied, "insufficient scope, requires %s", auth.ScopeMarketDataRead)
+	}
+
+	snapshot, err := s.engine.GetOrderBook(req.Symbol)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return snapshotToProto(snapshot, int(req.Depth)), nil
+}
+
+// StreamMarketData sends a snapshot of each requested book, then trades and
+// conflated snapshots as the books change
+func (s *Server) StreamMarketData(req *pb.StreamMarketDataRequest, stream pb.MarketDataService_StreamMarketDataServer) error {
+	ctx := stream.Context()
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing authentication")
+	}
+	if len(req.Symbols) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one symbol is required")
+	}
+	if req.Depth < 0 {
+		return status.Error(codes.InvalidArgument, "depth must not be negative")
+	}
+	for _, symbol := range req.Symbols {
+		if !claims.Allows(auth.ScopeMarketDataRead, auth.Resource{Symbol: symbol}) {
+			return status.Errorf(codes.PermissionDenied, "insufficient scope for %s, requires %s", symbol, auth.ScopeMarketDataRead)
+		}
+	}
+
+	// Subscribe before taking the first snapshots so no change is missed
+	sub := s.feed.subscribe(req.Symbols)
+	defer s.feed.unsubscribe(sub)
+
+	sendBook := func(symbol string) error {
+		snapshot, err := s.engine.GetOrderBook(symbol)
+		if err != nil {
+			// The book is created by the symbol's first order
+			snapshot = &types.OrderBookSnapshot{Symbol: symbol, Timestamp: time.Now()}
+		}
+		return stream.Send(&pb.MarketDataEvent{
+			Event: &pb.MarketDataEvent_Book{Book: snapshotToProto(snapshot, int(req.Depth))},
+		})
+	}
+	sendTrade := func(trade types.Trade) error {
+		return stream.Send(&pb.MarketDataEvent{
+			Event: &pb.MarketDataEvent_Trade{Trade: tradeToProto(&trade)},
+		})
+	}
+
+	for symbol := range sub.symbols {
+		if err := sendBook(symbol); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.feed.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case trade := <-sub.trades:
+			if err := sendTrade(trade); err != nil {
+				return err
+			}
+		case <-sub.changed:
+			symbols, lagged := sub.takeDirty()
+			if lagged {
+				return status.Error(codes.ResourceExhausted, "stream fell behind the market data feed")
+			}
+			// Send the trades that caused the change before the new book
+			for drained := false; !drained; {
+				select {
+				case trade := <-sub.trades:
+					if err := sendTrade(trade); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+			for _, symbol := range symbols {
+				if err := sendBook(symbol); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// SubmitOrder places an order for the caller. Rejected orders are returned
+// with their reject reason rather than as an error.
+func (s *Server) SubmitOrder(ctx context.Context, req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authentication")
+	}
+
+	// Unknown types and sides map to empty ones, which Validate refuses
+	order := &types.Order{
+		ID:            uuid.New().String(),
+		ClientOrderID: req.ClientOrderId,
+		UserID:        claims.UserID,
+		Symbol:        req.Symbol,
+		Type:          typesFromProto[req.Type],
+		Side:          sidesFromProto[req.Side],
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		StopPrice:     req.StopPrice,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := order.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	acct, err := s.accounts.ResolveAccount(ctx, claims.UserID, req.AccountId)
+	if errors.Is(err, account.ErrAccountNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("Failed to resolve account",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID))
+		return nil, status.Error(codes.Internal, "failed to resolve account")
+	}
+
+	if !claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: req.Symbol, Account: acct.ID}) {
+		return nil, status.Errorf(codes.PermissionDenied, "insufficient scope, requires %s", auth.ScopeOrdersWrite)
+	}
+
+	order.AccountID = acct.ID
+
+	trades, err := s.engine.ProcessOrder(order)
+
+	// A rejected market order may already have traded part of its quantity
+
+	if err != nil && order.Status != types.OrderStatusRejected {
+		s.logger.Error("Failed to process order",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+			zap.String("user_id", order.UserID))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.SubmitOrderResponse{
+		Order: orderToProto(order),
+		Fills: fillsToProto(order.ID, trades),
+	}, nil
+}
+
+// CancelOrder cancels one of the caller's resting orders. Cancelling
+// another user's order requires the orders:cancel:any scope.
+func (s *Server) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authentication")
+	}
+
+	order, err := s.engine.GetOrder(req.OrderId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+
+	permission := auth.ScopeOrdersWrite
+	if order.UserID != claims.UserID {
+		permission = auth.ScopeOrdersCancelAny
+	}
+	if !claims.Allows(permission, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+		// Do not reveal that another user's order exists
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+
+	if err := s.engine.CancelOrder(req.OrderId); err != nil {
+		// The order filled or was cancelled since it was looked up
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	order.Status = types.OrderStatusCancelled
+	order.UpdatedAt = time.Now()
+	return &pb.CancelOrderResponse{Order: orderToProto(&order)}, nil
+}
+
+// AmendOrder changes the price and total quantity of one of the caller's
+// resting limit orders
+func (s *Server) AmendOrder(ctx context.Context, req *pb.AmendOrderRequest) (*pb.AmendOrderResponse, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authentication")
+	}
+
+	if req.Price <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "price must be positive")
+	}
+	if req.Quantity <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "quantity must be positive")
+	}
+
+	order, err := s.engine.GetOrder(req.OrderId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+	if order.UserID != claims.UserID ||
+		!claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+	if order.Type != types.LimitOrder {
+		return nil, status.Error(codes.FailedPrecondition, "only limit orders can be amended")
+	}
+	if req.Quantity <= order.FilledQty {
+		return nil, status.Errorf(codes.InvalidArgument, "quantity must exceed the filled quantity %g", order.FilledQty)
+	}
+
+	amended, trades, err := s.engine.AmendOrder(req.OrderId, req.Price, req.Quantity)
+	if err != nil {
+		return nil, rejectStatus(err)
+	}
+
+	return &pb.AmendOrderResponse{
+		Order: orderToProto(&amended),
+		Fills: fillsToProto(amended.ID, trades),
+	}, nil
+}
+
+// GetOrder returns one of the caller's orders from the live engine, or
+// from storage once it has closed. Other users' orders require the
+// orders:read:any scope.
+func (s *Server) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authentication")
+	}
+
+	order, err := s.engine.GetOrder(req.OrderId)
+	if err != nil {
+		stored, err := s.store.GetOrder(ctx, req.OrderId)
+		if errors.Is(err, store.ErrOrderNotFound) {
+			return nil, status.Error(codes.NotFound, "order not found")
+		}
+		if err != nil {
+			s.logger.Error("Failed to get order",
+				zap.Error(err),
+				zap.String("order_id", req.OrderId))
+			return nil, status.Error(codes.Internal, "failed to get order")
+		}
+		order = *stored
+	}
+
+	permission := auth.ScopeOrdersRead
+	if order.UserID != claims.UserID {
+		permission = auth.ScopeOrdersReadAny
+	}
+	if !claims.Allows(permission, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+
+	return orderToProto(&order), nil
+}
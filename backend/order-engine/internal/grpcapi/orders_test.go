@@ -0,0 +1,216 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// accountStore keeps accounts in memory and stores nothing else
+type accountStore struct {
+	mutex    sync.Mutex
+	accounts []*types.Account
+}
+
+func (s *accountStore) CreateAccount(ctx context.Context, account *types.Account) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accounts = append(s.accounts, account)
+	return nil
+}
+
+func (s *accountStore) ListAccounts(ctx context.Context) ([]*types.Account, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*types.Account(nil), s.accounts...), nil
+}
+
+func (s *accountStore) ListBalances(ctx context.Context) ([]*types.Balance, error) {
+	return nil, nil
+}
+
+func (s *accountStore) ListPositions(ctx context.Context) ([]*types.Position, error) {
+	return nil, nil
+}
+
+func (s *accountStore) ListRiskLimits(ctx context.Context) (map[string]types.RiskLimits, error) {
+	return make(map[string]types.RiskLimits), nil
+}
+
+func (s *accountStore) SaveRiskLimits(ctx context.Context, accountID string, limits types.RiskLimits) error {
+	return nil
+}
+
+func (s *accountStore) SaveTransfer(ctx context.Context, transfer *types.Transfer) error {
+	return nil
+}
+
+func (s *accountStore) RecordSettlement(settlement account.Settlement) {}
+
+func (s *accountStore) ListKillSwitches(ctx context.Context) ([]*types.KillSwitch, error) {
+	return nil, nil
+}
+
+func (s *accountStore) SaveKillSwitch(ctx context.Context, ks *types.KillSwitch, event *types.AuditEvent) error {
+	return nil
+}
+
+func (s *accountStore) DeleteKillSwitch(ctx context.Context, accountID string, event *types.AuditEvent) error {
+	return nil
+}
+
+// newTestServer returns a server on a fresh engine, without storage
+func newTestServer(t *testing.T) *Server {
+	accounts, err := account.NewManager(context.Background(), &accountStore{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	return NewServer(matching.NewMatchingEngine(), nil, accounts, NewFeed(), zap.NewNop())
+}
+
+// as returns a context authenticated as a trader, narrowed to scopes if
+// any are given
+func as(t *testing.T, userID string, scopes ...string) context.Context {
+	claims := &auth.Claims{UserID: userID, Role: auth.RoleTrader, Scopes: scopes}
+	if err := auth.DefaultPolicy().Apply(claims); err != nil {
+		t.Fatalf("apply policy: %v", err)
+	}
+	return context.WithValue(context.Background(), claimsKey{}, claims)
+}
+
+func limit(side pb.Side, price, quantity float64) *pb.SubmitOrderRequest {
+	return &pb.SubmitOrderRequest{
+		Symbol:   "BTC-USD",
+		Type:     pb.OrderType_ORDER_TYPE_LIMIT,
+		Side:     side,
+		Price:    price,
+		Quantity: quantity,
+	}
+}
+
+func wantCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("error %v, want %s", err, code)
+	}
+}
+
+func TestSubmitOrder(t *testing.T) {
+	s := newTestServer(t)
+
+	_, err := s.SubmitOrder(context.Background(), limit(pb.Side_SIDE_BUY, 100, 1))
+	wantCode(t, err, codes.Unauthenticated)
+
+	// Unknown enums and bad quantities are refused before reaching the engine
+	_, err = s.SubmitOrder(as(t, "alice"), limit(pb.Side_SIDE_UNSPECIFIED, 100, 1))
+	wantCode(t, err, codes.InvalidArgument)
+	_, err = s.SubmitOrder(as(t, "alice"), limit(pb.Side_SIDE_BUY, 100, 0))
+	wantCode(t, err, codes.InvalidArgument)
+
+	req := limit(pb.Side_SIDE_BUY, 100, 1)
+	req.AccountId = "someone-elses"
+	_, err = s.SubmitOrder(as(t, "alice"), req)
+	wantCode(t, err, codes.NotFound)
+
+	_, err = s.SubmitOrder(as(t, "alice", auth.ScopeOrdersWrite+"@symbol=ETH-USD"), limit(pb.Side_SIDE_BUY, 100, 1))
+	wantCode(t, err, codes.PermissionDenied)
+
+	maker, err := s.SubmitOrder(as(t, "alice"), limit(pb.Side_SIDE_SELL, 100, 1))
+	if err != nil {
+		t.Fatalf("submit maker: %v", err)
+	}
+	if maker.Order.Status != pb.OrderStatus_ORDER_STATUS_NEW || maker.Order.AccountId != "alice" || len(maker.Fills) != 0 {
+		t.Fatalf("maker response %v", maker)
+	}
+
+	taker, err := s.SubmitOrder(as(t, "bob"), limit(pb.Side_SIDE_BUY, 100, 2))
+	if err != nil {
+		t.Fatalf("submit taker: %v", err)
+	}
+	if taker.Order.Status != pb.OrderStatus_ORDER_STATUS_PARTIAL || taker.Order.RemainingQty != 1 {
+		t.Fatalf("taker order %v, want partially filled with 1 remaining", taker.Order)
+	}
+	if len(taker.Fills) != 1 {
+		t.Fatalf("%d fills, want 1", len(taker.Fills))
+	}
+	fill := taker.Fills[0]
+	if fill.OrderId != taker.Order.Id || fill.Side != pb.Side_SIDE_BUY ||
+		fill.Liquidity != pb.Liquidity_LIQUIDITY_TAKER || fill.Price != 100 || fill.Quantity != 1 {
+		t.Fatalf("fill %v is not the taker's side of the trade", fill)
+	}
+}
+
+func TestCancelAndAmendOtherUsersOrders(t *testing.T) {
+	s := newTestServer(t)
+
+	resting, err := s.SubmitOrder(as(t, "alice"), limit(pb.Side_SIDE_SELL, 100, 2))
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	id := resting.Order.Id
+
+	// Other users' orders look missing
+	_, err = s.CancelOrder(as(t, "bob"), &pb.CancelOrderRequest{OrderId: id})
+	wantCode(t, err, codes.NotFound)
+	_, err = s.AmendOrder(as(t, "bob"), &pb.AmendOrderRequest{OrderId: id, Price: 101, Quantity: 2})
+	wantCode(t, err, codes.NotFound)
+
+	_, err = s.AmendOrder(as(t, "alice"), &pb.AmendOrderRequest{OrderId: id, Price: 0, Quantity: 2})
+	wantCode(t, err, codes.InvalidArgument)
+
+	if _, err := s.SubmitOrder(as(t, "bob"), limit(pb.Side_SIDE_BUY, 100, 1)); err != nil {
+		t.Fatalf("submit taker: %v", err)
+	}
+	_, err = s.AmendOrder(as(t, "alice"), &pb.AmendOrderRequest{OrderId: id, Price: 100, Quantity: 1})
+	wantCode(t, err, codes.InvalidArgument)
+
+	amended, err := s.AmendOrder(as(t, "alice"), &pb.AmendOrderRequest{OrderId: id, Price: 101, Quantity: 3})
+	if err != nil {
+		t.Fatalf("amend: %v", err)
+	}
+	if amended.Order.Price != 101 || amended.Order.RemainingQty != 2 {
+		t.Fatalf("amended order %v, want 2 remaining at 101", amended.Order)
+	}
+
+	// An administrator may cancel it
+	admin := &auth.Claims{UserID: "ops", Role: auth.RoleAdmin}
+	auth.DefaultPolicy().Apply(admin)
+	cancelled, err := s.CancelOrder(context.WithValue(context.Background(), claimsKey{}, admin), &pb.CancelOrderRequest{OrderId: id})
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if cancelled.Order.Status != pb.OrderStatus_ORDER_STATUS_CANCELLED {
+		t.Fatalf("cancelled order status %s", cancelled.Order.Status)
+	}
+
+	_, err = s.CancelOrder(as(t, "alice"), &pb.CancelOrderRequest{OrderId: id})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestRejectStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{matching.Reject(types.RejectReasonMessageRate, errors.New("too fast")), codes.ResourceExhausted},
+		{matching.Reject(types.RejectReasonMessageRatio, errors.New("too many")), codes.ResourceExhausted},
+		{matching.Reject(types.RejectReasonRiskLimit, errors.New("too big")), codes.FailedPrecondition},
+		{errors.New("order not found"), codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		if code := status.Code(rejectStatus(tt.err)); code != tt.code {
+			t.Errorf("rejectStatus(%v) = %s, want %s", tt.err, code, tt.code)
+		}
+	}
+}
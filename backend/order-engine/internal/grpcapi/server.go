@@ -0,0 +1,60 @@
+package grpcapi
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/store"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	pb "github.com/XNL-21bct0051-SDE-2/order-engine/proto/orderengine/v1"
+)
+
+// Server implements the gRPC order entry and market data services on top
+// of the same engine, accounts and storage as the HTTP API
+type Server struct {
+	pb.UnimplementedOrderServiceServer
+	pb.UnimplementedMarketDataServiceServer
+
+	engine   *matching.MatchingEngine
+	store    *store.PostgresStore
+	accounts *account.Manager
+	feed     *Feed
+	logger   *zap.Logger
+}
+
+func NewServer(engine *matching.MatchingEngine, pgStore *store.PostgresStore, accounts *account.Manager, feed *Feed, logger *zap.Logger) *Server {
+	return &Server{
+		engine:   engine,
+		store:    pgStore,
+		accounts: accounts,
+		feed:     feed,
+		logger:   logger,
+	}
+}
+
+// Register adds the services to a gRPC server
+func (s *Server) Register(grpcServer *grpc.Server) {
+	pb.RegisterOrderServiceServer(grpcServer, s)
+	pb.RegisterMarketDataServiceServer(grpcServer, s)
+}
+
+// rejectStatus converts an engine rejection into a status. Throttled
+// messages are reported as exhausted resources so clients back off.
+func rejectStatus(err error) error {
+	var rejectErr *matching.RejectError
+	if !errors.As(err, &rejectErr) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	switch rejectErr.Reason {
+	case types.RejectReasonMessageRate, types.RejectReasonMessageRatio:
+		return status.Errorf(codes.ResourceExhausted, "%s: %v", rejectErr.Reason, err)
+	default:
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", rejectErr.Reason, err)
+	}
+}
@@ -0,0 +1,68 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errStreamRevoked ends the streams of a user whose credentials are revoked
+var errStreamRevoked = errors.New("credentials revoked")
+
+// Streams tracks the open streams of each user, so they can be ended when
+// the user's tokens are revoked rather than running on until the client
+// disconnects
+type Streams struct {
+	mutex  sync.Mutex
+	byUser map[string]map[*stream]struct{}
+}
+
+type stream struct {
+	cancel context.CancelCauseFunc
+}
+
+func NewStreams() *Streams {
+	return &Streams{byUser: make(map[string]map[*stream]struct{})}
+}
+
+// track returns a context for a stream of the user that DisconnectUser
+// cancels, and a function to call once the stream ends
+func (s *Streams) track(ctx context.Context, userID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	st := &stream{cancel: cancel}
+
+	s.mutex.Lock()
+	streams, exists := s.byUser[userID]
+	if !exists {
+		streams = make(map[*stream]struct{})
+		s.byUser[userID] = streams
+	}
+	streams[st] = struct{}{}
+	s.mutex.Unlock()
+
+	return ctx, func() {
+		s.mutex.Lock()
+		if streams, exists := s.byUser[userID]; exists {
+			delete(streams, st)
+			if len(streams) == 0 {
+				delete(s.byUser, userID)
+			}
+		}
+		s.mutex.Unlock()
+		cancel(nil)
+	}
+}
+
+// DisconnectUser ends every open stream of the user and returns how many
+// were ended. Clients see Unauthenticated rather than the reason.
+func (s *Streams) DisconnectUser(userID, reason string) int {
+	s.mutex.Lock()
+	streams := s.byUser[userID]
+	delete(s.byUser, userID)
+	s.mutex.Unlock()
+
+	for st := range streams {
+		st.cancel(errStreamRevoked)
+	}
+	return len(streams)
+}
@@ -0,0 +1,32 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStreamsDisconnectUser(t *testing.T) {
+	streams := NewStreams()
+
+	alice, aliceDone := streams.track(context.Background(), "alice")
+	defer aliceDone()
+	bob, bobDone := streams.track(context.Background(), "bob")
+	defer bobDone()
+
+	if n := streams.DisconnectUser("alice", "revoked"); n != 1 {
+		t.Fatalf("disconnected %d streams, want 1", n)
+	}
+	if !errors.Is(context.Cause(alice), errStreamRevoked) {
+		t.Fatalf("alice's stream cause = %v, want %v", context.Cause(alice), errStreamRevoked)
+	}
+	if bob.Err() != nil {
+		t.Fatalf("bob's stream ended: %v", bob.Err())
+	}
+
+	// A finished stream is forgotten
+	bobDone()
+	if n := streams.DisconnectUser("bob", "revoked"); n != 0 {
+		t.Fatalf("disconnected %d finished streams, want 0", n)
+	}
+}
@@ -0,0 +1,234 @@
+package marketdata
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// recentCandles is the number of closed bars kept in memory per symbol and
+// time frame, covering the time it takes to persist them
+const recentCandles = 100
+
+// CandleListener is called with every change to a live bar and with every
+// bar as it closes. It is called from engine listeners and must not block.
+type CandleListener func(candle types.Candle, sequence uint64)
+
+// CandleStore persists closed bars without blocking the caller
+type CandleStore interface {
+	RecordCandle(candle types.Candle)
+}
+
+type candleKey struct {
+	symbol    string
+	timeFrame types.TimeFrame
+}
+
+// Candles aggregates trades into bars of every time frame for every
+// symbol. Periods without trades get empty bars that carry the previous
+// close, and closed bars are handed to the store.
+type Candles struct {
+	store     CandleStore
+	live      map[candleKey]*types.Candle
+	recent    map[candleKey][]types.Candle
+	sequences map[string]uint64
+	listeners []CandleListener
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func NewCandles(store CandleStore) *Candles {
+	return &Candles{
+		store:     store,
+		live:      make(map[candleKey]*types.Candle),
+		recent:    make(map[candleKey][]types.Candle),
+		sequences: make(map[string]uint64),
+		now:       time.Now,
+	}
+}
+
+// AddListener registers a listener for bar updates. It must be called
+// before any trades are processed.
+func (c *Candles) AddListener(listener CandleListener) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.listeners = append(c.listeners, listener)
+}
+
+// OnTrade adds a trade to the live bars of its symbol, closing the bars it
+// is past. It can be registered as an engine trade listener and is also
+// used to load recent trades.
+func (c *Candles) OnTrade(trade types.Trade) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, tf := range types.TimeFrames {
+		key := candleKey{symbol: trade.Symbol, timeFrame: tf}
+		live := c.roll(key, trade.ExecutedAt)
+		if live == nil {
+			live = &types.Candle{
+				Symbol:    trade.Symbol,
+				TimeFrame: tf,
+				OpenTime:  tf.Start(trade.ExecutedAt),
+			}
+			c.live[key] = live
+		}
+
+		if live.Trades == 0 {
+			live.Open, live.High, live.Low = trade.Price, trade.Price, trade.Price
+		}
+		live.High = math.Max(live.High, trade.Price)
+		live.Low = math.Min(live.Low, trade.Price)
+		live.Close = trade.Price
+		live.Volume += trade.Quantity
+		live.QuoteVolume += trade.Price * trade.Quantity
+		live.Trades++
+		c.notify(*live)
+	}
+}
+
+// Run closes bars as their periods end, so symbols that stop trading still
+// get their empty bars, until the context is cancelled
+func (c *Candles) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.closeElapsed()
+		}
+	}
+}
+
+func (c *Candles) closeElapsed() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	for key := range c.live {
+		c.roll(key, now)
+	}
+}
+
+// roll closes the live bar of a key and the empty bars after it until the
+// bar containing t, and returns that bar. It returns nil for keys without
+// a live bar. Times before the live bar count towards it. Callers must
+// hold the lock.
+func (c *Candles) roll(key candleKey, t time.Time) *types.Candle {
+	live, exists := c.live[key]
+	if !exists {
+		return nil
+	}
+
+	for !t.Before(live.CloseTime()) {
+		closed := *live
+		closed.Closed = true
+		c.close(key, closed)
+
+		live = &types.Candle{
+			Symbol:    key.symbol,
+			TimeFrame: key.timeFrame,
+			OpenTime:  closed.CloseTime(),
+			Open:      closed.Close,
+			High:      closed.Close,
+			Low:       closed.Close,
+			Close:     closed.Close,
+		}
+		c.live[key] = live
+		if !live.CloseTime().After(t) {
+			continue
+		}
+		c.notify(*live)
+	}
+	return live
+}
+
+// close records a closed bar. Callers must hold the lock.
+func (c *Candles) close(key candleKey, candle types.Candle) {
+	recent := append(c.recent[key], candle)
+	if len(recent) > recentCandles {
+		recent = recent[len(recent)-recentCandles:]
+	}
+	c.recent[key] = recent
+
+	if c.store != nil {
+		c.store.RecordCandle(candle)
+	}
+	c.notify(candle)
+}
+
+// notify advances the symbol's sequence and reports a bar. Callers must
+// hold the lock.
+func (c *Candles) notify(candle types.Candle) {
+	c.sequences[candle.Symbol]++
+	for _, listener := range c.listeners {
+		listener(candle, c.sequences[candle.Symbol])
+	}
+}
+
+// Live returns the live bar of every time frame of a symbol, shortest time
+// frame first, with the sequence of the symbol's last bar update
+func (c *Candles) Live(symbol string) ([]types.Candle, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	candles := make([]types.Candle, 0, len(types.TimeFrames))
+	for _, tf := range types.TimeFrames {
+		if live := c.roll(candleKey{symbol: symbol, timeFrame: tf}, now); live != nil {
+			candles = append(candles, *live)
+		}
+	}
+	return candles, c.sequences[symbol]
+}
+
+// Recent returns the bars in memory that open in [from, to), oldest first:
+// the most recently closed bars and the live bar. A zero to is unbounded.
+func (c *Candles) Recent(symbol string, tf types.TimeFrame, from, to time.Time) []types.Candle {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := candleKey{symbol: symbol, timeFrame: tf}
+	live := c.roll(key, c.now())
+
+	candles := make([]types.Candle, 0)
+	inRange := func(candle types.Candle) bool {
+		return !candle.OpenTime.Before(from) && (to.IsZero() || candle.OpenTime.Before(to))
+	}
+	for _, candle := range c.recent[key] {
+		if inRange(candle) {
+			candles = append(candles, candle)
+		}
+	}
+	if live != nil && inRange(*live) {
+		candles = append(candles, *live)
+	}
+	return candles
+}
+
+// MergeCandles combines stored bars with the bars in memory, which win for
+// the same open time, and returns them oldest first
+func MergeCandles(stored, recent []types.Candle) []types.Candle {
+	byOpen := make(map[time.Time]types.Candle, len(stored)+len(recent))
+	for _, candle := range stored {
+		byOpen[candle.OpenTime.UTC()] = candle
+	}
+	for _, candle := range recent {
+		byOpen[candle.OpenTime.UTC()] = candle
+	}
+
+	merged := make([]types.Candle, 0, len(byOpen))
+	for _, candle := range byOpen {
+		merged = append(merged, candle)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].OpenTime.Before(merged[j].OpenTime) })
+	return merged
+}
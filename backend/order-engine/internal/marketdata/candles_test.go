@@ -0,0 +1,106 @@
+package marketdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// candleStore records the bars it is given
+type candleStore struct {
+	candles []types.Candle
+}
+
+func (s *candleStore) RecordCandle(candle types.Candle) {
+	s.candles = append(s.candles, candle)
+}
+
+// minutes returns the stored one minute bars
+func (s *candleStore) minutes() []types.Candle {
+	var candles []types.Candle
+	for _, candle := range s.candles {
+		if candle.TimeFrame == types.TimeFrame1m {
+			candles = append(candles, candle)
+		}
+	}
+	return candles
+}
+
+func TestCandlesFillGapsWithEmptyBars(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	store := &candleStore{}
+	candles := NewCandles(store)
+	candles.now = func() time.Time { return now }
+
+	candles.OnTrade(trade("BTC-USD", 100, 1, start.Add(10*time.Second)))
+	candles.OnTrade(trade("BTC-USD", 105, 2, start.Add(40*time.Second)))
+	candles.OnTrade(trade("BTC-USD", 110, 1, start.Add(3*time.Minute+20*time.Second)))
+
+	closed := store.minutes()
+	if len(closed) != 3 {
+		t.Fatalf("%d one minute bars closed, want 3", len(closed))
+	}
+	first := closed[0]
+	if !first.OpenTime.Equal(start) || first.Open != 100 || first.High != 105 || first.Low != 100 ||
+		first.Close != 105 || first.Volume != 3 || first.Trades != 2 || !first.Closed {
+		t.Fatalf("first bar %+v", first)
+	}
+	for i, gap := range closed[1:] {
+		if !gap.OpenTime.Equal(start.Add(time.Duration(i+1)*time.Minute)) ||
+			gap.Open != 105 || gap.High != 105 || gap.Low != 105 || gap.Close != 105 ||
+			gap.Volume != 0 || gap.Trades != 0 {
+			t.Fatalf("gap bar %+v does not carry the previous close", gap)
+		}
+	}
+
+	// Bars close as time passes without trades
+	now = start.Add(5 * time.Minute)
+	candles.closeElapsed()
+	closed = store.minutes()
+	if len(closed) != 5 {
+		t.Fatalf("%d one minute bars closed, want 5", len(closed))
+	}
+	if last := closed[4]; !last.OpenTime.Equal(start.Add(4*time.Minute)) || last.Close != 110 || last.Trades != 0 {
+		t.Fatalf("bar after the last trade %+v", last)
+	}
+
+	recent := candles.Recent("BTC-USD", types.TimeFrame1m, start.Add(2*time.Minute), start.Add(5*time.Minute))
+	if len(recent) != 3 || !recent[0].OpenTime.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("recent bars %+v, want the three from 00:02", recent)
+	}
+
+	live, _ := candles.Live("BTC-USD")
+	if len(live) != len(types.TimeFrames) || live[0].Closed || !live[0].OpenTime.Equal(now) {
+		t.Fatalf("live bars %+v", live)
+	}
+	if hour := live[3]; hour.TimeFrame != types.TimeFrame1h || hour.Open != 100 || hour.Close != 110 || hour.Trades != 3 {
+		t.Fatalf("live hour bar %+v", hour)
+	}
+}
+
+func TestMergeCandlesPrefersRecentBars(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := []types.Candle{
+		{OpenTime: start.Add(time.Minute), Close: 1},
+		{OpenTime: start, Close: 1},
+	}
+	recent := []types.Candle{
+		{OpenTime: start.Add(time.Minute).In(time.FixedZone("x", 3600)), Close: 2},
+		{OpenTime: start.Add(2 * time.Minute), Close: 2},
+	}
+
+	merged := MergeCandles(stored, recent)
+	if len(merged) != 3 {
+		t.Fatalf("%d merged bars, want 3", len(merged))
+	}
+	for i, candle := range merged {
+		if !candle.OpenTime.Equal(start.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("bar %d opens at %v, bars are out of order", i, candle.OpenTime)
+		}
+	}
+	if merged[1].Close != 2 {
+		t.Fatal("stored bar replaced the bar in memory")
+	}
+}
@@ -0,0 +1,285 @@
+// Package marketdata derives market statistics from the matching engine's
+// trades and book updates.
+package marketdata
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+const (
+	// TickerWindow is the period ticker statistics cover
+	TickerWindow = 24 * time.Hour
+	// tickerBucket is the resolution of the ticker window. Trades leave the
+	// window a bucket at a time.
+	tickerBucket = time.Minute
+)
+
+// TickerListener is called with every change to a symbol's ticker. It is
+// called from engine listeners and must not block.
+type TickerListener func(ticker types.Ticker)
+
+// bucket aggregates the trades of one tickerBucket
+type bucket struct {
+	start       time.Time
+	open        float64
+	high        float64
+	low         float64
+	volume      float64
+	quoteVolume float64
+	trades      int
+}
+
+// rollingStats keeps a symbol's buckets in the window oldest first, with
+// the window's totals so a trade only updates them instead of rescanning
+type rollingStats struct {
+	buckets     []bucket
+	high        float64
+	low         float64
+	volume      float64
+	quoteVolume float64
+	trades      int
+
+	last     float64
+	bestBid  float64
+	bestAsk  float64
+	sequence uint64
+}
+
+// Tickers keeps rolling 24 hour statistics per symbol, updated from trades
+// and book updates as they happen
+type Tickers struct {
+	symbols   map[string]*rollingStats
+	listeners []TickerListener
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func NewTickers() *Tickers {
+	return &Tickers{
+		symbols: make(map[string]*rollingStats),
+		now:     time.Now,
+	}
+}
+
+// AddListener registers a listener for ticker changes. It must be called
+// before any trades are processed.
+func (t *Tickers) AddListener(listener TickerListener) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.listeners = append(t.listeners, listener)
+}
+
+// OnTrade adds a trade to its symbol's statistics. It can be registered as
+// an engine trade listener and is also used to load recent trades.
+func (t *Tickers) OnTrade(trade types.Trade) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	if trade.ExecutedAt.Before(now.Add(-TickerWindow)) {
+		return
+	}
+
+	stats := t.stats(trade.Symbol)
+	stats.expire(now)
+	stats.add(trade)
+	t.notify(trade.Symbol, stats, now)
+}
+
+// OnBookUpdate records the best prices of a book. It can be registered as
+// an engine book listener.
+func (t *Tickers) OnBookUpdate(update types.BookUpdate) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := t.stats(update.Symbol)
+	if stats.bestBid == update.BestBid && stats.bestAsk == update.BestAsk {
+		return
+	}
+	stats.bestBid = update.BestBid
+	stats.bestAsk = update.BestAsk
+	t.notify(update.Symbol, stats, t.now())
+}
+
+// Run moves the windows forward every bucket so tickers of symbols that
+// stop trading still age out, until the context is cancelled
+func (t *Tickers) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickerBucket)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.expire()
+		}
+	}
+}
+
+func (t *Tickers) expire() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	for symbol, stats := range t.symbols {
+		if stats.expire(now) {
+			t.notify(symbol, stats, now)
+		}
+	}
+}
+
+// Get returns a symbol's ticker
+func (t *Tickers) Get(symbol string) (types.Ticker, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats, exists := t.symbols[symbol]
+	if !exists {
+		return types.Ticker{}, fmt.Errorf("no ticker for symbol %s", symbol)
+	}
+	now := t.now()
+	if stats.expire(now) {
+		t.notify(symbol, stats, now)
+	}
+	return stats.ticker(symbol, now), nil
+}
+
+// All returns the ticker of every symbol, ordered by symbol
+func (t *Tickers) All() []types.Ticker {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	tickers := make([]types.Ticker, 0, len(t.symbols))
+	for symbol, stats := range t.symbols {
+		if stats.expire(now) {
+			t.notify(symbol, stats, now)
+		}
+		tickers = append(tickers, stats.ticker(symbol, now))
+	}
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].Symbol < tickers[j].Symbol })
+	return tickers
+}
+
+func (t *Tickers) stats(symbol string) *rollingStats {
+	stats, exists := t.symbols[symbol]
+	if !exists {
+		stats = &rollingStats{}
+		t.symbols[symbol] = stats
+	}
+	return stats
+}
+
+// notify advances a ticker's sequence and reports it. Callers must hold
+// the lock.
+func (t *Tickers) notify(symbol string, stats *rollingStats, now time.Time) {
+	stats.sequence++
+	if len(t.listeners) == 0 {
+		return
+	}
+	ticker := stats.ticker(symbol, now)
+	for _, listener := range t.listeners {
+		listener(ticker)
+	}
+}
+
+// add records a trade in the newest bucket, starting a new one when the
+// trade is past it. Trades reported slightly out of order are counted in
+// the newest bucket.
+func (s *rollingStats) add(trade types.Trade) {
+	start := trade.ExecutedAt.Truncate(tickerBucket)
+	if n := len(s.buckets); n == 0 || start.After(s.buckets[n-1].start) {
+		s.buckets = append(s.buckets, bucket{
+			start: start,
+			open:  trade.Price,
+			high:  trade.Price,
+			low:   trade.Price,
+		})
+	}
+
+	b := &s.buckets[len(s.buckets)-1]
+	b.high = math.Max(b.high, trade.Price)
+	b.low = math.Min(b.low, trade.Price)
+	b.volume += trade.Quantity
+	b.quoteVolume += trade.Price * trade.Quantity
+	b.trades++
+
+	if s.trades == 0 {
+		s.high, s.low = trade.Price, trade.Price
+	}
+	s.high = math.Max(s.high, trade.Price)
+	s.low = math.Min(s.low, trade.Price)
+	s.volume += trade.Quantity
+	s.quoteVolume += trade.Price * trade.Quantity
+	s.trades++
+	s.last = trade.Price
+}
+
+// expire drops the buckets that have left the window and reports whether
+// there were any. The high and low are only rescanned when a bucket leaves.
+func (s *rollingStats) expire(now time.Time) bool {
+	cutoff := now.Add(-TickerWindow)
+	expired := 0
+	for expired < len(s.buckets) && !s.buckets[expired].start.Add(tickerBucket).After(cutoff) {
+		b := s.buckets[expired]
+		s.volume -= b.volume
+		s.quoteVolume -= b.quoteVolume
+		s.trades -= b.trades
+		expired++
+	}
+	if expired == 0 {
+		return false
+	}
+	s.buckets = s.buckets[expired:]
+
+	if len(s.buckets) == 0 {
+		// Start again from exact zeros rather than accumulated rounding
+		s.high, s.low, s.volume, s.quoteVolume, s.trades = 0, 0, 0, 0, 0
+		return true
+	}
+	s.high, s.low = s.buckets[0].high, s.buckets[0].low
+	for _, b := range s.buckets[1:] {
+		s.high = math.Max(s.high, b.high)
+		s.low = math.Min(s.low, b.low)
+	}
+	return true
+}
+
+// ticker reports the statistics. Without trades in the window the open,
+// high and low stay at the last price and the change is zero.
+func (s *rollingStats) ticker(symbol string, now time.Time) types.Ticker {
+	ticker := types.Ticker{
+		Symbol:      symbol,
+		Sequence:    s.sequence,
+		Open:        s.last,
+		High:        s.last,
+		Low:         s.last,
+		Last:        s.last,
+		Volume:      s.volume,
+		QuoteVolume: s.quoteVolume,
+		BestBid:     s.bestBid,
+		BestAsk:     s.bestAsk,
+		Trades:      s.trades,
+		OpenTime:    now.Add(-TickerWindow),
+		CloseTime:   now,
+	}
+	if len(s.buckets) > 0 {
+		ticker.Open = s.buckets[0].open
+		ticker.High = s.high
+		ticker.Low = s.low
+		ticker.PriceChange = s.last - ticker.Open
+		if ticker.Open != 0 {
+			ticker.PriceChangePercent = ticker.PriceChange / ticker.Open * 100
+		}
+	}
+	return ticker
+}
@@ -0,0 +1,68 @@
+package marketdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func trade(symbol string, price, quantity float64, at time.Time) types.Trade {
+	return types.Trade{Symbol: symbol, Price: price, Quantity: quantity, ExecutedAt: at}
+}
+
+func TestTickerExpiresTradesOutOfTheWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	tickers := NewTickers()
+	tickers.now = func() time.Time { return now }
+
+	var updates []types.Ticker
+	tickers.AddListener(func(ticker types.Ticker) { updates = append(updates, ticker) })
+
+	// Trades older than the window are ignored
+	tickers.OnTrade(trade("BTC-USD", 90, 5, start.Add(-TickerWindow-time.Minute)))
+	if len(updates) != 0 {
+		t.Fatalf("%d updates for a trade outside the window", len(updates))
+	}
+
+	tickers.OnTrade(trade("BTC-USD", 100, 1, start))
+	now = start.Add(time.Hour)
+	tickers.OnTrade(trade("BTC-USD", 120, 2, now))
+	now = start.Add(2 * time.Hour)
+	tickers.OnTrade(trade("BTC-USD", 110, 1, now))
+
+	ticker, err := tickers.Get("BTC-USD")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if ticker.Open != 100 || ticker.High != 120 || ticker.Low != 100 || ticker.Last != 110 ||
+		ticker.Volume != 4 || ticker.QuoteVolume != 450 || ticker.Trades != 3 || ticker.PriceChange != 10 {
+		t.Fatalf("ticker %+v", ticker)
+	}
+
+	// The first trade's bucket leaves the window a day after it started
+	now = start.Add(TickerWindow + time.Minute)
+	tickers.expire()
+	if n := len(updates); n != 4 {
+		t.Fatalf("%d updates, want one for the expiry", n)
+	}
+	ticker = updates[len(updates)-1]
+	if ticker.Open != 120 || ticker.Low != 110 || ticker.Volume != 3 || ticker.Trades != 2 || ticker.Sequence != 4 {
+		t.Fatalf("ticker after expiry %+v", ticker)
+	}
+
+	// Nothing changes until the next bucket leaves
+	tickers.expire()
+	if n := len(updates); n != 4 {
+		t.Fatalf("%d updates, want none without an expiry", n)
+	}
+
+	// Once every trade has left, the ticker holds the last price
+	now = start.Add(TickerWindow + 3*time.Hour)
+	ticker, _ = tickers.Get("BTC-USD")
+	if ticker.Open != 110 || ticker.High != 110 || ticker.Low != 110 ||
+		ticker.Volume != 0 || ticker.QuoteVolume != 0 || ticker.Trades != 0 || ticker.PriceChange != 0 {
+		t.Fatalf("ticker without trades %+v", ticker)
+	}
+}
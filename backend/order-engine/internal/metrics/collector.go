@@ -79,6 +79,72 @@ var (
 		},
 		[]string{"handler", "method", "status"},
 	)
+
+	// OrderMessagesThrottled tracks order messages rejected by the engine's
+	// per-account throttles
+	OrderMessagesThrottled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_messages_throttled_total",
+			Help: "Total number of order messages rejected by engine throttles",
+		},
+		[]string{"reason", "message"},
+	)
+
+	// WebSocketMessagesConflated tracks updates skipped for WebSocket
+	// clients that were behind, to be replaced by a snapshot
+	WebSocketMessagesConflated = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_messages_conflated_total",
+			Help: "Total number of WebSocket updates replaced by a later snapshot for slow clients",
+		},
+		[]string{"channel"},
+	)
+
+	// WebSocketMessagesDropped tracks messages discarded when slow
+	// WebSocket clients are disconnected
+	WebSocketMessagesDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_messages_dropped_total",
+			Help: "Total number of WebSocket messages discarded for disconnected slow clients",
+		},
+		[]string{"channel"},
+	)
+
+	// WebSocketSlowConsumers tracks clients disconnected for falling behind
+	WebSocketSlowConsumers = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_slow_consumer_disconnects_total",
+			Help: "Total number of WebSocket clients disconnected for falling behind",
+		},
+	)
+
+	// StoreWritesDropped tracks queued writes the store gave up on
+	StoreWritesDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "store_writes_dropped_total",
+			Help: "Total number of queued database writes dropped after failing",
+		},
+		[]string{"kind"},
+	)
+
+	// StoreOutboxSpilled tracks writes waiting on disk because the
+	// database fell behind; alert when it stays above zero
+	StoreOutboxSpilled = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "store_outbox_spilled_records",
+			Help: "Number of queued database writes spilled to disk and not yet written",
+		},
+		[]string{"kind"},
+	)
+
+	// RateLimitedRequests tracks requests rejected by the HTTP rate limiter
+	RateLimitedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limited_total",
+			Help: "Total number of HTTP requests rejected by rate limiting",
+		},
+		[]string{"scope"},
+	)
 )
 
 // RecordOrderProcessed increments the orders processed counter
@@ -115,4 +181,39 @@ func RecordOrderCancellation(symbol, orderType string) {
 func RecordHTTPRequest(handler, method, status string, duration float64) {
 	HTTPRequestDuration.WithLabelValues(handler, method, status).Observe(duration)
 	HTTPRequestsTotal.WithLabelValues(handler, method, status).Inc()
-} 
\ No newline at end of file
+}
+
+// RecordRateLimited increments the rate limited requests counter
+func RecordRateLimited(scope string) {
+	RateLimitedRequests.WithLabelValues(scope).Inc()
+}
+
+// RecordOrderThrottled increments the throttled order messages counter
+func RecordOrderThrottled(reason, message string) {
+	OrderMessagesThrottled.WithLabelValues(reason, message).Inc()
+}
+
+// RecordWebSocketConflated counts an update skipped for a slow client
+func RecordWebSocketConflated(channel string) {
+	WebSocketMessagesConflated.WithLabelValues(channel).Inc()
+}
+
+// RecordWebSocketDropped counts a message discarded for a slow client
+func RecordWebSocketDropped(channel string) {
+	WebSocketMessagesDropped.WithLabelValues(channel).Inc()
+}
+
+// RecordWebSocketSlowConsumer counts a slow client disconnect
+func RecordWebSocketSlowConsumer() {
+	WebSocketSlowConsumers.Inc()
+}
+
+// RecordStoreWritesDropped counts queued writes the store gave up on
+func RecordStoreWritesDropped(kind string, count int) {
+	StoreWritesDropped.WithLabelValues(kind).Add(float64(count))
+}
+
+// RecordStoreOutboxSpilled adjusts the writes waiting on disk by delta
+func RecordStoreOutboxSpilled(kind string, delta int) {
+	StoreOutboxSpilled.WithLabelValues(kind).Add(float64(delta))
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket that refills at Rate tokens per second up to
+// Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// Unlimited reports whether the limit is disabled
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Result describes the state of a bucket after a request was charged
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit float64
+	// Remaining is the number of tokens left
+	Remaining float64
+	// RetryAfter is how long until the request could succeed when denied
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Limiter charges requests against named token buckets
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit, cost float64) (Result, error)
+}
+
+// ResultFor builds the result for a bucket holding tokens after the
+// request was charged, or refused when it was not allowed
+func ResultFor(limit Limit, tokens, cost float64, allowed bool) Result {
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  math.Max(0, tokens),
+		ResetAfter: secondsToDuration((limit.Burst - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((math.Min(cost, limit.Burst) - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// refill returns the tokens in a bucket after the elapsed time
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return math.Min(limit.Burst, tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// sweepInterval is how often idle buckets are dropped from memory
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// MemoryLimiter keeps buckets in process memory. Each replica limits
+// independently.
+type MemoryLimiter struct {
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes cost tokens from the bucket if it holds enough
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit, cost float64) (Result, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: limit.Burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = refill(limit, b.tokens, now.Sub(b.updated))
+	b.updated = now
+
+	allowed := b.tokens >= cost
+	if allowed {
+		b.tokens -= cost
+	}
+	return ResultFor(limit, b.tokens, cost, allowed), nil
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// starts full anyway
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if refill(b.limit, b.tokens, now.Sub(b.updated)) >= b.limit.Burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a memory limiter on a clock advanced by the test
+func newTestLimiter() (*MemoryLimiter, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	return l, &now
+}
+
+func allow(t *testing.T, l Limiter, key string, limit Limit, cost float64) Result {
+	t.Helper()
+	result, err := l.Allow(context.Background(), key, limit, cost)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	return result
+}
+
+func TestMemoryLimiterBurst(t *testing.T) {
+	l, _ := newTestLimiter()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		result := allow(t, l, "ip:a", limit, 1)
+		if !result.Allowed || result.Remaining != float64(2-i) {
+			t.Fatalf("request %d: %+v, want allowed with %d left", i+1, result, 2-i)
+		}
+	}
+
+	result := allow(t, l, "ip:a", limit, 1)
+	if result.Allowed {
+		t.Fatal("request over the burst allowed")
+	}
+	if result.RetryAfter != time.Second || result.ResetAfter != 3*time.Second {
+		t.Fatalf("retry after %s, reset after %s, want 1s and 3s", result.RetryAfter, result.ResetAfter)
+	}
+
+	// Buckets are independent
+	if result := allow(t, l, "ip:b", limit, 1); !result.Allowed {
+		t.Fatal("other bucket limited")
+	}
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	l, now := newTestLimiter()
+	limit := Limit{Rate: 2, Burst: 4}
+
+	allow(t, l, "user:alice", limit, 4)
+	if allow(t, l, "user:alice", limit, 1).Allowed {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	// Half a second refills one token at 2 per second
+	*now = now.Add(500 * time.Millisecond)
+	if result := allow(t, l, "user:alice", limit, 1); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after refill: %+v, want allowed with none left", result)
+	}
+
+	// Refills stop at the burst
+	*now = now.Add(time.Hour)
+	if result := allow(t, l, "user:alice", limit, 1); result.Remaining != 3 {
+		t.Fatalf("after a long idle: %v left, want 3", result.Remaining)
+	}
+}
+
+func TestMemoryLimiterWeight(t *testing.T) {
+	l, now := newTestLimiter()
+	limit := Limit{Rate: 1, Burst: 10}
+
+	if result := allow(t, l, "user:alice", limit, 8); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("weighted request: %+v, want allowed with 2 left", result)
+	}
+
+	// A denied request takes nothing, and waits for its whole cost
+	result := allow(t, l, "user:alice", limit, 5)
+	if result.Allowed || result.Remaining != 2 || result.RetryAfter != 3*time.Second {
+		t.Fatalf("heavy request: %+v, want denied with 2 left and a 3s retry", result)
+	}
+	if result := allow(t, l, "user:alice", limit, 2); !result.Allowed {
+		t.Fatal("request within the remaining tokens denied")
+	}
+
+	// A request costing more than the burst waits for a full bucket
+	*now = now.Add(4 * time.Second)
+	if result := allow(t, l, "user:alice", limit, 20); result.Allowed || result.RetryAfter != 6*time.Second {
+		t.Fatalf("oversized request: %+v, want denied with a 6s retry", result)
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	l, now := newTestLimiter()
+	limit := Limit{Rate: 1, Burst: 100}
+
+	allow(t, l, "ip:idle", limit, 1)
+	allow(t, l, "ip:busy", limit, 100)
+
+	// After a minute the idle bucket is full again and dropped, the busy
+	// one is still refilling
+	*now = now.Add(sweepInterval)
+	allow(t, l, "ip:other", limit, 1)
+	if _, exists := l.buckets["ip:idle"]; exists {
+		t.Fatal("full bucket not swept")
+	}
+	if _, exists := l.buckets["ip:busy"]; !exists {
+		t.Fatal("refilling bucket swept")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		Default: Limit{Rate: 1, Burst: 1},
+		Roles: map[string]Limit{
+			"trader": {Rate: 10, Burst: 20},
+			"admin":  {Rate: 50, Burst: 100},
+		},
+		Weights: map[string]float64{"get /api/v1/orderbook/:symbol": 5},
+	}
+
+	if w := policy.Weight("GET", "/api/v1/orderbook/:symbol"); w != 5 {
+		t.Fatalf("weight %g, want 5", w)
+	}
+	if w := policy.Weight("POST", "/api/v1/orders"); w != 1 {
+		t.Fatalf("unlisted weight %g, want 1", w)
+	}
+
+	if limit := policy.LimitFor([]string{"trader", "admin"}); limit.Rate != 50 {
+		t.Fatalf("limit %+v, want the most generous role", limit)
+	}
+	if limit := policy.LimitFor([]string{"viewer"}); limit != policy.Default {
+		t.Fatalf("limit %+v, want the default", limit)
+	}
+}
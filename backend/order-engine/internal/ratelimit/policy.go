@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"strings"
+)
+
+// Policy decides which bucket limits and request weights apply
+type Policy struct {
+	// IP limits every request by client address
+	IP Limit
+	// Default limits authenticated users without a configured role
+	Default Limit
+	// Roles overrides Default per role; the most generous role wins
+	Roles map[string]Limit
+	// Weights is the cost of an endpoint, keyed by lower-case
+	// "method route", e.g. "get /api/v1/orderbook/:symbol". Unlisted
+	// endpoints cost 1.
+	Weights map[string]float64
+}
+
+// Weight returns the cost of a request to the route
+func (p *Policy) Weight(method, route string) float64 {
+	if w, ok := p.Weights[strings.ToLower(method+" "+route)]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// LimitFor returns the limit of a principal with the given roles
+func (p *Policy) LimitFor(roles []string) Limit {
+	limit, found := Limit{}, false
+	for _, role := range roles {
+		if l, ok := p.Roles[role]; ok && (!found || l.Rate > limit.Rate) {
+			limit, found = l, true
+		}
+	}
+	if !found {
+		return p.Default
+	}
+	return limit
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// CreateAccount inserts an account, ignoring one that already exists
+func (s *PostgresStore) CreateAccount(ctx context.Context, a *types.Account) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO accounts (id, user_id, parent_id, name, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		a.ID, a.UserID, a.ParentID, a.Name, a.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+	return nil
+}
+
+// ListAccounts returns every account in creation order
+func (s *PostgresStore) ListAccounts(ctx context.Context) ([]*types.Account, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, parent_id, name, created_at FROM accounts
+		ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]*types.Account, 0)
+	for rows.Next() {
+		var a types.Account
+		if err := rows.Scan(&a.ID, &a.UserID, &a.ParentID, &a.Name, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// ListBalances returns the balances of every account
+func (s *PostgresStore) ListBalances(ctx context.Context) ([]*types.Balance, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT account_id, asset, amount, updated_at FROM balances`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make([]*types.Balance, 0)
+	for rows.Next() {
+		var b types.Balance
+		if err := rows.Scan(&b.AccountID, &b.Asset, &b.Amount, &b.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances = append(balances, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// ListPositions returns the positions of every account
+func (s *PostgresStore) ListPositions(ctx context.Context) ([]*types.Position, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT account_id, symbol, quantity, avg_price, updated_at FROM positions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make([]*types.Position, 0)
+	for rows.Next() {
+		var p types.Position
+		if err := rows.Scan(&p.AccountID, &p.Symbol, &p.Quantity, &p.AvgPrice, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan position: %w", err)
+		}
+		positions = append(positions, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read positions: %w", err)
+	}
+
+	return positions, nil
+}
+
+// ListRiskLimits returns the limits of every account that has them
+func (s *PostgresStore) ListRiskLimits(ctx context.Context) (map[string]types.RiskLimits, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT account_id, max_order_qty, max_order_value, max_position_qty
+		FROM risk_limits`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query risk limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := make(map[string]types.RiskLimits)
+	for rows.Next() {
+		var accountID string
+		var l types.RiskLimits
+		if err := rows.Scan(&accountID, &l.MaxOrderQty, &l.MaxOrderValue, &l.MaxPositionQty); err != nil {
+			return nil, fmt.Errorf("failed to scan risk limits: %w", err)
+		}
+		limits[accountID] = l
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read risk limits: %w", err)
+	}
+
+	return limits, nil
+}
+
+// SaveRiskLimits sets the limits of an account
+func (s *PostgresStore) SaveRiskLimits(ctx context.Context, accountID string, l types.RiskLimits) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO risk_limits (account_id, max_order_qty, max_order_value,
+			max_position_qty, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (account_id) DO UPDATE SET
+			max_order_qty = EXCLUDED.max_order_qty,
+			max_order_value = EXCLUDED.max_order_value,
+			max_position_qty = EXCLUDED.max_position_qty,
+			updated_at = EXCLUDED.updated_at`,
+		accountID, l.MaxOrderQty, l.MaxOrderValue, l.MaxPositionQty, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save risk limits: %w", err)
+	}
+	return nil
+}
+
+// SaveTransfer records a transfer and applies it to both balances in one
+// transaction
+func (s *PostgresStore) SaveTransfer(ctx context.Context, t *types.Transfer) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO transfers (id, from_account_id, to_account_id, asset, amount,
+			created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		t.ID, t.FromAccountID, t.ToAccountID, t.Asset, t.Amount, t.CreatedBy, t.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save transfer: %w", err)
+	}
+
+	if t.FromAccountID != "" {
+		if err := applyBalanceDelta(ctx, tx, t.FromAccountID, t.Asset, -t.Amount, t.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := applyBalanceDelta(ctx, tx, t.ToAccountID, t.Asset, t.Amount, t.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transfer: %w", err)
+	}
+	return nil
+}
+
+// RecordSettlement queues a trade settlement for persistence. It never
+// blocks: settlements the database cannot keep up with are spilled to the
+// outbox directory.
+func (s *PostgresStore) RecordSettlement(settlement account.Settlement) {
+	s.settlements.push(settlement)
+}
+
+func (s *PostgresStore) writeSettlement(ctx context.Context, record []byte) error {
+	var settlement account.Settlement
+	if err := json.Unmarshal(record, &settlement); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+	if err := s.SaveSettlement(ctx, &settlement); err != nil {
+		return fmt.Errorf("settlement of trade %s: %w", settlement.TradeID, err)
+	}
+	return nil
+}
+
+// SaveSettlement applies a trade's balance changes and stores the resulting
+// positions in one transaction. Balances are stored as deltas so they
+// commute with concurrent transfers; the trade is marked settled in the
+// same transaction so a retried settlement is applied only once.
+func (s *PostgresStore) SaveSettlement(ctx context.Context, settlement *account.Settlement) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO settled_trades (trade_id, settled_at) VALUES ($1, $2)
+		ON CONFLICT (trade_id) DO NOTHING`,
+		settlement.TradeID, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark trade settled: %w", err)
+	}
+	if settled, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to mark trade settled: %w", err)
+	} else if settled == 0 {
+		return nil
+	}
+
+	for _, b := range settlement.Balances {
+		if err := applyBalanceDelta(ctx, tx, b.AccountID, b.Asset, b.Delta, now); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range settlement.Positions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO positions (account_id, symbol, quantity, avg_price, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (account_id, symbol) DO UPDATE SET
+				quantity = EXCLUDED.quantity,
+				avg_price = EXCLUDED.avg_price,
+				updated_at = EXCLUDED.updated_at`,
+			p.AccountID, p.Symbol, p.Quantity, p.AvgPrice, p.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save position: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit settlement: %w", err)
+	}
+	return nil
+}
+
+func applyBalanceDelta(ctx context.Context, tx *sql.Tx, accountID, asset string, delta float64, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO balances (account_id, asset, amount, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id, asset) DO UPDATE SET
+			amount = balances.amount + EXCLUDED.amount,
+			updated_at = EXCLUDED.updated_at`,
+		accountID, asset, delta, at,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	return nil
+}
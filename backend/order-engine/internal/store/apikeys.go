@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+const apiKeyColumns = `id, user_id, label, roles, scopes, allowed_ips,
+	encrypted_secret, created_at, revoked_at`
+
+// CreateAPIKey inserts a new API key
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, key *auth.APIKey) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		key.ID, key.UserID, key.Label, pq.Array(key.Roles), pq.Array(key.Scopes),
+		pq.Array(key.AllowedIPs), key.EncryptedSecret, key.CreatedAt, key.RevokedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID, including revoked keys
+func (s *PostgresStore) GetAPIKey(ctx context.Context, id string) (*auth.APIKey, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the user's keys, newest first
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, userID string) ([]*auth.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*auth.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks one of the user's keys as revoked
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+		time.Now(), id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if n == 0 {
+		return auth.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*auth.APIKey, error) {
+	var key auth.APIKey
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.UserID, &key.Label, pq.Array(&key.Roles),
+		pq.Array(&key.Scopes), pq.Array(&key.AllowedIPs), &key.EncryptedSecret,
+		&key.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// ListKillSwitches returns every engaged kill switch
+func (s *PostgresStore) ListKillSwitches(ctx context.Context) ([]*types.KillSwitch, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT account_id, reason, set_by, set_at FROM kill_switches`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query kill switches: %w", err)
+	}
+	defer rows.Close()
+
+	kills := make([]*types.KillSwitch, 0)
+	for rows.Next() {
+		var ks types.KillSwitch
+		if err := rows.Scan(&ks.AccountID, &ks.Reason, &ks.SetBy, &ks.SetAt); err != nil {
+			return nil, fmt.Errorf("failed to scan kill switch: %w", err)
+		}
+		kills = append(kills, &ks)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read kill switches: %w", err)
+	}
+
+	return kills, nil
+}
+
+// SaveKillSwitch engages a kill switch and records the audit event in one
+// transaction
+func (s *PostgresStore) SaveKillSwitch(ctx context.Context, ks *types.KillSwitch, event *types.AuditEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO kill_switches (account_id, reason, set_by, set_at)
+		VALUES ($1, $2, $3, $4)`,
+		ks.AccountID, ks.Reason, ks.SetBy, ks.SetAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save kill switch: %w", err)
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit kill switch: %w", err)
+	}
+	return nil
+}
+
+// DeleteKillSwitch releases a kill switch and records the audit event in
+// one transaction
+func (s *PostgresStore) DeleteKillSwitch(ctx context.Context, accountID string, event *types.AuditEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM kill_switches WHERE account_id = $1`, accountID); err != nil {
+		return fmt.Errorf("failed to delete kill switch: %w", err)
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit kill switch release: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns the account's audit trail, newest first
+func (s *PostgresStore) ListAuditEvents(ctx context.Context, accountID string, limit int) ([]*types.AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, action, account_id, actor, reason, created_at FROM audit_events
+		WHERE account_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`,
+		accountID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*types.AuditEvent, 0)
+	for rows.Next() {
+		var e types.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Action, &e.AccountID, &e.Actor, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+func saveAuditEvent(ctx context.Context, tx *sql.Tx, e *types.AuditEvent) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_events (id, action, account_id, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.ID, e.Action, e.AccountID, e.Actor, e.Reason, e.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save audit event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// CandleFilter selects the bars of one symbol and time frame that open in
+// [From, To). Zero times are unbounded.
+type CandleFilter struct {
+	Symbol    string
+	TimeFrame types.TimeFrame
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// RecordCandle queues a closed bar for persistence without blocking the
+// caller
+func (s *PostgresStore) RecordCandle(candle types.Candle) {
+	s.candles.push(candle)
+}
+
+func (s *PostgresStore) writeCandle(ctx context.Context, record []byte) error {
+	var candle types.Candle
+	if err := json.Unmarshal(record, &candle); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+	if err := s.SaveCandle(ctx, &candle); err != nil {
+		return fmt.Errorf("%s %s candle at %s: %w", candle.Symbol, candle.TimeFrame, candle.OpenTime, err)
+	}
+	return nil
+}
+
+// SaveCandle upserts a bar, so bars rebuilt from replayed trades replace
+// the stored ones
+func (s *PostgresStore) SaveCandle(ctx context.Context, candle *types.Candle) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO candles (symbol, time_frame, open_time, open, high, low,
+			close, volume, quote_volume, trades)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (symbol, time_frame, open_time) DO UPDATE SET
+			open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low,
+			close = EXCLUDED.close, volume = EXCLUDED.volume,
+			quote_volume = EXCLUDED.quote_volume, trades = EXCLUDED.trades`,
+		candle.Symbol, candle.TimeFrame, candle.OpenTime, candle.Open, candle.High,
+		candle.Low, candle.Close, candle.Volume, candle.QuoteVolume, candle.Trades,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save candle: %w", err)
+	}
+	return nil
+}
+
+// ListCandles returns the stored bars matching the filter, oldest first
+func (s *PostgresStore) ListCandles(ctx context.Context, filter CandleFilter) ([]types.Candle, error) {
+	query := `SELECT open_time, open, high, low, close, volume, quote_volume, trades
+		FROM candles
+		WHERE symbol = $1 AND time_frame = $2 AND open_time >= $3`
+	args := []interface{}{filter.Symbol, filter.TimeFrame, filter.From}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		query += fmt.Sprintf(" AND open_time < $%d", len(args))
+	}
+	query += " ORDER BY open_time"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query candles: %w", err)
+	}
+	defer rows.Close()
+
+	candles := make([]types.Candle, 0)
+	for rows.Next() {
+		candle := types.Candle{Symbol: filter.Symbol, TimeFrame: filter.TimeFrame, Closed: true}
+		if err := rows.Scan(&candle.OpenTime, &candle.Open, &candle.High, &candle.Low,
+			&candle.Close, &candle.Volume, &candle.QuoteVolume, &candle.Trades); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candle.OpenTime = candle.OpenTime.UTC()
+		candles = append(candles, candle)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read candles: %w", err)
+	}
+	return candles, nil
+}
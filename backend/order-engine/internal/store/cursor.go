@@ -0,0 +1,55 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a result set ordered newest first by time,
+// with the ID breaking ties between rows sharing a timestamp
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Encode returns the opaque string form handed to API clients
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor previously produced by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Time: time.Unix(0, ts).UTC(), ID: id}, nil
+}
+
+// After reports whether a row at (t, id) comes after the cursor position
+func (c *Cursor) After(t time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	if t.Equal(c.Time) {
+		return id < c.ID
+	}
+	return t.Before(c.Time)
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{Time: time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC), ID: "order:1"}
+	decoded, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !decoded.Time.Equal(c.Time) || decoded.ID != c.ID {
+		t.Fatalf("decoded %+v, want %+v", decoded, c)
+	}
+
+	for _, raw := range []string{"", "!!!", "MTIz", "YWJjOmlk", "MTIzOg"} {
+		if _, err := DecodeCursor(raw); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("decode %q: got %v, want %v", raw, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestCursorAfter(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &Cursor{Time: at, ID: "m"}
+
+	tests := []struct {
+		name  string
+		time  time.Time
+		id    string
+		after bool
+	}{
+		{"older", at.Add(-time.Second), "z", true},
+		{"newer", at.Add(time.Second), "a", false},
+		{"same time, lower ID", at, "a", true},
+		{"same row", at, "m", false},
+		{"same time, higher ID", at, "z", false},
+	}
+	for _, tt := range tests {
+		if got := c.After(tt.time, tt.id); got != tt.after {
+			t.Fatalf("%s: After = %v, want %v", tt.name, got, tt.after)
+		}
+	}
+
+	var none *Cursor
+	if !none.After(at, "a") {
+		t.Fatal("a nil cursor must match every row")
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// fakeDB records the statements run on it and answers each query with the
+// columns and rows returned by its rows function
+type fakeDB struct {
+	rows func(query string, args []interface{}) ([]string, [][]driver.Value)
+
+	mutex      sync.Mutex
+	statements []statement
+	commits    int
+}
+
+// statement is a query or exec run on a fakeDB, with its whitespace
+// collapsed
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// newFakeStore returns a store on a fake database
+func newFakeStore(t *testing.T, db *fakeDB) *PostgresStore {
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() { conn.Close() })
+	return &PostgresStore{db: conn, queued: make(map[string]types.Order)}
+}
+
+func (db *fakeDB) record(query string, named []driver.NamedValue) statement {
+	args := make([]interface{}, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	s := statement{query: strings.Join(strings.Fields(query), " "), args: args}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.statements = append(db.statements, s)
+	return s
+}
+
+// ran returns the statements run so far
+func (db *fakeDB) ran() []statement {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]statement(nil), db.statements...)
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeConn{db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{c.db}, nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.db.record(query, args)
+	if c.db.rows == nil {
+		return &fakeRows{}, nil
+	}
+	columns, values := c.db.rows(s.query, s.args)
+	return &fakeRows{columns: columns, values: values}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+	tx.db.commits++
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// columns names n columns, as only their number matters to Scan
+func columns(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "c"
+	}
+	return names
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// FillFilter selects a user's fills, newest first
+type FillFilter struct {
+	UserID    string
+	AccountID string
+	Symbol    string
+	From      time.Time
+	To        time.Time
+	Cursor    *Cursor
+	Limit     int
+}
+
+func saveFill(ctx context.Context, tx *sql.Tx, fill *types.Fill) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO fills (id, trade_id, order_id, client_order_id, user_id,
+			symbol, side, liquidity, price, quantity, fee, executed_at, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO NOTHING`,
+		fill.ID, fill.TradeID, fill.OrderID, fill.ClientOrderID, fill.UserID,
+		fill.Symbol, string(fill.Side), string(fill.Liquidity), fill.Price,
+		fill.Quantity, fill.Fee, fill.ExecutedAt, fill.AccountID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save fill: %w", err)
+	}
+	return nil
+}
+
+// ListFills returns the user's fills matching the filter, newest first
+func (s *PostgresStore) ListFills(ctx context.Context, filter FillFilter) ([]*types.Fill, error) {
+	conds := []string{"user_id = $1"}
+	args := []interface{}{filter.UserID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.AccountID != "" {
+		conds = append(conds, "account_id = "+arg(filter.AccountID))
+	}
+	if filter.Symbol != "" {
+		conds = append(conds, "symbol = "+arg(filter.Symbol))
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "executed_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "executed_at < "+arg(filter.To))
+	}
+	if filter.Cursor != nil {
+		conds = append(conds, fmt.Sprintf("(executed_at, id) < (%s, %s)",
+			arg(filter.Cursor.Time), arg(filter.Cursor.ID)))
+	}
+
+	query := `SELECT id, trade_id, order_id, client_order_id, user_id, symbol,
+		side, liquidity, price, quantity, fee, executed_at, account_id FROM fills
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY executed_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fills: %w", err)
+	}
+	defer rows.Close()
+
+	fills := make([]*types.Fill, 0)
+	for rows.Next() {
+		var fill types.Fill
+		if err := rows.Scan(&fill.ID, &fill.TradeID, &fill.OrderID,
+			&fill.ClientOrderID, &fill.UserID, &fill.Symbol, &fill.Side,
+			&fill.Liquidity, &fill.Price, &fill.Quantity, &fill.Fee,
+			&fill.ExecutedAt, &fill.AccountID); err != nil {
+			return nil, fmt.Errorf("failed to scan fill: %w", err)
+		}
+		fills = append(fills, &fill)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fills: %w", err)
+	}
+
+	return fills, nil
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestListFillsQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &fakeDB{rows: func(query string, args []interface{}) ([]string, [][]driver.Value) {
+		return columns(13), [][]driver.Value{{
+			"t1-B", "t1", "o1", "client-1", "u1", "BTC-USD", "BUY", "TAKER",
+			100.0, 1.0, 0.1, base, "a1",
+		}}
+	}}
+	s := newFakeStore(t, db)
+
+	fills, err := s.ListFills(context.Background(), FillFilter{
+		UserID:    "u1",
+		AccountID: "a1",
+		Symbol:    "BTC-USD",
+		From:      base,
+		To:        base.Add(time.Hour),
+		Cursor:    &Cursor{Time: base.Add(time.Minute), ID: "t9-S"},
+		Limit:     50,
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(fills) != 1 || fills[0].ID != "t1-B" || fills[0].Liquidity != types.LiquidityTaker || fills[0].Fee != 0.1 {
+		t.Fatalf("fills %+v, want the scanned row", fills)
+	}
+
+	statement := db.ran()[0]
+	want := "WHERE user_id = $1 AND account_id = $2 AND symbol = $3" +
+		" AND executed_at >= $4 AND executed_at < $5 AND (executed_at, id) < ($6, $7)" +
+		" ORDER BY executed_at DESC, id DESC LIMIT $8"
+	if !strings.HasSuffix(statement.query, want) {
+		t.Fatalf("query %q, want it to end with %q", statement.query, want)
+	}
+	wantArgs := fmt.Sprint([]interface{}{"u1", "a1", "BTC-USD", base, base.Add(time.Hour),
+		base.Add(time.Minute), "t9-S", int64(50)})
+	if args := fmt.Sprint(statement.args); args != wantArgs {
+		t.Fatalf("args %s, want %s", args, wantArgs)
+	}
+
+	// The user is always filtered on, even with nothing else to filter
+	if _, err := s.ListFills(context.Background(), FillFilter{UserID: "u2"}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if query := db.ran()[1].query; !strings.HasSuffix(query, "WHERE user_id = $1 ORDER BY executed_at DESC, id DESC") {
+		t.Fatalf("unfiltered query %q", query)
+	}
+}
+
+func TestSaveTradeSavesBothFills(t *testing.T) {
+	db := &fakeDB{}
+	s := newFakeStore(t, db)
+
+	trade := &types.Trade{
+		ID:              "t1",
+		Symbol:          "BTC-USD",
+		BuyOrderID:      "buy",
+		SellOrderID:     "sell",
+		Price:           100,
+		Quantity:        1,
+		BuyerUserID:     "alice",
+		SellerUserID:    "bob",
+		BuyerAccountID:  "alice",
+		SellerAccountID: "bob",
+		TakerSide:       types.BuyOrder,
+		ExecutedAt:      time.Now(),
+	}
+	if err := s.SaveTrade(context.Background(), trade); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	statements := db.ran()
+	if len(statements) != 3 || db.commits != 1 {
+		t.Fatalf("ran %d statements with %d commits, want the trade and two fills in one transaction", len(statements), db.commits)
+	}
+	if !strings.HasPrefix(statements[0].query, "INSERT INTO trades") {
+		t.Fatalf("first statement %q, want the trade", statements[0].query)
+	}
+	fills := make(map[string]string)
+	for _, s := range statements[1:] {
+		if !strings.HasPrefix(s.query, "INSERT INTO fills") || !strings.HasSuffix(s.query, "ON CONFLICT (id) DO NOTHING") {
+			t.Fatalf("statement %q, want an idempotent fill insert", s.query)
+		}
+		// id, then liquidity as the eighth column
+		fills[s.args[0].(string)] = s.args[7].(string)
+	}
+	if fills["t1-B"] != string(types.LiquidityTaker) || fills["t1-S"] != string(types.LiquidityMaker) {
+		t.Fatalf("fills %v, want the buyer taking and the seller making", fills)
+	}
+}
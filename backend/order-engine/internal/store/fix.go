@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/fix"
+)
+
+// PostgresStore implements fix.SessionStore, so FIX sessions resume their
+// sequence numbers and can resend messages after a gateway restart
+var _ fix.SessionStore = (*PostgresStore)(nil)
+
+func (s *PostgresStore) LoadSession(ctx context.Context, sessionID string) (*fix.SessionState, error) {
+	var state fix.SessionState
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, next_sender_seq, next_target_seq FROM fix_sessions
+		WHERE session_id = $1`,
+		sessionID,
+	).Scan(&state.UserID, &state.NextSenderSeq, &state.NextTargetSeq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load FIX session: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *PostgresStore) ResetSession(ctx context.Context, sessionID, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM fix_messages WHERE session_id = $1`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete FIX messages: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO fix_sessions (session_id, user_id, next_sender_seq, next_target_seq, updated_at)
+		VALUES ($1, $2, 1, 1, NOW())
+		ON CONFLICT (session_id) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			next_sender_seq = 1,
+			next_target_seq = 1,
+			updated_at = EXCLUDED.updated_at`,
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset FIX session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit FIX session reset: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveOutgoing(ctx context.Context, sessionID string, seqNum int, raw []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if raw != nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO fix_messages (session_id, seq_num, message)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (session_id, seq_num) DO UPDATE SET message = EXCLUDED.message`,
+			sessionID, seqNum, raw,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save FIX message: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE fix_sessions SET next_sender_seq = $2, updated_at = NOW()
+		WHERE session_id = $1`,
+		sessionID, seqNum+1); err != nil {
+		return fmt.Errorf("failed to update FIX sender sequence: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit FIX message: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) SetNextTargetSeq(ctx context.Context, sessionID string, seqNum int) error {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE fix_sessions SET next_target_seq = $2, updated_at = NOW()
+		WHERE session_id = $1`,
+		sessionID, seqNum); err != nil {
+		return fmt.Errorf("failed to update FIX target sequence: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) LoadOutgoing(ctx context.Context, sessionID string, begin, end int) ([]fix.StoredMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT seq_num, message FROM fix_messages
+		WHERE session_id = $1 AND seq_num >= $2 AND ($3 = 0 OR seq_num <= $3)
+		ORDER BY seq_num`,
+		sessionID, begin, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query FIX messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]fix.StoredMessage, 0)
+	for rows.Next() {
+		var m fix.StoredMessage
+		if err := rows.Scan(&m.SeqNum, &m.Raw); err != nil {
+			return nil, fmt.Errorf("failed to scan FIX message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read FIX messages: %w", err)
+	}
+
+	return messages, nil
+}
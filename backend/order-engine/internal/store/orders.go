@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// OrderFilter selects a user's orders. Zero-valued fields match everything.
+type OrderFilter struct {
+	UserID    string
+	AccountID string
+	Symbol    string
+	Side      types.OrderSide
+	Type      types.OrderType
+	Statuses  []types.OrderStatus
+	From      time.Time
+	To        time.Time
+	Cursor    *Cursor
+	Limit     int
+}
+
+// Matches reports whether an order satisfies the filter, including the cursor
+func (f OrderFilter) Matches(order *types.Order) bool {
+	if f.UserID != "" && order.UserID != f.UserID {
+		return false
+	}
+	if f.AccountID != "" && order.AccountID != f.AccountID {
+		return false
+	}
+	if f.Symbol != "" && order.Symbol != f.Symbol {
+		return false
+	}
+	if f.Side != "" && order.Side != f.Side {
+		return false
+	}
+	if f.Type != "" && order.Type != f.Type {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsStatus(f.Statuses, order.Status) {
+		return false
+	}
+	if !f.From.IsZero() && order.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !order.CreatedAt.Before(f.To) {
+		return false
+	}
+	return f.Cursor.After(order.CreatedAt, order.ID)
+}
+
+func containsStatus(statuses []types.OrderStatus, status types.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordOrder queues an order update for persistence, so it can be
+// registered as a matching engine order listener. It never blocks: updates
+// the database cannot keep up with are spilled to the outbox directory.
+func (s *PostgresStore) RecordOrder(order types.Order) {
+	if isClosed(order.Status) {
+		s.queuedMu.Lock()
+		s.queued[order.ID] = order
+		s.queuedMu.Unlock()
+	}
+	s.orders.push(order)
+}
+
+func (s *PostgresStore) writeOrder(ctx context.Context, record []byte) error {
+	var order types.Order
+	if err := json.Unmarshal(record, &order); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+
+	err := s.SaveOrder(ctx, &order)
+	if err == nil || permanent(err) {
+		s.unqueue(&order)
+	}
+	if err != nil {
+		return fmt.Errorf("order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+// unqueue forgets a written order update unless a later one is queued
+func (s *PostgresStore) unqueue(order *types.Order) {
+	s.queuedMu.Lock()
+	defer s.queuedMu.Unlock()
+
+	if queued, ok := s.queued[order.ID]; ok && queued.Status == order.Status && queued.UpdatedAt.Equal(order.UpdatedAt) {
+		delete(s.queued, order.ID)
+	}
+}
+
+func isClosed(status types.OrderStatus) bool {
+	switch status {
+	case types.OrderStatusFilled, types.OrderStatusCancelled, types.OrderStatusRejected:
+		return true
+	}
+	return false
+}
+
+// SaveOrder inserts the order or updates its mutable fields
+func (s *PostgresStore) SaveOrder(ctx context.Context, order *types.Order) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO orders (id, user_id, symbol, type, side, price, quantity,
+			filled_qty, remaining_qty, status, stop_price, created_at, updated_at,
+			client_order_id, account_id, reject_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			price = EXCLUDED.price,
+			quantity = EXCLUDED.quantity,
+			filled_qty = EXCLUDED.filled_qty,
+			remaining_qty = EXCLUDED.remaining_qty,
+			status = EXCLUDED.status,
+			reject_reason = EXCLUDED.reject_reason,
+			updated_at = EXCLUDED.updated_at`,
+		order.ID, order.UserID, order.Symbol, string(order.Type), string(order.Side),
+		order.Price, order.Quantity, order.FilledQty, order.RemainingQty,
+		string(order.Status), order.StopPrice, order.CreatedAt, order.UpdatedAt,
+		order.ClientOrderID, order.AccountID, string(order.RejectReason),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save order: %w", err)
+	}
+	return nil
+}
+
+// GetOrder returns a stored order by ID
+func (s *PostgresStore) GetOrder(ctx context.Context, id string) (*types.Order, error) {
+	var order types.Order
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, symbol, type, side, price, quantity, filled_qty,
+			remaining_qty, status, stop_price, created_at, updated_at,
+			client_order_id, account_id, reject_reason
+		FROM orders WHERE id = $1`, id,
+	).Scan(&order.ID, &order.UserID, &order.Symbol, &order.Type,
+		&order.Side, &order.Price, &order.Quantity, &order.FilledQty,
+		&order.RemainingQty, &order.Status, &order.StopPrice,
+		&order.CreatedAt, &order.UpdatedAt, &order.ClientOrderID,
+		&order.AccountID, &order.RejectReason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return &order, nil
+}
+
+// ListOrders returns orders matching the filter, newest first. Orders
+// whose final update is still queued are included as of that update, so
+// an order that has left the engine never drops out of the results.
+func (s *PostgresStore) ListOrders(ctx context.Context, filter OrderFilter) ([]*types.Order, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		conds = append(conds, "user_id = "+arg(filter.UserID))
+	}
+	if filter.AccountID != "" {
+		conds = append(conds, "account_id = "+arg(filter.AccountID))
+	}
+	if filter.Symbol != "" {
+		conds = append(conds, "symbol = "+arg(filter.Symbol))
+	}
+	if filter.Side != "" {
+		conds = append(conds, "side = "+arg(string(filter.Side)))
+	}
+	if filter.Type != "" {
+		conds = append(conds, "type = "+arg(string(filter.Type)))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = arg(string(status))
+		}
+		conds = append(conds, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.To))
+	}
+	if filter.Cursor != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) < (%s, %s)",
+			arg(filter.Cursor.Time), arg(filter.Cursor.ID)))
+	}
+
+	query := `SELECT id, user_id, symbol, type, side, price, quantity, filled_qty,
+		remaining_qty, status, stop_price, created_at, updated_at, client_order_id,
+		account_id, reject_reason FROM orders`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := make([]*types.Order, 0)
+	for rows.Next() {
+		var order types.Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Symbol, &order.Type,
+			&order.Side, &order.Price, &order.Quantity, &order.FilledQty,
+			&order.RemainingQty, &order.Status, &order.StopPrice,
+			&order.CreatedAt, &order.UpdatedAt, &order.ClientOrderID,
+			&order.AccountID, &order.RejectReason); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read orders: %w", err)
+	}
+
+	return s.withQueued(orders, filter), nil
+}
+
+// withQueued replaces stored orders with their queued final updates and
+// adds the queued orders matching the filter, keeping the order and limit
+func (s *PostgresStore) withQueued(stored []*types.Order, filter OrderFilter) []*types.Order {
+	s.queuedMu.Lock()
+	defer s.queuedMu.Unlock()
+
+	if len(s.queued) == 0 {
+		return stored
+	}
+
+	orders := make([]*types.Order, 0, len(stored))
+	for _, order := range stored {
+		if _, queued := s.queued[order.ID]; !queued {
+			orders = append(orders, order)
+		}
+	}
+	for _, order := range s.queued {
+		order := order
+		if filter.Matches(&order) {
+			orders = append(orders, &order)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].ID > orders[j].ID
+		}
+		return orders[i].CreatedAt.After(orders[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+	}
+	return orders
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestWithQueued(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	order := func(id string, minute int, status types.OrderStatus) *types.Order {
+		return &types.Order{
+			ID:        id,
+			UserID:    "u1",
+			Symbol:    "BTC-USD",
+			Status:    status,
+			CreatedAt: base.Add(time.Duration(minute) * time.Minute),
+			UpdatedAt: base.Add(time.Duration(minute) * time.Minute),
+		}
+	}
+
+	s := &PostgresStore{queued: make(map[string]types.Order)}
+	// o2 filled and o4 was cancelled, but neither update has been written
+	s.queued["o2"] = *order("o2", 2, types.OrderStatusFilled)
+	s.queued["o4"] = *order("o4", 4, types.OrderStatusCancelled)
+	s.queued["other"] = types.Order{ID: "other", UserID: "u2", Status: types.OrderStatusFilled, CreatedAt: base}
+
+	stored := []*types.Order{
+		order("o3", 3, types.OrderStatusNew),
+		order("o2", 2, types.OrderStatusNew),
+		order("o1", 1, types.OrderStatusFilled),
+	}
+
+	got := s.withQueued(stored, OrderFilter{UserID: "u1", Limit: 3})
+	want := []struct {
+		id     string
+		status types.OrderStatus
+	}{
+		{"o4", types.OrderStatusCancelled},
+		{"o3", types.OrderStatusNew},
+		{"o2", types.OrderStatusFilled},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d orders, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Status != w.status {
+			t.Fatalf("order %d is %s %s, want %s %s", i, got[i].ID, got[i].Status, w.id, w.status)
+		}
+	}
+
+	// Queued orders outside the filter are left out
+	got = s.withQueued(nil, OrderFilter{UserID: "u1", Statuses: []types.OrderStatus{types.OrderStatusCancelled}})
+	if len(got) != 1 || got[0].ID != "o4" {
+		t.Fatalf("got %v, want only o4", got)
+	}
+
+	// A written update is forgotten, unless a later one has been queued
+	s.unqueue(order("o2", 2, types.OrderStatusFilled))
+	if _, ok := s.queued["o2"]; ok {
+		t.Fatal("written update still queued")
+	}
+	s.unqueue(order("o4", 4, types.OrderStatusNew))
+	if _, ok := s.queued["o4"]; !ok {
+		t.Fatal("later update forgotten")
+	}
+}
+
+func TestListOrdersQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &fakeDB{rows: func(query string, args []interface{}) ([]string, [][]driver.Value) {
+		return columns(16), [][]driver.Value{{
+			"o1", "u1", "BTC-USD", "LIMIT", "BUY", 100.0, 2.0, 1.0, 1.0, "PARTIAL",
+			0.0, base, base, "client-1", "a1", "",
+		}}
+	}}
+	s := newFakeStore(t, db)
+
+	filter := OrderFilter{
+		UserID:    "u1",
+		AccountID: "a1",
+		Symbol:    "BTC-USD",
+		Side:      types.BuyOrder,
+		Type:      types.LimitOrder,
+		Statuses:  []types.OrderStatus{types.OrderStatusNew, types.OrderStatusPartial},
+		From:      base,
+		To:        base.Add(time.Hour),
+		Cursor:    &Cursor{Time: base.Add(time.Minute), ID: "o9"},
+		Limit:     10,
+	}
+	orders, err := s.ListOrders(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	statements := db.ran()
+	if len(statements) != 1 {
+		t.Fatalf("ran %d statements, want 1", len(statements))
+	}
+	want := "WHERE user_id = $1 AND account_id = $2 AND symbol = $3 AND side = $4" +
+		" AND type = $5 AND status IN ($6, $7) AND created_at >= $8" +
+		" AND created_at < $9 AND (created_at, id) < ($10, $11)" +
+		" ORDER BY created_at DESC, id DESC LIMIT $12"
+	if !strings.HasSuffix(statements[0].query, want) {
+		t.Fatalf("query %q, want it to end with %q", statements[0].query, want)
+	}
+	args := fmt.Sprint(statements[0].args)
+	wantArgs := fmt.Sprint([]interface{}{"u1", "a1", "BTC-USD", "BUY", "LIMIT", "NEW", "PARTIAL",
+		base, base.Add(time.Hour), base.Add(time.Minute), "o9", int64(10)})
+	if args != wantArgs {
+		t.Fatalf("args %s, want %s", args, wantArgs)
+	}
+
+	if len(orders) != 1 || orders[0].ID != "o1" || orders[0].Status != types.OrderStatusPartial ||
+		orders[0].AccountID != "a1" || orders[0].ClientOrderID != "client-1" {
+		t.Fatalf("orders %+v, want the scanned row", orders)
+	}
+
+	// Without a filter every order is listed
+	if _, err := s.ListOrders(context.Background(), OrderFilter{}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if query := db.ran()[1].query; strings.Contains(query, "WHERE") || strings.Contains(query, "LIMIT") {
+		t.Fatalf("unfiltered query %q", query)
+	}
+}
@@ -0,0 +1,448 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/metrics"
+)
+
+const (
+	// writeQueueSize bounds the records of each kind waiting in memory;
+	// later records are spilled to disk
+	writeQueueSize = 4096
+
+	// Failed writes are retried with a backoff doubling between these
+	writeRetryMin = 100 * time.Millisecond
+	writeRetryMax = 5 * time.Second
+)
+
+var (
+	errCorruptRecord = errors.New("corrupt outbox record")
+	errNoSpill       = errors.New("no outbox directory configured")
+)
+
+// outbox queues one kind of write for a background writer without ever
+// blocking the producer, which is often the matching engine holding its
+// lock. Up to writeQueueSize records wait in memory. Beyond that, and for
+// as long as spilled records remain, records are appended to spill files
+// in dir and read back in order once the writer catches up. Spill files
+// outlive the process: records the writer could not save by Close are
+// spilled as well, and files found at start are written first. They are
+// not synced, so they survive a crash of the process but not of the host.
+type outbox struct {
+	kind   string
+	dir    string
+	save   func(ctx context.Context, record []byte) error
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending [][]byte
+	spill   *os.File
+	files   []string // spill files not yet written, oldest first
+	seq     int64
+	closed  bool
+
+	wake    chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// newOutbox starts the writer of one kind of record, picking up the spill
+// files a previous run left in dir. An empty dir disables spilling, so
+// records are dropped, and counted, while the memory queue is full.
+func newOutbox(kind, dir string, save func(ctx context.Context, record []byte) error, logger *zap.Logger) (*outbox, error) {
+	o := &outbox{
+		kind:    kind,
+		dir:     dir,
+		save:    save,
+		logger:  logger.With(zap.String("kind", kind)),
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+		}
+		files, err := filepath.Glob(filepath.Join(dir, kind+"-*.jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list outbox files: %w", err)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			records, err := countRecords(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read outbox file: %w", err)
+			}
+			metrics.RecordStoreOutboxSpilled(kind, records)
+			o.files = append(o.files, file)
+		}
+		if len(o.files) > 0 {
+			o.seq = o.fileSeq(o.files[len(o.files)-1])
+			o.logger.Warn("Writing records spilled by a previous run", zap.Int("files", len(o.files)))
+		}
+	}
+
+	go o.run()
+	return o, nil
+}
+
+// push queues a record. It never blocks on the database.
+func (o *outbox) push(v interface{}) {
+	record, err := json.Marshal(v)
+	if err != nil {
+		o.logger.Error("Failed to encode "+o.kind+", dropping it", zap.Error(err))
+		metrics.RecordStoreWritesDropped(o.kind, 1)
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.closed && len(o.files) == 0 && len(o.pending) < writeQueueSize {
+		o.pending = append(o.pending, record)
+		o.signal()
+		return
+	}
+
+	if err := o.appendSpill(record); err != nil {
+		o.logger.Error("Failed to spill "+o.kind+", dropping it", zap.Error(err))
+		metrics.RecordStoreWritesDropped(o.kind, 1)
+		return
+	}
+	o.signal()
+}
+
+// signal wakes the writer; callers hold the lock
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// appendSpill adds a record to the newest spill file, starting one if
+// needed; callers hold the lock
+func (o *outbox) appendSpill(record []byte) error {
+	if o.dir == "" {
+		return errNoSpill
+	}
+	if o.spill == nil {
+		file, err := os.OpenFile(o.fileName(o.nextSeq()), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create outbox file: %w", err)
+		}
+		if len(o.files) == 0 {
+			o.logger.Warn("Writes are backing up, spilling to disk", zap.String("file", file.Name()))
+		}
+		o.spill = file
+		o.files = append(o.files, file.Name())
+	}
+
+	if _, err := o.spill.Write(append(record, '\n')); err != nil {
+		return fmt.Errorf("failed to write outbox file: %w", err)
+	}
+	metrics.RecordStoreOutboxSpilled(o.kind, 1)
+	return nil
+}
+
+func (o *outbox) run() {
+	defer close(o.done)
+
+	for {
+		batch, file, ok := o.take()
+		if !ok {
+			return
+		}
+		if file != "" {
+			o.replay(file)
+			continue
+		}
+		for i, record := range batch {
+			if !o.persist(record) {
+				o.rescue(batch[i:])
+				return
+			}
+		}
+	}
+}
+
+// take waits for the next records to write: the memory queue or, once it
+// is empty, the oldest spill file. After Close only the memory queue is
+// written, and take returns false once it is empty.
+func (o *outbox) take() ([][]byte, string, bool) {
+	for {
+		o.mu.Lock()
+		if len(o.pending) > 0 {
+			batch := o.pending
+			o.pending = nil
+			o.mu.Unlock()
+			return batch, "", true
+		}
+		if o.closed {
+			o.mu.Unlock()
+			return nil, "", false
+		}
+		if len(o.files) > 0 {
+			file := o.files[0]
+			if o.spill != nil && o.spill.Name() == file {
+				// Later records go to a new file while this one is read
+				o.spill.Close()
+				o.spill = nil
+			}
+			o.mu.Unlock()
+			return nil, file, true
+		}
+		o.mu.Unlock()
+
+		select {
+		case <-o.wake:
+		case <-o.closing:
+		}
+	}
+}
+
+// replay writes the records of a spill file and removes it. If the store
+// closes first, the file is cut down to the records not yet written.
+func (o *outbox) replay(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		o.logger.Error("Failed to open outbox file", zap.Error(err), zap.String("file", file))
+		o.finish(file)
+		return
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// A record cut short by a crash
+				o.logger.Error("Dropping partial "+o.kind+" record", zap.String("file", file))
+				metrics.RecordStoreWritesDropped(o.kind, 1)
+			}
+			break
+		}
+		if err != nil {
+			// Leave the file for the next start, which writes it again;
+			// every write is idempotent
+			o.logger.Error("Failed to read outbox file", zap.Error(err), zap.String("file", file))
+			o.finish(file)
+			return
+		}
+
+		if !o.persist(bytes.TrimSuffix(line, []byte("\n"))) {
+			if err := keepRest(file, line, reader); err != nil {
+				o.logger.Error("Failed to keep unwritten "+o.kind+" records", zap.Error(err), zap.String("file", file))
+			}
+			return
+		}
+		metrics.RecordStoreOutboxSpilled(o.kind, -1)
+	}
+
+	if err := os.Remove(file); err != nil {
+		o.logger.Error("Failed to remove outbox file", zap.Error(err), zap.String("file", file))
+	}
+	o.finish(file)
+}
+
+// finish forgets a spill file once it has been written
+func (o *outbox) finish(file string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.files) > 0 && o.files[0] == file {
+		o.files = o.files[1:]
+	}
+	if len(o.files) == 0 {
+		o.logger.Info("Caught up with spilled writes")
+	}
+}
+
+// keepRest replaces a spill file with the record that could not be written
+// and those after it
+func keepRest(file string, line []byte, rest io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(line); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, rest); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// rescue spills the records the writer could not save before closing,
+// along with anything still queued in memory, ahead of the spill files
+func (o *outbox) rescue(records [][]byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	records = append(records, o.pending...)
+	o.pending = nil
+
+	if o.dir == "" {
+		o.logger.Error("Database unavailable on close, dropping queued writes", zap.Int("records", len(records)))
+		metrics.RecordStoreWritesDropped(o.kind, len(records))
+		return
+	}
+
+	seq := o.nextSeq()
+	if len(o.files) > 0 {
+		seq = o.fileSeq(o.files[0]) - 1
+	}
+	name := o.fileName(seq)
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o600); err != nil {
+		o.logger.Error("Failed to spill queued writes on close, dropping them", zap.Error(err), zap.Int("records", len(records)))
+		metrics.RecordStoreWritesDropped(o.kind, len(records))
+		return
+	}
+	o.logger.Warn("Database unavailable on close, spilled queued writes",
+		zap.String("file", name), zap.Int("records", len(records)))
+	metrics.RecordStoreOutboxSpilled(o.kind, len(records))
+	o.files = append([]string{name}, o.files...)
+}
+
+// persist saves a record, retrying with backoff until it succeeds, so a
+// database outage holds back the writer rather than losing the record. A
+// record that can never be saved is dropped and counted. It returns false
+// if the store closes before the record is saved.
+func (o *outbox) persist(record []byte) bool {
+	backoff := writeRetryMin
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := o.save(ctx, record)
+		cancel()
+		if err == nil {
+			return true
+		}
+
+		if permanent(err) {
+			o.logger.Error("Failed to persist "+o.kind+", dropping it", zap.Error(err))
+			metrics.RecordStoreWritesDropped(o.kind, 1)
+			return true
+		}
+
+		select {
+		case <-time.After(backoff):
+			o.logger.Warn("Retrying "+o.kind+" write", zap.Error(err), zap.Duration("backoff", backoff))
+		case <-o.closing:
+			return false
+		}
+		if backoff *= 2; backoff > writeRetryMax {
+			backoff = writeRetryMax
+		}
+	}
+}
+
+// close writes what is queued in memory and stops the writer. Records it
+// cannot write, the spill files, and records pushed afterwards are kept in
+// the outbox directory for the next start.
+func (o *outbox) close() {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	close(o.closing)
+	<-o.done
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.spill != nil {
+		o.spill.Close()
+		o.spill = nil
+	}
+}
+
+// nextSeq returns an increasing spill file sequence; callers hold the lock
+func (o *outbox) nextSeq() int64 {
+	if now := time.Now().UnixNano(); now > o.seq {
+		o.seq = now
+	} else {
+		o.seq++
+	}
+	return o.seq
+}
+
+func (o *outbox) fileName(seq int64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%s-%020d.jsonl", o.kind, seq))
+}
+
+func (o *outbox) fileSeq(file string) int64 {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), o.kind+"-"), ".jsonl")
+	seq, _ := strconv.ParseInt(name, 10, 64)
+	return seq
+}
+
+// countRecords returns the number of complete records in a spill file
+func countRecords(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		count += bytes.Count(buf[:n], []byte("\n"))
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// permanent reports whether a write failed on its data, so retrying it
+// cannot succeed
+func permanent(err error) bool {
+	if errors.Is(err, errCorruptRecord) {
+		return true
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Class() {
+	case "22", "23": // data exception, integrity constraint violation
+		return true
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeWriter records what an outbox saves and fails as told
+type fakeWriter struct {
+	mu    sync.Mutex
+	saved []string
+	calls int
+	fail  func(record string) error
+	gate  chan struct{} // when set, every save waits for it
+}
+
+func (w *fakeWriter) save(ctx context.Context, raw []byte) error {
+	if w.gate != nil {
+		<-w.gate
+	}
+
+	var record string
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return errCorruptRecord
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	if w.fail != nil {
+		if err := w.fail(record); err != nil {
+			return err
+		}
+	}
+	w.saved = append(w.saved, record)
+	return nil
+}
+
+func (w *fakeWriter) snapshot() ([]string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.saved...), w.calls
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitSaved(t *testing.T, w *fakeWriter, n int) []string {
+	t.Helper()
+	waitFor(t, "records to be saved", func() bool {
+		saved, _ := w.snapshot()
+		return len(saved) >= n
+	})
+	saved, _ := w.snapshot()
+	return saved
+}
+
+func spillFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	return files
+}
+
+func newTestOutbox(t *testing.T, dir string, w *fakeWriter) *outbox {
+	t.Helper()
+	o, err := newOutbox("test", dir, w.save, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new outbox: %v", err)
+	}
+	return o
+}
+
+func TestOutboxSavesInOrder(t *testing.T) {
+	w := &fakeWriter{}
+	o := newTestOutbox(t, t.TempDir(), w)
+	defer o.close()
+
+	for _, record := range []string{"a", "b", "c"} {
+		o.push(record)
+	}
+	if saved := waitSaved(t, w, 3); !reflect.DeepEqual(saved, []string{"a", "b", "c"}) {
+		t.Fatalf("saved %v, want [a b c]", saved)
+	}
+}
+
+func TestOutboxSpillsWhenBehind(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{gate: make(chan struct{})}
+	o := newTestOutbox(t, dir, w)
+	defer o.close()
+
+	// The writer holds the first record while the rest back up
+	var want []string
+	total := writeQueueSize + 3
+	for i := 0; i < total; i++ {
+		record := string(rune('a'+i%26)) + string(rune('0'+i%10))
+		want = append(want, record)
+		o.push(record)
+		if i == 0 {
+			waitFor(t, "the writer to take the first record", func() bool {
+				o.mu.Lock()
+				defer o.mu.Unlock()
+				return len(o.pending) == 0
+			})
+		}
+	}
+
+	if files := spillFiles(t, dir); len(files) != 1 {
+		t.Fatalf("spill files %v, want one", files)
+	}
+
+	close(w.gate)
+	saved := waitSaved(t, w, total)
+	if !reflect.DeepEqual(saved, want) {
+		t.Fatalf("saved %d records out of order", len(saved))
+	}
+	waitFor(t, "the spill file to be removed", func() bool {
+		return len(spillFiles(t, dir)) == 0
+	})
+}
+
+func TestOutboxReplaysFilesFromPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test-00000000000000000001.jsonl")
+	// The last record was cut short by a crash
+	if err := os.WriteFile(file, []byte("\"a\"\n\"b\"\n\"c"), 0o600); err != nil {
+		t.Fatalf("write spill file: %v", err)
+	}
+
+	w := &fakeWriter{}
+	o := newTestOutbox(t, dir, w)
+	defer o.close()
+
+	o.push("d")
+	if saved := waitSaved(t, w, 3); !reflect.DeepEqual(saved, []string{"a", "b", "d"}) {
+		t.Fatalf("saved %v, want [a b d]", saved)
+	}
+	waitFor(t, "the spill file to be removed", func() bool {
+		return len(spillFiles(t, dir)) == 0
+	})
+}
+
+func TestOutboxKeepsUnsavedRecordsOnClose(t *testing.T) {
+	dir := t.TempDir()
+	down := errors.New("connection refused")
+	w := &fakeWriter{fail: func(string) error { return down }}
+	o := newTestOutbox(t, dir, w)
+
+	o.push("a")
+	o.push("b")
+	waitFor(t, "a failed write", func() bool {
+		_, calls := w.snapshot()
+		return calls > 0
+	})
+	o.close()
+
+	// Pushing after close does not panic and the record is kept too
+	o.push("c")
+
+	if files := spillFiles(t, dir); len(files) != 2 {
+		t.Fatalf("spill files %v, want the rescued records and the late one", files)
+	}
+
+	next := &fakeWriter{}
+	o = newTestOutbox(t, dir, next)
+	defer o.close()
+	if saved := waitSaved(t, next, 3); !reflect.DeepEqual(saved, []string{"a", "b", "c"}) {
+		t.Fatalf("saved %v, want [a b c]", saved)
+	}
+}
+
+func TestOutboxKeepsRestOfInterruptedReplay(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test-00000000000000000001.jsonl")
+	if err := os.WriteFile(file, []byte("\"a\"\n\"b\"\n\"c\"\n"), 0o600); err != nil {
+		t.Fatalf("write spill file: %v", err)
+	}
+
+	w := &fakeWriter{fail: func(record string) error {
+		if record == "b" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	o := newTestOutbox(t, dir, w)
+	waitFor(t, "a failed write", func() bool {
+		_, calls := w.snapshot()
+		return calls > 1
+	})
+	o.close()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read spill file: %v", err)
+	}
+	if string(data) != "\"b\"\n\"c\"\n" {
+		t.Fatalf("spill file holds %q, want the records from b on", data)
+	}
+}
+
+func TestOutboxDropsRecordsThatCannotBeSaved(t *testing.T) {
+	w := &fakeWriter{fail: func(record string) error {
+		if record == "bad" {
+			return errCorruptRecord
+		}
+		return nil
+	}}
+	o := newTestOutbox(t, t.TempDir(), w)
+	defer o.close()
+
+	o.push("a")
+	o.push("bad")
+	o.push("b")
+	if saved := waitSaved(t, w, 2); !reflect.DeepEqual(saved, []string{"a", "b"}) {
+		t.Fatalf("saved %v, want [a b]", saved)
+	}
+}
+
+func TestOutboxWithoutDirectoryDropsOverflow(t *testing.T) {
+	w := &fakeWriter{gate: make(chan struct{})}
+	o := newTestOutbox(t, "", w)
+
+	o.push("first")
+	waitFor(t, "the writer to take the first record", func() bool {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return len(o.pending) == 0
+	})
+	for i := 0; i < writeQueueSize+5; i++ {
+		o.push("next")
+	}
+
+	o.mu.Lock()
+	pending := len(o.pending)
+	o.mu.Unlock()
+	if pending != writeQueueSize {
+		t.Fatalf("%d records queued, want %d", pending, writeQueueSize)
+	}
+
+	close(w.gate)
+	o.close()
+}
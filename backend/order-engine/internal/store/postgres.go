@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// PostgresStore persists the engine's history. Order updates, trades,
+// settlements and candles are recorded through outboxes so recording never
+// waits on the database.
+type PostgresStore struct {
+	db          *sql.DB
+	logger      *zap.Logger
+	orders      *outbox
+	trades      *outbox
+	settlements *outbox
+	candles     *outbox
+
+	// queued holds the latest terminal update of each order still waiting
+	// in the order outbox
+	queued   map[string]types.Order
+	queuedMu sync.Mutex
+}
+
+// NewPostgresStore connects to the database and starts the writers.
+// Writes the database cannot keep up with are spilled to outboxDir.
+func NewPostgresStore(dsn, outboxDir string, logger *zap.Logger) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	s := &PostgresStore{
+		db:     db,
+		logger: logger,
+		queued: make(map[string]types.Order),
+	}
+
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := s.startOutboxes(outboxDir); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *PostgresStore) startOutboxes(dir string) error {
+	var err error
+	if s.orders, err = newOutbox("order", dir, s.writeOrder, s.logger); err != nil {
+		return err
+	}
+	if s.trades, err = newOutbox("trade", dir, s.writeTrade, s.logger); err != nil {
+		return err
+	}
+	if s.settlements, err = newOutbox("settlement", dir, s.writeSettlement, s.logger); err != nil {
+		return err
+	}
+	if s.candles, err = newOutbox("candle", dir, s.writeCandle, s.logger); err != nil {
+		return err
+	}
+	return nil
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS orders (
+		id            TEXT PRIMARY KEY,
+		user_id       TEXT NOT NULL,
+		symbol        TEXT NOT NULL,
+		type          TEXT NOT NULL,
+		side          TEXT NOT NULL,
+		price         DOUBLE PRECISION NOT NULL,
+		quantity      DOUBLE PRECISION NOT NULL,
+		filled_qty    DOUBLE PRECISION NOT NULL,
+		remaining_qty DOUBLE PRECISION NOT NULL,
+		status        TEXT NOT NULL,
+		stop_price    DOUBLE PRECISION NOT NULL DEFAULT 0,
+		created_at    TIMESTAMPTZ NOT NULL,
+		updated_at    TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS orders_user_created_idx ON orders (user_id, created_at DESC, id DESC)`,
+	`CREATE TABLE IF NOT EXISTS trades (
+		id             TEXT PRIMARY KEY,
+		symbol         TEXT NOT NULL,
+		buy_order_id   TEXT NOT NULL,
+		sell_order_id  TEXT NOT NULL,
+		price          DOUBLE PRECISION NOT NULL,
+		quantity       DOUBLE PRECISION NOT NULL,
+		buyer_user_id  TEXT NOT NULL,
+		seller_user_id TEXT NOT NULL,
+		executed_at    TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS trades_symbol_executed_idx ON trades (symbol, executed_at, id)`,
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS client_order_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS fills (
+		id              TEXT PRIMARY KEY,
+		trade_id        TEXT NOT NULL,
+		order_id        TEXT NOT NULL,
+		client_order_id TEXT NOT NULL DEFAULT '',
+		user_id         TEXT NOT NULL,
+		symbol          TEXT NOT NULL,
+		side            TEXT NOT NULL,
+		liquidity       TEXT NOT NULL,
+		price           DOUBLE PRECISION NOT NULL,
+		quantity        DOUBLE PRECISION NOT NULL,
+		fee             DOUBLE PRECISION NOT NULL,
+		executed_at     TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS fills_user_executed_idx ON fills (user_id, executed_at DESC, id DESC)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id               TEXT PRIMARY KEY,
+		user_id          TEXT NOT NULL,
+		label            TEXT NOT NULL DEFAULT '',
+		roles            TEXT[] NOT NULL,
+		scopes           TEXT[] NOT NULL,
+		allowed_ips      TEXT[] NOT NULL,
+		encrypted_secret BYTEA NOT NULL,
+		created_at       TIMESTAMPTZ NOT NULL,
+		revoked_at       TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id, created_at DESC)`,
+	`CREATE TABLE IF NOT EXISTS accounts (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		parent_id  TEXT NOT NULL DEFAULT '',
+		name       TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS accounts_user_idx ON accounts (user_id, created_at)`,
+	`CREATE TABLE IF NOT EXISTS balances (
+		account_id TEXT NOT NULL,
+		asset      TEXT NOT NULL,
+		amount     DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (account_id, asset)
+	)`,
+	`CREATE TABLE IF NOT EXISTS positions (
+		account_id TEXT NOT NULL,
+		symbol     TEXT NOT NULL,
+		quantity   DOUBLE PRECISION NOT NULL,
+		avg_price  DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (account_id, symbol)
+	)`,
+	`CREATE TABLE IF NOT EXISTS risk_limits (
+		account_id       TEXT PRIMARY KEY,
+		max_order_qty    DOUBLE PRECISION NOT NULL,
+		max_order_value  DOUBLE PRECISION NOT NULL,
+		max_position_qty DOUBLE PRECISION NOT NULL,
+		updated_at       TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS transfers (
+		id              TEXT PRIMARY KEY,
+		from_account_id TEXT NOT NULL DEFAULT '',
+		to_account_id   TEXT NOT NULL,
+		asset           TEXT NOT NULL,
+		amount          DOUBLE PRECISION NOT NULL,
+		created_by      TEXT NOT NULL,
+		created_at      TIMESTAMPTZ NOT NULL
+	)`,
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS account_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE trades ADD COLUMN IF NOT EXISTS buyer_account_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE trades ADD COLUMN IF NOT EXISTS seller_account_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE fills ADD COLUMN IF NOT EXISTS account_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS reject_reason TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS kill_switches (
+		account_id TEXT PRIMARY KEY,
+		reason     TEXT NOT NULL,
+		set_by     TEXT NOT NULL,
+		set_at     TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id         TEXT PRIMARY KEY,
+		action     TEXT NOT NULL,
+		account_id TEXT NOT NULL,
+		actor      TEXT NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_events_account_idx ON audit_events (account_id, created_at DESC)`,
+	`CREATE TABLE IF NOT EXISTS fix_sessions (
+		session_id      TEXT PRIMARY KEY,
+		user_id         TEXT NOT NULL,
+		next_sender_seq INTEGER NOT NULL,
+		next_target_seq INTEGER NOT NULL,
+		updated_at      TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS fix_messages (
+		session_id TEXT NOT NULL,
+		seq_num    INTEGER NOT NULL,
+		message    BYTEA NOT NULL,
+		PRIMARY KEY (session_id, seq_num)
+	)`,
+	`CREATE TABLE IF NOT EXISTS candles (
+		symbol       TEXT NOT NULL,
+		time_frame   TEXT NOT NULL,
+		open_time    TIMESTAMPTZ NOT NULL,
+		open         DOUBLE PRECISION NOT NULL,
+		high         DOUBLE PRECISION NOT NULL,
+		low          DOUBLE PRECISION NOT NULL,
+		close        DOUBLE PRECISION NOT NULL,
+		volume       DOUBLE PRECISION NOT NULL,
+		quote_volume DOUBLE PRECISION NOT NULL,
+		trades       INTEGER NOT NULL,
+		PRIMARY KEY (symbol, time_frame, open_time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS settled_trades (
+		trade_id   TEXT PRIMARY KEY,
+		settled_at TIMESTAMPTZ NOT NULL
+	)`,
+}
+
+// migrate creates the tables and indexes used by the store
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	for _, stmt := range schema {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close writes what the outboxes hold in memory and closes the database
+// connection. Records that cannot be written, and any recorded after
+// Close, are kept in the outbox directory for the next start, so Close is
+// safe while producers are still running.
+func (s *PostgresStore) Close() error {
+	for _, o := range []*outbox{s.orders, s.trades, s.settlements, s.candles} {
+		if o != nil {
+			o.close()
+		}
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// TradeFilter selects trades for a symbol in execution order. AfterID is
+// the ID of the last trade the caller has seen.
+type TradeFilter struct {
+	Symbol  string
+	From    time.Time
+	To      time.Time
+	AfterID string
+	Limit   int
+}
+
+// RecordTrade queues a trade for persistence, so it can be registered as a
+// matching engine trade listener. It never blocks: trades the database
+// cannot keep up with are spilled to the outbox directory.
+func (s *PostgresStore) RecordTrade(trade types.Trade) {
+	s.trades.push(trade)
+}
+
+func (s *PostgresStore) writeTrade(ctx context.Context, record []byte) error {
+	var trade types.Trade
+	if err := json.Unmarshal(record, &trade); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+	if err := s.SaveTrade(ctx, &trade); err != nil {
+		return fmt.Errorf("trade %s: %w", trade.ID, err)
+	}
+	return nil
+}
+
+// SaveTrade inserts a trade and the fills of both counterparties in one
+// transaction, ignoring duplicates
+func (s *PostgresStore) SaveTrade(ctx context.Context, trade *types.Trade) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO trades (id, symbol, buy_order_id, sell_order_id, price,
+			quantity, buyer_user_id, seller_user_id, executed_at,
+			buyer_account_id, seller_account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING`,
+		trade.ID, trade.Symbol, trade.BuyOrderID, trade.SellOrderID, trade.Price,
+		trade.Quantity, trade.BuyerUserID, trade.SellerUserID, trade.ExecutedAt,
+		trade.BuyerAccountID, trade.SellerAccountID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save trade: %w", err)
+	}
+
+	for _, fill := range trade.Fills() {
+		if err := saveFill(ctx, tx, &fill); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit trade: %w", err)
+	}
+	return nil
+}
+
+// ListTrades returns a page of trades matching the filter, oldest first
+func (s *PostgresStore) ListTrades(ctx context.Context, filter TradeFilter) ([]*types.Trade, error) {
+	trades := make([]*types.Trade, 0)
+	err := s.StreamTrades(ctx, filter, func(trade *types.Trade) error {
+		trades = append(trades, trade)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trades, nil
+}
+
+// StreamTrades calls fn for each trade matching the filter, oldest first,
+// without buffering the result set. It stops at the first error from fn.
+func (s *PostgresStore) StreamTrades(ctx context.Context, filter TradeFilter, fn func(*types.Trade) error) error {
+	conds := []string{"symbol = $1"}
+	args := []interface{}{filter.Symbol}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !filter.From.IsZero() {
+		conds = append(conds, "executed_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "executed_at < "+arg(filter.To))
+	}
+	if filter.AfterID != "" {
+		var executedAt time.Time
+		err := s.db.QueryRowContext(ctx,
+			`SELECT executed_at FROM trades WHERE id = $1 AND symbol = $2`,
+			filter.AfterID, filter.Symbol).Scan(&executedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCursor
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve trade cursor: %w", err)
+		}
+		conds = append(conds, fmt.Sprintf("(executed_at, id) > (%s, %s)",
+			arg(executedAt), arg(filter.AfterID)))
+	}
+
+	query := `SELECT id, symbol, buy_order_id, sell_order_id, price, quantity,
+		buyer_user_id, seller_user_id, executed_at, buyer_account_id,
+		seller_account_id FROM trades
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY executed_at, id`
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var trade types.Trade
+		if err := rows.Scan(&trade.ID, &trade.Symbol, &trade.BuyOrderID,
+			&trade.SellOrderID, &trade.Price, &trade.Quantity, &trade.BuyerUserID,
+			&trade.SellerUserID, &trade.ExecutedAt, &trade.BuyerAccountID,
+			&trade.SellerAccountID); err != nil {
+			return fmt.Errorf("failed to scan trade: %w", err)
+		}
+		if err := fn(&trade); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read trades: %w", err)
+	}
+
+	return nil
+}
+
+// TradedSymbols returns the symbols with trades executed since the given time
+func (s *PostgresStore) TradedSymbols(ctx context.Context, since time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT symbol FROM trades WHERE executed_at >= $1 ORDER BY symbol`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traded symbols: %w", err)
+	}
+	defer rows.Close()
+
+	symbols := make([]string, 0)
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, fmt.Errorf("failed to scan symbol: %w", err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read symbols: %w", err)
+	}
+	return symbols, nil
+}
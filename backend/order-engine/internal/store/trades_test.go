@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestRecordTradeDoesNotBlock(t *testing.T) {
+	dir := t.TempDir()
+	gate := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		saved []string
+	)
+	save := func(ctx context.Context, record []byte) error {
+		<-gate
+		var trade types.Trade
+		if err := json.Unmarshal(record, &trade); err != nil {
+			return errCorruptRecord
+		}
+		mu.Lock()
+		saved = append(saved, trade.ID)
+		mu.Unlock()
+		return nil
+	}
+
+	trades, err := newOutbox("trade", dir, save, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new outbox: %v", err)
+	}
+	s := &PostgresStore{trades: trades}
+	defer trades.close()
+
+	// The database is stuck on the first trade while the engine keeps
+	// recording them
+	total := writeQueueSize * 2
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i++ {
+			s.RecordTrade(types.Trade{ID: fmt.Sprintf("t%05d", i), Symbol: "BTC-USD"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RecordTrade blocked while the database was stuck")
+	}
+
+	close(gate)
+	waitFor(t, "trades to be saved", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(saved) == total
+	})
+	for i, id := range saved {
+		if want := fmt.Sprintf("t%05d", i); id != want {
+			t.Fatalf("trade %d saved as %s, want %s", i, id, want)
+		}
+	}
+}
+
+// tradeRows answers the trade cursor lookup and the page query of a fake
+// database with the given trades
+func tradeRows(trades ...types.Trade) func(string, []interface{}) ([]string, [][]driver.Value) {
+	return func(query string, args []interface{}) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT executed_at FROM trades") {
+			for _, trade := range trades {
+				if trade.ID == args[0] {
+					return columns(1), [][]driver.Value{{trade.ExecutedAt}}
+				}
+			}
+			return columns(1), nil
+		}
+		rows := make([][]driver.Value, len(trades))
+		for i, trade := range trades {
+			rows[i] = []driver.Value{trade.ID, trade.Symbol, trade.BuyOrderID, trade.SellOrderID,
+				trade.Price, trade.Quantity, trade.BuyerUserID, trade.SellerUserID,
+				trade.ExecutedAt, trade.BuyerAccountID, trade.SellerAccountID}
+		}
+		return columns(11), rows
+	}
+}
+
+func TestListTradesResolvesCursor(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &fakeDB{rows: tradeRows(
+		types.Trade{ID: "t1", Symbol: "BTC-USD", Price: 100, Quantity: 1, ExecutedAt: base},
+		types.Trade{ID: "t2", Symbol: "BTC-USD", Price: 101, Quantity: 2, ExecutedAt: base.Add(time.Second)},
+	)}
+	s := newFakeStore(t, db)
+
+	trades, err := s.ListTrades(context.Background(), TradeFilter{
+		Symbol:  "BTC-USD",
+		From:    base,
+		To:      base.Add(time.Hour),
+		AfterID: "t1",
+		Limit:   2,
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(trades) != 2 || trades[1].ID != "t2" || trades[1].Price != 101 {
+		t.Fatalf("trades %+v, want the scanned rows", trades)
+	}
+
+	// The cursor's execution time is looked up, then used with its ID
+	statements := db.ran()
+	if len(statements) != 2 {
+		t.Fatalf("ran %d statements, want the cursor lookup and the page", len(statements))
+	}
+	if args := fmt.Sprint(statements[0].args); args != "[t1 BTC-USD]" {
+		t.Fatalf("cursor lookup args %s, want the trade ID and symbol", args)
+	}
+	want := "WHERE symbol = $1 AND executed_at >= $2 AND executed_at < $3" +
+		" AND (executed_at, id) > ($4, $5) ORDER BY executed_at, id LIMIT $6"
+	if !strings.HasSuffix(statements[1].query, want) {
+		t.Fatalf("query %q, want it to end with %q", statements[1].query, want)
+	}
+	wantArgs := fmt.Sprint([]interface{}{"BTC-USD", base, base.Add(time.Hour), base, "t1", int64(2)})
+	if args := fmt.Sprint(statements[1].args); args != wantArgs {
+		t.Fatalf("args %s, want %s", args, wantArgs)
+	}
+
+	// A cursor that is not a trade of the symbol is refused
+	if _, err := s.ListTrades(context.Background(), TradeFilter{Symbol: "BTC-USD", AfterID: "unknown"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("unknown cursor: got %v, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func TestStreamTradesForExport(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var all []types.Trade
+	for i := 0; i < 5; i++ {
+		all = append(all, types.Trade{ID: fmt.Sprintf("t%d", i), Symbol: "BTC-USD", ExecutedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	db := &fakeDB{rows: tradeRows(all...)}
+	s := newFakeStore(t, db)
+
+	// Exports stream the whole range, unpaged, in execution order
+	var streamed []string
+	err := s.StreamTrades(context.Background(), TradeFilter{Symbol: "BTC-USD", From: base}, func(trade *types.Trade) error {
+		streamed = append(streamed, trade.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if fmt.Sprint(streamed) != "[t0 t1 t2 t3 t4]" {
+		t.Fatalf("streamed %v, want every trade in order", streamed)
+	}
+	if query := db.ran()[0].query; strings.Contains(query, "LIMIT") {
+		t.Fatalf("export query %q is paged", query)
+	}
+
+	// A failed write stops the export
+	errClosed := errors.New("client went away")
+	streamed = nil
+	err = s.StreamTrades(context.Background(), TradeFilter{Symbol: "BTC-USD", From: base}, func(trade *types.Trade) error {
+		streamed = append(streamed, trade.ID)
+		if len(streamed) == 2 {
+			return errClosed
+		}
+		return nil
+	})
+	if !errors.Is(err, errClosed) || len(streamed) != 2 {
+		t.Fatalf("stream returned %v after %v, want the write error after 2 trades", err, streamed)
+	}
+}
@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/metrics"
+)
+
+const (
+	// sendBufferSize is the number of messages queued for a client's writer
+	sendBufferSize = 256
+	// maxBacklog bounds the messages held back for a client whose send
+	// buffer is full
+	maxBacklog = 1024
+	// slowConsumerTimeout is how long a client may stay behind before it
+	// is disconnected
+	slowConsumerTimeout = 10 * time.Second
+	// drainInterval is how often held back messages are retried
+	drainInterval = 100 * time.Millisecond
+
+	// CloseSlowConsumer is the close code of clients disconnected for not
+	// reading their messages fast enough
+	CloseSlowConsumer = 4008
+)
+
+// conflated channels carry state rather than events: while a client is
+// behind, their updates are dropped and it is sent a fresh snapshot once it
+// catches up. Updates of other channels, trades, snapshots and responses
+// are held back in order.
+var conflated = map[string]bool{
+	ChannelMarket:  true,
+	ChannelL3:      true,
+	ChannelTicker:  true,
+	ChannelCandles: true,
+}
+
+// outbox is what the hub holds back for a client that is behind
+type outbox struct {
+	backlog []channelMessage
+	stale   map[subscription]bool
+	since   time.Time
+}
+
+// deliver queues a message for a client, holding it back if the client's
+// send buffer is full. Private events the client's scopes do not cover are
+// left out.
+func (h *Hub) deliver(client *Client, message channelMessage) {
+	if message.resource != nil && !client.allows(message.channel, *message.resource) {
+		return
+	}
+
+	box := h.outboxes[client]
+	if box == nil {
+		select {
+		case client.send <- message.data:
+			return
+		default:
+		}
+		box = &outbox{stale: make(map[subscription]bool), since: time.Now()}
+		h.outboxes[client] = box
+	}
+
+	if _, resyncable := h.snapshots[message.channel]; resyncable && message.sequence != 0 && conflated[message.channel] {
+		box.stale[message.subscription] = true
+		client.conflated++
+		metrics.RecordWebSocketConflated(message.channel)
+		return
+	}
+	if len(box.backlog) >= maxBacklog {
+		h.disconnectSlow(client, box, message)
+		return
+	}
+	box.backlog = append(box.backlog, message)
+}
+
+// drain moves held back messages into the send buffers of clients that
+// have room, resyncing the conflated channels of clients that caught up,
+// and disconnects clients that stayed behind for too long
+func (h *Hub) drain(now time.Time) {
+	for client, box := range h.outboxes {
+		sent := 0
+		for _, message := range box.backlog {
+			select {
+			case client.send <- message.data:
+				sent++
+				continue
+			default:
+			}
+			break
+		}
+		box.backlog = box.backlog[sent:]
+
+		if len(box.backlog) == 0 {
+			delete(h.outboxes, client)
+			for sub := range box.stale {
+				if client.subscribed(sub) {
+					h.resync(client, sub)
+				}
+			}
+			continue
+		}
+		if now.Sub(box.since) > slowConsumerTimeout {
+			h.disconnectSlow(client, box)
+		}
+	}
+}
+
+// disconnectSlow closes a client that could not keep up, discarding the
+// messages held back for it
+func (h *Hub) disconnectSlow(client *Client, box *outbox, discarded ...channelMessage) {
+	for _, message := range append(box.backlog, discarded...) {
+		channel := message.channel
+		if channel == "" {
+			channel = "response"
+		}
+		client.dropped++
+		metrics.RecordWebSocketDropped(channel)
+	}
+	metrics.RecordWebSocketSlowConsumer()
+
+	client.mu.Lock()
+	client.closeCode = CloseSlowConsumer
+	client.closeReason = "slow consumer"
+	client.mu.Unlock()
+
+	h.logger.Warn("Disconnected slow client",
+		zap.String("user_id", client.userID),
+		zap.Duration("behind", time.Since(box.since)),
+		zap.Int("conflated", client.conflated),
+		zap.Int("dropped", client.dropped))
+	h.drop(client)
+}
@@ -0,0 +1,124 @@
+package ws
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slowClient is a client of the hub whose send buffer holds one message,
+// used without Run so the test drives the hub
+func slowClient(h *Hub, subs ...subscription) *Client {
+	client := &Client{hub: h, send: make(chan []byte, 1), subscriptions: make(map[subscription]bool)}
+	for _, sub := range subs {
+		client.subscriptions[sub] = true
+	}
+	h.clients[client] = true
+	return client
+}
+
+func update(sub subscription, sequence uint64) channelMessage {
+	return channelMessage{subscription: sub, sequence: sequence, data: []byte(fmt.Sprintf("%s-%d", sub.channel, sequence))}
+}
+
+// received returns the message waiting in a client's send buffer
+func received(t *testing.T, client *Client) string {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		return string(data)
+	default:
+		t.Fatal("nothing sent")
+	}
+	return ""
+}
+
+func TestSlowClientsAreConflated(t *testing.T) {
+	h := NewHub(zap.NewNop())
+	h.snapshots[ChannelTicker] = func(sub subscription) (uint64, []byte, error) {
+		return 3, []byte("ticker-snapshot"), nil
+	}
+	ticker := subscription{channel: ChannelTicker, symbol: "BTC-USD"}
+	trades := subscription{channel: ChannelTrades, symbol: "BTC-USD"}
+	client := slowClient(h, ticker, trades)
+
+	h.deliver(client, update(ticker, 1))
+	// The buffer is full: ticker updates are dropped for a snapshot while
+	// trades and responses wait in order
+	h.deliver(client, update(ticker, 2))
+	h.deliver(client, update(trades, 1))
+	h.deliver(client, update(ticker, 3))
+	h.deliver(client, channelMessage{data: []byte("response")})
+
+	box := h.outboxes[client]
+	if box == nil || len(box.backlog) != 2 || !box.stale[ticker] || client.conflated != 2 {
+		t.Fatalf("outbox %+v with %d conflated, want 2 held back and ticker stale", box, client.conflated)
+	}
+
+	h.drain(time.Now())
+	if got := received(t, client); got != "ticker-1" {
+		t.Fatalf("sent %q first", got)
+	}
+	h.drain(time.Now())
+	if got := received(t, client); got != "trades-1" {
+		t.Fatalf("sent %q second", got)
+	}
+	h.drain(time.Now())
+	if got := received(t, client); got != "response" {
+		t.Fatalf("sent %q third", got)
+	}
+	if h.outboxes[client] != nil {
+		t.Fatal("outbox kept after catching up")
+	}
+
+	// Catching up resyncs the conflated channel, holding its updates until
+	// the snapshot
+	if h.pending[client][ticker] == nil {
+		t.Fatal("ticker updates not held back for the resync")
+	}
+	select {
+	case sync := <-h.syncs:
+		h.completeSync(sync)
+	case <-time.After(time.Second):
+		t.Fatal("no resync after catching up")
+	}
+	if got := received(t, client); got != "ticker-snapshot" {
+		t.Fatalf("sent %q after catching up, want the snapshot", got)
+	}
+	if _, held := h.pending[client][ticker]; held {
+		t.Fatal("updates still held back after the snapshot")
+	}
+}
+
+func TestSlowClientsAreDisconnected(t *testing.T) {
+	h := NewHub(zap.NewNop())
+	trades := subscription{channel: ChannelTrades, symbol: "BTC-USD"}
+
+	// A backlog past its bound disconnects at once
+	full := slowClient(h, trades)
+	for sequence := uint64(1); sequence <= maxBacklog+2; sequence++ {
+		h.deliver(full, update(trades, sequence))
+	}
+	if h.clients[full] || full.closeCode != CloseSlowConsumer || full.dropped != maxBacklog+1 {
+		t.Fatalf("client kept with close code %d after dropping %d", full.closeCode, full.dropped)
+	}
+	received(t, full)
+	if _, open := <-full.send; open {
+		t.Fatal("send buffer of a disconnected client left open")
+	}
+
+	// So does staying behind for too long
+	behind := slowClient(h, trades)
+	h.deliver(behind, update(trades, 1))
+	h.deliver(behind, update(trades, 2))
+	h.drain(time.Now())
+	if !h.clients[behind] {
+		t.Fatal("client disconnected before the timeout")
+	}
+	h.drain(time.Now().Add(slowConsumerTimeout + time.Second))
+	if h.clients[behind] || behind.closeCode != CloseSlowConsumer || behind.dropped != 1 {
+		t.Fatalf("client kept with close code %d after dropping %d", behind.closeCode, behind.dropped)
+	}
+}
@@ -0,0 +1,168 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// BookSource provides the snapshots new book subscribers start from
+type BookSource interface {
+	GetOrderBook(symbol string) (*types.OrderBookSnapshot, error)
+	GetOrderBookL3(symbol string) (*types.OrderBookL3Snapshot, error)
+}
+
+// SetBookSource enables the book channels: subscribers receive a snapshot
+// of the book followed by its updates. It must be called before Run.
+func (h *Hub) SetBookSource(books BookSource) {
+	h.snapshots[ChannelMarket] = func(sub subscription) (uint64, []byte, error) {
+		snapshot, err := books.GetOrderBook(sub.symbol)
+		if err != nil {
+			// The book is created by the symbol's first order
+			snapshot = &types.OrderBookSnapshot{Symbol: sub.symbol, Timestamp: time.Now()}
+		}
+		data, err := snapshotMessage(snapshot)
+		return snapshot.Sequence, data, err
+	}
+	h.snapshots[ChannelL3] = func(sub subscription) (uint64, []byte, error) {
+		snapshot, err := books.GetOrderBookL3(sub.symbol)
+		if err != nil {
+			snapshot = &types.OrderBookL3Snapshot{Symbol: sub.symbol, Timestamp: time.Now()}
+		}
+		data, err := l3SnapshotMessage(snapshot)
+		return snapshot.Sequence, data, err
+	}
+}
+
+// PublishBookUpdate queues a level change for the market channel. It is
+// meant to be registered as an engine book listener and only blocks if
+// the hub falls behind.
+func (h *Hub) PublishBookUpdate(update types.BookUpdate) {
+	data, err := l2UpdateMessage(update)
+	if err != nil {
+		h.logger.Error("Failed to marshal book update", zap.Error(err), zap.String("symbol", update.Symbol))
+		return
+	}
+	h.publish(subscription{channel: ChannelMarket, symbol: update.Symbol}, update.Sequence, data)
+}
+
+// PublishBookOrderEvent queues a resting order change for the L3 channel,
+// like PublishBookUpdate
+func (h *Hub) PublishBookOrderEvent(event types.BookOrderEvent) {
+	data, err := l3UpdateMessage(event)
+	if err != nil {
+		h.logger.Error("Failed to marshal book order event", zap.Error(err), zap.String("symbol", event.Symbol))
+		return
+	}
+	h.publish(subscription{channel: ChannelL3, symbol: event.Symbol}, event.Sequence, data)
+}
+
+// snapshotMessage encodes the L2 snapshot a subscriber starts from; the
+// l2update messages that follow it continue from its sequence
+func snapshotMessage(snapshot *types.OrderBookSnapshot) ([]byte, error) {
+	bids, asks := snapshot.Bids, snapshot.Asks
+	if bids == nil {
+		bids = []types.OrderBookLevel{}
+	}
+	if asks == nil {
+		asks = []types.OrderBookLevel{}
+	}
+	return json.Marshal(struct {
+		Type      string                 `json:"type"`
+		Symbol    string                 `json:"symbol"`
+		Sequence  uint64                 `json:"sequence"`
+		Checksum  uint32                 `json:"checksum"`
+		Timestamp time.Time              `json:"timestamp"`
+		Bids      []types.OrderBookLevel `json:"bids"`
+		Asks      []types.OrderBookLevel `json:"asks"`
+	}{
+		Type:      "orderbook",
+		Symbol:    snapshot.Symbol,
+		Sequence:  snapshot.Sequence,
+		Checksum:  snapshot.Checksum,
+		Timestamp: snapshot.Timestamp,
+		Bids:      bids,
+		Asks:      asks,
+	})
+}
+
+// l2UpdateMessage encodes a level change. A quantity of zero removes the
+// level.
+func l2UpdateMessage(update types.BookUpdate) ([]byte, error) {
+	return json.Marshal(struct {
+		Type      string          `json:"type"`
+		Symbol    string          `json:"symbol"`
+		Sequence  uint64          `json:"sequence"`
+		Side      types.OrderSide `json:"side"`
+		Price     float64         `json:"price"`
+		Quantity  float64         `json:"quantity"`
+		Checksum  uint32          `json:"checksum"`
+		Timestamp time.Time       `json:"timestamp"`
+	}{
+		Type:      "l2update",
+		Symbol:    update.Symbol,
+		Sequence:  update.Sequence,
+		Side:      update.Side,
+		Price:     update.Price,
+		Quantity:  update.Quantity,
+		Checksum:  update.Checksum,
+		Timestamp: update.Timestamp,
+	})
+}
+
+// l3SnapshotMessage encodes the L3 snapshot a subscriber starts from
+func l3SnapshotMessage(snapshot *types.OrderBookL3Snapshot) ([]byte, error) {
+	bids, asks := snapshot.Bids, snapshot.Asks
+	if bids == nil {
+		bids = []types.BookOrder{}
+	}
+	if asks == nil {
+		asks = []types.BookOrder{}
+	}
+	return json.Marshal(struct {
+		Type      string            `json:"type"`
+		Symbol    string            `json:"symbol"`
+		Sequence  uint64            `json:"sequence"`
+		Timestamp time.Time         `json:"timestamp"`
+		Bids      []types.BookOrder `json:"bids"`
+		Asks      []types.BookOrder `json:"asks"`
+	}{
+		Type:      "orderbook_l3",
+		Symbol:    snapshot.Symbol,
+		Sequence:  snapshot.Sequence,
+		Timestamp: snapshot.Timestamp,
+		Bids:      bids,
+		Asks:      asks,
+	})
+}
+
+// l3UpdateMessage encodes a resting order change. Event is add, modify,
+// cancel or execute; a quantity of zero removes the order.
+func l3UpdateMessage(event types.BookOrderEvent) ([]byte, error) {
+	return json.Marshal(struct {
+		Type        string                   `json:"type"`
+		Event       types.BookOrderEventType `json:"event"`
+		Symbol      string                   `json:"symbol"`
+		Sequence    uint64                   `json:"sequence"`
+		OrderID     string                   `json:"order_id"`
+		Side        types.OrderSide          `json:"side"`
+		Price       float64                  `json:"price"`
+		Quantity    float64                  `json:"quantity"`
+		ExecutedQty float64                  `json:"executed_quantity,omitempty"`
+		Timestamp   time.Time                `json:"timestamp"`
+	}{
+		Type:        "l3update",
+		Event:       event.Type,
+		Symbol:      event.Symbol,
+		Sequence:    event.Sequence,
+		OrderID:     event.OrderID,
+		Side:        event.Side,
+		Price:       event.Price,
+		Quantity:    event.Quantity,
+		ExecutedQty: event.ExecutedQty,
+		Timestamp:   event.Timestamp,
+	})
+}
@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// CandleSource provides the live bars new subscribers start from
+type CandleSource interface {
+	Live(symbol string) ([]types.Candle, uint64)
+}
+
+// SetCandleSource enables the candles channel: subscribers receive the
+// live bar of every time frame followed by bar updates. It must be called
+// before Run.
+func (h *Hub) SetCandleSource(candles CandleSource) {
+	h.snapshots[ChannelCandles] = func(sub subscription) (uint64, []byte, error) {
+		live, sequence := candles.Live(sub.symbol)
+		data, err := json.Marshal(struct {
+			Type     string         `json:"type"`
+			Symbol   string         `json:"symbol"`
+			Sequence uint64         `json:"sequence"`
+			Candles  []types.Candle `json:"candles"`
+		}{
+			Type:     "candles",
+			Symbol:   sub.symbol,
+			Sequence: sequence,
+			Candles:  live,
+		})
+		return sequence, data, err
+	}
+}
+
+// PublishCandle queues a bar update for the candles channel. Closed bars
+// are sent once more as they close. It is meant to be registered as a
+// candle listener and only blocks if the hub falls behind.
+func (h *Hub) PublishCandle(candle types.Candle, sequence uint64) {
+	data, err := json.Marshal(struct {
+		Type     string `json:"type"`
+		Sequence uint64 `json:"sequence"`
+		types.Candle
+	}{
+		Type:     "candle",
+		Sequence: sequence,
+		Candle:   candle,
+	})
+	if err != nil {
+		h.logger.Error("Failed to marshal candle", zap.Error(err), zap.String("symbol", candle.Symbol))
+		return
+	}
+	h.publish(subscription{channel: ChannelCandles, symbol: candle.Symbol}, sequence, data)
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// messageBufferSize bounds the channel messages waiting for the hub
+const messageBufferSize = 4096
+
+// snapshotFunc encodes the current state of a subscription's channel for a
+// new subscriber, with the sequence the channel's updates continue from
+type snapshotFunc func(sub subscription) (uint64, []byte, error)
+
+// channelMessage is an encoded update for the subscribers of a channel.
+// Messages without a sequence are events, such as trades, rather than
+// changes to the snapshot and are never held back.
+type channelMessage struct {
+	subscription
+	sequence uint64
+	data     []byte
+	// resource is what a private event is about
+	resource *auth.Resource
+	// reset marks the channel's kept updates as no longer replayable
+	reset bool
+}
+
+// channelSync is a client's subscription to a channel while its snapshot
+// is taken. It is sent when the sync starts and again, done, with the
+// encoded snapshot.
+type channelSync struct {
+	subscription
+	client   *Client
+	done     bool
+	sequence uint64
+	snapshot []byte
+}
+
+// publish queues an update for a channel's subscribers. It only blocks if
+// the hub falls messageBufferSize messages behind.
+func (h *Hub) publish(sub subscription, sequence uint64, data []byte) {
+	h.publishUpdate(Update{Topic: sub.topic(), Sequence: sequence, Data: data})
+}
+
+// publishUpdate relays an update and queues it for the hub's subscribers
+func (h *Hub) publishUpdate(update Update) {
+	if h.relay != nil {
+		h.relay(update)
+	}
+	h.messages <- update.message()
+}
+
+// resync restarts a client's view of a channel from Run
+func (h *Hub) resync(client *Client, sub subscription) {
+	snapshot, ok := h.snapshots[sub.channel]
+	if !ok {
+		return
+	}
+	h.holdUpdates(client, sub)
+	go h.takeSnapshot(client, sub, snapshot)
+}
+
+// holdUpdates holds back a subscription's updates until its snapshot or
+// replay arrives. It is called by Run.
+func (h *Hub) holdUpdates(client *Client, sub subscription) {
+	if h.pending[client] == nil {
+		h.pending[client] = make(map[subscription][]channelMessage)
+	}
+	h.pending[client][sub] = make([]channelMessage, 0)
+}
+
+// takeSnapshot encodes a subscription's snapshot and hands it to Run
+func (h *Hub) takeSnapshot(client *Client, sub subscription, snapshot snapshotFunc) {
+	sync := channelSync{subscription: sub, client: client, done: true}
+	sequence, data, err := snapshot(sub)
+	if err == nil {
+		data, err = client.filterSnapshot(sub.channel, data)
+	}
+	if err != nil {
+		h.logger.Error("Failed to take snapshot",
+			zap.Error(err),
+			zap.String("channel", sub.channel),
+			zap.String("symbol", sub.symbol))
+	} else {
+		sync.sequence, sync.snapshot = sequence, data
+	}
+	h.syncs <- sync
+}
+
+// completeSync sends a client its snapshot and then the updates that
+// arrived after it was taken
+func (h *Hub) completeSync(sync channelSync) {
+	pending := h.pending[sync.client][sync.subscription]
+	delete(h.pending[sync.client], sync.subscription)
+
+	if sync.snapshot == nil {
+		return
+	}
+	h.deliver(sync.client, channelMessage{subscription: sync.subscription, data: sync.snapshot})
+	for _, message := range pending {
+		if message.sequence <= sync.sequence || !h.clients[sync.client] {
+			continue
+		}
+		h.deliver(sync.client, message)
+	}
+}
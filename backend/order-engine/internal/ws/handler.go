@@ -1,44 +1,198 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
 )
 
+// Channels a client can subscribe to for a symbol. Subscribing without a
+// channel uses ChannelMarket.
+const (
+	// ChannelMarket carries trades and L2 book updates
+	ChannelMarket = "market"
+	// ChannelL3 carries every change to a resting order
+	ChannelL3 = "l3"
+	// ChannelTicker carries 24 hour statistics
+	ChannelTicker = "ticker"
+	// ChannelCandles carries the bars of every time frame
+	ChannelCandles = "candles"
+	// ChannelTrades carries every trade, numbered per symbol
+	ChannelTrades = "trades"
+)
+
+// Private channels carry the events of the connection's user across all
+// symbols and are subscribed to without a symbol
+const (
+	// ChannelOrders carries an execution report for every order change
+	ChannelOrders = "orders"
+	// ChannelFills carries every fill
+	ChannelFills = "fills"
+	// ChannelBalances carries every balance change of the user's accounts
+	ChannelBalances = "balances"
+	// ChannelPositions carries every position change of the user's accounts
+	ChannelPositions = "positions"
+)
+
+var channels = map[string]bool{
+	ChannelMarket:    true,
+	ChannelL3:        true,
+	ChannelTicker:    true,
+	ChannelCandles:   true,
+	ChannelTrades:    true,
+	ChannelOrders:    true,
+	ChannelFills:     true,
+	ChannelBalances:  true,
+	ChannelPositions: true,
+}
+
+// privateScopes maps each private channel to the scope it requires
+var privateScopes = map[string]string{
+	ChannelOrders:    auth.ScopeOrdersRead,
+	ChannelFills:     auth.ScopeOrdersRead,
+	ChannelBalances:  auth.ScopeAccountsRead,
+	ChannelPositions: auth.ScopeAccountsRead,
+}
+
+// subscription is one channel of one symbol, or a private channel of one
+// user
+type subscription struct {
+	channel string
+	symbol  string
+	user    string
+}
+
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	symbols  map[string]bool
-	mu       sync.RWMutex
-	userID   string
+	// id keys the client's order entry throttle
+	id            string
+	hub           *Hub
+	conn          *websocket.Conn
+	send          chan []byte
+	subscriptions map[subscription]bool
+	mu            sync.RWMutex
+	userID        string
+	claims        *auth.Claims
+	closeCode     int
+	closeReason   string
+	// closed is set once the hub dropped the client, after which it takes
+	// no new subscriptions
+	closed bool
+
+	// conflated and dropped count the client's updates replaced by a later
+	// snapshot and its messages discarded when it was disconnected for
+	// falling behind. They are only touched by Run.
+	conflated int
+	dropped   int
+}
+
+// disconnectRequest asks the hub to close every connection of a user
+type disconnectRequest struct {
+	userID string
+	reason string
+	done   chan int
 }
 
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	messages   chan channelMessage
+	syncs      chan channelSync
+	replays    chan channelReplay
+	replies    chan reply
 	register   chan *Client
 	unregister chan *Client
+	disconnect chan disconnectRequest
+	snapshots  map[string]snapshotFunc
+	orders     *orderEntry
 	logger     *zap.Logger
+
+	// pending holds the messages for channels whose snapshot a client is
+	// waiting for. It is only touched by Run.
+	pending map[*Client]map[subscription][]channelMessage
+	// outboxes holds back messages for clients that are not keeping up. It
+	// is only touched by Run.
+	outboxes map[*Client]*outbox
+	// history keeps the recent updates of every channel for clients that
+	// resubscribe from a sequence. It is only touched by Run.
+	history map[subscription]*history
+
+	// sequences numbers the trades of each symbol and the updates of each
+	// user's private channels. Private channels forgotten when idle are
+	// numbered again from sequenceFloor, the highest sequence forgotten.
+	sequences     map[subscription]uint64
+	sequenceFloor uint64
+	sequenceMutex sync.Mutex
+
+	// relay forwards published updates to other processes, and
+	// interestListener learns which topics to receive from them
+	relay            func(update Update)
+	interestListener InterestListener
+	interest         map[subscription]int
+	interestMutex    sync.Mutex
 }
 
 func NewHub(logger *zap.Logger) *Hub {
-	return &Hub{
+	h := &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
+		messages:   make(chan channelMessage, messageBufferSize),
+		syncs:      make(chan channelSync),
+		replays:    make(chan channelReplay),
+		replies:    make(chan reply),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		disconnect: make(chan disconnectRequest),
+		snapshots:  make(map[string]snapshotFunc),
 		logger:     logger,
+		pending:    make(map[*Client]map[subscription][]channelMessage),
+		outboxes:   make(map[*Client]*outbox),
+		history:    make(map[subscription]*history),
+		sequences:  make(map[subscription]uint64),
+		interest:   make(map[subscription]int),
+	}
+	h.snapshots[ChannelTrades] = h.tradesSnapshot
+	return h
+}
+
+// drop forgets a client that is being closed and closes its send buffer.
+// Clients already dropped are ignored, so every path may call it.
+func (h *Hub) drop(client *Client) {
+	if !h.clients[client] {
+		return
+	}
+	delete(h.clients, client)
+	delete(h.pending, client)
+	delete(h.outboxes, client)
+	close(client.send)
+
+	client.mu.Lock()
+	client.closed = true
+	for sub := range client.subscriptions {
+		h.removeInterest(sub)
 	}
+	client.mu.Unlock()
+}
+
+// subscribed reports whether a client is subscribed to a channel of a symbol
+func (c *Client) subscribed(sub subscription) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.subscriptions[sub]
 }
 
 func (h *Hub) Run() {
+	drain := time.NewTicker(drainInterval)
+	defer drain.Stop()
+	sweep := time.NewTicker(historySweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
@@ -47,65 +201,232 @@ func (h *Hub) Run() {
 				zap.String("user_id", client.userID))
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			if h.clients[client] {
+				h.drop(client)
 				h.logger.Info("Client disconnected",
 					zap.String("user_id", client.userID))
 			}
 
-		case message := <-h.broadcast:
-			var update struct {
-				Symbol string `json:"symbol"`
+		case req := <-h.disconnect:
+			closed := 0
+			for client := range h.clients {
+				if client.userID != req.userID {
+					continue
+				}
+				client.mu.Lock()
+				client.closeCode = websocket.ClosePolicyViolation
+				client.closeReason = req.reason
+				client.mu.Unlock()
+
+				h.drop(client)
+				closed++
 			}
-			if err := json.Unmarshal(message, &update); err != nil {
-				h.logger.Error("Failed to unmarshal update", zap.Error(err))
+			h.logger.Info("Disconnected user",
+				zap.String("user_id", req.userID),
+				zap.String("reason", req.reason),
+				zap.Int("connections", closed))
+			req.done <- closed
+
+		case message := <-h.messages:
+			if message.reset {
+				h.resetHistory(message.subscription)
 				continue
 			}
-
+			if message.sequence != 0 {
+				h.record(message, time.Now())
+			}
 			for client := range h.clients {
-				client.mu.RLock()
-				subscribed := client.symbols[update.Symbol]
-				client.mu.RUnlock()
-
-				if subscribed {
-					select {
-					case client.send <- message:
-					default:
-						close(client.send)
-						delete(h.clients, client)
-					}
+				if !client.subscribed(message.subscription) {
+					continue
 				}
+				pending, syncing := h.pending[client][message.subscription]
+				if syncing && message.sequence != 0 {
+					h.pending[client][message.subscription] = append(pending, message)
+					continue
+				}
+				h.deliver(client, message)
+			}
+
+		case reply := <-h.replies:
+			if h.clients[reply.client] {
+				h.deliver(reply.client, channelMessage{data: reply.data})
+			}
+
+		case sync := <-h.syncs:
+			if !h.clients[sync.client] {
+				continue
 			}
+			if !sync.done {
+				h.holdUpdates(sync.client, sync.subscription)
+				continue
+			}
+			h.completeSync(sync)
+
+		case replay := <-h.replays:
+			if h.clients[replay.client] {
+				h.replay(replay)
+			}
+
+		case now := <-drain.C:
+			h.drain(now)
+
+		case now := <-sweep.C:
+			h.forgetIdle(now)
 		}
 	}
 }
 
-func (c *Client) Subscribe(symbol string) {
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// Handler upgrades HTTP requests for an authenticated user to WebSocket clients
+type Handler struct {
+	hub    *Hub
+	claims *auth.Claims
+}
+
+func NewHandler(hub *Hub, claims *auth.Claims) *Handler {
+	return &Handler{
+		hub:    hub,
+		claims: claims,
+	}
+}
+
+// ServeWS upgrades the connection, registers the client and starts its pumps
+func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.hub.logger.Error("Failed to upgrade connection",
+			zap.Error(err),
+			zap.String("user_id", h.claims.UserID))
+		return
+	}
+
+	client := &Client{
+		id:            uuid.New().String(),
+		hub:           h.hub,
+		conn:          conn,
+		send:          make(chan []byte, sendBufferSize),
+		subscriptions: make(map[subscription]bool),
+		userID:        h.claims.UserID,
+		claims:        h.claims,
+	}
+	h.hub.register <- client
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+// subscription returns the client's subscription to a channel. Private
+// channels ignore the symbol and are always the client's own user's.
+func (c *Client) subscription(channel, symbol string) subscription {
+	if channel == "" {
+		channel = ChannelMarket
+	}
+	if _, private := privateScopes[channel]; private {
+		return subscription{channel: channel, user: c.userID}
+	}
+	return subscription{channel: channel, symbol: symbol}
+}
+
+// Subscribe adds a channel of a symbol to the client and, when the hub has
+// a source for the channel, sends a snapshot followed by its updates.
+// Subscribing again resyncs the channel, e.g. after a sequence gap.
+func (c *Client) Subscribe(channel, symbol string) error {
+	sub, err := c.subscribe(channel, symbol, false)
+	if err != nil {
+		return err
+	}
+	c.sync(sub)
+	return nil
+}
+
+// subscribe checks and adds a subscription without syncing it. Updates of
+// a channel with a snapshot, or that will be replayed, are held back from
+// the moment it is added until the sync or replay.
+func (c *Client) subscribe(channel, symbol string, replay bool) (subscription, error) {
+	sub := c.subscription(channel, symbol)
+	if !channels[sub.channel] {
+		return sub, invalidRequest("unknown channel %q", sub.channel)
+	}
+	scope, private := privateScopes[sub.channel]
+	if private && !c.claims.HasScope(scope) {
+		return sub, insufficientScope(scope)
+	}
+	if !private && sub.symbol == "" {
+		return sub, invalidRequest("symbol is required")
+	}
+
+	if _, ok := c.hub.snapshots[sub.channel]; ok || replay {
+		c.hub.syncs <- channelSync{subscription: sub, client: c}
+	}
+
 	c.mu.Lock()
-	c.symbols[symbol] = true
+	if c.closed {
+		c.mu.Unlock()
+		return sub, errClientClosed
+	}
+	gained := false
+	if !c.subscriptions[sub] {
+		var err error
+		if gained, err = c.hub.addInterest(sub); err != nil {
+			c.mu.Unlock()
+			return sub, err
+		}
+	}
+	c.subscriptions[sub] = true
 	c.mu.Unlock()
+
+	// Updates kept from an earlier interest in the topic may be followed
+	// by a gap
+	if gained {
+		c.hub.messages <- channelMessage{subscription: sub, reset: true}
+	}
 	c.hub.logger.Info("Client subscribed to symbol",
 		zap.String("user_id", c.userID),
-		zap.String("symbol", symbol))
+		zap.String("channel", sub.channel),
+		zap.String("symbol", sub.symbol))
+	return sub, nil
+}
+
+// sync sends a subscription's snapshot when its channel has one
+func (c *Client) sync(sub subscription) {
+	if snapshot, ok := c.hub.snapshots[sub.channel]; ok {
+		c.hub.takeSnapshot(c, sub, snapshot)
+	}
 }
 
-func (c *Client) Unsubscribe(symbol string) {
+func (c *Client) Unsubscribe(channel, symbol string) subscription {
+	sub := c.subscription(channel, symbol)
+
 	c.mu.Lock()
-	delete(c.symbols, symbol)
+	if c.subscriptions[sub] {
+		delete(c.subscriptions, sub)
+		c.hub.removeInterest(sub)
+	}
 	c.mu.Unlock()
 	c.hub.logger.Info("Client unsubscribed from symbol",
 		zap.String("user_id", c.userID),
-		zap.String("symbol", symbol))
+		zap.String("channel", sub.channel),
+		zap.String("symbol", sub.symbol))
+	return sub
 }
 
+// ReadPump handles the client's requests until the connection closes
 func (c *Client) ReadPump() {
+	ctx, cancel := context.WithCancel(context.Background())
 	defer func() {
+		cancel()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512) // Max message size
+	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -123,24 +444,12 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		var cmd struct {
-			Action string `json:"action"`
-			Symbol string `json:"symbol"`
-		}
-
-		if err := json.Unmarshal(message, &cmd); err != nil {
-			c.hub.logger.Error("Failed to unmarshal command",
-				zap.Error(err),
-				zap.String("user_id", c.userID))
+		var req request
+		if err := json.Unmarshal(message, &req); err != nil {
+			c.respond(&req, nil, invalidRequest("malformed request: %v", err))
 			continue
 		}
-
-		switch cmd.Action {
-		case "subscribe":
-			c.Subscribe(cmd.Symbol)
-		case "unsubscribe":
-			c.Unsubscribe(cmd.Symbol)
-		}
+		c.handle(ctx, &req)
 	}
 }
 
@@ -156,7 +465,13 @@ func (c *Client) WritePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.mu.RLock()
+				closeMessage := []byte{}
+				if c.closeCode != 0 {
+					closeMessage = websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				}
+				c.mu.RUnlock()
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
@@ -179,33 +494,17 @@ func (c *Client) WritePump() {
 	}
 }
 
-// BroadcastOrderBookUpdate sends order book updates to subscribed clients
-func (h *Hub) BroadcastOrderBookUpdate(symbol string, snapshot *types.OrderBookSnapshot) {
-	data, err := json.Marshal(struct {
-		Type      string                   `json:"type"`
-		Symbol    string                   `json:"symbol"`
-		Timestamp time.Time                `json:"timestamp"`
-		Bids      []types.OrderBookLevel   `json:"bids"`
-		Asks      []types.OrderBookLevel   `json:"asks"`
-	}{
-		Type:      "orderbook",
-		Symbol:    symbol,
-		Timestamp: snapshot.Timestamp,
-		Bids:      snapshot.Bids,
-		Asks:      snapshot.Asks,
-	})
-
-	if err != nil {
-		h.logger.Error("Failed to marshal order book update",
-			zap.Error(err),
-			zap.String("symbol", symbol))
-		return
-	}
-
-	h.broadcast <- data
+// DisconnectUser closes every connection of the user with a policy
+// violation close frame carrying the reason, and returns how many were closed
+func (h *Hub) DisconnectUser(userID, reason string) int {
+	done := make(chan int, 1)
+	h.disconnect <- disconnectRequest{userID: userID, reason: reason, done: done}
+	return <-done
 }
 
-// BroadcastTrade sends trade updates to subscribed clients
+// BroadcastTrade sends trade updates to the market channel. Trades are not
+// sequenced there and are not held back while a book snapshot is taken; the
+// trades channel numbers them for replay.
 func (h *Hub) BroadcastTrade(trade *types.Trade) {
 	data, err := json.Marshal(struct {
 		Type      string    `json:"type"`
@@ -228,5 +527,5 @@ func (h *Hub) BroadcastTrade(trade *types.Trade) {
 		return
 	}
 
-	h.broadcast <- data
-} 
\ No newline at end of file
+	h.publish(subscription{channel: ChannelMarket, symbol: trade.Symbol}, 0, data)
+}
@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// server serves a hub to traders, narrowed to the scopes in the query
+type server struct {
+	t   *testing.T
+	hub *Hub
+	url string
+}
+
+// serve runs the hub behind a WebSocket server. Sources must be set on
+// the hub before.
+func serve(t *testing.T, hub *Hub) *server {
+	go hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &auth.Claims{UserID: r.URL.Query().Get("user"), Role: auth.RoleTrader, Scopes: r.URL.Query()["scope"]}
+		auth.DefaultPolicy().Apply(claims)
+		NewHandler(hub, claims).ServeWS(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &server{t: t, hub: hub, url: "ws" + strings.TrimPrefix(srv.URL, "http")}
+}
+
+type client struct {
+	t        *testing.T
+	conn     *websocket.Conn
+	messages chan map[string]interface{}
+}
+
+func (s *server) dial(userID string, scopes ...string) *client {
+	query := url.Values{"user": {userID}, "scope": scopes}
+	conn, _, err := websocket.DefaultDialer.Dial(s.url+"?"+query.Encode(), nil)
+	if err != nil {
+		s.t.Fatalf("dial: %v", err)
+	}
+	c := &client{t: s.t, conn: conn, messages: make(chan map[string]interface{}, 100)}
+	go func() {
+		defer close(c.messages)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message map[string]interface{}
+			if err := json.Unmarshal(data, &message); err == nil {
+				c.messages <- message
+			}
+		}
+	}()
+	s.t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+func (c *client) send(req map[string]interface{}) {
+	if err := c.conn.WriteJSON(req); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// expect returns the next message, which must have the given type
+func (c *client) expect(messageType string) map[string]interface{} {
+	c.t.Helper()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("connection closed, want %s", messageType)
+		}
+		if message["type"] != messageType {
+			c.t.Fatalf("got %v, want %s", message, messageType)
+		}
+		return message
+	case <-time.After(2 * time.Second):
+		c.t.Fatalf("timed out waiting for %s", messageType)
+	}
+	return nil
+}
+
+// expectNone checks that no message arrives for a while
+func (c *client) expectNone() {
+	c.t.Helper()
+	select {
+	case message := <-c.messages:
+		c.t.Fatalf("unexpected message %v", message)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// orderSource serves fixed open orders per user
+type orderSource map[string][]types.Order
+
+func (s orderSource) GetOrdersByUser(userID string) []types.Order {
+	return s[userID]
+}
+
+func report(id, userID, symbol string) types.ExecutionReport {
+	return types.ExecutionReport{
+		ExecType: types.ExecTypeNew,
+		Order:    types.Order{ID: id, UserID: userID, AccountID: userID, Symbol: symbol},
+	}
+}
+
+func TestPrivateChannelsRouteToTheirUser(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	hub.SetOrderSource(orderSource{
+		"alice": {
+			{ID: "open-btc", UserID: "alice", AccountID: "alice", Symbol: "BTC-USD"},
+			{ID: "open-eth", UserID: "alice", AccountID: "alice", Symbol: "ETH-USD"},
+		},
+	})
+	s := serve(t, hub)
+
+	alice := s.dial("alice")
+	alice.send(map[string]interface{}{"action": "subscribe", "channel": ChannelOrders, "symbol": "ignored"})
+	if result := alice.expect("response")["result"].(map[string]interface{}); result["channel"] != ChannelOrders || result["symbol"] != nil {
+		t.Fatalf("subscribed to %v, want the private orders channel", result)
+	}
+	if orders := alice.expect("orders")["orders"].([]interface{}); len(orders) != 2 {
+		t.Fatalf("snapshot has %d orders, want 2", len(orders))
+	}
+
+	// A narrowed connection of the same user only sees what it covers
+	narrowed := s.dial("alice", auth.ScopeOrdersRead+"@symbol=ETH-USD")
+	narrowed.send(map[string]interface{}{"action": "subscribe", "channel": ChannelOrders})
+	narrowed.expect("response")
+	orders := narrowed.expect("orders")["orders"].([]interface{})
+	if len(orders) != 1 || orders[0].(map[string]interface{})["id"] != "open-eth" {
+		t.Fatalf("narrowed snapshot %v, want only open-eth", orders)
+	}
+
+	bob := s.dial("bob")
+	bob.send(map[string]interface{}{"action": "subscribe", "channel": ChannelOrders})
+	bob.expect("response")
+	bob.expect("orders")
+
+	hub.PublishExecutionReport(report("alice-btc", "alice", "BTC-USD"))
+	hub.PublishExecutionReport(report("alice-eth", "alice", "ETH-USD"))
+	hub.PublishExecutionReport(report("bob-btc", "bob", "BTC-USD"))
+
+	first, second := alice.expect("execution_report"), alice.expect("execution_report")
+	if first["id"] != "alice-btc" || first["sequence"] != 1.0 || second["id"] != "alice-eth" || second["sequence"] != 2.0 {
+		t.Fatalf("alice's reports %v, %v", first, second)
+	}
+	alice.expectNone()
+
+	// Sequences are per user and keep counting the events left out
+	if report := narrowed.expect("execution_report"); report["id"] != "alice-eth" || report["sequence"] != 2.0 {
+		t.Fatalf("narrowed report %v", report)
+	}
+	narrowed.expectNone()
+	if report := bob.expect("execution_report"); report["id"] != "bob-btc" || report["sequence"] != 1.0 {
+		t.Fatalf("bob's report %v", report)
+	}
+	bob.expectNone()
+
+	// Private channels need their scope
+	analyst := s.dial("carol", auth.ScopeMarketDataRead)
+	analyst.send(map[string]interface{}{"action": "subscribe", "channel": ChannelOrders, "request_id": "r1"})
+	if failed := analyst.expect("error"); failed["code"] != CodeForbidden || failed["request_id"] != "r1" {
+		t.Fatalf("subscription without orders:read answered %v", failed)
+	}
+	hub.PublishExecutionReport(report("carol-btc", "carol", "BTC-USD"))
+	analyst.expectNone()
+}
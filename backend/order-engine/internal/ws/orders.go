@@ -0,0 +1,221 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// AccountResolver maps the account of an order request to one of the
+// user's accounts. An empty account ID means the master account.
+type AccountResolver interface {
+	ResolveAccount(ctx context.Context, userID, accountID string) (types.Account, error)
+}
+
+// orderEntry places and cancels orders for the hub's clients
+type orderEntry struct {
+	engine   *matching.MatchingEngine
+	accounts AccountResolver
+	limiter  *ratelimit.MemoryLimiter
+	limit    ratelimit.Limit
+}
+
+// SetOrderEntry enables the order entry actions. Each connection may send
+// order requests at the rate of limit; an unlimited limit disables the
+// throttle. It must be called before Run.
+func (h *Hub) SetOrderEntry(engine *matching.MatchingEngine, accounts AccountResolver, limit ratelimit.Limit) {
+	h.orders = &orderEntry{
+		engine:   engine,
+		accounts: accounts,
+		limiter:  ratelimit.NewMemoryLimiter(),
+		limit:    limit,
+	}
+}
+
+// throttle charges an order request to the connection's bucket
+func (o *orderEntry) throttle(ctx context.Context, c *Client) error {
+	if o.limit.Unlimited() {
+		return nil
+	}
+	result, err := o.limiter.Allow(ctx, c.id, o.limit, 1)
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		return &requestError{
+			code:       CodeThrottled,
+			message:    "too many order requests",
+			retryAfter: result.RetryAfter,
+		}
+	}
+	return nil
+}
+
+// orderResult is the result of an order request and the order's fills
+type orderResult struct {
+	Order *types.Order `json:"order"`
+	Fills []types.Fill `json:"fills"`
+}
+
+// placeOrder validates and places an order like the HTTP API
+func (c *Client) placeOrder(ctx context.Context, req *request) (interface{}, error) {
+	order := &types.Order{
+		ID:            uuid.New().String(),
+		ClientOrderID: req.ClientOrderID,
+		UserID:        c.userID,
+		Symbol:        req.Symbol,
+		Type:          req.Type,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		StopPrice:     req.StopPrice,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := order.Validate(); err != nil {
+		return nil, invalidRequest("%v", err)
+	}
+
+	acct, err := c.hub.orders.accounts.ResolveAccount(ctx, c.userID, req.AccountID)
+	if errors.Is(err, account.ErrAccountNotFound) {
+		return nil, &requestError{code: CodeNotFound, message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: req.Symbol, Account: acct.ID}) {
+		return nil, insufficientScope(auth.ScopeOrdersWrite)
+	}
+	order.AccountID = acct.ID
+
+	trades, err := c.hub.orders.engine.ProcessOrder(order)
+
+	// A rejected market order may already have traded part of its quantity
+
+	result := orderResult{Order: order, Fills: types.OrderFills(order.ID, trades)}
+	if err != nil && order.Status == types.OrderStatusRejected {
+		return result, &requestError{code: CodeRejected, message: err.Error(), rejectReason: order.RejectReason}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cancelOrder cancels one of the caller's resting orders. Cancelling
+// another user's order requires the orders:cancel:any scope.
+func (c *Client) cancelOrder(req *request) (interface{}, error) {
+	if req.OrderID == "" {
+		return nil, invalidRequest("order ID is required")
+	}
+
+	order, err := c.hub.orders.engine.GetOrder(req.OrderID)
+	if err != nil {
+		return nil, errOrderNotFound
+	}
+
+	permission := auth.ScopeOrdersWrite
+	if order.UserID != c.userID {
+		permission = auth.ScopeOrdersCancelAny
+	}
+	if !c.claims.Allows(permission, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+		return nil, errOrderNotFound
+	}
+
+	if err := c.hub.orders.engine.CancelOrder(req.OrderID); err != nil {
+		// The order filled or was cancelled since it was looked up
+		return nil, errOrderNotFound
+	}
+
+	order.Status = types.OrderStatusCancelled
+	order.UpdatedAt = time.Now()
+	return orderResult{Order: &order}, nil
+}
+
+// amendOrder changes the price and total quantity of one of the caller's
+// resting limit orders, like the gRPC API
+func (c *Client) amendOrder(ctx context.Context, req *request) (interface{}, error) {
+	switch {
+	case req.OrderID == "":
+		return nil, invalidRequest("order ID is required")
+	case req.Price <= 0:
+		return nil, invalidRequest("price must be positive")
+	case req.Quantity <= 0:
+		return nil, invalidRequest("quantity must be positive")
+	}
+
+	order, err := c.hub.orders.engine.GetOrder(req.OrderID)
+	if err != nil {
+		return nil, errOrderNotFound
+	}
+	if order.UserID != c.userID ||
+		!c.claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+		return nil, errOrderNotFound
+	}
+	if order.Type != types.LimitOrder {
+		return nil, &requestError{code: CodeRejected, message: "only limit orders can be amended"}
+	}
+	if req.Quantity <= order.FilledQty {
+		return nil, invalidRequest("quantity must exceed the filled quantity %g", order.FilledQty)
+	}
+
+	amended, trades, err := c.hub.orders.engine.AmendOrder(req.OrderID, req.Price, req.Quantity)
+	if err != nil {
+		reqErr := &requestError{code: CodeRejected, message: err.Error()}
+		var rejectErr *matching.RejectError
+		if errors.As(err, &rejectErr) {
+			reqErr.rejectReason = rejectErr.Reason
+		}
+		return nil, reqErr
+	}
+	return orderResult{Order: &amended, Fills: types.OrderFills(amended.ID, trades)}, nil
+}
+
+// cancelAll cancels the caller's resting orders, optionally only those of
+// a symbol or an account. Orders outside the caller's orders:write scope
+// are left alone.
+func (c *Client) cancelAll(ctx context.Context, req *request) (interface{}, error) {
+	accountID := ""
+	if req.AccountID != "" {
+		acct, err := c.hub.orders.accounts.ResolveAccount(ctx, c.userID, req.AccountID)
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return nil, &requestError{code: CodeNotFound, message: err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		accountID = acct.ID
+	}
+
+	cancelled := make([]types.Order, 0)
+	for _, order := range c.hub.orders.engine.GetOrdersByUser(c.userID) {
+		if (req.Symbol != "" && order.Symbol != req.Symbol) || (accountID != "" && order.AccountID != accountID) {
+			continue
+		}
+		if !c.claims.Allows(auth.ScopeOrdersWrite, auth.Resource{Symbol: order.Symbol, Account: order.AccountID}) {
+			continue
+		}
+		if err := c.hub.orders.engine.CancelOrder(order.ID); err != nil {
+			// Filled since it was listed
+			continue
+		}
+		order.Status = types.OrderStatusCancelled
+		order.UpdatedAt = time.Now()
+		cancelled = append(cancelled, order)
+	}
+
+	return struct {
+		Orders []types.Order `json:"orders"`
+	}{
+		Orders: cancelled,
+	}, nil
+}
@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/account"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ratelimit"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// masterAccounts resolves every user's master account and nothing else
+type masterAccounts struct{}
+
+func (masterAccounts) ResolveAccount(ctx context.Context, userID, accountID string) (types.Account, error) {
+	if accountID != "" && accountID != userID {
+		return types.Account{}, account.ErrAccountNotFound
+	}
+	return types.Account{ID: userID, UserID: userID}, nil
+}
+
+func place(requestID string, side types.OrderSide, orderType types.OrderType, price, quantity float64) map[string]interface{} {
+	return map[string]interface{}{
+		"action":     ActionPlaceOrder,
+		"request_id": requestID,
+		"symbol":     "BTC-USD",
+		"side":       side,
+		"type":       orderType,
+		"price":      price,
+		"quantity":   quantity,
+	}
+}
+
+// result returns the order and fills of an order request's answer
+func result(message map[string]interface{}) (map[string]interface{}, []interface{}) {
+	result := message["result"].(map[string]interface{})
+	fills, _ := result["fills"].([]interface{})
+	return result["order"].(map[string]interface{}), fills
+}
+
+func TestOrderEntry(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	hub.SetOrderEntry(matching.NewMatchingEngine(), masterAccounts{}, ratelimit.Limit{})
+	s := serve(t, hub)
+
+	alice, bob := s.dial("alice"), s.dial("bob")
+
+	bob.send(place("resting", types.SellOrder, types.LimitOrder, 100, 1))
+	answer := bob.expect("response")
+	resting, _ := result(answer)
+	if answer["request_id"] != "resting" || answer["action"] != ActionPlaceOrder || resting["status"] != string(types.OrderStatusNew) {
+		t.Fatalf("placing a resting order answered %v", answer)
+	}
+
+	// A market order larger than the book trades what it can and is
+	// rejected with its result
+	alice.send(place("market", types.BuyOrder, types.MarketOrder, 0, 2))
+	rejected := alice.expect("error")
+	if rejected["request_id"] != "market" || rejected["code"] != CodeRejected ||
+		rejected["reject_reason"] != string(types.RejectReasonNoLiquidity) {
+		t.Fatalf("partly filled market order answered %v", rejected)
+	}
+	order, fills := result(rejected)
+	if order["status"] != string(types.OrderStatusRejected) || order["filled_qty"] != 1.0 || len(fills) != 1 {
+		t.Fatalf("rejected order %v with fills %v", order, fills)
+	}
+
+	bob.send(place("again", types.SellOrder, types.LimitOrder, 101, 1))
+	again, _ := result(bob.expect("response"))
+
+	// Other users' orders look missing
+	alice.send(map[string]interface{}{"action": ActionCancelOrder, "request_id": "steal", "order_id": again["id"]})
+	if failed := alice.expect("error"); failed["code"] != CodeNotFound || failed["request_id"] != "steal" {
+		t.Fatalf("cancelling another user's order answered %v", failed)
+	}
+	bob.send(map[string]interface{}{"action": ActionCancelOrder, "order_id": again["id"]})
+	if cancelled, _ := result(bob.expect("response")); cancelled["status"] != string(types.OrderStatusCancelled) {
+		t.Fatalf("cancelled order %v", cancelled)
+	}
+
+	tests := []struct {
+		name string
+		req  map[string]interface{}
+		code string
+	}{
+		{"invalid quantity", place("q", types.BuyOrder, types.LimitOrder, 100, 0), CodeInvalidRequest},
+		{"unknown side", place("s", "HOLD", types.LimitOrder, 100, 1), CodeInvalidRequest},
+		{"unknown account", map[string]interface{}{
+			"action": ActionPlaceOrder, "symbol": "BTC-USD", "side": types.BuyOrder,
+			"type": types.LimitOrder, "price": 100, "quantity": 1, "account_id": "bobs",
+		}, CodeNotFound},
+		{"amend without an order", map[string]interface{}{"action": ActionAmendOrder, "price": 100, "quantity": 1}, CodeInvalidRequest},
+		{"unknown action", map[string]interface{}{"action": "transfer"}, CodeUnknownAction},
+	}
+	for _, tt := range tests {
+		alice.send(tt.req)
+		if failed := alice.expect("error"); failed["code"] != tt.code || failed["error"] == "" || failed["result"] != nil {
+			t.Fatalf("%s answered %v, want %s", tt.name, failed, tt.code)
+		}
+	}
+
+	if err := alice.conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if failed := alice.expect("error"); failed["code"] != CodeInvalidRequest {
+		t.Fatalf("malformed request answered %v", failed)
+	}
+}
+
+func TestOrderEntryDisabledAndThrottled(t *testing.T) {
+	disabled := serve(t, NewHub(zap.NewNop())).dial("alice")
+	disabled.send(place("p", types.BuyOrder, types.LimitOrder, 100, 1))
+	if failed := disabled.expect("error"); failed["code"] != CodeUnknownAction {
+		t.Fatalf("order entry without an engine answered %v", failed)
+	}
+
+	hub := NewHub(zap.NewNop())
+	hub.SetOrderEntry(matching.NewMatchingEngine(), masterAccounts{}, ratelimit.Limit{Rate: 0.1, Burst: 2})
+	s := serve(t, hub)
+	alice := s.dial("alice")
+
+	for i := 0; i < 2; i++ {
+		alice.send(place("p", types.BuyOrder, types.LimitOrder, 100, 1))
+		alice.expect("response")
+	}
+	alice.send(place("p", types.BuyOrder, types.LimitOrder, 100, 1))
+	throttled := alice.expect("error")
+	if retryAfter, _ := throttled["retry_after_ms"].(float64); throttled["code"] != CodeThrottled || retryAfter <= 0 {
+		t.Fatalf("request over the limit answered %v", throttled)
+	}
+
+	// The throttle is per connection
+	other := s.dial("alice")
+	other.send(place("p", types.BuyOrder, types.LimitOrder, 100, 1))
+	other.expect("response")
+}
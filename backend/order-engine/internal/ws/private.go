@@ -0,0 +1,265 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// OrderSource provides the open orders new order subscribers start from
+type OrderSource interface {
+	GetOrdersByUser(userID string) []types.Order
+}
+
+// AccountSource provides the balances and positions new subscribers start
+// from
+type AccountSource interface {
+	Accounts(userID string) []types.Account
+	Balances(accountID string) []types.Balance
+	Positions(accountID string) []types.Position
+}
+
+// SetOrderSource enables the orders channel: subscribers receive their open
+// orders followed by execution reports. It must be called before Run.
+func (h *Hub) SetOrderSource(orders OrderSource) {
+	h.snapshots[ChannelOrders] = func(sub subscription) (uint64, []byte, error) {
+		sequence := h.sequence(sub)
+		data, err := json.Marshal(struct {
+			Type     string        `json:"type"`
+			Sequence uint64        `json:"sequence"`
+			Orders   []types.Order `json:"orders"`
+		}{
+			Type:     "orders",
+			Sequence: sequence,
+			Orders:   orders.GetOrdersByUser(sub.user),
+		})
+		return sequence, data, err
+	}
+}
+
+// SetAccountSource enables the balances and positions channels for every
+// account of the subscriber. It must be called before Run.
+func (h *Hub) SetAccountSource(accounts AccountSource) {
+	h.snapshots[ChannelBalances] = func(sub subscription) (uint64, []byte, error) {
+		sequence := h.sequence(sub)
+		balances := make([]types.Balance, 0)
+		for _, account := range accounts.Accounts(sub.user) {
+			balances = append(balances, accounts.Balances(account.ID)...)
+		}
+		data, err := json.Marshal(struct {
+			Type     string          `json:"type"`
+			Sequence uint64          `json:"sequence"`
+			Balances []types.Balance `json:"balances"`
+		}{
+			Type:     "balances",
+			Sequence: sequence,
+			Balances: balances,
+		})
+		return sequence, data, err
+	}
+	h.snapshots[ChannelPositions] = func(sub subscription) (uint64, []byte, error) {
+		sequence := h.sequence(sub)
+		positions := make([]types.Position, 0)
+		for _, account := range accounts.Accounts(sub.user) {
+			positions = append(positions, accounts.Positions(account.ID)...)
+		}
+		data, err := json.Marshal(struct {
+			Type      string           `json:"type"`
+			Sequence  uint64           `json:"sequence"`
+			Positions []types.Position `json:"positions"`
+		}{
+			Type:      "positions",
+			Sequence:  sequence,
+			Positions: positions,
+		})
+		return sequence, data, err
+	}
+}
+
+// PublishExecutionReport queues an order change for its owner's orders
+// channel. It is meant to be registered as an engine execution listener.
+func (h *Hub) PublishExecutionReport(report types.ExecutionReport) {
+	resource := &auth.Resource{Symbol: report.Symbol, Account: report.AccountID}
+	h.publishSequenced(subscription{channel: ChannelOrders, user: report.UserID}, resource, func(sequence uint64) ([]byte, error) {
+		return json.Marshal(struct {
+			Type     string `json:"type"`
+			Sequence uint64 `json:"sequence"`
+			types.ExecutionReport
+		}{
+			Type:            "execution_report",
+			Sequence:        sequence,
+			ExecutionReport: report,
+		})
+	})
+}
+
+// PublishFills queues both sides of a trade for their owners' fills
+// channels. It is meant to be registered as an engine trade listener.
+func (h *Hub) PublishFills(trade types.Trade) {
+	for _, fill := range trade.Fills() {
+		fill := fill
+		resource := &auth.Resource{Symbol: fill.Symbol, Account: fill.AccountID}
+		h.publishSequenced(subscription{channel: ChannelFills, user: fill.UserID}, resource, func(sequence uint64) ([]byte, error) {
+			return json.Marshal(struct {
+				Type     string `json:"type"`
+				Sequence uint64 `json:"sequence"`
+				types.Fill
+			}{
+				Type:     "fill",
+				Sequence: sequence,
+				Fill:     fill,
+			})
+		})
+	}
+}
+
+// PublishBalance queues a balance change for the owner's balances channel.
+// It is meant to be registered as an account balance listener.
+func (h *Hub) PublishBalance(userID string, balance types.Balance) {
+	resource := &auth.Resource{Account: balance.AccountID}
+	h.publishSequenced(subscription{channel: ChannelBalances, user: userID}, resource, func(sequence uint64) ([]byte, error) {
+		return json.Marshal(struct {
+			Type     string `json:"type"`
+			Sequence uint64 `json:"sequence"`
+			types.Balance
+		}{
+			Type:     "balance",
+			Sequence: sequence,
+			Balance:  balance,
+		})
+	})
+}
+
+// PublishPosition queues a position change for the owner's positions
+// channel. It is meant to be registered as an account position listener.
+func (h *Hub) PublishPosition(userID string, position types.Position) {
+	resource := &auth.Resource{Symbol: position.Symbol, Account: position.AccountID}
+	h.publishSequenced(subscription{channel: ChannelPositions, user: userID}, resource, func(sequence uint64) ([]byte, error) {
+		return json.Marshal(struct {
+			Type     string `json:"type"`
+			Sequence uint64 `json:"sequence"`
+			types.Position
+		}{
+			Type:     "position",
+			Sequence: sequence,
+			Position: position,
+		})
+	})
+}
+
+// publishSequenced numbers an update of a channel numbered by the hub, a
+// symbol's trades or a user's private channel, and queues it for the
+// channel's subscribers. Callers publish each channel's updates in order,
+// e.g. under the engine lock. Private updates carry the resource they are
+// about.
+func (h *Hub) publishSequenced(sub subscription, resource *auth.Resource, message func(sequence uint64) ([]byte, error)) {
+	h.sequenceMutex.Lock()
+	sequence, exists := h.sequences[sub]
+	if !exists {
+		sequence = h.sequenceFloor
+	}
+	sequence++
+	h.sequences[sub] = sequence
+	h.sequenceMutex.Unlock()
+
+	data, err := message(sequence)
+	if err != nil {
+		h.logger.Error("Failed to marshal update",
+			zap.Error(err),
+			zap.String("channel", sub.channel),
+			zap.String("symbol", sub.symbol),
+			zap.String("user_id", sub.user))
+		return
+	}
+	h.publishUpdate(Update{Topic: sub.topic(), Sequence: sequence, Data: data, Resource: resource})
+}
+
+// sequence returns the sequence of the last update of a channel numbered by
+// the hub.
+// Snapshots read it before the state they encode: an update in between is
+// then sent after a snapshot that already includes it, which is harmless
+// as every update carries the full state of what changed.
+func (h *Hub) sequence(sub subscription) uint64 {
+	h.sequenceMutex.Lock()
+	defer h.sequenceMutex.Unlock()
+
+	if sequence, exists := h.sequences[sub]; exists {
+		return sequence
+	}
+	return h.sequenceFloor
+}
+
+// forgetSequence drops the sequence of an idle channel. It is numbered
+// again after every sequence forgotten, so replays from before cannot be
+// mistaken for later updates; clients see a skip, as for events left out.
+func (h *Hub) forgetSequence(sub subscription) {
+	h.sequenceMutex.Lock()
+	defer h.sequenceMutex.Unlock()
+
+	if sequence := h.sequences[sub]; sequence > h.sequenceFloor {
+		h.sequenceFloor = sequence
+	}
+	delete(h.sequences, sub)
+}
+
+// snapshotLists names the list of items in each private channel's snapshot
+var snapshotLists = map[string]string{
+	ChannelOrders:    "orders",
+	ChannelBalances:  "balances",
+	ChannelPositions: "positions",
+}
+
+// allows reports whether the client may be sent a private event on the
+// resource. Events of public channels are always allowed.
+func (c *Client) allows(channel string, r auth.Resource) bool {
+	scope, private := privateScopes[channel]
+	return !private || c.claims.Allows(scope, r)
+}
+
+// filterSnapshot leaves the items the client's scopes do not cover out of
+// a private channel's snapshot. Snapshots may come from another process,
+// so they are filtered where the client is served.
+func (c *Client) filterSnapshot(channel string, data []byte) ([]byte, error) {
+	list, ok := snapshotLists[channel]
+	if !ok {
+		return data, nil
+	}
+
+	var snapshot map[string]json.RawMessage
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode %s snapshot: %w", channel, err)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(snapshot[list], &items); err != nil {
+		return nil, fmt.Errorf("failed to decode %s snapshot: %w", channel, err)
+	}
+
+	kept := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var r struct {
+			Symbol    string `json:"symbol"`
+			AccountID string `json:"account_id"`
+		}
+		if err := json.Unmarshal(item, &r); err != nil {
+			return nil, fmt.Errorf("failed to decode %s snapshot: %w", channel, err)
+		}
+		if c.allows(channel, auth.Resource{Symbol: r.Symbol, Account: r.AccountID}) {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(items) {
+		return data, nil
+	}
+
+	encoded, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	snapshot[list] = encoded
+	return json.Marshal(snapshot)
+}
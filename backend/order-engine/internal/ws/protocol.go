@@ -0,0 +1,204 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// maxMessageSize bounds a client request
+const maxMessageSize = 4096
+
+// Actions a client can request
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionPlaceOrder  = "place_order"
+	ActionCancelOrder = "cancel_order"
+	ActionAmendOrder  = "amend_order"
+	ActionCancelAll   = "cancel_all"
+)
+
+// Error codes of failed requests
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeUnknownAction  = "unknown_action"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeRejected       = "rejected"
+	CodeThrottled      = "throttled"
+	CodeInternal       = "internal_error"
+)
+
+// request is a client message. The request ID is optional and echoed in
+// the response; the other fields depend on the action.
+type request struct {
+	Action    string `json:"action"`
+	RequestID string `json:"request_id"`
+
+	// subscribe and unsubscribe. A subscription with the last sequence the
+	// client received replays the updates it missed instead of starting
+	// from a snapshot.
+	Channel  string  `json:"channel"`
+	SinceSeq *uint64 `json:"since_seq"`
+
+	// Order entry. Symbol also selects the subscription's symbol.
+	Symbol        string          `json:"symbol"`
+	OrderID       string          `json:"order_id"`
+	ClientOrderID string          `json:"client_order_id"`
+	AccountID     string          `json:"account_id"`
+	Type          types.OrderType `json:"type"`
+	Side          types.OrderSide `json:"side"`
+	Price         float64         `json:"price"`
+	Quantity      float64         `json:"quantity"`
+	StopPrice     float64         `json:"stop_price"`
+}
+
+// response answers a request. Failed requests have type "error" and a
+// code; a rejected order still carries its result.
+type response struct {
+	Type         string             `json:"type"`
+	RequestID    string             `json:"request_id,omitempty"`
+	Action       string             `json:"action,omitempty"`
+	Code         string             `json:"code,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	RejectReason types.RejectReason `json:"reject_reason,omitempty"`
+	RetryAfterMs int64              `json:"retry_after_ms,omitempty"`
+	Result       interface{}        `json:"result,omitempty"`
+}
+
+// reply is a response waiting to be queued for its client by the hub
+type reply struct {
+	client *Client
+	data   []byte
+}
+
+// requestError fails a request with a code sent to the client
+type requestError struct {
+	code         string
+	message      string
+	rejectReason types.RejectReason
+	retryAfter   time.Duration
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return &requestError{code: CodeInvalidRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func insufficientScope(scope string) error {
+	return &requestError{code: CodeForbidden, message: "insufficient scope, requires " + scope}
+}
+
+// errClientClosed fails the requests a client sent as it was closed
+var errClientClosed = &requestError{code: CodeInvalidRequest, message: "connection is closing"}
+
+// errOrderNotFound also hides other users' orders
+var errOrderNotFound = &requestError{code: CodeNotFound, message: "order not found"}
+
+// handle runs a request and sends its response
+func (c *Client) handle(ctx context.Context, req *request) {
+	switch req.Action {
+	case ActionSubscribe:
+		// Respond before the snapshot or missed updates are sent
+		sub, err := c.subscribe(req.Channel, req.Symbol, req.SinceSeq != nil)
+		if err != nil {
+			c.respond(req, nil, err)
+			return
+		}
+		c.respond(req, subscriptionResult(sub), nil)
+		if req.SinceSeq != nil {
+			c.replay(sub, *req.SinceSeq)
+		} else {
+			c.sync(sub)
+		}
+
+	case ActionUnsubscribe:
+		sub := c.Unsubscribe(req.Channel, req.Symbol)
+		c.respond(req, subscriptionResult(sub), nil)
+
+	case ActionPlaceOrder, ActionCancelOrder, ActionAmendOrder, ActionCancelAll:
+		if c.hub.orders == nil {
+			c.respond(req, nil, &requestError{code: CodeUnknownAction, message: "order entry is not enabled"})
+			return
+		}
+		if err := c.hub.orders.throttle(ctx, c); err != nil {
+			c.respond(req, nil, err)
+			return
+		}
+
+		var result interface{}
+		var err error
+		switch req.Action {
+		case ActionPlaceOrder:
+			result, err = c.placeOrder(ctx, req)
+		case ActionCancelOrder:
+			result, err = c.cancelOrder(req)
+		case ActionAmendOrder:
+			result, err = c.amendOrder(ctx, req)
+		case ActionCancelAll:
+			result, err = c.cancelAll(ctx, req)
+		}
+		c.respond(req, result, err)
+
+	default:
+		c.respond(req, nil, &requestError{code: CodeUnknownAction, message: fmt.Sprintf("unknown action %q", req.Action)})
+	}
+}
+
+// respond queues the response to a request. Errors other than request
+// errors are logged and reported without their details.
+func (c *Client) respond(req *request, result interface{}, err error) {
+	resp := response{
+		Type:      "response",
+		RequestID: req.RequestID,
+		Action:    req.Action,
+		Result:    result,
+	}
+	if err != nil {
+		resp.Type = "error"
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			resp.Code = reqErr.code
+			resp.Error = reqErr.message
+			resp.RejectReason = reqErr.rejectReason
+			resp.RetryAfterMs = reqErr.retryAfter.Milliseconds()
+		} else {
+			c.hub.logger.Error("Failed to handle request",
+				zap.Error(err),
+				zap.String("user_id", c.userID),
+				zap.String("action", req.Action))
+			resp.Code = CodeInternal
+			resp.Error = "internal error"
+			resp.Result = nil
+		}
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		c.hub.logger.Error("Failed to marshal response",
+			zap.Error(err),
+			zap.String("user_id", c.userID))
+		return
+	}
+	c.hub.replies <- reply{client: c, data: data}
+}
+
+func subscriptionResult(sub subscription) interface{} {
+	return struct {
+		Channel string `json:"channel"`
+		Symbol  string `json:"symbol,omitempty"`
+	}{
+		Channel: sub.channel,
+		Symbol:  sub.symbol,
+	}
+}
@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+)
+
+// ErrNoSnapshot is returned for snapshots of channels the hub has no
+// source for
+var ErrNoSnapshot = errors.New("channel has no snapshot")
+
+// Topic is a channel of a symbol, or a private channel of a user, as
+// relayed between the processes publishing updates and the hubs serving
+// them
+type Topic struct {
+	Channel string
+	Symbol  string
+	UserID  string
+}
+
+// Update is an encoded message of a topic. Updates without a sequence are
+// events, such as market channel trades. Resource is what a private update
+// is about; it is left out for clients whose scopes do not cover it.
+type Update struct {
+	Topic
+	Sequence uint64
+	Data     []byte
+	Resource *auth.Resource
+}
+
+// InterestListener is told when a hub's clients first subscribe to a topic
+// and when the last of them leaves. A failure to gain interest fails the
+// subscription. It is called with the subscribing client locked and must
+// not block.
+type InterestListener func(topic Topic, interested bool) error
+
+// RemoteSnapshot takes the snapshot of a topic from the process publishing
+// its updates
+type RemoteSnapshot func(topic Topic) (uint64, []byte, error)
+
+func (u Update) message() channelMessage {
+	return channelMessage{
+		subscription: u.Topic.subscription(),
+		sequence:     u.Sequence,
+		data:         u.Data,
+		resource:     u.Resource,
+	}
+}
+
+func (s subscription) topic() Topic {
+	return Topic{Channel: s.channel, Symbol: s.symbol, UserID: s.user}
+}
+
+func (t Topic) subscription() subscription {
+	return subscription{channel: t.Channel, symbol: t.Symbol, user: t.UserID}
+}
+
+// SetRelay forwards every update published on the hub, e.g. to gateways
+// serving clients in other processes. relay is called by the publisher, in
+// order, and must not block. It must be called before Run.
+func (h *Hub) SetRelay(relay func(update Update)) {
+	h.relay = relay
+}
+
+// SetInterestListener reports the topics the hub's clients are subscribed
+// to, e.g. to receive only their updates from other processes. It must be
+// called before Run.
+func (h *Hub) SetInterestListener(listener InterestListener) {
+	h.interestListener = listener
+}
+
+// SetRemoteSnapshot takes the snapshots of every channel from another
+// process, replacing any local source. It must be called before Run.
+func (h *Hub) SetRemoteSnapshot(snapshot RemoteSnapshot) {
+	for channel := range channels {
+		h.snapshots[channel] = func(sub subscription) (uint64, []byte, error) {
+			return snapshot(sub.topic())
+		}
+	}
+}
+
+// Publish queues an update relayed from another process for the hub's
+// clients. Updates of a topic must be published in order.
+func (h *Hub) Publish(update Update) {
+	h.messages <- update.message()
+}
+
+// Snapshot encodes the current state of a topic as sent to a new
+// subscriber, with the sequence its updates continue from
+func (h *Hub) Snapshot(topic Topic) (uint64, []byte, error) {
+	snapshot, ok := h.snapshots[topic.Channel]
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNoSnapshot, topic.Channel)
+	}
+	return snapshot(topic.subscription())
+}
+
+// addInterest counts a client's new subscription and reports whether it
+// is the first to the topic
+func (h *Hub) addInterest(sub subscription) (bool, error) {
+	if h.interestListener == nil {
+		return false, nil
+	}
+	h.interestMutex.Lock()
+	defer h.interestMutex.Unlock()
+
+	if h.interest[sub] == 0 {
+		if err := h.interestListener(sub.topic(), true); err != nil {
+			return false, err
+		}
+	}
+	h.interest[sub]++
+	return h.interest[sub] == 1, nil
+}
+
+// removeInterest counts a subscription that ended
+func (h *Hub) removeInterest(sub subscription) {
+	if h.interestListener == nil {
+		return
+	}
+	h.interestMutex.Lock()
+	defer h.interestMutex.Unlock()
+
+	h.interest[sub]--
+	if h.interest[sub] > 0 {
+		return
+	}
+	delete(h.interest, sub)
+	if err := h.interestListener(sub.topic(), false); err != nil {
+		h.logger.Error("Failed to drop interest in topic",
+			zap.Error(err),
+			zap.String("channel", sub.channel),
+			zap.String("symbol", sub.symbol),
+			zap.String("user_id", sub.user))
+	}
+}
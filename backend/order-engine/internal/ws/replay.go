@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// historySize bounds the recent updates kept per channel for replay
+	historySize = 1024
+	// historyIdleTimeout is how long a channel without subscribers keeps
+	// its history after its last update
+	historyIdleTimeout = 10 * time.Minute
+	// historySweepInterval is how often idle histories are forgotten
+	historySweepInterval = time.Minute
+)
+
+// history is a ring buffer of a channel's latest updates, oldest first
+type history struct {
+	messages []channelMessage
+	start    int
+	// evicted is the sequence of the newest update no longer kept
+	evicted uint64
+	// updated is when the last update was kept
+	updated time.Time
+}
+
+// add keeps an update, evicting the oldest one when the history is full
+func (r *history) add(message channelMessage) {
+	if len(r.messages) < historySize {
+		r.messages = append(r.messages, message)
+		return
+	}
+	r.evicted = r.messages[r.start].sequence
+	r.messages[r.start] = message
+	r.start = (r.start + 1) % historySize
+}
+
+// reset treats every kept update as evicted
+func (r *history) reset() {
+	if n := len(r.messages); n > 0 {
+		r.evicted = r.messages[(r.start+n-1)%n].sequence
+	}
+	r.messages = nil
+	r.start = 0
+}
+
+// since returns the updates after a sequence. It fails when some of them
+// are no longer kept or the sequence is newer than any update, e.g. from
+// before a restart.
+func (r *history) since(sequence uint64) ([]channelMessage, bool) {
+	n := len(r.messages)
+	if n == 0 || sequence < r.evicted || sequence > r.messages[(r.start+n-1)%n].sequence {
+		return nil, false
+	}
+
+	missed := make([]channelMessage, 0)
+	for i := 0; i < n; i++ {
+		message := r.messages[(r.start+i)%n]
+		if message.sequence > sequence {
+			missed = append(missed, message)
+		}
+	}
+	return missed, true
+}
+
+// channelReplay is a client's subscription to a channel from the last
+// sequence it received
+type channelReplay struct {
+	subscription
+	client *Client
+	since  uint64
+}
+
+// record keeps a sequenced update for replay. A new history knows nothing
+// before its first update, e.g. after an idle one was forgotten. It is
+// called by Run.
+func (h *Hub) record(message channelMessage, now time.Time) {
+	r := h.history[message.subscription]
+	if r == nil {
+		r = &history{evicted: message.sequence - 1}
+		h.history[message.subscription] = r
+	}
+	r.add(message)
+	r.updated = now
+}
+
+// forgetIdle drops the histories of channels without subscribers that had
+// no update for historyIdleTimeout, and the sequences of such private
+// channels, so users and symbols no longer followed do not hold memory. It
+// is called by Run.
+func (h *Hub) forgetIdle(now time.Time) {
+	subscribed := make(map[subscription]bool)
+	for client := range h.clients {
+		client.mu.RLock()
+		for sub := range client.subscriptions {
+			subscribed[sub] = true
+		}
+		client.mu.RUnlock()
+	}
+
+	for sub, r := range h.history {
+		if subscribed[sub] || now.Sub(r.updated) < historyIdleTimeout {
+			continue
+		}
+		delete(h.history, sub)
+		if sub.user != "" {
+			h.forgetSequence(sub)
+		}
+	}
+}
+
+// resetHistory stops replaying a channel's kept updates, e.g. when a gap
+// may follow them. It is called by Run.
+func (h *Hub) resetHistory(sub subscription) {
+	if r := h.history[sub]; r != nil {
+		r.reset()
+	}
+}
+
+// replay sends a client the updates it missed since a sequence. When they
+// are no longer kept it is told to start from a snapshot instead, which is
+// sent if the channel has one.
+func (c *Client) replay(sub subscription, since uint64) {
+	c.hub.replays <- channelReplay{subscription: sub, client: c, since: since}
+}
+
+// replay completes a replay request. It is called by Run.
+func (h *Hub) replay(replay channelReplay) {
+	// Updates held back since the subscription was added are all in the
+	// history
+	delete(h.pending[replay.client], replay.subscription)
+	if !replay.client.subscribed(replay.subscription) {
+		return
+	}
+
+	var missed []channelMessage
+	ok := false
+	if r := h.history[replay.subscription]; r != nil {
+		missed, ok = r.since(replay.since)
+	}
+	if ok {
+		for _, message := range missed {
+			h.deliver(replay.client, message)
+		}
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		Type     string `json:"type"`
+		Channel  string `json:"channel"`
+		Symbol   string `json:"symbol,omitempty"`
+		SinceSeq uint64 `json:"since_seq"`
+	}{
+		Type:     "snapshot_required",
+		Channel:  replay.channel,
+		Symbol:   replay.symbol,
+		SinceSeq: replay.since,
+	})
+	if err != nil {
+		h.logger.Error("Failed to marshal snapshot notice",
+			zap.Error(err),
+			zap.String("channel", replay.channel))
+		return
+	}
+	h.deliver(replay.client, channelMessage{data: data})
+	h.resync(replay.client, replay.subscription)
+}
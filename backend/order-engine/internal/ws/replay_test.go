@@ -0,0 +1,160 @@
+package ws
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// publish numbers an update of a channel and keeps it as Run would
+func publish(h *Hub, sub subscription, now time.Time) uint64 {
+	h.publishSequenced(sub, nil, func(sequence uint64) ([]byte, error) {
+		return []byte(`{}`), nil
+	})
+	message := <-h.messages
+	h.record(message, now)
+	return message.sequence
+}
+
+func TestHubForgetsIdleChannels(t *testing.T) {
+	h := NewHub(zap.NewNop())
+	start := time.Now()
+
+	orders := subscription{channel: ChannelOrders, user: "user-1"}
+	followed := subscription{channel: ChannelOrders, user: "user-2"}
+	trades := subscription{channel: ChannelTrades, symbol: "BTC-USD"}
+	for i := 0; i < 3; i++ {
+		publish(h, orders, start)
+		publish(h, followed, start)
+		publish(h, trades, start)
+	}
+	h.clients[&Client{subscriptions: map[subscription]bool{followed: true}}] = true
+
+	h.forgetIdle(start.Add(historyIdleTimeout / 2))
+	if len(h.history) != 3 {
+		t.Fatalf("%d histories kept before the timeout, want 3", len(h.history))
+	}
+
+	h.forgetIdle(start.Add(historyIdleTimeout))
+	if _, kept := h.history[orders]; kept {
+		t.Fatal("idle private history kept")
+	}
+	if _, kept := h.history[trades]; kept {
+		t.Fatal("idle trades history kept")
+	}
+	if _, kept := h.history[followed]; !kept {
+		t.Fatal("history of a followed channel forgotten")
+	}
+	if _, kept := h.sequences[orders]; kept {
+		t.Fatal("idle private sequence kept")
+	}
+
+	// Symbols keep their numbering, as gateways may still follow them
+	if sequence := publish(h, trades, start); sequence != 4 {
+		t.Fatalf("trade numbered %d, want 4", sequence)
+	}
+
+	// The forgotten channel is numbered again after what was forgotten,
+	// and replays from before it need a snapshot
+	if sequence := publish(h, orders, start); sequence != 4 {
+		t.Fatalf("order update numbered %d, want 4", sequence)
+	}
+	if _, ok := h.history[orders].since(2); ok {
+		t.Fatal("replayed updates that were forgotten")
+	}
+	missed, ok := h.history[orders].since(3)
+	if !ok || len(missed) != 1 || missed[0].sequence != 4 {
+		t.Fatalf("replay since 3 is %v, %v; want update 4", missed, ok)
+	}
+}
+
+func TestHistoryEvictsOldestUpdates(t *testing.T) {
+	r := &history{}
+	for sequence := uint64(1); sequence <= historySize+5; sequence++ {
+		r.add(channelMessage{sequence: sequence})
+	}
+
+	if _, ok := r.since(4); ok {
+		t.Fatal("replayed from an evicted update")
+	}
+	missed, ok := r.since(5)
+	if !ok || len(missed) != historySize || missed[0].sequence != 6 || missed[len(missed)-1].sequence != historySize+5 {
+		t.Fatalf("replay since the newest evicted update is %d updates, %v", len(missed), ok)
+	}
+	if missed, ok := r.since(historySize + 5); !ok || len(missed) != 0 {
+		t.Fatalf("replay since the last update is %v, %v; want nothing", missed, ok)
+	}
+	if _, ok := r.since(historySize + 6); ok {
+		t.Fatal("replayed from a sequence newer than any update")
+	}
+
+	r.reset()
+	if _, ok := r.since(historySize + 5); ok {
+		t.Fatal("replayed after a reset")
+	}
+}
+
+func publishTrades(h *Hub, from, to int) {
+	for i := from; i <= to; i++ {
+		h.PublishTrade(types.Trade{ID: fmt.Sprintf("t%d", i), Symbol: "BTC-USD", Price: 100, Quantity: 1})
+	}
+}
+
+// expectTrades checks that the next messages are the trades numbered from
+// first to last
+func (c *client) expectTrades(first, last int) {
+	c.t.Helper()
+	for i := first; i <= last; i++ {
+		if trade := c.expect("trade"); trade["sequence"] != float64(i) || trade["id"] != fmt.Sprintf("t%d", i) {
+			c.t.Fatalf("got trade %v, want t%d", trade, i)
+		}
+	}
+}
+
+func TestSubscribeSinceSequence(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	s := serve(t, hub)
+
+	live := s.dial("alice")
+	live.send(map[string]interface{}{"action": "subscribe", "channel": ChannelTrades, "symbol": "BTC-USD"})
+	live.expect("response")
+	live.expect("trades")
+	publishTrades(hub, 1, 3)
+	live.expectTrades(1, 3)
+
+	// A client that received trade 1 is sent what it missed, without a
+	// snapshot, and then the live trades
+	resumed := s.dial("bob")
+	resumed.send(map[string]interface{}{"action": "subscribe", "channel": ChannelTrades, "symbol": "BTC-USD", "since_seq": 1})
+	resumed.expect("response")
+	resumed.expectTrades(2, 3)
+	publishTrades(hub, 4, 4)
+	resumed.expectTrades(4, 4)
+	resumed.expectNone()
+	live.expectTrades(4, 4)
+
+	// A sequence the hub cannot replay from needs a snapshot, which is sent
+	stale := s.dial("carol")
+	stale.send(map[string]interface{}{"action": "subscribe", "channel": ChannelTrades, "symbol": "BTC-USD", "since_seq": 10})
+	stale.expect("response")
+	notice := stale.expect("snapshot_required")
+	if notice["channel"] != ChannelTrades || notice["symbol"] != "BTC-USD" || notice["since_seq"] != 10.0 {
+		t.Fatalf("snapshot notice %v", notice)
+	}
+	if snapshot := stale.expect("trades"); snapshot["sequence"] != 4.0 {
+		t.Fatalf("snapshot %v, want sequence 4", snapshot)
+	}
+	publishTrades(hub, 5, 5)
+	stale.expectTrades(5, 5)
+
+	// Channels without history need a snapshot too
+	unknown := s.dial("dave")
+	unknown.send(map[string]interface{}{"action": "subscribe", "channel": ChannelTrades, "symbol": "ETH-USD", "since_seq": 0})
+	unknown.expect("response")
+	unknown.expect("snapshot_required")
+	unknown.expect("trades")
+}
@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// TickerSource provides the tickers new subscribers start from
+type TickerSource interface {
+	Get(symbol string) (types.Ticker, error)
+}
+
+// SetTickerSource enables the ticker channel. It must be called before Run.
+func (h *Hub) SetTickerSource(tickers TickerSource) {
+	h.snapshots[ChannelTicker] = func(sub subscription) (uint64, []byte, error) {
+		ticker, err := tickers.Get(sub.symbol)
+		if err != nil {
+			// Symbols without trades yet have an empty ticker
+			ticker = types.Ticker{Symbol: sub.symbol}
+		}
+		data, err := tickerMessage(ticker)
+		return ticker.Sequence, data, err
+	}
+}
+
+// PublishTicker queues a ticker change for the ticker channel. It is meant
+// to be registered as a ticker listener and only blocks if the hub falls
+// behind.
+func (h *Hub) PublishTicker(ticker types.Ticker) {
+	data, err := tickerMessage(ticker)
+	if err != nil {
+		h.logger.Error("Failed to marshal ticker", zap.Error(err), zap.String("symbol", ticker.Symbol))
+		return
+	}
+	h.publish(subscription{channel: ChannelTicker, symbol: ticker.Symbol}, ticker.Sequence, data)
+}
+
+// tickerMessage encodes a ticker. Every message carries the full ticker.
+func tickerMessage(ticker types.Ticker) ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		types.Ticker
+	}{
+		Type:   "ticker",
+		Ticker: ticker,
+	})
+}
@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// tradesSnapshot starts the trades channel of a symbol. It carries no
+// trades, only the sequence the channel continues from; recent trades are
+// served by the HTTP API.
+func (h *Hub) tradesSnapshot(sub subscription) (uint64, []byte, error) {
+	sequence := h.sequence(sub)
+	data, err := json.Marshal(struct {
+		Type     string `json:"type"`
+		Symbol   string `json:"symbol"`
+		Sequence uint64 `json:"sequence"`
+	}{
+		Type:     "trades",
+		Symbol:   sub.symbol,
+		Sequence: sequence,
+	})
+	return sequence, data, err
+}
+
+// PublishTrade numbers a trade and queues it for the trades channel of its
+// symbol. It is meant to be registered as an engine trade listener.
+func (h *Hub) PublishTrade(trade types.Trade) {
+	h.publishSequenced(subscription{channel: ChannelTrades, symbol: trade.Symbol}, nil, func(sequence uint64) ([]byte, error) {
+		return json.Marshal(struct {
+			Type      string          `json:"type"`
+			Sequence  uint64          `json:"sequence"`
+			ID        string          `json:"id"`
+			Symbol    string          `json:"symbol"`
+			Price     float64         `json:"price"`
+			Quantity  float64         `json:"quantity"`
+			TakerSide types.OrderSide `json:"taker_side"`
+			Timestamp time.Time       `json:"timestamp"`
+		}{
+			Type:      "trade",
+			Sequence:  sequence,
+			ID:        trade.ID,
+			Symbol:    trade.Symbol,
+			Price:     trade.Price,
+			Quantity:  trade.Quantity,
+			TakerSide: trade.TakerSide,
+			Timestamp: trade.ExecutedAt,
+		})
+	})
+}
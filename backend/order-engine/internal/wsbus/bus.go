@@ -0,0 +1,122 @@
+// Package wsbus carries WebSocket updates over NATS from the server, which
+// runs the matching engine, to ws-gateway processes serving the clients.
+//
+// Updates are published on one subject per symbol and channel and one per
+// user and channel:
+//
+//	ws.symbol.<symbol>.<channel>
+//	ws.user.<user>.<channel>
+//
+// with their sequence in the Sequence header. Gateways request snapshots
+// on the same subjects under ws.snapshot. Users whose connections must be
+// closed, e.g. after a revocation, are announced with the reason on
+//
+//	ws.user.<user>.disconnect
+package wsbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+)
+
+const (
+	subjectPrefix  = "ws."
+	snapshotPrefix = "ws.snapshot."
+	// disconnectChannel is the private channel announcing disconnects
+	disconnectChannel = "disconnect"
+
+	sequenceHeader = "Sequence"
+	errorHeader    = "Error"
+	// Private updates carry the symbol and account they are about
+	symbolHeader  = "Symbol"
+	accountHeader = "Account"
+)
+
+// Connect connects to NATS, logging disconnects and reconnects
+func Connect(url, username, password, name string, logger *zap.Logger) (*nats.Conn, error) {
+	options := []nats.Option{
+		nats.Name(name),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn("Disconnected from NATS", zap.Error(err))
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info("Reconnected to NATS", zap.String("url", conn.ConnectedUrl()))
+		}),
+	}
+	if username != "" {
+		options = append(options, nats.UserInfo(username, password))
+	}
+
+	conn, err := nats.Connect(url, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return conn, nil
+}
+
+// subject returns the subject of a topic's updates, without the prefix
+func subject(topic ws.Topic) (string, error) {
+	kind, id := "symbol", topic.Symbol
+	if topic.UserID != "" {
+		kind, id = "user", topic.UserID
+	}
+	for _, token := range []string{id, topic.Channel} {
+		if token == "" || strings.ContainsAny(token, ".*> \t\r\n") {
+			return "", fmt.Errorf("invalid subject token %q", token)
+		}
+	}
+	return kind + "." + id + "." + topic.Channel, nil
+}
+
+// parseSubject is the inverse of subject
+func parseSubject(subject string) (ws.Topic, error) {
+	tokens := strings.Split(subject, ".")
+	if len(tokens) != 3 {
+		return ws.Topic{}, fmt.Errorf("invalid subject %q", subject)
+	}
+	switch tokens[0] {
+	case "symbol":
+		return ws.Topic{Channel: tokens[2], Symbol: tokens[1]}, nil
+	case "user":
+		return ws.Topic{Channel: tokens[2], UserID: tokens[1]}, nil
+	}
+	return ws.Topic{}, fmt.Errorf("invalid subject %q", subject)
+}
+
+func setSequence(msg *nats.Msg, sequence uint64) {
+	msg.Header.Set(sequenceHeader, strconv.FormatUint(sequence, 10))
+}
+
+func sequence(msg *nats.Msg) (uint64, error) {
+	value := msg.Header.Get(sequenceHeader)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func setResource(msg *nats.Msg, resource *auth.Resource) {
+	if resource == nil {
+		return
+	}
+	msg.Header.Set(symbolHeader, resource.Symbol)
+	msg.Header.Set(accountHeader, resource.Account)
+}
+
+// resource returns the resource of a private update, or nil
+func resource(msg *nats.Msg) *auth.Resource {
+	_, hasSymbol := msg.Header[symbolHeader]
+	_, hasAccount := msg.Header[accountHeader]
+	if !hasSymbol && !hasAccount {
+		return nil
+	}
+	return &auth.Resource{Symbol: msg.Header.Get(symbolHeader), Account: msg.Header.Get(accountHeader)}
+}
@@ -0,0 +1,100 @@
+package wsbus
+
+import (
+	"errors"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+)
+
+// Publisher relays the updates of the server's hub to NATS and answers
+// the gateways' snapshot requests from it
+type Publisher struct {
+	conn   *nats.Conn
+	hub    *ws.Hub
+	logger *zap.Logger
+}
+
+func NewPublisher(conn *nats.Conn, hub *ws.Hub, logger *zap.Logger) *Publisher {
+	return &Publisher{
+		conn:   conn,
+		hub:    hub,
+		logger: logger,
+	}
+}
+
+// Publish sends an update to its topic's subject. It is meant to be set as
+// the hub's relay; NATS buffers it without blocking.
+func (p *Publisher) Publish(update ws.Update) {
+	subject, err := subject(update.Topic)
+	if err != nil {
+		p.logger.Warn("Skipped update without a valid subject",
+			zap.Error(err),
+			zap.String("channel", update.Channel))
+		return
+	}
+
+	msg := nats.NewMsg(subjectPrefix + subject)
+	msg.Data = update.Data
+	setSequence(msg, update.Sequence)
+	setResource(msg, update.Resource)
+	if err := p.conn.PublishMsg(msg); err != nil {
+		p.logger.Error("Failed to publish update",
+			zap.Error(err),
+			zap.String("subject", msg.Subject))
+	}
+}
+
+// DisconnectUser tells the gateways to close every connection of the user.
+// It is meant to be registered as a disconnector next to the server's own
+// and reports no connections, as the gateways close them.
+func (p *Publisher) DisconnectUser(userID, reason string) int {
+	subject, err := subject(ws.Topic{Channel: disconnectChannel, UserID: userID})
+	if err != nil {
+		p.logger.Warn("Skipped disconnect without a valid subject",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		return 0
+	}
+	if err := p.conn.Publish(subjectPrefix+subject, []byte(reason)); err != nil {
+		p.logger.Error("Failed to publish disconnect",
+			zap.Error(err),
+			zap.String("user_id", userID))
+	}
+	return 0
+}
+
+// ServeSnapshots answers snapshot requests until the returned subscription
+// is unsubscribed or the connection drained
+func (p *Publisher) ServeSnapshots() (*nats.Subscription, error) {
+	return p.conn.Subscribe(snapshotPrefix+">", p.respond)
+}
+
+func (p *Publisher) respond(req *nats.Msg) {
+	reply := nats.NewMsg(req.Reply)
+
+	topic, err := parseSubject(req.Subject[len(snapshotPrefix):])
+	var sequence uint64
+	if err == nil {
+		sequence, reply.Data, err = p.hub.Snapshot(topic)
+	}
+	if err != nil {
+		if !errors.Is(err, ws.ErrNoSnapshot) {
+			p.logger.Error("Failed to take snapshot",
+				zap.Error(err),
+				zap.String("subject", req.Subject))
+		}
+		reply.Data = nil
+		reply.Header.Set(errorHeader, err.Error())
+	} else {
+		setSequence(reply, sequence)
+	}
+
+	if err := req.RespondMsg(reply); err != nil {
+		p.logger.Error("Failed to answer snapshot request",
+			zap.Error(err),
+			zap.String("subject", req.Subject))
+	}
+}
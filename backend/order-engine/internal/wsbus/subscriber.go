@@ -0,0 +1,133 @@
+package wsbus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+)
+
+// Subscriber feeds a gateway's hub with the updates of the topics its
+// clients are subscribed to, and takes their snapshots from the server
+type Subscriber struct {
+	conn    *nats.Conn
+	hub     *ws.Hub
+	timeout time.Duration
+	logger  *zap.Logger
+
+	// subscriptions is only touched by SetInterest, which the hub calls
+	// one topic change at a time
+	subscriptions map[ws.Topic]*nats.Subscription
+}
+
+func NewSubscriber(conn *nats.Conn, hub *ws.Hub, timeout time.Duration, logger *zap.Logger) *Subscriber {
+	return &Subscriber{
+		conn:          conn,
+		hub:           hub,
+		timeout:       timeout,
+		logger:        logger,
+		subscriptions: make(map[ws.Topic]*nats.Subscription),
+	}
+}
+
+// SetInterest subscribes to a topic's subject while the hub has clients for
+// it. It is meant to be the hub's interest listener.
+//
+// Subscribing only queues the request on the connection, so it does not
+// block; the snapshot requested next on the same connection reaches the
+// server after it, so no update between the two is lost.
+func (s *Subscriber) SetInterest(topic ws.Topic, interested bool) error {
+	if !interested {
+		sub := s.subscriptions[topic]
+		delete(s.subscriptions, topic)
+		if sub == nil {
+			return nil
+		}
+		return sub.Unsubscribe()
+	}
+
+	subject, err := subject(topic)
+	if err != nil {
+		return err
+	}
+	sub, err := s.conn.Subscribe(subjectPrefix+subject, func(msg *nats.Msg) {
+		s.deliver(topic, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+	s.subscriptions[topic] = sub
+	return nil
+}
+
+func (s *Subscriber) deliver(topic ws.Topic, msg *nats.Msg) {
+	sequence, err := sequence(msg)
+	if err != nil {
+		s.logger.Error("Skipped update with an invalid sequence",
+			zap.Error(err),
+			zap.String("subject", msg.Subject))
+		return
+	}
+	s.hub.Publish(ws.Update{Topic: topic, Sequence: sequence, Data: msg.Data, Resource: resource(msg)})
+}
+
+// Snapshot requests a topic's snapshot from the server. It is meant to be
+// the hub's remote snapshot.
+func (s *Subscriber) Snapshot(topic ws.Topic) (uint64, []byte, error) {
+	subject, err := subject(topic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reply, err := s.conn.RequestMsg(nats.NewMsg(snapshotPrefix+subject), s.timeout)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to request snapshot of %s: %w", subject, err)
+	}
+	if message := reply.Header.Get(errorHeader); message != "" {
+		return 0, nil, errors.New(message)
+	}
+	sequence, err := sequence(reply)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read snapshot of %s: %w", subject, err)
+	}
+	return sequence, reply.Data, nil
+}
+
+// SubscribeUsers calls fn with the updates of a private channel of every
+// user, e.g. for a FIX gateway following the orders it entered. fn is called
+// from one goroutine, in the order the updates were published.
+func SubscribeUsers(conn *nats.Conn, channel string, fn func(update ws.Update), logger *zap.Logger) (*nats.Subscription, error) {
+	sub, err := conn.Subscribe(subjectPrefix+"user.*."+channel, func(msg *nats.Msg) {
+		topic, err := parseSubject(msg.Subject[len(subjectPrefix):])
+		if err != nil {
+			logger.Error("Skipped update with an invalid subject",
+				zap.Error(err),
+				zap.String("subject", msg.Subject))
+			return
+		}
+		sequence, err := sequence(msg)
+		if err != nil {
+			logger.Error("Skipped update with an invalid sequence",
+				zap.Error(err),
+				zap.String("subject", msg.Subject))
+			return
+		}
+		fn(ws.Update{Topic: topic, Sequence: sequence, Data: msg.Data, Resource: resource(msg)})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s of every user: %w", channel, err)
+	}
+	return sub, nil
+}
+
+// SubscribeDisconnects calls disconnect for every user the server asks
+// gateways to disconnect, e.g. with a hub's or FIX acceptor's DisconnectUser
+func SubscribeDisconnects(conn *nats.Conn, disconnect func(userID, reason string) int, logger *zap.Logger) (*nats.Subscription, error) {
+	return SubscribeUsers(conn, disconnectChannel, func(update ws.Update) {
+		disconnect(update.UserID, string(update.Data))
+	}, logger)
+}
@@ -0,0 +1,439 @@
+package wsbus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/auth"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/internal/ws"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/matching"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// runNATS starts an embedded NATS server on a free port
+func runNATS(t *testing.T) *server.Server {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func connect(t *testing.T, url string) *nats.Conn {
+	conn, err := Connect(url, "", "", t.Name(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// runEngine runs a matching engine whose hub relays its updates to NATS
+func runEngine(t *testing.T, url string) *matching.MatchingEngine {
+	engine := matching.NewMatchingEngine()
+	hub := ws.NewHub(zap.NewNop())
+	publisher := NewPublisher(connect(t, url), hub, zap.NewNop())
+	hub.SetRelay(publisher.Publish)
+
+	hub.SetBookSource(engine)
+	engine.AddBookListener(hub.PublishBookUpdate)
+	engine.AddTradeListener(hub.PublishTrade)
+	hub.SetOrderSource(engine)
+	engine.AddExecutionListener(hub.PublishExecutionReport)
+
+	if _, err := publisher.ServeSnapshots(); err != nil {
+		t.Fatalf("serve snapshots: %v", err)
+	}
+	go hub.Run()
+	return engine
+}
+
+type gateway struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+// runGateway runs a gateway hub fed from NATS behind a WebSocket server
+func runGateway(t *testing.T, url string) *gateway {
+	hub := ws.NewHub(zap.NewNop())
+	conn := connect(t, url)
+	subscriber := NewSubscriber(conn, hub, 5*time.Second, zap.NewNop())
+	hub.SetInterestListener(subscriber.SetInterest)
+	hub.SetRemoteSnapshot(subscriber.Snapshot)
+	if _, err := SubscribeDisconnects(conn, hub.DisconnectUser, zap.NewNop()); err != nil {
+		t.Fatalf("subscribe to disconnects: %v", err)
+	}
+	go hub.Run()
+
+	g := &gateway{t: t}
+	g.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &auth.Claims{UserID: r.URL.Query().Get("user"), Role: auth.RoleTrader, Scopes: r.URL.Query()["scope"]}
+		auth.DefaultPolicy().Apply(claims)
+		ws.NewHandler(hub, claims).ServeWS(w, r)
+	}))
+	t.Cleanup(g.server.Close)
+	return g
+}
+
+// subscribers counts the NATS subscriptions matching a subject, waiting
+// for up to a second for it to reach want
+func subscribers(t *testing.T, srv *server.Server, subject string, want int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		subsz, err := srv.Subsz(&server.SubszOptions{Subscriptions: true, Test: subject})
+		if err != nil {
+			t.Fatalf("subsz: %v", err)
+		}
+		if subsz.Total == want || time.Now().After(deadline) {
+			return subsz.Total
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type client struct {
+	t        *testing.T
+	conn     *websocket.Conn
+	messages chan map[string]interface{}
+}
+
+func (g *gateway) dial(userID string, scopes ...string) *client {
+	query := url.Values{"user": {userID}, "scope": scopes}
+	address := "ws" + strings.TrimPrefix(g.server.URL, "http") + "?" + query.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+	if err != nil {
+		g.t.Fatalf("dial: %v", err)
+	}
+	c := &client{t: g.t, conn: conn, messages: make(chan map[string]interface{}, 100)}
+	go func() {
+		defer close(c.messages)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message map[string]interface{}
+			if err := json.Unmarshal(data, &message); err == nil {
+				c.messages <- message
+			}
+		}
+	}()
+	g.t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+func (c *client) send(req map[string]interface{}) {
+	if err := c.conn.WriteJSON(req); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// expect returns the next message, which must have the given type
+func (c *client) expect(messageType string) map[string]interface{} {
+	c.t.Helper()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("connection closed, want %s", messageType)
+		}
+		if message["type"] != messageType {
+			c.t.Fatalf("got %v, want %s", message, messageType)
+		}
+		return message
+	case <-time.After(2 * time.Second):
+		c.t.Fatalf("timed out waiting for %s", messageType)
+	}
+	return nil
+}
+
+// expectNone checks that no message arrives for a while
+func (c *client) expectNone() {
+	c.t.Helper()
+	select {
+	case message := <-c.messages:
+		c.t.Fatalf("unexpected message %v", message)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func limitOrder(id, userID string, side types.OrderSide, price, quantity float64) *types.Order {
+	return &types.Order{
+		ID:        id,
+		UserID:    userID,
+		AccountID: userID,
+		Symbol:    "BTC-USD",
+		Type:      types.LimitOrder,
+		Side:      side,
+		Price:     price,
+		Quantity:  quantity,
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestGatewayStreamsMarketData(t *testing.T) {
+	url := runNATS(t).ClientURL()
+	engine := runEngine(t, url)
+	g := runGateway(t, url)
+
+	if _, err := engine.ProcessOrder(limitOrder("resting", "bob", types.SellOrder, 101, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+
+	c := g.dial("alice")
+	c.send(map[string]interface{}{"action": "subscribe", "symbol": "BTC-USD"})
+	c.expect("response")
+	snapshot := c.expect("orderbook")
+	asks, _ := snapshot["asks"].([]interface{})
+	if len(asks) != 1 {
+		t.Fatalf("snapshot asks = %v, want the resting order", snapshot["asks"])
+	}
+
+	c.send(map[string]interface{}{"action": "subscribe", "channel": "trades", "symbol": "BTC-USD"})
+	c.expect("response")
+	c.expect("trades")
+
+	if _, err := engine.ProcessOrder(limitOrder("taker", "carol", types.BuyOrder, 101, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+
+	// Channels are relayed on their own subjects, in no particular order
+	// between them
+	received := make(map[interface{}]map[string]interface{})
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-c.messages:
+			received[message["type"]] = message
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for the trade, got %v", received)
+		}
+	}
+	update, trade := received["l2update"], received["trade"]
+	if update == nil || trade == nil {
+		t.Fatalf("got %v, want an l2update and a trade", received)
+	}
+	if update["sequence"].(float64) <= snapshot["sequence"].(float64) {
+		t.Fatalf("update sequence %v does not follow snapshot %v", update["sequence"], snapshot["sequence"])
+	}
+	if trade["sequence"].(float64) != 1 || trade["price"].(float64) != 101 {
+		t.Fatalf("trade = %v, want the first trade at 101", trade)
+	}
+}
+
+func TestGatewaySubscribesOnlyToItsClientsTopics(t *testing.T) {
+	srv := runNATS(t)
+	url := srv.ClientURL()
+	engine := runEngine(t, url)
+	a := runGateway(t, url)
+	b := runGateway(t, url)
+
+	alice := a.dial("alice")
+	alice.send(map[string]interface{}{"action": "subscribe", "channel": "orders"})
+	alice.expect("response")
+	alice.expect("orders")
+
+	bob := b.dial("bob")
+	bob.send(map[string]interface{}{"action": "subscribe", "channel": "orders"})
+	bob.expect("response")
+	bob.expect("orders")
+
+	// Each gateway only subscribes to its own client's orders
+	if n := subscribers(t, srv, "ws.user.alice.orders", 1); n != 1 {
+		t.Fatalf("%d subscriptions to alice's orders, want 1", n)
+	}
+	if n := subscribers(t, srv, "ws.symbol.BTC-USD.market", 0); n != 0 {
+		t.Fatalf("%d subscriptions to the market channel without clients", n)
+	}
+
+	if _, err := engine.ProcessOrder(limitOrder("order-1", "alice", types.BuyOrder, 100, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	report := alice.expect("execution_report")
+	if report["exec_type"] != string(types.ExecTypeNew) || report["id"] != "order-1" {
+		t.Fatalf("report = %v, want NEW order-1", report)
+	}
+	bob.expectNone()
+
+	// The last client leaving drops the subscription
+	alice.conn.Close()
+	if n := subscribers(t, srv, "ws.user.alice.orders", 0); n != 0 {
+		t.Fatalf("%d subscriptions to alice's orders after she left", n)
+	}
+}
+
+func TestGatewayLeavesOutOtherAccountsEvents(t *testing.T) {
+	url := runNATS(t).ClientURL()
+	engine := runEngine(t, url)
+	g := runGateway(t, url)
+
+	resting := limitOrder("resting", "alice", types.BuyOrder, 90, 1)
+	if _, err := engine.ProcessOrder(resting); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+
+	// The client's token only covers alice's sub-account
+	c := g.dial("alice", "orders:read@account=alice-sub", auth.ScopeMarketDataRead)
+	c.send(map[string]interface{}{"action": "subscribe", "channel": "orders"})
+	c.expect("response")
+	if orders, _ := c.expect("orders")["orders"].([]interface{}); len(orders) != 0 {
+		t.Fatalf("snapshot orders = %v, want none of the master account's", orders)
+	}
+
+	if _, err := engine.ProcessOrder(limitOrder("master", "alice", types.BuyOrder, 91, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	sub := limitOrder("sub", "alice", types.BuyOrder, 92, 1)
+	sub.AccountID = "alice-sub"
+	if _, err := engine.ProcessOrder(sub); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	if report := c.expect("execution_report"); report["id"] != "sub" {
+		t.Fatalf("report = %v, want only the sub-account's order", report)
+	}
+	c.expectNone()
+}
+
+func TestGatewayReplaysRelayedMessages(t *testing.T) {
+	url := runNATS(t).ClientURL()
+	engine := runEngine(t, url)
+	g := runGateway(t, url)
+
+	watcher := g.dial("watcher")
+	watcher.send(map[string]interface{}{"action": "subscribe", "channel": "trades", "symbol": "BTC-USD"})
+	watcher.expect("response")
+	watcher.expect("trades")
+
+	for i := 0; i < 3; i++ {
+		engine.ProcessOrder(limitOrder("sell", "bob", types.SellOrder, 100, 1))
+		engine.ProcessOrder(limitOrder("buy", "carol", types.BuyOrder, 100, 1))
+		watcher.expect("trade")
+	}
+
+	c := g.dial("alice")
+	c.send(map[string]interface{}{"action": "subscribe", "channel": "trades", "symbol": "BTC-USD", "since_seq": 1})
+	c.expect("response")
+	for _, want := range []float64{2, 3} {
+		if trade := c.expect("trade"); trade["sequence"].(float64) != want {
+			t.Fatalf("replayed trade %v, want sequence %v", trade, want)
+		}
+	}
+}
+
+func TestSubscribeUsers(t *testing.T) {
+	url := runNATS(t).ClientURL()
+	engine := runEngine(t, url)
+
+	conn := connect(t, url)
+	updates := make(chan ws.Update, 10)
+	if _, err := SubscribeUsers(conn, ws.ChannelOrders, func(update ws.Update) {
+		updates <- update
+	}, zap.NewNop()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	engine.ProcessOrder(limitOrder("sell", "bob", types.SellOrder, 100, 1))
+	engine.ProcessOrder(limitOrder("buy", "carol", types.BuyOrder, 100, 1))
+
+	// Both orders are acknowledged, then trade
+	want := []struct {
+		user     string
+		execType types.ExecType
+	}{
+		{"bob", types.ExecTypeNew},
+		{"carol", types.ExecTypeNew},
+		{"carol", types.ExecTypeTrade},
+		{"bob", types.ExecTypeTrade},
+	}
+	seen := make(map[string]int)
+	for i := 0; i < len(want); i++ {
+		select {
+		case update := <-updates:
+			var report types.ExecutionReport
+			if err := json.Unmarshal(update.Data, &report); err != nil {
+				t.Fatalf("decode report: %v", err)
+			}
+			if update.UserID != report.UserID || update.Sequence == 0 {
+				t.Fatalf("update %v of user %s, want a sequenced update of the report's user", update.Topic, report.UserID)
+			}
+			seen[report.UserID+" "+string(report.ExecType)]++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for reports, got %v", seen)
+		}
+	}
+	for _, w := range want {
+		if seen[w.user+" "+string(w.execType)] == 0 {
+			t.Fatalf("got %v, want a %s report for %s", seen, w.execType, w.user)
+		}
+	}
+}
+
+func TestGatewayDisconnectsUsersForTheServer(t *testing.T) {
+	srv := runNATS(t)
+	url := srv.ClientURL()
+	runEngine(t, url)
+	g := runGateway(t, url)
+	publisher := NewPublisher(connect(t, url), ws.NewHub(zap.NewNop()), zap.NewNop())
+
+	alice := g.dial("alice")
+	alice.send(map[string]interface{}{"action": "subscribe", "channel": "orders"})
+	alice.expect("response")
+	alice.expect("orders")
+	bob := g.dial("bob")
+	if n := subscribers(t, srv, "ws.user.alice.disconnect", 1); n != 1 {
+		t.Fatalf("%d subscriptions to disconnects, want 1", n)
+	}
+
+	publisher.DisconnectUser("alice", "token revoked")
+	select {
+	case message, ok := <-alice.messages:
+		if ok {
+			t.Fatalf("unexpected message %v", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("alice's connection was not closed")
+	}
+	bob.expectNone()
+}
+
+func TestSubject(t *testing.T) {
+	tests := []struct {
+		topic   ws.Topic
+		subject string
+	}{
+		{ws.Topic{Channel: ws.ChannelMarket, Symbol: "BTC-USD"}, "symbol.BTC-USD.market"},
+		{ws.Topic{Channel: ws.ChannelFills, UserID: "alice"}, "user.alice.fills"},
+	}
+	for _, tt := range tests {
+		subject, err := subject(tt.topic)
+		if err != nil || subject != tt.subject {
+			t.Fatalf("subject(%v) = %q, %v, want %q", tt.topic, subject, err, tt.subject)
+		}
+		topic, err := parseSubject(subject)
+		if err != nil || topic != tt.topic {
+			t.Fatalf("parseSubject(%q) = %v, %v, want %v", subject, topic, err, tt.topic)
+		}
+	}
+
+	for _, symbol := range []string{"", "BTC.USD", "BTC*", ">"} {
+		if _, err := subject(ws.Topic{Channel: ws.ChannelMarket, Symbol: symbol}); err == nil {
+			t.Fatalf("subject accepted symbol %q", symbol)
+		}
+	}
+}
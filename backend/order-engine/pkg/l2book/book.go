@@ -0,0 +1,163 @@
+// Package l2book is a reference client for the L2 order book feed. It
+// keeps a local copy of a book from a snapshot and the l2update messages
+// that follow it, and checks every update's sequence and checksum so a
+// client knows when to resubscribe for a fresh snapshot.
+package l2book
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/orderbook"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+var (
+	// ErrNoSnapshot is returned for updates received before a snapshot
+	ErrNoSnapshot = errors.New("no snapshot received")
+	// ErrSequenceGap is returned when an update was missed
+	ErrSequenceGap = errors.New("sequence gap")
+	// ErrChecksumMismatch is returned when the local book has drifted
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// Book is a local copy of one symbol's order book. After an error the book
+// is out of date until the next snapshot is applied.
+type Book struct {
+	symbol   string
+	sequence uint64
+	synced   bool
+	bids     map[float64]float64
+	asks     map[float64]float64
+}
+
+func NewBook(symbol string) *Book {
+	return &Book{
+		symbol: symbol,
+		bids:   make(map[float64]float64),
+		asks:   make(map[float64]float64),
+	}
+}
+
+// Sequence returns the sequence of the last snapshot or update applied
+func (b *Book) Sequence() uint64 {
+	return b.sequence
+}
+
+// ApplySnapshot replaces the book with a snapshot and verifies its checksum
+func (b *Book) ApplySnapshot(snapshot types.OrderBookSnapshot) error {
+	if snapshot.Symbol != b.symbol {
+		return fmt.Errorf("snapshot for %s applied to %s", snapshot.Symbol, b.symbol)
+	}
+
+	b.bids = make(map[float64]float64, len(snapshot.Bids))
+	for _, level := range snapshot.Bids {
+		b.bids[level.Price] = level.Quantity
+	}
+	b.asks = make(map[float64]float64, len(snapshot.Asks))
+	for _, level := range snapshot.Asks {
+		b.asks[level.Price] = level.Quantity
+	}
+	b.sequence = snapshot.Sequence
+	b.synced = true
+
+	return b.verify(snapshot.Checksum)
+}
+
+// ApplyUpdate applies a level change and verifies the checksum that came
+// with it. Updates the book already includes are ignored.
+func (b *Book) ApplyUpdate(update types.BookUpdate) error {
+	if update.Symbol != b.symbol {
+		return fmt.Errorf("update for %s applied to %s", update.Symbol, b.symbol)
+	}
+	if !b.synced {
+		return ErrNoSnapshot
+	}
+	if update.Sequence <= b.sequence {
+		return nil
+	}
+	if update.Sequence != b.sequence+1 {
+		b.synced = false
+		return fmt.Errorf("%w: expected %d, got %d", ErrSequenceGap, b.sequence+1, update.Sequence)
+	}
+
+	levels := b.asks
+	if update.Side == types.BuyOrder {
+		levels = b.bids
+	}
+	if update.Quantity == 0 {
+		delete(levels, update.Price)
+	} else {
+		levels[update.Price] = update.Quantity
+	}
+	b.sequence = update.Sequence
+
+	return b.verify(update.Checksum)
+}
+
+// HandleMessage applies an orderbook or l2update WebSocket message for the
+// book's symbol and ignores every other message
+func (b *Book) HandleMessage(data []byte) error {
+	var header struct {
+		Type   string `json:"type"`
+		Symbol string `json:"symbol"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	}
+	if header.Symbol != b.symbol {
+		return nil
+	}
+
+	switch header.Type {
+	case "orderbook":
+		var snapshot types.OrderBookSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		return b.ApplySnapshot(snapshot)
+	case "l2update":
+		var update types.BookUpdate
+		if err := json.Unmarshal(data, &update); err != nil {
+			return fmt.Errorf("failed to decode update: %w", err)
+		}
+		return b.ApplyUpdate(update)
+	}
+	return nil
+}
+
+// Bids returns the bid levels best first
+func (b *Book) Bids() []types.OrderBookLevel {
+	return sortedLevels(b.bids, func(x, y float64) bool { return x > y })
+}
+
+// Asks returns the ask levels best first
+func (b *Book) Asks() []types.OrderBookLevel {
+	return sortedLevels(b.asks, func(x, y float64) bool { return x < y })
+}
+
+// Checksum returns the checksum of the local book
+func (b *Book) Checksum() uint32 {
+	return orderbook.Checksum(b.Bids(), b.Asks())
+}
+
+func (b *Book) verify(expected uint32) error {
+	if actual := b.Checksum(); actual != expected {
+		b.synced = false
+		return fmt.Errorf("%w at sequence %d: expected %d, got %d", ErrChecksumMismatch, b.sequence, expected, actual)
+	}
+	return nil
+}
+
+// sortedLevels lists levels ordered by better. Order counts are not part
+// of the feed's updates and are left zero.
+func sortedLevels(levels map[float64]float64, better func(x, y float64) bool) []types.OrderBookLevel {
+	sorted := make([]types.OrderBookLevel, 0, len(levels))
+	for price, quantity := range levels {
+		sorted = append(sorted, types.OrderBookLevel{Price: price, Quantity: quantity})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return better(sorted[i].Price, sorted[j].Price) })
+	return sorted
+}
@@ -0,0 +1,232 @@
+package l2book
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/orderbook"
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+const symbol = "BTC-USD"
+
+// feed is an order book with every update it emitted
+type feed struct {
+	book    *orderbook.OrderBook
+	updates []types.BookUpdate
+	ids     []string
+	next    int
+}
+
+func newFeed() *feed {
+	f := &feed{book: orderbook.NewOrderBook(symbol)}
+	f.book.SetUpdateListener(func(update types.BookUpdate) {
+		f.updates = append(f.updates, update)
+	})
+	return f
+}
+
+func (f *feed) add(side types.OrderSide, price, quantity float64) {
+	f.next++
+	id := fmt.Sprintf("o-%d", f.next)
+	order := &types.Order{ID: id, Symbol: symbol, Side: side, Type: types.LimitOrder, Price: price, Quantity: quantity}
+	if err := f.book.AddOrder(order); err == nil {
+		f.ids = append(f.ids, id)
+	}
+}
+
+func (f *feed) snapshot(t testing.TB) types.OrderBookSnapshot {
+	snapshot, err := f.book.GetOrderBookSnapshot(symbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *snapshot
+}
+
+// apply runs one fuzzed operation against the book
+func (f *feed) apply(op, side, price, size byte) {
+	orderSide := types.BuyOrder
+	if side%2 == 1 {
+		orderSide = types.SellOrder
+	}
+	quantity := float64(size%20+1) / 10
+
+	if op%4 == 0 || len(f.ids) == 0 {
+		f.add(orderSide, float64(90+price%20), quantity)
+		return
+	}
+
+	index := int(price) % len(f.ids)
+	id := f.ids[index]
+	order, err := f.book.GetOrder(id)
+	if err != nil {
+		f.ids = append(f.ids[:index], f.ids[index+1:]...)
+		return
+	}
+
+	switch op % 4 {
+	case 1:
+		f.book.CancelOrder(id)
+	case 2:
+		f.book.ReduceOrder(id, order.FilledQty+(order.Quantity-order.FilledQty)*float64(size%4+1)/5)
+	case 3:
+		fill := order.RemainingQty
+		if size%2 == 0 {
+			fill = order.RemainingQty / 2
+		}
+		f.book.FillOrder(id, fill)
+	}
+}
+
+func TestChecksumFormat(t *testing.T) {
+	bids := []types.OrderBookLevel{{Price: 100, Quantity: 1.5}, {Price: 99.5, Quantity: 2}}
+	asks := []types.OrderBookLevel{{Price: 100.25, Quantity: 0.1}}
+
+	expected := crc32.ChecksumIEEE([]byte("100:1.5:100.25:0.1:99.5:2"))
+	if actual := orderbook.Checksum(bids, asks); actual != expected {
+		t.Fatalf("expected checksum %d, got %d", expected, actual)
+	}
+	if actual := orderbook.Checksum(nil, nil); actual != crc32.ChecksumIEEE(nil) {
+		t.Fatalf("expected empty book checksum %d, got %d", crc32.ChecksumIEEE(nil), actual)
+	}
+}
+
+func TestChecksumDepth(t *testing.T) {
+	f := newFeed()
+	for i := 0; i < orderbook.ChecksumDepth+5; i++ {
+		f.add(types.BuyOrder, float64(100-i), 1)
+	}
+	snapshot := f.snapshot(t)
+	top := snapshot.Bids[:orderbook.ChecksumDepth]
+
+	if snapshot.Checksum != orderbook.Checksum(top, nil) {
+		t.Fatal("checksum covers levels beyond the checksum depth")
+	}
+	if last := f.updates[len(f.updates)-1]; last.Checksum != snapshot.Checksum {
+		t.Fatalf("update checksum %d does not match snapshot checksum %d", last.Checksum, snapshot.Checksum)
+	}
+}
+
+func TestSequenceGap(t *testing.T) {
+	f := newFeed()
+	book := NewBook(symbol)
+	if err := book.ApplySnapshot(f.snapshot(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.add(types.BuyOrder, 100, 1)
+	f.add(types.BuyOrder, 101, 1)
+	if err := book.ApplyUpdate(f.updates[1]); !errors.Is(err, ErrSequenceGap) {
+		t.Fatalf("expected a sequence gap, got %v", err)
+	}
+	if err := book.ApplyUpdate(f.updates[0]); !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("expected updates to wait for a snapshot, got %v", err)
+	}
+
+	if err := book.ApplySnapshot(f.snapshot(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := book.ApplyUpdate(f.updates[1]); err != nil {
+		t.Fatalf("expected an update included in the snapshot to be ignored, got %v", err)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	f := newFeed()
+	book := NewBook(symbol)
+	if err := book.ApplySnapshot(f.snapshot(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.add(types.SellOrder, 100, 1)
+	update := f.updates[0]
+	update.Quantity = 2
+	if err := book.ApplyUpdate(update); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	book := NewBook(symbol)
+	messages := []string{
+		`{"type":"trade","symbol":"BTC-USD","price":100,"quantity":1}`,
+		`{"type":"orderbook","symbol":"BTC-USD","sequence":4,"checksum":` + fmt.Sprint(crc32.ChecksumIEEE([]byte("100:1"))) + `,"bids":[{"price":100,"quantity":1,"orders":1}],"asks":[]}`,
+		`{"type":"l2update","symbol":"ETH-USD","sequence":1,"side":"SELL","price":5,"quantity":1,"checksum":0}`,
+		`{"type":"l2update","symbol":"BTC-USD","sequence":5,"side":"SELL","price":101,"quantity":2,"checksum":` + fmt.Sprint(crc32.ChecksumIEEE([]byte("100:1:101:2"))) + `}`,
+	}
+	for _, message := range messages {
+		if err := book.HandleMessage([]byte(message)); err != nil {
+			t.Fatalf("failed to handle %s: %v", message, err)
+		}
+	}
+
+	if book.Sequence() != 5 {
+		t.Fatalf("expected sequence 5, got %d", book.Sequence())
+	}
+	if asks := book.Asks(); len(asks) != 1 || asks[0].Price != 101 || asks[0].Quantity != 2 {
+		t.Fatalf("unexpected asks %+v", asks)
+	}
+}
+
+// FuzzDeltas drives an OrderBook with arbitrary operations and checks that
+// a client joining at any point can follow the updates
+func FuzzDeltas(f *testing.F) {
+	f.Add(byte(0), []byte{0, 0, 1, 5, 0, 1, 2, 3, 3, 0, 1, 0})
+	f.Add(byte(2), []byte{0, 0, 0, 9, 0, 0, 0, 9, 2, 0, 0, 3, 3, 0, 0, 1, 1, 0, 0, 0})
+	f.Add(byte(5), []byte{0, 1, 7, 19, 0, 0, 3, 2, 0, 1, 8, 4, 3, 1, 2, 0, 2, 0, 1, 1, 1, 0, 0, 0, 0, 1, 7, 2})
+
+	f.Fuzz(func(t *testing.T, joinAfter byte, ops []byte) {
+		// Longer sequences only slow the fuzzer down
+		if len(ops) > 1024 {
+			ops = ops[:1024]
+		}
+
+		feed := newFeed()
+		book := NewBook(symbol)
+
+		join := int(joinAfter) % (len(ops)/4 + 1)
+		for i := 0; i+3 < len(ops); i += 4 {
+			if i/4 == join {
+				if err := book.ApplySnapshot(feed.snapshot(t)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			feed.apply(ops[i], ops[i+1], ops[i+2], ops[i+3])
+		}
+		if !book.synced {
+			if err := book.ApplySnapshot(feed.snapshot(t)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Replay every update, as a client that buffered them while
+		// waiting for its snapshot would
+		for _, update := range feed.updates {
+			if err := book.ApplyUpdate(update); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		snapshot := feed.snapshot(t)
+		if book.Sequence() != snapshot.Sequence {
+			t.Fatalf("expected sequence %d, got %d", snapshot.Sequence, book.Sequence())
+		}
+		assertLevels(t, "bids", snapshot.Bids, book.Bids())
+		assertLevels(t, "asks", snapshot.Asks, book.Asks())
+	})
+}
+
+func assertLevels(t *testing.T, side string, expected, actual []types.OrderBookLevel) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d %s, got %d", len(expected), side, len(actual))
+	}
+	for i := range expected {
+		if expected[i].Price != actual[i].Price || expected[i].Quantity != actual[i].Quantity {
+			t.Fatalf("%s level %d: expected %g@%g, got %g@%g", side, i,
+				expected[i].Quantity, expected[i].Price, actual[i].Quantity, actual[i].Price)
+		}
+	}
+}
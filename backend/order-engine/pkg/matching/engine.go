@@ -1,23 +1,115 @@
 package matching
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/orderbook"
 	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+	"github.com/google/uuid"
 )
 
+// OrderListener is called with a copy of an order every time its status or
+// fills change. Listeners run under the engine lock and must not block.
+type OrderListener func(order types.Order)
+
+// TradeListener is called with every trade the engine executes, in order.
+// Listeners run under the engine lock and must not block.
+type TradeListener func(trade types.Trade)
+
+// BookListener is called with every price level change of every book, in
+// sequence order per symbol. Listeners run under the engine lock and must
+// not block.
+type BookListener func(update types.BookUpdate)
+
+// BookOrderListener is called with every change to a resting order, with
+// the same sequence as the level change it causes and under the same rules
+// as BookListener
+type BookOrderListener func(event types.BookOrderEvent)
+
+// ExecutionListener is called with a report for every change to an order:
+// acceptance, each fill, cancels, amends and rejections. A fill is reported
+// to the taker and then the maker, after the trade listeners. Listeners run
+// under the engine lock and must not block.
+type ExecutionListener func(report types.ExecutionReport)
+
+// PreTradeCheck validates an order before it reaches the book. Returning an
+// error rejects the order. Checks run under the engine lock and must not block.
+type PreTradeCheck func(order *types.Order) error
+
+// RejectError rejects an order with a reason reported on the order
+type RejectError struct {
+	Reason types.RejectReason
+	Err    error
+}
+
+func (e *RejectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectError) Unwrap() error {
+	return e.Err
+}
+
+// Reject wraps err so the order is rejected with the given reason
+func Reject(reason types.RejectReason, err error) error {
+	return &RejectError{Reason: reason, Err: err}
+}
+
+// SelfTradePrevention selects which orders are not allowed to trade with
+// each other. When an incoming order would match a resting order in the
+// same scope, the resting order is cancelled and matching continues.
+type SelfTradePrevention string
+
+const (
+	// STPNone allows every match
+	STPNone SelfTradePrevention = "none"
+	// STPAccount prevents matches between orders of the same account
+	STPAccount SelfTradePrevention = "account"
+	// STPMaster prevents matches anywhere within one account hierarchy
+	STPMaster SelfTradePrevention = "master"
+)
+
+// ParseSelfTradePrevention validates a configured scope. Empty means none.
+func ParseSelfTradePrevention(s string) (SelfTradePrevention, error) {
+	switch stp := SelfTradePrevention(s); stp {
+	case "":
+		return STPNone, nil
+	case STPNone, STPAccount, STPMaster:
+		return stp, nil
+	default:
+		return "", fmt.Errorf("unknown self-trade prevention scope %q", s)
+	}
+}
+
+// FeeSchedule holds the fee rates charged on notional, per liquidity role
+type FeeSchedule struct {
+	MakerRate float64
+	TakerRate float64
+}
+
 type MatchingEngine struct {
-	orderBooks map[string]*orderbook.OrderBook
-	mutex      sync.RWMutex
+	orderBooks         map[string]*orderbook.OrderBook
+	fees               FeeSchedule
+	stp                SelfTradePrevention
+	checks             []PreTradeCheck
+	throttle           *throttle
+	orderListeners     []OrderListener
+	throttleListeners  []ThrottleListener
+	tradeListeners     []TradeListener
+	bookListeners      []BookListener
+	bookOrderListeners []BookOrderListener
+	executionListeners []ExecutionListener
+	mutex              sync.RWMutex
 }
 
 func NewMatchingEngine() *MatchingEngine {
 	return &MatchingEngine{
 		orderBooks: make(map[string]*orderbook.OrderBook),
+		stp:        STPNone,
 	}
 }
 
@@ -25,11 +117,40 @@ func (me *MatchingEngine) ProcessOrder(order *types.Order) ([]*types.Trade, erro
 	me.mutex.Lock()
 	defer me.mutex.Unlock()
 
-	// Get or create order book for symbol
+	// Initialize order state. Orders without an account belong to the
+	// user's master account.
+	if order.AccountID == "" {
+		order.AccountID = order.UserID
+	}
+	order.Status = types.OrderStatusNew
+	order.FilledQty = 0
+	order.RemainingQty = order.Quantity
+	// Creation times are kept at the microsecond precision the store
+	// persists, so live and stored orders sort and page the same way
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+	order.CreatedAt = order.CreatedAt.Truncate(time.Microsecond)
+	defer me.notifyOrder(order)
+
+	if err := me.admit(order, MessageNew); err != nil {
+		me.reject(order, err)
+		return nil, err
+	}
+
+	for _, check := range me.checks {
+		if err := check(order); err != nil {
+			me.reject(order, err)
+			return nil, err
+		}
+	}
+	me.notifyExecution(order, types.ExecTypeNew)
+
+	// Get or create order book for symbol, only once the order is accepted
+	// so rejected orders cannot create books
 	ob, exists := me.orderBooks[order.Symbol]
 	if !exists {
-		ob = orderbook.NewOrderBook(order.Symbol)
-		me.orderBooks[order.Symbol] = ob
+		ob = me.newOrderBook(order.Symbol)
 	}
 
 	// Process market orders immediately
@@ -61,8 +182,9 @@ func (me *MatchingEngine) processMarketOrder(ob *orderbook.OrderBook, order *typ
 
 	// Market orders that cannot be fully filled are rejected
 	if order.RemainingQty > 0 {
-		order.Status = types.OrderStatusRejected
-		return trades, fmt.Errorf("market order could not be fully filled")
+		err := Reject(types.RejectReasonNoLiquidity, fmt.Errorf("market order could not be fully filled"))
+		me.reject(order, err)
+		return trades, err
 	}
 
 	return trades, nil
@@ -100,54 +222,125 @@ func (me *MatchingEngine) matchOrder(ob *orderbook.OrderBook, order *types.Order
 			}
 		}
 
+		// Cancel our own resting order rather than trade with it
+		if me.isSelfTrade(order, matchingOrder) {
+			if err := ob.CancelOrder(matchingOrder.ID); err != nil {
+				return trades, err
+			}
+			matchingOrder.UpdatedAt = time.Now()
+			me.notifyOrder(matchingOrder)
+			me.notifyExecution(matchingOrder, types.ExecTypeCanceled)
+			continue
+		}
+
 		// Calculate trade quantity
 		tradeQty := min(order.RemainingQty, matchingOrder.RemainingQty)
 		tradePrice := matchingOrder.Price // Price-time priority: use existing order's price
 
 		// Create trade
 		trade := &types.Trade{
-			ID:           uuid.New().String(),
-			Symbol:       order.Symbol,
-			Price:        tradePrice,
-			Quantity:     tradeQty,
-			ExecutedAt:   time.Now(),
+			ID:         uuid.New().String(),
+			Symbol:     order.Symbol,
+			Price:      tradePrice,
+			Quantity:   tradeQty,
+			ExecutedAt: time.Now(),
+			TakerSide:  order.Side,
 		}
 
+		notional := tradePrice * tradeQty
+		takerFee := notional * me.fees.TakerRate
+		makerFee := notional * me.fees.MakerRate
+
 		if order.Side == types.BuyOrder {
 			trade.BuyOrderID = order.ID
 			trade.SellOrderID = matchingOrder.ID
 			trade.BuyerUserID = order.UserID
 			trade.SellerUserID = matchingOrder.UserID
+			trade.BuyerAccountID = order.AccountID
+			trade.SellerAccountID = matchingOrder.AccountID
+			trade.BuyClientOrderID = order.ClientOrderID
+			trade.SellClientOrderID = matchingOrder.ClientOrderID
+			trade.BuyerFee = takerFee
+			trade.SellerFee = makerFee
 		} else {
 			trade.BuyOrderID = matchingOrder.ID
 			trade.SellOrderID = order.ID
 			trade.BuyerUserID = matchingOrder.UserID
 			trade.SellerUserID = order.UserID
+			trade.BuyerAccountID = matchingOrder.AccountID
+			trade.SellerAccountID = order.AccountID
+			trade.BuyClientOrderID = matchingOrder.ClientOrderID
+			trade.SellClientOrderID = order.ClientOrderID
+			trade.BuyerFee = makerFee
+			trade.SellerFee = takerFee
 		}
 
-		// Update orders
+		// Update orders; the book takes a fully filled order off its level
 		order.FilledQty += tradeQty
 		order.RemainingQty -= tradeQty
-		matchingOrder.FilledQty += tradeQty
-		matchingOrder.RemainingQty -= tradeQty
+		if err := ob.FillOrder(matchingOrder.ID, tradeQty); err != nil {
+			return trades, err
+		}
 
 		// Update order statuses
 		me.updateOrderStatus(order)
 		me.updateOrderStatus(matchingOrder)
+		me.notifyOrder(matchingOrder)
 
-		// If matching order is fully filled, remove it from order book
-		if matchingOrder.Status == types.OrderStatusFilled {
-			if err := ob.CancelOrder(matchingOrder.ID); err != nil {
-				return trades, err
-			}
+		if me.throttle != nil {
+			me.throttle.recordFill(trade.BuyerAccountID)
+			me.throttle.recordFill(trade.SellerAccountID)
 		}
 
 		trades = append(trades, trade)
+		me.notifyTrade(trade)
+		me.notifyFills(order, matchingOrder, trade)
 	}
 
 	return trades, nil
 }
 
+// admit counts an order message against the account's throttle
+func (me *MatchingEngine) admit(order *types.Order, msg MessageType) error {
+	if me.throttle == nil {
+		return nil
+	}
+
+	event, err := me.throttle.admit(order.AccountID, order.UserID, msg)
+	if event != nil {
+		for _, listener := range me.throttleListeners {
+			listener(*event)
+		}
+	}
+	return err
+}
+
+// reject marks an order rejected with the reason carried by err
+func (me *MatchingEngine) reject(order *types.Order, err error) {
+	order.Status = types.OrderStatusRejected
+	order.RejectReason = types.RejectReasonOther
+	var rejectErr *RejectError
+	if errors.As(err, &rejectErr) {
+		order.RejectReason = rejectErr.Reason
+	}
+	order.UpdatedAt = time.Now()
+	me.notifyExecution(order, types.ExecTypeRejected)
+}
+
+// isSelfTrade reports whether two orders fall in the same self-trade
+// prevention scope. A master account's ID is its owner's user ID, so the
+// master scope compares users.
+func (me *MatchingEngine) isSelfTrade(taker, maker *types.Order) bool {
+	switch me.stp {
+	case STPAccount:
+		return taker.AccountID == maker.AccountID
+	case STPMaster:
+		return taker.UserID == maker.UserID
+	default:
+		return false
+	}
+}
+
 func (me *MatchingEngine) updateOrderStatus(order *types.Order) {
 	if order.RemainingQty == 0 {
 		order.Status = types.OrderStatusFilled
@@ -164,13 +357,364 @@ func (me *MatchingEngine) CancelOrder(orderID string) error {
 	// Find order book containing the order
 	for _, ob := range me.orderBooks {
 		if order, err := ob.GetOrder(orderID); err == nil {
-			return ob.CancelOrder(orderID)
+			// Cancels are counted but never throttled
+			me.admit(order, MessageCancel)
+			if err := ob.CancelOrder(orderID); err != nil {
+				return err
+			}
+			me.notifyOrder(order)
+			me.notifyExecution(order, types.ExecTypeCanceled)
+			return nil
 		}
 	}
 
 	return fmt.Errorf("order %s not found", orderID)
 }
 
+// AmendOrder changes the price and quantity of a resting limit order. The
+// quantity is the new total including what has already filled. Reducing the
+// quantity at the same price keeps the order's time priority; any other
+// change requeues it and may match it immediately. A rejected amend leaves
+// the order unchanged; if matching the requeued order fails, its remainder
+// is cancelled. It returns a copy of the amended order and any trades.
+func (me *MatchingEngine) AmendOrder(orderID string, price, quantity float64) (types.Order, []*types.Trade, error) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	var (
+		ob    *orderbook.OrderBook
+		order *types.Order
+	)
+	for _, book := range me.orderBooks {
+		if o, err := book.GetOrder(orderID); err == nil {
+			ob, order = book, o
+			break
+		}
+	}
+	if order == nil {
+		return types.Order{}, nil, fmt.Errorf("order %s not found", orderID)
+	}
+
+	if err := me.admit(order, MessageAmend); err != nil {
+		return *order, nil, err
+	}
+
+	if order.Type != types.LimitOrder {
+		return *order, nil, fmt.Errorf("only limit orders can be amended")
+	}
+	if price <= 0 {
+		return *order, nil, fmt.Errorf("price must be positive")
+	}
+	if quantity <= order.FilledQty {
+		return *order, nil, fmt.Errorf("quantity must exceed the filled quantity %g", order.FilledQty)
+	}
+
+	// Checks see the order as it would be after the amend
+	amended := *order
+	amended.Price = price
+	amended.Quantity = quantity
+	amended.RemainingQty = quantity - order.FilledQty
+	for _, check := range me.checks {
+		if err := check(&amended); err != nil {
+			return *order, nil, err
+		}
+	}
+
+	if price == order.Price && quantity <= order.Quantity {
+		if err := ob.ReduceOrder(orderID, quantity); err != nil {
+			return *order, nil, err
+		}
+		me.notifyOrder(order)
+		me.notifyExecution(order, types.ExecTypeReplaced)
+		return *order, nil, nil
+	}
+
+	if err := ob.RemoveOrder(orderID); err != nil {
+		return *order, nil, err
+	}
+	order.Price = price
+	order.Quantity = quantity
+	order.RemainingQty = quantity - order.FilledQty
+	order.UpdatedAt = time.Now()
+	me.notifyExecution(order, types.ExecTypeReplaced)
+
+	trades, err := me.matchOrder(ob, order)
+	if err == nil && order.RemainingQty > 0 {
+		err = ob.AddOrder(order)
+	}
+	if err != nil {
+		// The order is off the book, so its remainder is cancelled rather
+		// than left live where nothing can reach it
+		me.cancelRemainder(order)
+		return *order, trades, err
+	}
+	me.notifyOrder(order)
+
+	return *order, trades, nil
+}
+
+// cancelRemainder cancels what is left of an order that was taken off its
+// book and could not be put back, and reports its final state
+func (me *MatchingEngine) cancelRemainder(order *types.Order) {
+	if order.RemainingQty > 0 {
+		order.Status = types.OrderStatusCancelled
+		order.UpdatedAt = time.Now()
+		me.notifyExecution(order, types.ExecTypeCanceled)
+	}
+	me.notifyOrder(order)
+}
+
+// CancelAccountOrders cancels every resting order of the accounts across
+// all books and returns copies of the cancelled orders. Mass cancels are
+// administrative and not counted by the throttle.
+func (me *MatchingEngine) CancelAccountOrders(accountIDs []string) ([]types.Order, error) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	accounts := make(map[string]bool, len(accountIDs))
+	for _, id := range accountIDs {
+		accounts[id] = true
+	}
+
+	cancelled := make([]types.Order, 0)
+	for symbol, ob := range me.orderBooks {
+		orders, err := ob.GetOrdersBySymbol(symbol)
+		if err != nil {
+			return cancelled, err
+		}
+		for _, order := range orders {
+			if !accounts[order.AccountID] {
+				continue
+			}
+			if err := ob.CancelOrder(order.ID); err != nil {
+				return cancelled, err
+			}
+			order.UpdatedAt = time.Now()
+			me.notifyOrder(order)
+			me.notifyExecution(order, types.ExecTypeCanceled)
+			cancelled = append(cancelled, *order)
+		}
+	}
+
+	return cancelled, nil
+}
+
+// GetOrder returns a copy of a resting order
+func (me *MatchingEngine) GetOrder(orderID string) (types.Order, error) {
+	me.mutex.RLock()
+	defer me.mutex.RUnlock()
+
+	for _, ob := range me.orderBooks {
+		if order, err := ob.GetOrder(orderID); err == nil {
+			return *order, nil
+		}
+	}
+
+	return types.Order{}, fmt.Errorf("order %s not found", orderID)
+}
+
+// GetOrdersByUser returns copies of the user's resting orders across all books
+func (me *MatchingEngine) GetOrdersByUser(userID string) []types.Order {
+	me.mutex.RLock()
+	defer me.mutex.RUnlock()
+
+	orders := make([]types.Order, 0)
+	for _, ob := range me.orderBooks {
+		userOrders, _ := ob.GetOrdersByUser(userID)
+		for _, order := range userOrders {
+			orders = append(orders, *order)
+		}
+	}
+
+	return orders
+}
+
+// AddSymbol creates an empty order book for a new symbol
+func (me *MatchingEngine) AddSymbol(symbol string) error {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	if _, exists := me.orderBooks[symbol]; exists {
+		return fmt.Errorf("order book for symbol %s already exists", symbol)
+	}
+
+	me.newOrderBook(symbol)
+	return nil
+}
+
+// RemoveSymbol drops the order book for a symbol that has no resting orders
+func (me *MatchingEngine) RemoveSymbol(symbol string) error {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	ob, exists := me.orderBooks[symbol]
+	if !exists {
+		return fmt.Errorf("order book for symbol %s not found", symbol)
+	}
+
+	orders, err := ob.GetOrdersBySymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if len(orders) > 0 {
+		return fmt.Errorf("order book for symbol %s still has %d resting orders", symbol, len(orders))
+	}
+
+	delete(me.orderBooks, symbol)
+	return nil
+}
+
+// Symbols returns the symbols with an active order book in sorted order
+func (me *MatchingEngine) Symbols() []string {
+	me.mutex.RLock()
+	defer me.mutex.RUnlock()
+
+	symbols := make([]string, 0, len(me.orderBooks))
+	for symbol := range me.orderBooks {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	return symbols
+}
+
+// SetFeeSchedule sets the maker and taker rates applied to new trades
+func (me *MatchingEngine) SetFeeSchedule(fees FeeSchedule) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.fees = fees
+}
+
+// SetSelfTradePrevention sets the scope in which orders may not match
+func (me *MatchingEngine) SetSelfTradePrevention(stp SelfTradePrevention) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.stp = stp
+}
+
+// AddPreTradeCheck registers a check run on every new order
+func (me *MatchingEngine) AddPreTradeCheck(check PreTradeCheck) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.checks = append(me.checks, check)
+}
+
+// SetThrottle enables per-account order message throttling
+func (me *MatchingEngine) SetThrottle(config ThrottleConfig) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.throttle = newThrottle(config)
+}
+
+// AddThrottleListener registers a listener for throttled order messages
+func (me *MatchingEngine) AddThrottleListener(listener ThrottleListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.throttleListeners = append(me.throttleListeners, listener)
+}
+
+// AddOrderListener registers a listener for order state changes
+func (me *MatchingEngine) AddOrderListener(listener OrderListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.orderListeners = append(me.orderListeners, listener)
+}
+
+// AddTradeListener registers a listener for executed trades
+func (me *MatchingEngine) AddTradeListener(listener TradeListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.tradeListeners = append(me.tradeListeners, listener)
+}
+
+// AddBookListener registers a listener for order book level changes
+func (me *MatchingEngine) AddBookListener(listener BookListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.bookListeners = append(me.bookListeners, listener)
+}
+
+// AddBookOrderListener registers a listener for resting order changes
+func (me *MatchingEngine) AddBookOrderListener(listener BookOrderListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.bookOrderListeners = append(me.bookOrderListeners, listener)
+}
+
+// AddExecutionListener registers a listener for execution reports
+func (me *MatchingEngine) AddExecutionListener(listener ExecutionListener) {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.executionListeners = append(me.executionListeners, listener)
+}
+
+// newOrderBook creates a symbol's book, reporting its level changes to the
+// book listeners. Callers must hold the write lock.
+func (me *MatchingEngine) newOrderBook(symbol string) *orderbook.OrderBook {
+	ob := orderbook.NewOrderBook(symbol)
+	ob.SetUpdateListener(me.notifyBook)
+	ob.SetOrderEventListener(me.notifyBookOrder)
+	me.orderBooks[symbol] = ob
+	return ob
+}
+
+func (me *MatchingEngine) notifyBook(update types.BookUpdate) {
+	for _, listener := range me.bookListeners {
+		listener(update)
+	}
+}
+
+func (me *MatchingEngine) notifyBookOrder(event types.BookOrderEvent) {
+	for _, listener := range me.bookOrderListeners {
+		listener(event)
+	}
+}
+
+func (me *MatchingEngine) notifyOrder(order *types.Order) {
+	for _, listener := range me.orderListeners {
+		listener(*order)
+	}
+}
+
+func (me *MatchingEngine) notifyTrade(trade *types.Trade) {
+	for _, listener := range me.tradeListeners {
+		listener(*trade)
+	}
+}
+
+func (me *MatchingEngine) notifyExecution(order *types.Order, execType types.ExecType) {
+	for _, listener := range me.executionListeners {
+		listener(types.ExecutionReport{ExecType: execType, Order: *order})
+	}
+}
+
+// notifyFills reports a trade to the taker and then the maker
+func (me *MatchingEngine) notifyFills(taker, maker *types.Order, trade *types.Trade) {
+	if len(me.executionListeners) == 0 {
+		return
+	}
+
+	fills := trade.Fills()
+	takerFill, makerFill := fills[0], fills[1]
+	if taker.Side == types.SellOrder {
+		takerFill, makerFill = makerFill, takerFill
+	}
+	for _, listener := range me.executionListeners {
+		listener(types.NewTradeReport(*taker, takerFill))
+		listener(types.NewTradeReport(*maker, makerFill))
+	}
+}
+
 func (me *MatchingEngine) GetOrderBook(symbol string) (*types.OrderBookSnapshot, error) {
 	me.mutex.RLock()
 	defer me.mutex.RUnlock()
@@ -183,9 +727,22 @@ func (me *MatchingEngine) GetOrderBook(symbol string) (*types.OrderBookSnapshot,
 	return ob.GetOrderBookSnapshot(symbol)
 }
 
+// GetOrderBookL3 returns every resting order of a symbol's book
+func (me *MatchingEngine) GetOrderBookL3(symbol string) (*types.OrderBookL3Snapshot, error) {
+	me.mutex.RLock()
+	defer me.mutex.RUnlock()
+
+	ob, exists := me.orderBooks[symbol]
+	if !exists {
+		return nil, fmt.Errorf("order book for symbol %s not found", symbol)
+	}
+
+	return ob.GetL3Snapshot(symbol)
+}
+
 func min(a, b float64) float64 {
 	if a < b {
 		return a
 	}
 	return b
-} 
\ No newline at end of file
+}
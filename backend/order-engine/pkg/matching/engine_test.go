@@ -0,0 +1,156 @@
+package matching
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func limitOrder(id, accountID string, side types.OrderSide, price, quantity float64) *types.Order {
+	return &types.Order{
+		ID:        id,
+		UserID:    accountID,
+		AccountID: accountID,
+		Symbol:    "BTC-USD",
+		Type:      types.LimitOrder,
+		Side:      side,
+		Price:     price,
+		Quantity:  quantity,
+	}
+}
+
+func TestProcessOrderTruncatesCreatedAt(t *testing.T) {
+	me := NewMatchingEngine()
+
+	order := limitOrder("order-1", "alice", types.BuyOrder, 100, 1)
+	order.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	if _, err := me.ProcessOrder(order); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+
+	live, err := me.GetOrder("order-1")
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC); !live.CreatedAt.Equal(want) {
+		t.Fatalf("created at %v, want %v", live.CreatedAt, want)
+	}
+
+	unset := limitOrder("order-2", "alice", types.BuyOrder, 100, 1)
+	if _, err := me.ProcessOrder(unset); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	if unset.CreatedAt.IsZero() || unset.CreatedAt.Nanosecond()%1000 != 0 {
+		t.Fatalf("created at %v, want a time in whole microseconds", unset.CreatedAt)
+	}
+}
+
+func TestAmendCancelsOrderWhenRequeueFails(t *testing.T) {
+	me := NewMatchingEngine()
+	var updates []types.Order
+	me.AddOrderListener(func(order types.Order) {
+		updates = append(updates, order)
+	})
+	var reports []types.ExecType
+	me.AddExecutionListener(func(report types.ExecutionReport) {
+		reports = append(reports, report.ExecType)
+	})
+
+	order := limitOrder("order-1", "alice", types.BuyOrder, 100, 1)
+	if _, err := me.ProcessOrder(order); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+
+	// A resting order whose symbol has no book cannot be matched again
+	order.Symbol = "ETH-USD"
+	if _, _, err := me.AmendOrder("order-1", 101, 1); err == nil {
+		t.Fatal("amend succeeded, want the match error")
+	}
+
+	if _, err := me.GetOrder("order-1"); err == nil {
+		t.Fatal("order is still live after the failed amend")
+	}
+	last := updates[len(updates)-1]
+	if last.Status != types.OrderStatusCancelled {
+		t.Fatalf("final order update %s, want %s", last.Status, types.OrderStatusCancelled)
+	}
+	if got := reports[len(reports)-1]; got != types.ExecTypeCanceled {
+		t.Fatalf("final execution report %s, want %s", got, types.ExecTypeCanceled)
+	}
+}
+
+func TestRejectedOrderCreatesNoBook(t *testing.T) {
+	me := NewMatchingEngine()
+	me.AddPreTradeCheck(func(order *types.Order) error {
+		if order.Symbol == "DOGE-USD" {
+			return Reject(types.RejectReasonBlocked, errors.New("symbol not allowed"))
+		}
+		return nil
+	})
+
+	if _, err := me.ProcessOrder(&types.Order{
+		ID: "order-1", UserID: "alice", Symbol: "DOGE-USD",
+		Type: types.LimitOrder, Side: types.BuyOrder, Price: 1, Quantity: 1,
+	}); err == nil {
+		t.Fatal("order accepted, want the check to reject it")
+	}
+	if symbols := me.Symbols(); len(symbols) != 0 {
+		t.Fatalf("symbols = %v after a rejected order, want none", symbols)
+	}
+
+	if _, err := me.ProcessOrder(limitOrder("order-2", "alice", types.BuyOrder, 100, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	if symbols := me.Symbols(); len(symbols) != 1 || symbols[0] != "BTC-USD" {
+		t.Fatalf("symbols = %v, want the accepted order's book", symbols)
+	}
+}
+
+func TestSelfTradePreventionScopes(t *testing.T) {
+	// alice's sub-account rests a sell; alice's master account then buys
+	tests := []struct {
+		stp     SelfTradePrevention
+		account string
+		trades  int
+	}{
+		{STPNone, "alice", 1},
+		{STPAccount, "alice-sub", 0},
+		{STPAccount, "alice", 1},
+		{STPMaster, "alice", 0},
+	}
+	for _, tt := range tests {
+		me := NewMatchingEngine()
+		me.SetSelfTradePrevention(tt.stp)
+
+		resting := limitOrder("resting", "alice-sub", types.SellOrder, 100, 1)
+		resting.UserID = "alice"
+		if _, err := me.ProcessOrder(resting); err != nil {
+			t.Fatalf("%s: process resting order: %v", tt.stp, err)
+		}
+		taker := limitOrder("taker", tt.account, types.BuyOrder, 100, 1)
+		taker.UserID = "alice"
+		trades, err := me.ProcessOrder(taker)
+		if err != nil {
+			t.Fatalf("%s: process taker: %v", tt.stp, err)
+		}
+		if len(trades) != tt.trades {
+			t.Fatalf("%s from %s: %d trades, want %d", tt.stp, tt.account, len(trades), tt.trades)
+		}
+
+		// A prevented match cancels the resting order and rests the taker
+		if tt.trades == 0 {
+			if resting.Status != types.OrderStatusCancelled {
+				t.Fatalf("%s: resting order is %s, want cancelled", tt.stp, resting.Status)
+			}
+			if live, err := me.GetOrder("taker"); err != nil || live.Status != types.OrderStatusNew {
+				t.Fatalf("%s: taker %+v (%v), want it resting", tt.stp, live, err)
+			}
+		}
+	}
+
+	if _, err := ParseSelfTradePrevention("user"); err == nil {
+		t.Fatal("accepted an unknown scope")
+	}
+}
@@ -0,0 +1,186 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// MessageType is an order message counted by the throttle
+type MessageType string
+
+const (
+	MessageNew    MessageType = "NEW"
+	MessageAmend  MessageType = "AMEND"
+	MessageCancel MessageType = "CANCEL"
+)
+
+// ThrottleConfig limits the order messages of each account. Zero values
+// disable the corresponding limit.
+type ThrottleConfig struct {
+	// MaxMessagesPerSecond caps new, amend and cancel messages per second
+	MaxMessagesPerSecond int
+	// MaxMessageToFillRatio caps messages per fill over RatioWindow
+	MaxMessageToFillRatio float64
+	// RatioWindow is the rolling window of the ratio, in whole seconds
+	RatioWindow time.Duration
+	// MinRatioMessages is the number of messages in the window before the
+	// ratio is enforced, so quiet accounts are not rejected on their first
+	// unfilled orders
+	MinRatioMessages int
+}
+
+// ThrottleEvent describes an order message rejected by the throttle.
+// NewBreach is set on the first rejection after the account was in limits.
+type ThrottleEvent struct {
+	AccountID string
+	UserID    string
+	Message   MessageType
+	Reason    types.RejectReason
+	Messages  int
+	Fills     int
+	NewBreach bool
+	At        time.Time
+}
+
+// ThrottleListener is called for every throttled message. Listeners run
+// under the engine lock and must not block.
+type ThrottleListener func(event ThrottleEvent)
+
+var (
+	ErrMessageRateExceeded  = errors.New("order message rate exceeded")
+	ErrMessageRatioExceeded = errors.New("message-to-fill ratio exceeded")
+)
+
+// activitySlot counts one second of an account's activity
+type activitySlot struct {
+	second   int64
+	messages int
+	fills    int
+}
+
+type accountActivity struct {
+	slots    []activitySlot
+	breached bool
+	lastSeen int64
+}
+
+// throttle tracks per-account message and fill counts in a ring of
+// one-second slots covering the ratio window. It is guarded by the engine lock.
+type throttle struct {
+	config    ThrottleConfig
+	accounts  map[string]*accountActivity
+	lastSweep int64
+	now       func() time.Time
+}
+
+func newThrottle(config ThrottleConfig) *throttle {
+	if config.RatioWindow < time.Second {
+		config.RatioWindow = time.Second
+	}
+	return &throttle{
+		config:   config,
+		accounts: make(map[string]*accountActivity),
+		now:      time.Now,
+	}
+}
+
+func (t *throttle) window() int64 {
+	return int64(t.config.RatioWindow / time.Second)
+}
+
+// slot returns the account's slot for the second, resetting a stale one
+func (t *throttle) slot(accountID string, second int64) (*accountActivity, *activitySlot) {
+	activity, exists := t.accounts[accountID]
+	if !exists {
+		activity = &accountActivity{slots: make([]activitySlot, t.window())}
+		t.accounts[accountID] = activity
+	}
+	activity.lastSeen = second
+
+	s := &activity.slots[second%int64(len(activity.slots))]
+	if s.second != second {
+		*s = activitySlot{second: second}
+	}
+	return activity, s
+}
+
+// totals sums the account's messages and fills within the window
+func (t *throttle) totals(activity *accountActivity, second int64) (messages, fills int) {
+	for _, s := range activity.slots {
+		if second-s.second < t.window() {
+			messages += s.messages
+			fills += s.fills
+		}
+	}
+	return messages, fills
+}
+
+// admit counts a message and reports whether it breaches a limit. Cancels
+// are counted but never rejected, so a throttled account can always reduce
+// its exposure.
+func (t *throttle) admit(accountID, userID string, msg MessageType) (*ThrottleEvent, error) {
+	now := t.now()
+	second := now.Unix()
+	t.sweep(second)
+
+	activity, current := t.slot(accountID, second)
+	current.messages++
+	messages, fills := t.totals(activity, second)
+
+	var reason types.RejectReason
+	var err error
+	switch {
+	case msg == MessageCancel:
+	case t.config.MaxMessagesPerSecond > 0 && current.messages > t.config.MaxMessagesPerSecond:
+		reason = types.RejectReasonMessageRate
+		err = fmt.Errorf("%w: %d messages in the last second, limit %d",
+			ErrMessageRateExceeded, current.messages, t.config.MaxMessagesPerSecond)
+	case t.config.MaxMessageToFillRatio > 0 && messages >= t.config.MinRatioMessages &&
+		float64(messages)/float64(max(fills, 1)) > t.config.MaxMessageToFillRatio:
+		reason = types.RejectReasonMessageRatio
+		err = fmt.Errorf("%w: %d messages for %d fills in %s, limit %g",
+			ErrMessageRatioExceeded, messages, fills, t.config.RatioWindow, t.config.MaxMessageToFillRatio)
+	}
+
+	if err == nil {
+		if msg != MessageCancel {
+			activity.breached = false
+		}
+		return nil, nil
+	}
+
+	event := &ThrottleEvent{
+		AccountID: accountID,
+		UserID:    userID,
+		Message:   msg,
+		Reason:    reason,
+		Messages:  messages,
+		Fills:     fills,
+		NewBreach: !activity.breached,
+		At:        now,
+	}
+	activity.breached = true
+	return event, Reject(reason, err)
+}
+
+// recordFill counts a fill for the account
+func (t *throttle) recordFill(accountID string) {
+	_, current := t.slot(accountID, t.now().Unix())
+	current.fills++
+}
+
+// sweep drops accounts that have been idle for a whole window
+func (t *throttle) sweep(second int64) {
+	if second-t.lastSweep < t.window() {
+		return
+	}
+	for id, activity := range t.accounts {
+		if second-activity.lastSeen >= t.window() {
+			delete(t.accounts, id)
+		}
+	}
+	t.lastSweep = second
+}
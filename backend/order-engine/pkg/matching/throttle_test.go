@@ -0,0 +1,211 @@
+package matching
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// testClock is a manually advanced clock for the throttle
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestThrottle(config ThrottleConfig) (*throttle, *testClock) {
+	clock := &testClock{t: time.Unix(1700000000, 0)}
+	t := newThrottle(config)
+	t.now = clock.now
+	return t, clock
+}
+
+// admitN admits n messages, failing the test if any is rejected
+func admitN(t *testing.T, th *throttle, accountID string, msg MessageType, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := th.admit(accountID, "alice", msg); err != nil {
+			t.Fatalf("message %d rejected: %v", i+1, err)
+		}
+	}
+}
+
+func TestThrottleMessageRate(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{MaxMessagesPerSecond: 3})
+
+	admitN(t, th, "alice", MessageNew, 3)
+	event, err := th.admit("alice", "alice", MessageAmend)
+	if !errors.Is(err, ErrMessageRateExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRateExceeded)
+	}
+	var rejectErr *RejectError
+	if !errors.As(err, &rejectErr) || rejectErr.Reason != types.RejectReasonMessageRate {
+		t.Fatalf("got %v, want a %s rejection", err, types.RejectReasonMessageRate)
+	}
+	if event == nil || event.AccountID != "alice" || event.Message != MessageAmend || event.Messages != 4 {
+		t.Fatalf("event = %+v", event)
+	}
+
+	// Other accounts have their own budget
+	admitN(t, th, "bob", MessageNew, 3)
+
+	// The budget refills with the next second
+	clock.advance(time.Second)
+	admitN(t, th, "alice", MessageNew, 3)
+}
+
+func TestThrottleAlwaysAdmitsCancels(t *testing.T) {
+	th, _ := newTestThrottle(ThrottleConfig{
+		MaxMessagesPerSecond:  1,
+		MaxMessageToFillRatio: 1,
+		MinRatioMessages:      1,
+	})
+
+	admitN(t, th, "alice", MessageNew, 1)
+	admitN(t, th, "alice", MessageCancel, 5)
+
+	// Cancels still count towards the limits
+	if _, err := th.admit("alice", "alice", MessageNew); !errors.Is(err, ErrMessageRateExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRateExceeded)
+	}
+}
+
+func TestThrottleMessageToFillRatio(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{
+		MaxMessageToFillRatio: 2,
+		RatioWindow:           5 * time.Second,
+		MinRatioMessages:      4,
+	})
+
+	// Below the floor the ratio is not enforced
+	admitN(t, th, "alice", MessageNew, 3)
+	event, err := th.admit("alice", "alice", MessageNew)
+	if !errors.Is(err, ErrMessageRatioExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRatioExceeded)
+	}
+	if event.Reason != types.RejectReasonMessageRatio || event.Messages != 4 || event.Fills != 0 {
+		t.Fatalf("event = %+v", event)
+	}
+
+	// 5 messages for 2 fills is still over 2
+	th.recordFill("alice")
+	th.recordFill("alice")
+	if _, err := th.admit("alice", "alice", MessageNew); !errors.Is(err, ErrMessageRatioExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRatioExceeded)
+	}
+	// 6 messages for 3 fills is within it
+	th.recordFill("alice")
+	admitN(t, th, "alice", MessageNew, 1)
+
+	// Messages older than the window no longer count
+	clock.advance(5 * time.Second)
+	admitN(t, th, "alice", MessageNew, 3)
+}
+
+func TestThrottleRatioWindowSlides(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{
+		MaxMessageToFillRatio: 1,
+		RatioWindow:           3 * time.Second,
+		MinRatioMessages:      3,
+	})
+
+	admitN(t, th, "alice", MessageNew, 2)
+	clock.advance(2 * time.Second)
+	if _, err := th.admit("alice", "alice", MessageNew); !errors.Is(err, ErrMessageRatioExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRatioExceeded)
+	}
+
+	// The first two messages leave the window a second later
+	clock.advance(time.Second)
+	admitN(t, th, "alice", MessageNew, 1)
+}
+
+func TestThrottleNewBreach(t *testing.T) {
+	// The window only keeps the account from being swept between seconds
+	th, clock := newTestThrottle(ThrottleConfig{MaxMessagesPerSecond: 1, RatioWindow: 10 * time.Second})
+
+	admitN(t, th, "alice", MessageNew, 1)
+	first, _ := th.admit("alice", "alice", MessageNew)
+	second, _ := th.admit("alice", "alice", MessageNew)
+	if first == nil || !first.NewBreach {
+		t.Fatalf("first rejection = %+v, want a new breach", first)
+	}
+	if second == nil || second.NewBreach {
+		t.Fatalf("second rejection = %+v, want the same breach", second)
+	}
+
+	// A cancel does not end the breach
+	clock.advance(time.Second)
+	admitN(t, th, "alice", MessageCancel, 1)
+	if event, _ := th.admit("alice", "alice", MessageNew); event == nil || event.NewBreach {
+		t.Fatalf("rejection after a cancel = %+v, want the same breach", event)
+	}
+
+	// An admitted message does
+	clock.advance(time.Second)
+	admitN(t, th, "alice", MessageNew, 1)
+	if event, _ := th.admit("alice", "alice", MessageNew); event == nil || !event.NewBreach {
+		t.Fatalf("rejection after recovering = %+v, want a new breach", event)
+	}
+}
+
+func TestThrottleSweepsIdleAccounts(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleConfig{
+		MaxMessageToFillRatio: 10,
+		RatioWindow:           2 * time.Second,
+	})
+
+	admitN(t, th, "alice", MessageNew, 1)
+	clock.advance(time.Second)
+	admitN(t, th, "bob", MessageNew, 1)
+	if len(th.accounts) != 2 {
+		t.Fatalf("%d accounts tracked, want 2", len(th.accounts))
+	}
+
+	// Alice has been idle for a whole window, bob has not
+	clock.advance(time.Second)
+	admitN(t, th, "carol", MessageNew, 1)
+	if _, tracked := th.accounts["alice"]; tracked {
+		t.Fatal("idle account not swept")
+	}
+	if _, tracked := th.accounts["bob"]; !tracked {
+		t.Fatal("active account swept")
+	}
+}
+
+func TestEngineThrottlesOrders(t *testing.T) {
+	me := NewMatchingEngine()
+	me.SetThrottle(ThrottleConfig{MaxMessagesPerSecond: 1})
+	me.throttle.now = (&testClock{t: time.Unix(1700000000, 0)}).now
+	var events []ThrottleEvent
+	me.AddThrottleListener(func(event ThrottleEvent) {
+		events = append(events, event)
+	})
+
+	if _, err := me.ProcessOrder(limitOrder("order-1", "alice", types.BuyOrder, 100, 1)); err != nil {
+		t.Fatalf("process order: %v", err)
+	}
+	order := limitOrder("order-2", "alice", types.BuyOrder, 100, 1)
+	if _, err := me.ProcessOrder(order); !errors.Is(err, ErrMessageRateExceeded) {
+		t.Fatalf("got %v, want %v", err, ErrMessageRateExceeded)
+	}
+	if order.Status != types.OrderStatusRejected || order.RejectReason != types.RejectReasonMessageRate {
+		t.Fatalf("order %s %s, want rejected for the message rate", order.Status, order.RejectReason)
+	}
+	if len(events) != 1 || !events[0].NewBreach {
+		t.Fatalf("events = %+v, want one new breach", events)
+	}
+
+	// Cancels pass even while throttled
+	if err := me.CancelOrder("order-1"); err != nil {
+		t.Fatalf("cancel while throttled: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package orderbook
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+// ChecksumDepth is the number of levels per side a checksum covers
+const ChecksumDepth = 10
+
+// Checksum returns the CRC32 (IEEE) of a book's top ChecksumDepth levels
+// per side, given best first. The checksummed string interleaves the
+// sides level by level as
+//
+//	bidPrice:bidQuantity:askPrice:askQuantity:...
+//
+// with each number in the shortest decimal form that parses back to the
+// same float64 (strconv.FormatFloat with format 'f' and precision -1).
+// Once one side runs out of levels only the other side's continue, and an
+// empty book checksums the empty string.
+func Checksum(bids, asks []types.OrderBookLevel) uint32 {
+	var b strings.Builder
+	for i := 0; i < ChecksumDepth; i++ {
+		if i < len(bids) {
+			writeLevel(&b, bids[i])
+		}
+		if i < len(asks) {
+			writeLevel(&b, asks[i])
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(b.String()))
+}
+
+func writeLevel(b *strings.Builder, level types.OrderBookLevel) {
+	if b.Len() > 0 {
+		b.WriteByte(':')
+	}
+	b.WriteString(strconv.FormatFloat(level.Price, 'f', -1, 64))
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(level.Quantity, 'f', -1, 64))
+}
+
+// top returns the levels the checksum covers, best first. Callers must
+// hold the lock.
+func (ob *OrderBook) top() (bids, asks []types.OrderBookLevel) {
+	return topLevels(ob.bids.priceLevels, ob.bids.Less, ChecksumDepth),
+		topLevels(ob.asks.priceLevels, ob.asks.Less, ChecksumDepth)
+}
+
+// topLevels returns up to n visible levels of a heap best first. It walks
+// the heap from its root, so only the levels that can be next are compared
+// instead of sorting the whole side.
+func topLevels(levels priceLevels, less func(i, j int) bool, n int) []types.OrderBookLevel {
+	top := make([]types.OrderBookLevel, 0, n)
+	if len(levels) == 0 {
+		return top
+	}
+
+	candidates := []int{0}
+	for len(top) < n && len(candidates) > 0 {
+		best := 0
+		for i := range candidates {
+			if less(candidates[i], candidates[best]) {
+				best = i
+			}
+		}
+		index := candidates[best]
+		candidates = append(candidates[:best], candidates[best+1:]...)
+
+		level := levels[index]
+		if level.visible() {
+			top = append(top, types.OrderBookLevel{
+				Price:    level.price,
+				Quantity: level.volume,
+				Orders:   len(level.orders),
+			})
+		}
+		for _, child := range []int{2*index + 1, 2*index + 2} {
+			if child < len(levels) {
+				candidates = append(candidates, child)
+			}
+		}
+	}
+	return top
+}
@@ -0,0 +1,80 @@
+package orderbook
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+func TestChecksumString(t *testing.T) {
+	bids := []types.OrderBookLevel{{Price: 100.5, Quantity: 1}, {Price: 99, Quantity: 0.25}}
+	asks := []types.OrderBookLevel{{Price: 101, Quantity: 3}}
+
+	// Sides interleave level by level until both run out
+	want := crc32.ChecksumIEEE([]byte("100.5:1:101:3:99:0.25"))
+	if got := Checksum(bids, asks); got != want {
+		t.Fatalf("checksum %d, want %d", got, want)
+	}
+	if got := Checksum(nil, nil); got != crc32.ChecksumIEEE(nil) {
+		t.Fatalf("empty book checksum %d", got)
+	}
+
+	// Levels past the depth are not covered
+	deep := make([]types.OrderBookLevel, ChecksumDepth+1)
+	for i := range deep {
+		deep[i] = types.OrderBookLevel{Price: float64(100 - i), Quantity: 1}
+	}
+	if Checksum(deep, nil) != Checksum(deep[:ChecksumDepth], nil) {
+		t.Fatal("checksum covers levels past the depth")
+	}
+}
+
+func TestUpdateChecksumsMatchSnapshots(t *testing.T) {
+	r := newRecorder()
+
+	// checkSnapshot compares the last update's checksum with the book's
+	checkSnapshot := func(change string) {
+		t.Helper()
+		snapshot, err := r.book.GetOrderBookSnapshot(symbol)
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		if got := r.last().Checksum; got != snapshot.Checksum {
+			t.Fatalf("checksum after %s is %d, snapshot has %d", change, got, snapshot.Checksum)
+		}
+	}
+
+	// More levels than the checksum covers, added worst first so the heap
+	// is not already sorted
+	for i := 0; i < ChecksumDepth+5; i++ {
+		r.add(t, string(rune('a'+i)), types.BuyOrder, float64(90+i), 1)
+		r.add(t, string(rune('A'+i)), types.SellOrder, float64(130-i), 1)
+	}
+	checkSnapshot("adds")
+
+	if err := r.book.FillOrder("o", 0.25); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	checkSnapshot("a partial fill")
+
+	if err := r.book.ReduceOrder("O", 0.5); err != nil {
+		t.Fatalf("reduce: %v", err)
+	}
+	checkSnapshot("a reduce")
+
+	if err := r.book.CancelOrder("n"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	checkSnapshot("a cancel")
+
+	// A change below the covered depth leaves the checksum alone
+	before := r.last().Checksum
+	if err := r.book.CancelOrder("a"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if r.last().Checksum != before {
+		t.Fatal("checksum changed for a level past the depth")
+	}
+	checkSnapshot("a deep cancel")
+}
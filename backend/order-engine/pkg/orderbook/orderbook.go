@@ -3,6 +3,7 @@ package orderbook
 import (
 	"container/heap"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,21 +11,28 @@ import (
 )
 
 type priceLevel struct {
-	price   float64
-	orders  []*types.Order
-	volume  float64
+	price  float64
+	orders []*types.Order
+	volume float64
+}
+
+// visible reports whether the level is published. A level's volume is kept
+// incrementally, so a level of nearly filled orders can round down to
+// nothing before its last order leaves.
+func (pl *priceLevel) visible() bool {
+	return len(pl.orders) > 0 && pl.volume > 0
 }
 
 type priceLevels []*priceLevel
 
-func (pl priceLevels) Len() int           { return len(pl) }
-func (pl priceLevels) Swap(i, j int)      { pl[i], pl[j] = pl[j], pl[i] }
-func (pl priceLevels) Push(x interface{}) { pl = append(pl, x.(*priceLevel)) }
-func (pl priceLevels) Pop() interface{} {
-	old := pl
+func (pl priceLevels) Len() int            { return len(pl) }
+func (pl priceLevels) Swap(i, j int)       { pl[i], pl[j] = pl[j], pl[i] }
+func (pl *priceLevels) Push(x interface{}) { *pl = append(*pl, x.(*priceLevel)) }
+func (pl *priceLevels) Pop() interface{} {
+	old := *pl
 	n := len(old)
 	x := old[n-1]
-	pl = old[0 : n-1]
+	*pl = old[0 : n-1]
 	return x
 }
 
@@ -42,12 +50,23 @@ func (spl sellPriceLevels) Less(i, j int) bool {
 	return spl.priceLevels[i].price < spl.priceLevels[j].price
 }
 
+// UpdateListener receives every level change of a book. It is called with
+// the book's lock held and must not call back into the book.
+type UpdateListener func(update types.BookUpdate)
+
+// OrderEventListener receives every change to a resting order, under the
+// same rules as UpdateListener
+type OrderEventListener func(event types.BookOrderEvent)
+
 type OrderBook struct {
-	symbol string
-	bids   *buyPriceLevels
-	asks   *sellPriceLevels
-	orders map[string]*types.Order
-	mutex  sync.RWMutex
+	symbol        string
+	bids          *buyPriceLevels
+	asks          *sellPriceLevels
+	orders        map[string]*types.Order
+	sequence      uint64
+	listener      UpdateListener
+	orderListener OrderEventListener
+	mutex         sync.RWMutex
 }
 
 func NewOrderBook(symbol string) *OrderBook {
@@ -59,6 +78,71 @@ func NewOrderBook(symbol string) *OrderBook {
 	}
 }
 
+// SetUpdateListener registers the listener for level changes
+func (ob *OrderBook) SetUpdateListener(listener UpdateListener) {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	ob.listener = listener
+}
+
+// SetOrderEventListener registers the listener for resting order changes
+func (ob *OrderBook) SetOrderEventListener(listener OrderEventListener) {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	ob.orderListener = listener
+}
+
+// emit advances the sequence and reports the change to an order and the
+// new state of its level. A level that is no longer visible is reported
+// with zero quantity, as is an order that has left the book. Callers must hold the
+// write lock.
+func (ob *OrderBook) emit(eventType types.BookOrderEventType, order *types.Order, level *priceLevel, executed float64) {
+	ob.sequence++
+	now := time.Now()
+
+	if ob.listener != nil {
+		bids, asks := ob.top()
+		update := types.BookUpdate{
+			Symbol:    ob.symbol,
+			Sequence:  ob.sequence,
+			Side:      order.Side,
+			Price:     level.price,
+			Checksum:  Checksum(bids, asks),
+			Timestamp: now,
+		}
+		if level.visible() {
+			update.Quantity = level.volume
+			update.Orders = len(level.orders)
+		}
+		if len(bids) > 0 {
+			update.BestBid = bids[0].Price
+		}
+		if len(asks) > 0 {
+			update.BestAsk = asks[0].Price
+		}
+		ob.listener(update)
+	}
+
+	if ob.orderListener != nil {
+		event := types.BookOrderEvent{
+			Type:        eventType,
+			Symbol:      ob.symbol,
+			Sequence:    ob.sequence,
+			OrderID:     order.ID,
+			Side:        order.Side,
+			Price:       level.price,
+			ExecutedQty: executed,
+			Timestamp:   now,
+		}
+		if _, resting := ob.orders[order.ID]; resting {
+			event.Quantity = order.RemainingQty
+		}
+		ob.orderListener(event)
+	}
+}
+
 func (ob *OrderBook) AddOrder(order *types.Order) error {
 	ob.mutex.Lock()
 	defer ob.mutex.Unlock()
@@ -67,27 +151,25 @@ func (ob *OrderBook) AddOrder(order *types.Order) error {
 		return fmt.Errorf("order %s already exists", order.ID)
 	}
 
-	// Initialize order
-	order.Status = types.OrderStatusNew
-	order.RemainingQty = order.Quantity
-	order.FilledQty = 0
-	order.CreatedAt = time.Now()
+	// Initialize order, keeping any fills from matching before it rests
+	if order.Status == "" {
+		order.Status = types.OrderStatusNew
+	}
+	order.RemainingQty = order.Quantity - order.FilledQty
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
 	order.UpdatedAt = time.Now()
 
 	// Add to orders map
 	ob.orders[order.ID] = order
 
 	// Add to price level
-	var levels *priceLevels
-	if order.Side == types.BuyOrder {
-		levels = &ob.bids.priceLevels
-	} else {
-		levels = &ob.asks.priceLevels
-	}
+	levels, side := ob.sideLevels(order.Side)
 
 	// Find or create price level
 	var level *priceLevel
-	for _, l := range *levels {
+	for _, l := range *side {
 		if l.price == order.Price {
 			level = l
 			break
@@ -104,6 +186,7 @@ func (ob *OrderBook) AddOrder(order *types.Order) error {
 
 	level.orders = append(level.orders, order)
 	level.volume += order.RemainingQty
+	ob.emit(types.BookOrderAdded, order, level, 0)
 
 	return nil
 }
@@ -125,28 +208,125 @@ func (ob *OrderBook) CancelOrder(orderID string) error {
 	order.Status = types.OrderStatusCancelled
 	order.UpdatedAt = time.Now()
 
-	// Remove from price level
-	var levels *priceLevels
-	if order.Side == types.BuyOrder {
-		levels = &ob.bids.priceLevels
-	} else {
-		levels = &ob.asks.priceLevels
+	ob.removeOrder(order, types.BookOrderCancelled, 0)
+
+	return nil
+}
+
+// RemoveOrder takes an order off the book without changing its status,
+// e.g. to re-price it. Market data reports it as cancelled.
+func (ob *OrderBook) RemoveOrder(orderID string) error {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	order, exists := ob.orders[orderID]
+	if !exists {
+		return fmt.Errorf("order %s not found", orderID)
 	}
 
-	for _, level := range *levels {
+	ob.removeOrder(order, types.BookOrderCancelled, 0)
+
+	return nil
+}
+
+// ReduceOrder lowers the total quantity of a resting order in place, so it
+// keeps its position in the price level
+func (ob *OrderBook) ReduceOrder(orderID string, quantity float64) error {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	order, exists := ob.orders[orderID]
+	if !exists {
+		return fmt.Errorf("order %s not found", orderID)
+	}
+	if quantity > order.Quantity || quantity <= order.FilledQty {
+		return fmt.Errorf("invalid quantity %g for order %s", quantity, orderID)
+	}
+
+	level := ob.level(order)
+	level.volume -= order.Quantity - quantity
+
+	order.Quantity = quantity
+	order.RemainingQty = quantity - order.FilledQty
+	order.UpdatedAt = time.Now()
+	ob.emit(types.BookOrderModified, order, level, 0)
+
+	return nil
+}
+
+// FillOrder applies a fill to a resting order, taking it off the book once
+// nothing remains
+func (ob *OrderBook) FillOrder(orderID string, quantity float64) error {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	order, exists := ob.orders[orderID]
+	if !exists {
+		return fmt.Errorf("order %s not found", orderID)
+	}
+	if quantity <= 0 || quantity > order.RemainingQty {
+		return fmt.Errorf("invalid fill quantity %g for order %s", quantity, orderID)
+	}
+
+	level := ob.level(order)
+	level.volume -= quantity
+	order.FilledQty += quantity
+	order.RemainingQty -= quantity
+	order.UpdatedAt = time.Now()
+
+	if order.RemainingQty <= 0 {
+		ob.removeOrder(order, types.BookOrderExecuted, quantity)
+		return nil
+	}
+	ob.emit(types.BookOrderExecuted, order, level, quantity)
+
+	return nil
+}
+
+// level returns the price level a resting order is queued at. Callers must
+// hold the lock.
+func (ob *OrderBook) level(order *types.Order) *priceLevel {
+	_, side := ob.sideLevels(order.Side)
+	for _, level := range *side {
 		if level.price == order.Price {
-			for i, o := range level.orders {
-				if o.ID == orderID {
-					level.orders = append(level.orders[:i], level.orders[i+1:]...)
-					level.volume -= order.RemainingQty
-					break
-				}
+			return level
+		}
+	}
+	return nil
+}
+
+// removeOrder detaches the order from its price level, dropping the level
+// once it is empty, and reports the event that removed it. Callers must
+// hold the write lock.
+func (ob *OrderBook) removeOrder(order *types.Order, eventType types.BookOrderEventType, executed float64) {
+	delete(ob.orders, order.ID)
+
+	levels, side := ob.sideLevels(order.Side)
+	for i, level := range *side {
+		if level.price != order.Price {
+			continue
+		}
+		for j, o := range level.orders {
+			if o.ID == order.ID {
+				level.orders = append(level.orders[:j], level.orders[j+1:]...)
+				level.volume -= order.RemainingQty
+				break
 			}
-			break
 		}
+		if len(level.orders) == 0 {
+			heap.Remove(levels, i)
+		}
+		ob.emit(eventType, order, level, executed)
+		return
 	}
+}
 
-	return nil
+// sideLevels returns the heap for the given side together with its levels
+func (ob *OrderBook) sideLevels(side types.OrderSide) (heap.Interface, *priceLevels) {
+	if side == types.BuyOrder {
+		return ob.bids, &ob.bids.priceLevels
+	}
+	return ob.asks, &ob.asks.priceLevels
 }
 
 func (ob *OrderBook) GetOrder(orderID string) (*types.Order, error) {
@@ -241,6 +421,7 @@ func (ob *OrderBook) GetOrderBookSnapshot(symbol string) (*types.OrderBookSnapsh
 
 	snapshot := &types.OrderBookSnapshot{
 		Symbol:    ob.symbol,
+		Sequence:  ob.sequence,
 		Timestamp: time.Now(),
 		Bids:      make([]types.OrderBookLevel, 0, len(ob.bids.priceLevels)),
 		Asks:      make([]types.OrderBookLevel, 0, len(ob.asks.priceLevels)),
@@ -248,7 +429,7 @@ func (ob *OrderBook) GetOrderBookSnapshot(symbol string) (*types.OrderBookSnapsh
 
 	// Add bids
 	for _, level := range ob.bids.priceLevels {
-		if len(level.orders) > 0 {
+		if level.visible() {
 			snapshot.Bids = append(snapshot.Bids, types.OrderBookLevel{
 				Price:    level.price,
 				Quantity: level.volume,
@@ -259,7 +440,7 @@ func (ob *OrderBook) GetOrderBookSnapshot(symbol string) (*types.OrderBookSnapsh
 
 	// Add asks
 	for _, level := range ob.asks.priceLevels {
-		if len(level.orders) > 0 {
+		if level.visible() {
 			snapshot.Asks = append(snapshot.Asks, types.OrderBookLevel{
 				Price:    level.price,
 				Quantity: level.volume,
@@ -268,5 +449,51 @@ func (ob *OrderBook) GetOrderBookSnapshot(symbol string) (*types.OrderBookSnapsh
 		}
 	}
 
+	// The heaps only order their first level
+	sort.Slice(snapshot.Bids, func(i, j int) bool { return snapshot.Bids[i].Price > snapshot.Bids[j].Price })
+	sort.Slice(snapshot.Asks, func(i, j int) bool { return snapshot.Asks[i].Price < snapshot.Asks[j].Price })
+	snapshot.Checksum = Checksum(snapshot.Bids, snapshot.Asks)
+
+	return snapshot, nil
+}
+
+// GetL3Snapshot lists the book's resting orders with the sequence of the
+// last change it includes
+func (ob *OrderBook) GetL3Snapshot(symbol string) (*types.OrderBookL3Snapshot, error) {
+	if symbol != ob.symbol {
+		return nil, fmt.Errorf("invalid symbol %s", symbol)
+	}
+
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	snapshot := &types.OrderBookL3Snapshot{
+		Symbol:    ob.symbol,
+		Sequence:  ob.sequence,
+		Timestamp: time.Now(),
+		Bids:      bookOrders(ob.bids.priceLevels, func(a, b float64) bool { return a > b }),
+		Asks:      bookOrders(ob.asks.priceLevels, func(a, b float64) bool { return a < b }),
+	}
+
 	return snapshot, nil
-} 
\ No newline at end of file
+}
+
+// bookOrders lists the orders of the levels, ordering the levels with
+// better and keeping each level's time priority
+func bookOrders(levels priceLevels, better func(a, b float64) bool) []types.BookOrder {
+	sorted := make(priceLevels, len(levels))
+	copy(sorted, levels)
+	sort.Slice(sorted, func(i, j int) bool { return better(sorted[i].price, sorted[j].price) })
+
+	orders := make([]types.BookOrder, 0)
+	for _, level := range sorted {
+		for _, order := range level.orders {
+			orders = append(orders, types.BookOrder{
+				OrderID:  order.ID,
+				Price:    level.price,
+				Quantity: order.RemainingQty,
+			})
+		}
+	}
+	return orders
+}
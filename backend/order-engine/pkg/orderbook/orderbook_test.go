@@ -0,0 +1,171 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/XNL-21bct0051-SDE-2/order-engine/pkg/types"
+)
+
+const symbol = "BTC-USD"
+
+// recorder is an order book with every update and order event it emitted
+type recorder struct {
+	book    *OrderBook
+	updates []types.BookUpdate
+	events  []types.BookOrderEvent
+}
+
+func newRecorder() *recorder {
+	r := &recorder{book: NewOrderBook(symbol)}
+	r.book.SetUpdateListener(func(update types.BookUpdate) {
+		r.updates = append(r.updates, update)
+	})
+	r.book.SetOrderEventListener(func(event types.BookOrderEvent) {
+		r.events = append(r.events, event)
+	})
+	return r
+}
+
+func (r *recorder) add(t *testing.T, id string, side types.OrderSide, price, quantity float64) {
+	t.Helper()
+	order := &types.Order{ID: id, Symbol: symbol, Side: side, Type: types.LimitOrder, Price: price, Quantity: quantity}
+	if err := r.book.AddOrder(order); err != nil {
+		t.Fatalf("add %s: %v", id, err)
+	}
+}
+
+// last returns the most recent update
+func (r *recorder) last() types.BookUpdate {
+	return r.updates[len(r.updates)-1]
+}
+
+func TestLevelUpdates(t *testing.T) {
+	r := newRecorder()
+
+	r.add(t, "b1", types.BuyOrder, 100, 1)
+	r.add(t, "b2", types.BuyOrder, 100, 2)
+	r.add(t, "a1", types.SellOrder, 101, 1.5)
+	if u := r.updates[1]; u.Side != types.BuyOrder || u.Price != 100 || u.Quantity != 3 || u.Orders != 2 {
+		t.Fatalf("bid level update %+v, want 3 across 2 orders", u)
+	}
+	if u := r.last(); u.BestBid != 100 || u.BestAsk != 101 || u.Quantity != 1.5 {
+		t.Fatalf("ask level update %+v", u)
+	}
+
+	if err := r.book.FillOrder("b1", 0.5); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if u := r.last(); u.Quantity != 2.5 || u.Orders != 2 {
+		t.Fatalf("partially filled level %+v, want 2.5 across 2 orders", u)
+	}
+	if err := r.book.ReduceOrder("b2", 1); err != nil {
+		t.Fatalf("reduce: %v", err)
+	}
+	if u := r.last(); u.Quantity != 1.5 || u.Orders != 2 {
+		t.Fatalf("reduced level %+v, want 1.5 across 2 orders", u)
+	}
+
+	// A level that empties is reported with zero quantity
+	if err := r.book.CancelOrder("b1"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := r.book.FillOrder("b2", 1); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if u := r.last(); u.Price != 100 || u.Quantity != 0 || u.Orders != 0 || u.BestBid != 0 || u.BestAsk != 101 {
+		t.Fatalf("emptied level %+v", u)
+	}
+
+	// Every change advances the sequence by one, and a snapshot carries
+	// the last sequence it includes
+	for i, u := range r.updates {
+		if u.Symbol != symbol || u.Sequence != uint64(i+1) {
+			t.Fatalf("update %d has sequence %d", i, u.Sequence)
+		}
+	}
+	snapshot, err := r.book.GetOrderBookSnapshot(symbol)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snapshot.Sequence != uint64(len(r.updates)) || len(snapshot.Bids) != 0 || len(snapshot.Asks) != 1 {
+		t.Fatalf("snapshot %+v after %d updates", snapshot, len(r.updates))
+	}
+
+	// Refused changes emit nothing
+	if err := r.book.CancelOrder("b1"); err == nil {
+		t.Fatal("cancelled an order twice")
+	}
+	if err := r.book.FillOrder("a1", 2); err == nil {
+		t.Fatal("filled more than remains")
+	}
+	if snapshot.Sequence != uint64(len(r.updates)) {
+		t.Fatalf("%d updates after refused changes", len(r.updates))
+	}
+}
+
+func TestOrderEvents(t *testing.T) {
+	r := newRecorder()
+
+	r.add(t, "b1", types.BuyOrder, 100, 2)
+	r.add(t, "b2", types.BuyOrder, 100, 1)
+	r.add(t, "a1", types.SellOrder, 101, 1)
+	if err := r.book.FillOrder("b1", 0.5); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if err := r.book.ReduceOrder("b1", 1.5); err != nil {
+		t.Fatalf("reduce: %v", err)
+	}
+	if err := r.book.FillOrder("a1", 1); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if err := r.book.CancelOrder("b2"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	want := []types.BookOrderEvent{
+		{Type: types.BookOrderAdded, OrderID: "b1", Side: types.BuyOrder, Price: 100, Quantity: 2},
+		{Type: types.BookOrderAdded, OrderID: "b2", Side: types.BuyOrder, Price: 100, Quantity: 1},
+		{Type: types.BookOrderAdded, OrderID: "a1", Side: types.SellOrder, Price: 101, Quantity: 1},
+		{Type: types.BookOrderExecuted, OrderID: "b1", Side: types.BuyOrder, Price: 100, Quantity: 1.5, ExecutedQty: 0.5},
+		{Type: types.BookOrderModified, OrderID: "b1", Side: types.BuyOrder, Price: 100, Quantity: 1},
+		{Type: types.BookOrderExecuted, OrderID: "a1", Side: types.SellOrder, Price: 101, Quantity: 0, ExecutedQty: 1},
+		{Type: types.BookOrderCancelled, OrderID: "b2", Side: types.BuyOrder, Price: 100, Quantity: 0},
+	}
+	if len(r.events) != len(want) {
+		t.Fatalf("%d order events, want %d", len(r.events), len(want))
+	}
+	for i, event := range r.events {
+		// Each event shares its sequence with the level update it causes
+		if event.Sequence != r.updates[i].Sequence || event.Symbol != symbol {
+			t.Fatalf("event %d has sequence %d, its level update %d", i, event.Sequence, r.updates[i].Sequence)
+		}
+		event.Symbol, event.Sequence, event.Timestamp = "", 0, want[i].Timestamp
+		if event != want[i] {
+			t.Fatalf("event %d is %+v, want %+v", i, event, want[i])
+		}
+	}
+
+	// The L3 snapshot keeps time priority within a level
+	r.add(t, "b3", types.BuyOrder, 100, 3)
+	r.add(t, "b4", types.BuyOrder, 102, 1)
+	snapshot, err := r.book.GetL3Snapshot(symbol)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snapshot.Sequence != r.events[len(r.events)-1].Sequence {
+		t.Fatalf("snapshot sequence %d, last event %d", snapshot.Sequence, r.events[len(r.events)-1].Sequence)
+	}
+	wantBids := []types.BookOrder{
+		{OrderID: "b4", Price: 102, Quantity: 1},
+		{OrderID: "b1", Price: 100, Quantity: 1},
+		{OrderID: "b3", Price: 100, Quantity: 3},
+	}
+	if len(snapshot.Bids) != len(wantBids) || len(snapshot.Asks) != 0 {
+		t.Fatalf("snapshot bids %+v asks %+v", snapshot.Bids, snapshot.Asks)
+	}
+	for i, order := range snapshot.Bids {
+		if order != wantBids[i] {
+			t.Fatalf("bid %d is %+v, want %+v", i, order, wantBids[i])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// Account holds orders, positions and balances. Every user has a master
+// account whose ID is the user ID; sub-accounts point to it through ParentID.
+type Account struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsMaster reports whether the account is the root of its hierarchy
+func (a *Account) IsMaster() bool {
+	return a.ParentID == ""
+}
+
+// MasterID returns the ID of the master account the account belongs to
+func (a *Account) MasterID() string {
+	if a.IsMaster() {
+		return a.ID
+	}
+	return a.ParentID
+}
+
+type Balance struct {
+	AccountID string    `json:"account_id"`
+	Asset     string    `json:"asset"`
+	Amount    float64   `json:"amount"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Position is an account's net filled quantity in a symbol. Quantity is
+// negative for short positions.
+type Position struct {
+	AccountID string    `json:"account_id"`
+	Symbol    string    `json:"symbol"`
+	Quantity  float64   `json:"quantity"`
+	AvgPrice  float64   `json:"avg_price"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Apply adds a fill to the position, keeping the average entry price of
+// the open quantity
+func (p *Position) Apply(side OrderSide, qty, price float64, at time.Time) {
+	delta := qty
+	if side == SellOrder {
+		delta = -qty
+	}
+
+	next := p.Quantity + delta
+	switch {
+	case next == 0:
+		p.AvgPrice = 0
+	case p.Quantity == 0 || (p.Quantity > 0) != (next > 0):
+		// Opened or flipped: the remainder was entered at this price
+		p.AvgPrice = price
+	case (p.Quantity > 0) == (delta > 0):
+		// Increased: blend the entry prices
+		p.AvgPrice = (p.AvgPrice*abs(p.Quantity) + price*qty) / abs(next)
+	}
+
+	p.Quantity = next
+	p.UpdatedAt = at
+}
+
+// RiskLimits bound an account's orders and positions. Zero means unlimited.
+type RiskLimits struct {
+	MaxOrderQty    float64 `json:"max_order_qty"`
+	MaxOrderValue  float64 `json:"max_order_value"`
+	MaxPositionQty float64 `json:"max_position_qty"`
+}
+
+// Transfer moves an asset between two accounts of the same hierarchy. A
+// transfer without a source account is a deposit.
+type Transfer struct {
+	ID            string    `json:"id"`
+	FromAccountID string    `json:"from_account_id,omitempty"`
+	ToAccountID   string    `json:"to_account_id"`
+	Asset         string    `json:"asset"`
+	Amount        float64   `json:"amount"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// KillSwitch blocks new orders for an account, and for all its
+// sub-accounts when set on a master account
+type KillSwitch struct {
+	AccountID string    `json:"account_id"`
+	Reason    string    `json:"reason"`
+	SetBy     string    `json:"set_by"`
+	SetAt     time.Time `json:"set_at"`
+}
+
+// AuditEvent records an administrative action on an account
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Action    string    `json:"action"`
+	AccountID string    `json:"account_id"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	AuditKillSwitchEngaged  = "kill_switch.engaged"
+	AuditKillSwitchReleased = "kill_switch.released"
+)
+
+// SplitSymbol returns the base and quote assets of a symbol such as
+// "BTC-USD" or "BTC/USD"
+func SplitSymbol(symbol string) (base, quote string, ok bool) {
+	if base, quote, ok = strings.Cut(symbol, "-"); ok && base != "" && quote != "" {
+		return base, quote, true
+	}
+	if base, quote, ok = strings.Cut(symbol, "/"); ok && base != "" && quote != "" {
+		return base, quote, true
+	}
+	return "", "", false
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
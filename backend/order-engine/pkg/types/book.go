@@ -0,0 +1,70 @@
+package types
+
+import (
+	"time"
+)
+
+// BookUpdate is a change to one price level of an order book. Quantity is
+// the level's new total size; zero means the level is gone. Sequence
+// increases by one with every update to the symbol's book, so a consumer
+// applying updates to a snapshot can detect a gap, and Checksum covers the
+// top of the book after the update (see orderbook.Checksum). BestBid and
+// BestAsk are the best prices after the update, zero for an empty side.
+type BookUpdate struct {
+	Symbol    string    `json:"symbol"`
+	Sequence  uint64    `json:"sequence"`
+	Side      OrderSide `json:"side"`
+	Price     float64   `json:"price"`
+	Quantity  float64   `json:"quantity"`
+	Orders    int       `json:"orders"`
+	Checksum  uint32    `json:"checksum"`
+	BestBid   float64   `json:"best_bid"`
+	BestAsk   float64   `json:"best_ask"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BookOrderEventType is what happened to a resting order
+type BookOrderEventType string
+
+const (
+	BookOrderAdded     BookOrderEventType = "add"
+	BookOrderModified  BookOrderEventType = "modify"
+	BookOrderCancelled BookOrderEventType = "cancel"
+	BookOrderExecuted  BookOrderEventType = "execute"
+)
+
+// BookOrderEvent is a change to one resting order of an order book, without
+// the order's owner. Quantity is the order's remaining size, zero once it
+// has left the book, and ExecutedQty is the size of an execution. An order
+// re-priced by an amend is cancelled and added again at the back of its
+// new level. Every event shares its sequence with the BookUpdate for the
+// same change.
+type BookOrderEvent struct {
+	Type        BookOrderEventType `json:"type"`
+	Symbol      string             `json:"symbol"`
+	Sequence    uint64             `json:"sequence"`
+	OrderID     string             `json:"order_id"`
+	Side        OrderSide          `json:"side"`
+	Price       float64            `json:"price"`
+	Quantity    float64            `json:"quantity"`
+	ExecutedQty float64            `json:"executed_quantity,omitempty"`
+	Timestamp   time.Time          `json:"timestamp"`
+}
+
+// OrderBookL3Snapshot lists every resting order of a book, best level first
+// and in time priority within a level. Sequence is that of the last event
+// the snapshot includes.
+type OrderBookL3Snapshot struct {
+	Symbol    string      `json:"symbol"`
+	Sequence  uint64      `json:"sequence"`
+	Timestamp time.Time   `json:"timestamp"`
+	Bids      []BookOrder `json:"bids"`
+	Asks      []BookOrder `json:"asks"`
+}
+
+// BookOrder is a resting order as published in L3 market data
+type BookOrder struct {
+	OrderID  string  `json:"order_id"`
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+}
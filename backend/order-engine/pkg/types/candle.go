@@ -0,0 +1,71 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+type TimeFrame string
+
+const (
+	TimeFrame1m  TimeFrame = "1m"
+	TimeFrame5m  TimeFrame = "5m"
+	TimeFrame15m TimeFrame = "15m"
+	TimeFrame1h  TimeFrame = "1h"
+	TimeFrame4h  TimeFrame = "4h"
+	TimeFrame1d  TimeFrame = "1d"
+)
+
+// TimeFrames lists every supported time frame, shortest first
+var TimeFrames = []TimeFrame{TimeFrame1m, TimeFrame5m, TimeFrame15m, TimeFrame1h, TimeFrame4h, TimeFrame1d}
+
+var timeFrameDurations = map[TimeFrame]time.Duration{
+	TimeFrame1m:  time.Minute,
+	TimeFrame5m:  5 * time.Minute,
+	TimeFrame15m: 15 * time.Minute,
+	TimeFrame1h:  time.Hour,
+	TimeFrame4h:  4 * time.Hour,
+	TimeFrame1d:  24 * time.Hour,
+}
+
+// ParseTimeFrame validates a time frame name
+func ParseTimeFrame(s string) (TimeFrame, error) {
+	tf := TimeFrame(s)
+	if _, ok := timeFrameDurations[tf]; !ok {
+		return "", fmt.Errorf("unknown time frame %q", s)
+	}
+	return tf, nil
+}
+
+// Duration returns the length of one bar
+func (tf TimeFrame) Duration() time.Duration {
+	return timeFrameDurations[tf]
+}
+
+// Start returns the start of the bar containing t. Bars are aligned to
+// UTC, so daily bars start at midnight UTC.
+func (tf TimeFrame) Start(t time.Time) time.Time {
+	return t.Truncate(tf.Duration()).UTC()
+}
+
+// Candle is an OHLCV bar. A bar without trades carries the previous bar's
+// close as its open, high, low and close. Closed is false for the bar
+// still being built.
+type Candle struct {
+	Symbol      string    `json:"symbol"`
+	TimeFrame   TimeFrame `json:"time_frame"`
+	OpenTime    time.Time `json:"open_time"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	Volume      float64   `json:"volume"`
+	QuoteVolume float64   `json:"quote_volume"`
+	Trades      int       `json:"trades"`
+	Closed      bool      `json:"closed"`
+}
+
+// CloseTime returns the end of the bar
+func (c *Candle) CloseTime() time.Time {
+	return c.OpenTime.Add(c.TimeFrame.Duration())
+}
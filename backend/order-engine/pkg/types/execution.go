@@ -0,0 +1,39 @@
+package types
+
+type ExecType string
+
+const (
+	ExecTypeNew      ExecType = "NEW"
+	ExecTypeTrade    ExecType = "TRADE"
+	ExecTypeCanceled ExecType = "CANCELED"
+	ExecTypeReplaced ExecType = "REPLACED"
+	ExecTypeRejected ExecType = "REJECTED"
+)
+
+// ExecutionReport is a change to an order as reported to its owner. It
+// carries the order's full state after the change; trade reports also
+// carry the fill that caused it.
+type ExecutionReport struct {
+	ExecType ExecType `json:"exec_type"`
+	Order
+
+	TradeID   string    `json:"trade_id,omitempty"`
+	LastPrice float64   `json:"last_price,omitempty"`
+	LastQty   float64   `json:"last_qty,omitempty"`
+	Fee       float64   `json:"fee,omitempty"`
+	Liquidity Liquidity `json:"liquidity,omitempty"`
+}
+
+// NewTradeReport reports a fill of an order. The order must already
+// include the fill.
+func NewTradeReport(order Order, fill Fill) ExecutionReport {
+	return ExecutionReport{
+		ExecType:  ExecTypeTrade,
+		Order:     order,
+		TradeID:   fill.TradeID,
+		LastPrice: fill.Price,
+		LastQty:   fill.Quantity,
+		Fee:       fill.Fee,
+		Liquidity: fill.Liquidity,
+	}
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"time"
+)
+
+type Liquidity string
+
+const (
+	LiquidityMaker Liquidity = "MAKER"
+	LiquidityTaker Liquidity = "TAKER"
+)
+
+// Fill is one side of a trade as seen by the user who owned that order
+type Fill struct {
+	ID            string    `json:"id"`
+	TradeID       string    `json:"trade_id"`
+	OrderID       string    `json:"order_id"`
+	ClientOrderID string    `json:"client_order_id,omitempty"`
+	UserID        string    `json:"user_id"`
+	AccountID     string    `json:"account_id"`
+	Symbol        string    `json:"symbol"`
+	Side          OrderSide `json:"side"`
+	Liquidity     Liquidity `json:"liquidity"`
+	Price         float64   `json:"price"`
+	Quantity      float64   `json:"quantity"`
+	Fee           float64   `json:"fee"`
+	ExecutedAt    time.Time `json:"executed_at"`
+}
+
+// Fills splits a trade into the buyer's and the seller's fill
+func (t *Trade) Fills() []Fill {
+	buyLiquidity, sellLiquidity := LiquidityMaker, LiquidityTaker
+	if t.TakerSide == BuyOrder {
+		buyLiquidity, sellLiquidity = LiquidityTaker, LiquidityMaker
+	}
+
+	return []Fill{
+		{
+			ID:            t.ID + "-B",
+			TradeID:       t.ID,
+			OrderID:       t.BuyOrderID,
+			ClientOrderID: t.BuyClientOrderID,
+			UserID:        t.BuyerUserID,
+			AccountID:     t.BuyerAccountID,
+			Symbol:        t.Symbol,
+			Side:          BuyOrder,
+			Liquidity:     buyLiquidity,
+			Price:         t.Price,
+			Quantity:      t.Quantity,
+			Fee:           t.BuyerFee,
+			ExecutedAt:    t.ExecutedAt,
+		},
+		{
+			ID:            t.ID + "-S",
+			TradeID:       t.ID,
+			OrderID:       t.SellOrderID,
+			ClientOrderID: t.SellClientOrderID,
+			UserID:        t.SellerUserID,
+			AccountID:     t.SellerAccountID,
+			Symbol:        t.Symbol,
+			Side:          SellOrder,
+			Liquidity:     sellLiquidity,
+			Price:         t.Price,
+			Quantity:      t.Quantity,
+			Fee:           t.SellerFee,
+			ExecutedAt:    t.ExecutedAt,
+		},
+	}
+}
+
+// OrderFills returns the order's side of each trade, e.g. to answer the
+// request that placed it without revealing the counterparties
+func OrderFills(orderID string, trades []*Trade) []Fill {
+	fills := make([]Fill, 0, len(trades))
+	for _, trade := range trades {
+		for _, fill := range trade.Fills() {
+			if fill.OrderID == orderID {
+				fills = append(fills, fill)
+			}
+		}
+	}
+	return fills
+}
@@ -1,12 +1,18 @@
 package types
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
+// MaxClientOrderIDLength bounds client order IDs on every entry point
+const MaxClientOrderIDLength = 64
+
 type OrderType string
 type OrderSide string
 type OrderStatus string
+type RejectReason string
 
 const (
 	LimitOrder  OrderType = "LIMIT"
@@ -16,39 +22,80 @@ const (
 	BuyOrder  OrderSide = "BUY"
 	SellOrder OrderSide = "SELL"
 
-	OrderStatusNew        OrderStatus = "NEW"
+	OrderStatusNew       OrderStatus = "NEW"
 	OrderStatusPartial   OrderStatus = "PARTIAL"
 	OrderStatusFilled    OrderStatus = "FILLED"
 	OrderStatusCancelled OrderStatus = "CANCELLED"
 	OrderStatusRejected  OrderStatus = "REJECTED"
+
+	RejectReasonMessageRate  RejectReason = "MESSAGE_RATE_EXCEEDED"
+	RejectReasonMessageRatio RejectReason = "MESSAGE_RATIO_EXCEEDED"
+	RejectReasonRiskLimit    RejectReason = "RISK_LIMIT_EXCEEDED"
+	RejectReasonNoLiquidity  RejectReason = "INSUFFICIENT_LIQUIDITY"
+	RejectReasonBlocked      RejectReason = "ACCOUNT_BLOCKED"
+	RejectReasonBalance      RejectReason = "INSUFFICIENT_BALANCE"
+	RejectReasonOther        RejectReason = "OTHER"
 )
 
 type Order struct {
-	ID            string      `json:"id"`
-	UserID        string      `json:"user_id"`
-	Symbol        string      `json:"symbol"`
-	Type         OrderType   `json:"type"`
-	Side         OrderSide   `json:"side"`
-	Price        float64     `json:"price"`
-	Quantity     float64     `json:"quantity"`
-	FilledQty    float64     `json:"filled_qty"`
-	RemainingQty float64     `json:"remaining_qty"`
-	Status       OrderStatus `json:"status"`
-	StopPrice    float64     `json:"stop_price,omitempty"`
-	CreatedAt    time.Time   `json:"created_at"`
-	UpdatedAt    time.Time   `json:"updated_at"`
+	ID            string       `json:"id"`
+	ClientOrderID string       `json:"client_order_id,omitempty"`
+	UserID        string       `json:"user_id"`
+	AccountID     string       `json:"account_id"`
+	Symbol        string       `json:"symbol"`
+	Type          OrderType    `json:"type"`
+	Side          OrderSide    `json:"side"`
+	Price         float64      `json:"price"`
+	Quantity      float64      `json:"quantity"`
+	FilledQty     float64      `json:"filled_qty"`
+	RemainingQty  float64      `json:"remaining_qty"`
+	Status        OrderStatus  `json:"status"`
+	RejectReason  RejectReason `json:"reject_reason,omitempty"`
+	StopPrice     float64      `json:"stop_price,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// Validate checks the fields a client sets on a new order. Every entry
+// point calls it before resolving the order's account.
+func (o *Order) Validate() error {
+	switch {
+	case o.Symbol == "":
+		return errors.New("symbol is required")
+	case o.Type != LimitOrder && o.Type != MarketOrder && o.Type != StopOrder:
+		return errors.New("type must be LIMIT, MARKET or STOP")
+	case o.Side != BuyOrder && o.Side != SellOrder:
+		return errors.New("side must be BUY or SELL")
+	case len(o.ClientOrderID) > MaxClientOrderIDLength:
+		return fmt.Errorf("client order ID must be at most %d characters", MaxClientOrderIDLength)
+	case o.Quantity <= 0:
+		return errors.New("quantity must be positive")
+	case o.Type == LimitOrder && o.Price <= 0:
+		return errors.New("limit orders require a valid price")
+	case o.Type == StopOrder && o.StopPrice <= 0:
+		return errors.New("stop orders require a valid stop price")
+	}
+	return nil
 }
 
 type Trade struct {
-	ID           string    `json:"id"`
-	Symbol       string    `json:"symbol"`
-	BuyOrderID   string    `json:"buy_order_id"`
-	SellOrderID  string    `json:"sell_order_id"`
-	Price        float64   `json:"price"`
-	Quantity     float64   `json:"quantity"`
-	ExecutedAt   time.Time `json:"executed_at"`
-	BuyerUserID  string    `json:"buyer_user_id"`
-	SellerUserID string    `json:"seller_user_id"`
+	ID              string    `json:"id"`
+	Symbol          string    `json:"symbol"`
+	BuyOrderID      string    `json:"buy_order_id"`
+	SellOrderID     string    `json:"sell_order_id"`
+	Price           float64   `json:"price"`
+	Quantity        float64   `json:"quantity"`
+	ExecutedAt      time.Time `json:"executed_at"`
+	BuyerUserID     string    `json:"buyer_user_id"`
+	SellerUserID    string    `json:"seller_user_id"`
+	BuyerAccountID  string    `json:"buyer_account_id"`
+	SellerAccountID string    `json:"seller_account_id"`
+	TakerSide       OrderSide `json:"taker_side"`
+	BuyerFee        float64   `json:"buyer_fee"`
+	SellerFee       float64   `json:"seller_fee"`
+
+	BuyClientOrderID  string `json:"buy_client_order_id,omitempty"`
+	SellClientOrderID string `json:"sell_client_order_id,omitempty"`
 }
 
 type OrderBook interface {
@@ -62,9 +109,14 @@ type OrderBook interface {
 	GetOrderBookSnapshot(symbol string) (*OrderBookSnapshot, error)
 }
 
+// OrderBookSnapshot lists a book's levels best first. Sequence is that of
+// the last BookUpdate the snapshot includes, and Checksum matches that
+// update's.
 type OrderBookSnapshot struct {
-	Symbol    string          `json:"symbol"`
-	Timestamp time.Time       `json:"timestamp"`
+	Symbol    string           `json:"symbol"`
+	Sequence  uint64           `json:"sequence"`
+	Checksum  uint32           `json:"checksum"`
+	Timestamp time.Time        `json:"timestamp"`
 	Bids      []OrderBookLevel `json:"bids"`
 	Asks      []OrderBookLevel `json:"asks"`
 }
@@ -79,4 +131,4 @@ type MatchingEngine interface {
 	ProcessOrder(order *Order) ([]*Trade, error)
 	CancelOrder(orderID string) error
 	GetOrderBook(symbol string) (*OrderBookSnapshot, error)
-} 
\ No newline at end of file
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"time"
+)
+
+// Ticker summarises a symbol's trading over the last 24 hours together with
+// the current best prices. Sequence increases with every change to the
+// ticker.
+type Ticker struct {
+	Symbol             string    `json:"symbol"`
+	Sequence           uint64    `json:"sequence"`
+	Open               float64   `json:"open"`
+	High               float64   `json:"high"`
+	Low                float64   `json:"low"`
+	Last               float64   `json:"last"`
+	Volume             float64   `json:"volume"`
+	QuoteVolume        float64   `json:"quote_volume"`
+	PriceChange        float64   `json:"price_change"`
+	PriceChangePercent float64   `json:"price_change_percent"`
+	BestBid            float64   `json:"best_bid"`
+	BestAsk            float64   `json:"best_ask"`
+	Trades             int       `json:"trades"`
+	OpenTime           time.Time `json:"open_time"`
+	CloseTime          time.Time `json:"close_time"`
+}
@@ -0,0 +1,4 @@
+// Package orderenginev1 contains the generated gRPC API of the order engine
+package orderenginev1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative orderengine/v1/orderengine.proto